@@ -0,0 +1,637 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// accountCommands are the commands signing up and in, and managing the account, its sessions and tokens.
+func accountCommands() []*command {
+	return []*command{
+		{
+			name:    "signup",
+			summary: "Register a new user",
+			description: "Logins are case-insensitive and stored in lowercase. With --zk the password never leaves the client. " +
+				"The password is asked for, or read from stdin if it is piped.",
+			access: accessServer,
+			flags: func(fs *flag.FlagSet) runFunc {
+				login := fs.String("login", "", "Login of the new user")
+				zk := fs.Bool("zk", false, "Register for zero-knowledge sign-in, sending only a verifier of the password")
+				return func(e *env) error {
+					if *login == "" {
+						return required("login")
+					}
+					password, err := newPassword(e)
+					if err != nil {
+						return err
+					}
+					if *zk {
+						err = e.invoker.CreateUserSRP(*login, password)
+					} else {
+						err = e.invoker.CreateUser(*login, password)
+					}
+					if err != nil {
+						return fmt.Errorf("failed to create user: %w", err)
+					}
+					e.success("User created successfully")
+					return nil
+				}
+			},
+			examples: []string{"--server http://localhost:8080 signup --login alice"},
+		},
+		{
+			name:    "signin",
+			summary: "Sign in and print the token",
+			description: "The token is printed for scripts, use login to keep it for the following commands instead. " +
+				"The password is asked for, or read from stdin if it is piped.",
+			access: accessServer,
+			flags: func(fs *flag.FlagSet) runFunc {
+				signIn := signInFlags(fs)
+				return func(e *env) error {
+					token, err := signIn(e)
+					if err != nil {
+						return err
+					}
+					_, err = fmt.Fprintln(e.stdout, token)
+					return err
+				}
+			},
+			examples: []string{"--server http://localhost:8080 signin --login alice"},
+		},
+		{
+			name:    "login",
+			summary: "Sign in and store the token encrypted for the profile, which the following commands use",
+			description: "--server creates the profile, or changes its server. The password is asked for, or read from " +
+				"stdin if it is piped, and the two-factor code if required.",
+			access: accessServer,
+			flags: func(fs *flag.FlagSet) runFunc {
+				signIn := signInFlags(fs)
+				return func(e *env) error {
+					return login(e, signIn)
+				}
+			},
+			examples: []string{"login --server http://localhost:8080 --login alice", "--profile work login --sso"},
+		},
+		{
+			name:    "logout",
+			summary: "Sign out the session of the profile and delete its token",
+			description: "The token is deleted even if the session can't be signed out on the server, " +
+				"e.g. because it has expired.",
+			access: accessServer,
+			flags: func(fs *flag.FlagSet) runFunc {
+				return logout
+			},
+		},
+		{
+			name:    "enable-2fa",
+			summary: "Enable two-factor authentication with an authenticator app",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				return enableTwoFactor
+			},
+		},
+		{
+			name:    "disable-2fa",
+			summary: "Disable two-factor authentication",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				code := fs.String("code", "", "Current code of the authenticator app or a recovery code, asked for if omitted")
+				return func(e *env) error {
+					input, err := e.promptIfEmpty(*code, "Two-factor code (or recovery code): ")
+					if err != nil {
+						return err
+					}
+					code, recoveryCode := splitTwoFactorCode(input)
+					if err = e.invoker.DisableTwoFactor(e.token, code, recoveryCode); err != nil {
+						return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+					}
+					e.success("Two-factor authentication disabled")
+					return nil
+				}
+			},
+		},
+		{
+			name:    "failed-signins",
+			summary: "List recent failed sign-ins into your account",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				return failedSignIns
+			},
+		},
+		{
+			name:    "change-password",
+			summary: "Change the password, which revokes all other tokens",
+			description: "The new token replaces the token of the profile, or is printed if the token was given " +
+				"with --token.",
+			access: accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				return func(e *env) error {
+					current, err := e.promptSecretIfEmpty("", "Current password: ")
+					if err != nil {
+						return err
+					}
+					password, err := newPassword(e)
+					if err != nil {
+						return err
+					}
+					token, err := e.invoker.ChangePassword(e.token, current, password)
+					if err != nil {
+						return fmt.Errorf("failed to change password: %w", err)
+					}
+					return printNewToken(e, token, "Password changed, all other tokens are revoked.")
+				}
+			},
+		},
+		{
+			name:    "change-login",
+			summary: "Rename the login",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				newLogin := fs.String("login", "", "New login")
+				return func(e *env) error {
+					if *newLogin == "" {
+						return required("login")
+					}
+					if err := e.invoker.ChangeLogin(e.token, *newLogin); err != nil {
+						return fmt.Errorf("failed to change login: %w", err)
+					}
+					e.success("Login changed to %s", *newLogin)
+					return nil
+				}
+			},
+			examples: []string{"change-login --login alice2"},
+		},
+		{
+			name:    "delete-account",
+			summary: "Delete the account with all vault entries permanently",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				yes := fs.Bool("yes", false, "Don't ask for confirmation")
+				return func(e *env) error {
+					if !*yes {
+						answer, err := e.prompt("This deletes the account and all vault entries permanently. Type 'yes' to continue: ")
+						if err != nil {
+							return err
+						}
+						if answer != "yes" {
+							return errors.New("aborted")
+						}
+					}
+					password, err := e.promptSecretIfEmpty("", "Password: ")
+					if err != nil {
+						return err
+					}
+					if err = e.invoker.DeleteAccount(e.token, password); err != nil {
+						return fmt.Errorf("failed to delete account: %w", err)
+					}
+					if e.tokenStored {
+						if err = e.store.DeleteToken(e.profileName); err != nil {
+							return err
+						}
+					}
+					e.success("Account deleted")
+					return nil
+				}
+			},
+		},
+		{
+			name:    "list-sessions",
+			summary: "List the devices you are signed in on",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				return listSessions
+			},
+		},
+		{
+			name:    "revoke-session",
+			summary: "Sign out a device",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				id := fs.Uint64("id", 0, "`ID` of the session, see list-sessions")
+				return func(e *env) error {
+					if *id == 0 {
+						return required("id")
+					}
+					if err := e.invoker.RevokeSession(e.token, strconv.FormatUint(*id, 10)); err != nil {
+						return fmt.Errorf("failed to revoke session: %w", err)
+					}
+					e.success("Session %d revoked successfully", *id)
+					return nil
+				}
+			},
+			examples: []string{"revoke-session --id 3"},
+		},
+		{
+			name:    "revoke-other-sessions",
+			summary: "Sign out all other devices",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				return func(e *env) error {
+					if err := e.invoker.RevokeOtherSessions(e.token); err != nil {
+						return fmt.Errorf("failed to revoke sessions: %w", err)
+					}
+					e.success("All other sessions revoked successfully")
+					return nil
+				}
+			},
+		},
+		{
+			name:    "enable-zk",
+			summary: "Switch the account to zero-knowledge sign-in, or change its password",
+			description: "The current password, asked for with --current-password, is only required while the account still " +
+				"has one. All other tokens " +
+				"are revoked, the new token replaces the token of the profile.",
+			access: accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				withCurrent := fs.Bool("current-password", false, "Ask for the current password, required while the account "+
+					"has no zero-knowledge sign-in")
+				return func(e *env) error {
+					var current string
+					if *withCurrent {
+						var err error
+						if current, err = e.promptSecretIfEmpty("", "Current password: "); err != nil {
+							return err
+						}
+					}
+					password, err := newPassword(e)
+					if err != nil {
+						return err
+					}
+					token, err := e.invoker.EnableSRP(e.token, current, password)
+					if err != nil {
+						return fmt.Errorf("failed to enable zero-knowledge sign-in: %w", err)
+					}
+					return printNewToken(e, token, "Zero-knowledge sign-in enabled, all other tokens are revoked.")
+				}
+			},
+		},
+		{
+			name:    "create-token",
+			summary: "Create a scoped personal access token for scripts and CI jobs",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				name := fs.String("name", "", "Name of the token")
+				permission := fs.String("permission", "", "Permission of the token, read or write")
+				ttl := fs.Duration("ttl", 0, "Lifetime of the token, e.g. 720h, 30 days if omitted")
+				keyPrefix := fs.String("key-prefix", "", "Restrict the token to the entries whose key starts with the `prefix`")
+				vaultIDs := fs.String("vault-ids", "", "Restrict the token to a comma separated list of entry `IDs`")
+				return func(e *env) error {
+					if *name == "" {
+						return required("name")
+					}
+					if *permission == "" {
+						return required("permission")
+					}
+					tokenRequest := handlers.TokenRequest{Name: *name, Permission: *permission, KeyPrefix: *keyPrefix}
+					if *ttl != 0 {
+						expiresAt := time.Now().Add(*ttl)
+						tokenRequest.ExpiresAt = &expiresAt
+					}
+					if *vaultIDs != "" {
+						for _, id := range strings.Split(*vaultIDs, ",") {
+							vaultID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+							if err != nil {
+								return &usageError{msg: fmt.Sprintf("invalid vault ID '%s'", id)}
+							}
+							tokenRequest.VaultIDs = append(tokenRequest.VaultIDs, vaultID)
+						}
+					}
+					created, err := e.invoker.CreateToken(e.token, tokenRequest)
+					if err != nil {
+						return fmt.Errorf("failed to create token: %w", err)
+					}
+					if ok, err := e.printJSON(created); ok {
+						return err
+					}
+					e.success("Token %d created, it will not be shown again:", created.ID)
+					_, err = fmt.Fprintln(e.stdout, created.Token)
+					return err
+				}
+			},
+			examples: []string{"create-token --name ci --permission read --ttl 720h --key-prefix login/"},
+		},
+		{
+			name:    "list-tokens",
+			summary: "List personal access tokens",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				return listTokens
+			},
+		},
+		{
+			name:    "revoke-token",
+			summary: "Revoke a personal access token",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				id := fs.Uint64("id", 0, "`ID` of the token, see list-tokens")
+				return func(e *env) error {
+					if *id == 0 {
+						return required("id")
+					}
+					if err := e.invoker.RevokeToken(e.token, strconv.FormatUint(*id, 10)); err != nil {
+						return fmt.Errorf("failed to revoke token: %w", err)
+					}
+					e.success("Token %d revoked successfully", *id)
+					return nil
+				}
+			},
+			examples: []string{"revoke-token --id 2"},
+		},
+		{
+			name:    "usage",
+			summary: "Show the storage used by your vault entries and the quota",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				return func(e *env) error {
+					usage, err := e.invoker.GetUsage(e.token)
+					if err != nil {
+						return fmt.Errorf("failed to get usage: %w", err)
+					}
+					return printUsage(e, usage)
+				}
+			},
+		},
+		{
+			name:        "audit",
+			summary:     "Show sign-ins, failed sign-ins and accesses to your vault entries, newest first",
+			description: "If there are older events, the command listing them is printed.",
+			access:      accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				before := fs.Uint64("before", 0, "List the events older than the event with this `ID`")
+				return func(e *env) error {
+					return audit(e, *before)
+				}
+			},
+		},
+	}
+}
+
+// signInFlags defines the flags of the sign-in commands and returns the function signing in.
+func signInFlags(fs *flag.FlagSet) func(e *env) (string, error) {
+	login := fs.String("login", "", "Login of the user")
+	zk := fs.Bool("zk", false, "Sign in without sending the password")
+	sso := fs.Bool("sso", false, "Sign in with the identity provider in a browser")
+	return func(e *env) (string, error) {
+		if *sso {
+			if *login != "" || *zk {
+				return "", &usageError{msg: "--sso takes no --login and --zk"}
+			}
+			return signInOIDC(e)
+		}
+		if *login == "" {
+			return "", required("login")
+		}
+		password, err := e.promptSecretIfEmpty("", "Password: ")
+		if err != nil {
+			return "", err
+		}
+		var token string
+		if *zk {
+			token, err = e.invoker.SignInSRP(*login, password)
+		} else {
+			token, err = e.invoker.SignIn(*login, password)
+		}
+		token, err = completeTwoFactor(e, token, err)
+		if err != nil {
+			return "", fmt.Errorf("sign-in failed: %w", err)
+		}
+		return token, nil
+	}
+}
+
+// signInOIDC prints the verification page and the user code, and waits until the user has approved the sign-in
+// there and signed in at the identity provider. Returns the token.
+func signInOIDC(e *env) (string, error) {
+	start, err := e.invoker.StartOIDCSignIn()
+	if err != nil {
+		return "", fmt.Errorf("failed to start single sign-on: %w", err)
+	}
+	fmt.Fprintln(e.stdout, "Open this URL in a browser, enter the code and sign in:")
+	fmt.Fprintln(e.stdout, start.VerificationURI)
+	fmt.Fprintf(e.stdout, "Code: %s\n", start.UserCode)
+	fmt.Fprintln(e.stdout, "Waiting for the sign-in...")
+
+	token, err := e.invoker.WaitOIDCSignIn(start)
+	token, err = completeTwoFactor(e, token, err)
+	if err != nil {
+		return "", fmt.Errorf("sign-in failed: %w", err)
+	}
+	return token, nil
+}
+
+// completeTwoFactor completes a sign-in which requires two-factor authentication with a code asked for,
+// and returns the token and the error of the sign-in otherwise.
+func completeTwoFactor(e *env, token string, err error) (string, error) {
+	var twoFactorErr *client.TwoFactorRequiredError
+	if !errors.As(err, &twoFactorErr) {
+		return token, err
+	}
+	input, err := e.prompt("Two-factor code (or recovery code): ")
+	if err != nil {
+		return "", err
+	}
+	code, recoveryCode := splitTwoFactorCode(input)
+	return e.invoker.SignInTwoFactor(twoFactorErr.MFAToken, code, recoveryCode)
+}
+
+// splitTwoFactorCode tells TOTP codes and recovery codes apart, recovery codes contain a dash.
+func splitTwoFactorCode(input string) (code string, recoveryCode string) {
+	if strings.Contains(input, "-") {
+		return "", input
+	}
+	return input, ""
+}
+
+// newPassword asks for a new password, twice on a terminal to catch typing mistakes.
+func newPassword(e *env) (string, error) {
+	password, err := e.promptSecretIfEmpty("", "New password: ")
+	if err != nil || e.readPassword == nil {
+		return password, err
+	}
+	repeated, err := e.promptSecret("Repeat the password: ")
+	if err != nil {
+		return "", err
+	}
+	if repeated != password {
+		return "", errors.New("passwords don't match")
+	}
+	return password, nil
+}
+
+// printNewToken stores the token which replaced the token of the command, or prints it.
+func printNewToken(e *env, token, message string) error {
+	stored, err := e.replaceToken(token)
+	if err != nil {
+		return err
+	}
+	if stored {
+		e.success("%s The new token is stored for profile %s.", message, e.profileName)
+		return nil
+	}
+	if ok, err := e.printJSON(map[string]string{"token": token}); ok {
+		return err
+	}
+	e.success("%s New token:", message)
+	_, err = fmt.Fprintln(e.stdout, token)
+	return err
+}
+
+// enableTwoFactor prints the provisioning URI, asks for the first code of the authenticator app
+// and prints the recovery codes.
+func enableTwoFactor(e *env) error {
+	enrollment, err := e.invoker.EnrollTwoFactor(e.token)
+	if err != nil {
+		return fmt.Errorf("failed to start two-factor enrollment: %w", err)
+	}
+	fmt.Fprintln(e.stdout, "Add this account to your authenticator app:")
+	fmt.Fprintln(e.stdout, enrollment.ProvisioningURI)
+	fmt.Fprintf(e.stdout, "or enter the secret manually: %s\n", enrollment.Secret)
+
+	code, err := e.prompt("Code from the authenticator app: ")
+	if err != nil {
+		return err
+	}
+	recoveryCodes, err := e.invoker.ActivateTwoFactor(e.token, code)
+	if err != nil {
+		return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	if ok, err := e.printJSON(map[string][]string{"recovery_codes": recoveryCodes}); ok {
+		return err
+	}
+	e.success("Two-factor authentication enabled. Store these recovery codes in a safe place, each can be used once:")
+	for _, c := range recoveryCodes {
+		fmt.Fprintln(e.stdout, c)
+	}
+	return nil
+}
+
+// failedSignIns lists the failed sign-ins into the account of the user.
+func failedSignIns(e *env) error {
+	attempts, err := e.invoker.ListFailedSignIns(e.token)
+	if err != nil {
+		return fmt.Errorf("failed to list failed sign-ins: %w", err)
+	}
+	if ok, err := e.printJSON(attempts); ok {
+		return err
+	}
+	if len(attempts) == 0 {
+		e.success("No failed sign-ins")
+		return nil
+	}
+	for _, a := range attempts {
+		fmt.Fprintf(e.stdout, "%s  %-15s  %-24s  %s\n", a.CreatedAt.Local().Format(time.DateTime), a.IP, a.Reason, a.UserAgent)
+	}
+	return nil
+}
+
+// listSessions lists the active sign-in sessions of the user.
+func listSessions(e *env) error {
+	sessions, err := e.invoker.ListSessions(e.token)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+	if ok, err := e.printJSON(sessions); ok {
+		return err
+	}
+	for _, s := range sessions {
+		current := ""
+		if s.Current {
+			current = " (current)"
+		}
+		device := s.DeviceName
+		if device == "" {
+			device = "unknown device"
+		}
+		fmt.Fprintf(e.stdout, "%d  %s%s  %s  signed in %s, last seen %s  %s\n",
+			s.ID, device, current, s.IP,
+			s.CreatedAt.Local().Format(time.DateTime), s.LastSeenAt.Local().Format(time.DateTime), s.UserAgent)
+	}
+	return nil
+}
+
+// listTokens lists the personal access tokens of the user.
+func listTokens(e *env) error {
+	tokens, err := e.invoker.ListTokens(e.token)
+	if err != nil {
+		return fmt.Errorf("failed to list tokens: %w", err)
+	}
+	if ok, err := e.printJSON(tokens); ok {
+		return err
+	}
+	for _, t := range tokens {
+		expires := "never"
+		if t.ExpiresAt != nil {
+			expires = t.ExpiresAt.Local().Format(time.DateTime)
+		}
+		scope := t.KeyPrefix
+		if len(t.VaultIDs) > 0 {
+			ids := make([]string, len(t.VaultIDs))
+			for i, id := range t.VaultIDs {
+				ids[i] = strconv.FormatUint(id, 10)
+			}
+			scope = strings.TrimSpace(scope + " vaults " + strings.Join(ids, ","))
+		}
+		fmt.Fprintf(e.stdout, "%d  %-20s  %-5s  expires %s  %s\n", t.ID, t.Name, t.Permission, expires, scope)
+	}
+	return nil
+}
+
+// printUsage prints the storage used by the vault entries of a user and their quota.
+func printUsage(e *env, usage handlers.UsageResponse) error {
+	if ok, err := e.printJSON(usage); ok {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "Entries: %d of %s\n", usage.Usage.Entries, formatLimit(usage.Quota.MaxEntries))
+	fmt.Fprintf(e.stdout, "Bytes:   %d of %s\n", usage.Usage.Bytes, formatLimit(usage.Quota.MaxBytes))
+	return nil
+}
+
+// formatLimit formats a limit of a quota, where zero means unlimited.
+func formatLimit(limit int64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+// audit lists the audit log of the user, optionally the events older than an event ID.
+func audit(e *env, beforeID uint64) error {
+	events, err := e.invoker.ListAuditEvents(e.token, beforeID)
+	if err != nil {
+		return fmt.Errorf("failed to list audit events: %w", err)
+	}
+	if ok, err := e.printJSON(events); ok {
+		return err
+	}
+	if len(events) == 0 {
+		e.success("No audit events")
+		return nil
+	}
+	for _, ev := range events {
+		target := ""
+		switch {
+		case ev.VaultID != 0:
+			target = fmt.Sprintf("vault %d", ev.VaultID)
+		case ev.Action == storage.AuditTokenCreate || ev.Action == storage.AuditTokenRevoke:
+			target = fmt.Sprintf("token %d", ev.TokenID)
+		}
+		via := ""
+		if ev.TokenID != 0 && ev.VaultID != 0 {
+			via = fmt.Sprintf("via token %d", ev.TokenID)
+		}
+		fmt.Fprintf(e.stdout, "%6d  %s  %-14s  %-11s  %-15s  %-14s  %s\n",
+			ev.ID, ev.CreatedAt.Local().Format(time.DateTime), ev.Action, target, ev.IP, via, ev.Detail)
+	}
+	if len(events) == handlers.AuditEventsLimit {
+		fmt.Fprintf(e.stdout, "Older events: ./client audit --before %d\n", events[len(events)-1].ID)
+	}
+	return nil
+}
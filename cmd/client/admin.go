@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+)
+
+// adminCommand is the group of the admin API commands, which require a token of a user with the admin role.
+func adminCommand() *command {
+	return &command{
+		name:    "admin",
+		summary: "Manage users and run maintenance jobs, requires the admin role",
+		subcommands: []*command{
+			{
+				name:    "users",
+				summary: "List the users whose login contains the query, ordered by ID",
+				description: "If there are more users, the command listing the following users is printed. " +
+					"The server operator grants the admin role with './server admin <login> grant'.",
+				access: accessToken,
+				flags: func(fs *flag.FlagSet) runFunc {
+					query := fs.String("query", "", "Part of the logins to list")
+					after := fs.Uint64("after", 0, "List the users after the user with this `ID`")
+					return func(e *env) error {
+						users, err := e.invoker.AdminListUsers(e.token, *query, *after)
+						if err != nil {
+							return fmt.Errorf("failed to list users: %w", err)
+						}
+						if ok, err := e.printJSON(users); ok {
+							return err
+						}
+						for _, u := range users {
+							printAdminUser(e, u)
+						}
+						if len(users) == handlers.AdminUsersLimit {
+							fmt.Fprintf(e.stdout, "More users: ./client admin users --query '%s' --after %d\n", *query, users[len(users)-1].ID)
+						}
+						return nil
+					}
+				},
+				examples: []string{"admin users --query bob"},
+			},
+			{
+				name:    "user",
+				summary: "Show a user",
+				access:  accessToken,
+				flags: func(fs *flag.FlagSet) runFunc {
+					id := userIDFlag(fs)
+					return func(e *env) error {
+						if *id == 0 {
+							return required("id")
+						}
+						u, err := e.invoker.AdminGetUser(e.token, strconv.FormatUint(*id, 10))
+						if err != nil {
+							return fmt.Errorf("failed to get user: %w", err)
+						}
+						if ok, err := e.printJSON(u); ok {
+							return err
+						}
+						printAdminUser(e, u)
+						return nil
+					}
+				},
+			},
+			{
+				name:    "usage",
+				summary: "Show the storage usage and the quota of a user",
+				access:  accessToken,
+				flags: func(fs *flag.FlagSet) runFunc {
+					id := userIDFlag(fs)
+					return func(e *env) error {
+						if *id == 0 {
+							return required("id")
+						}
+						usage, err := e.invoker.AdminGetUsage(e.token, strconv.FormatUint(*id, 10))
+						if err != nil {
+							return fmt.Errorf("failed to get usage: %w", err)
+						}
+						return printUsage(e, usage)
+					}
+				},
+			},
+			adminUpdateCommand("disable", "Sign a user out and reject their sign-ins and personal access tokens until enable"),
+			adminUpdateCommand("enable", "Enable a disabled user"),
+			adminUpdateCommand("logout", "Sign a user out of all sessions, personal access tokens stay valid"),
+			adminUpdateCommand("reset-2fa", "Disable two-factor authentication of a user who lost their authenticator and recovery codes"),
+			{
+				name:    "jobs",
+				summary: "List the maintenance jobs of the server",
+				access:  accessToken,
+				flags: func(fs *flag.FlagSet) runFunc {
+					return func(e *env) error {
+						jobs, err := e.invoker.AdminListJobs(e.token)
+						if err != nil {
+							return fmt.Errorf("failed to list jobs: %w", err)
+						}
+						if ok, err := e.printJSON(jobs); ok {
+							return err
+						}
+						for _, j := range jobs {
+							fmt.Fprintln(e.stdout, j)
+						}
+						return nil
+					}
+				},
+			},
+			{
+				name:    "run-job",
+				summary: "Run a maintenance job and print its result",
+				access:  accessToken,
+				flags: func(fs *flag.FlagSet) runFunc {
+					job := fs.String("job", "", "Name of the job, see admin jobs")
+					return func(e *env) error {
+						if *job == "" {
+							return required("job")
+						}
+						result, err := e.invoker.AdminRunJob(e.token, *job)
+						if err != nil {
+							return fmt.Errorf("failed to run job: %w", err)
+						}
+						if ok, err := e.printJSON(result); ok {
+							return err
+						}
+						b, err := json.MarshalIndent(result.Result, "", "  ")
+						if err != nil {
+							return fmt.Errorf("failed to marshal job result: %w", err)
+						}
+						e.success("Job %s finished in %s", result.Job, result.Duration)
+						_, err = fmt.Fprintln(e.stdout, string(b))
+						return err
+					}
+				},
+				examples: []string{"admin run-job --job verify-integrity"},
+			},
+		},
+	}
+}
+
+// userIDFlag defines the --id flag of the ID of a user.
+func userIDFlag(fs *flag.FlagSet) *uint64 {
+	return fs.Uint64("id", 0, "`ID` of the user, see admin users")
+}
+
+// adminUpdateCommand returns the admin command changing a user with the action of the admin API.
+func adminUpdateCommand(action, summary string) *command {
+	return &command{
+		name:    action,
+		summary: summary,
+		access:  accessToken,
+		flags: func(fs *flag.FlagSet) runFunc {
+			id := userIDFlag(fs)
+			return func(e *env) error {
+				if *id == 0 {
+					return required("id")
+				}
+				u, err := e.invoker.AdminUpdateUser(e.token, strconv.FormatUint(*id, 10), action)
+				if err != nil {
+					return fmt.Errorf("failed to run admin %s command: %w", action, err)
+				}
+				if ok, err := e.printJSON(u); ok {
+					return err
+				}
+				printAdminUser(e, u)
+				return nil
+			}
+		},
+		examples: []string{fmt.Sprintf("admin %s --id 42", action)},
+	}
+}
+
+// printAdminUser prints a user of the admin API on a line.
+func printAdminUser(e *env, u handlers.AdminUserResponse) {
+	var flags []string
+	if u.Disabled {
+		flags = append(flags, "disabled")
+	}
+	if u.TOTPEnabled {
+		flags = append(flags, "2fa")
+	}
+	if u.SRPEnabled {
+		flags = append(flags, "zero-knowledge")
+	}
+	fmt.Fprintf(e.stdout, "%6d  %-30s  %-5s  %s\n", u.ID, u.Login, u.Role, strings.Join(flags, ","))
+}
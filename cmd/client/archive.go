@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/archive"
+	"github.com/andreevym/gophkeeper/internal/importer"
+)
+
+// archiveCommands are the commands exporting and importing vault entries.
+func archiveCommands() []*command {
+	return []*command{
+		{
+			name:    "export",
+			summary: "Export all vault entries to an archive file encrypted with a passphrase",
+			description: "The downloaded archive is verified, so that an incomplete archive is never left behind. " +
+				"The passphrase is asked for twice if omitted.",
+			access: accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				path := fs.String("file", "", "`Path` of the archive to write, which must not exist")
+				passphrase := fs.String("passphrase", "", "Passphrase of the archive, asked for if omitted")
+				return func(e *env) error {
+					if *path == "" {
+						return required("file")
+					}
+					return export(e, *path, *passphrase)
+				}
+			},
+			examples: []string{"export --file vault.gkarchive"},
+		},
+		{
+			name:    "import",
+			summary: "Import an archive, or the export of another password manager",
+			description: "Reads archives of export, Bitwarden JSON, KeePass XML, 1Password CSV and browser password " +
+				"CSV exports. Entries whose key already exists are skipped, overwritten or kept as copies.",
+			access: accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				path := fs.String("file", "", "`Path` of the archive or export")
+				duplicates := fs.String("duplicates", "skip", "What to do with entries whose key exists: skip, overwrite or keep")
+				passphrase := fs.String("passphrase", "", "Passphrase of the archive, asked for if omitted")
+				format := fs.String("format", "", "Format of the export instead of the detected one: bitwarden, keepass, 1password or browser")
+				dryRun := fs.Bool("dry-run", false, "List the entries without importing them")
+				return func(e *env) error {
+					if *path == "" {
+						return required("file")
+					}
+					return importFile(e, *path, *duplicates, *passphrase, *format, *dryRun)
+				}
+			},
+			examples: []string{
+				"import --file vault.gkarchive --duplicates overwrite",
+				"import --file bitwarden_export.json --dry-run",
+			},
+		},
+	}
+}
+
+// archivePassphrase returns the passphrase of the flag, or asks for it if it is empty.
+// A new passphrase is asked for twice to catch typing mistakes.
+func archivePassphrase(e *env, passphrase string, confirm bool) (string, error) {
+	if passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase, err := e.promptSecretIfEmpty("", "Archive passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		repeated, err := e.promptSecret("Repeat the passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if repeated != passphrase {
+			return "", errors.New("passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
+
+// export exports all vault entries to an archive file encrypted with the passphrase, and verifies it.
+func export(e *env, path, passphrase string) error {
+	passphrase, err := archivePassphrase(e, passphrase, true)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	err = e.invoker.ExportVault(e.token, passphrase, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	var entries int
+	if err == nil {
+		file, err = os.Open(path)
+		if err == nil {
+			_, entries, err = archive.Verify(bufio.NewReader(file), passphrase)
+			file.Close()
+		}
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to export vault: %w", err)
+	}
+	if ok, err := e.printJSON(map[string]any{"file": path, "entries": entries}); ok {
+		return err
+	}
+	e.success("Exported %d entries to %s", entries, path)
+	return nil
+}
+
+// importFile imports the vault entries of an archive file, or of the export of another password manager.
+func importFile(e *env, path, duplicates, passphrase, format string, dryRun bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	// Archives are streamed, the exports of other password managers are read as a whole.
+	reader := bufio.NewReader(file)
+	head, _ := reader.Peek(64)
+
+	var body io.Reader = reader
+	if archive.IsArchive(head) {
+		passphrase, err = archivePassphrase(e, passphrase, false)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			manifest, entries, err := archive.Verify(reader, passphrase)
+			if err != nil {
+				return fmt.Errorf("failed to read archive: %w", err)
+			}
+			fmt.Fprintf(e.stdout, "Archive of %s created %s with %d entries\n",
+				manifest.Login, manifest.CreatedAt.Local().Format(time.DateTime), entries)
+			e.success("Dry run, nothing was imported")
+			return nil
+		}
+	} else {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		result, err := importer.Parse(data, importer.Format(format))
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", path, err)
+		}
+		printImportReport(e, result)
+		if dryRun {
+			e.success("Dry run, nothing was imported")
+			return nil
+		}
+		// The items are sent as an archive encrypted with a one-time passphrase, so that they are imported
+		// in a single request with the handling of duplicates of archive imports.
+		data, passphrase, err = itemsArchive(result.Items)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	result, err := e.invoker.ImportVault(e.token, passphrase, body, duplicates)
+	if err != nil {
+		return fmt.Errorf("failed to import vault: %w", err)
+	}
+	if ok, err := e.printJSON(result); ok {
+		return err
+	}
+	e.success("Imported %s: %d created, %d overwritten, %d skipped", path, result.Created, result.Overwritten, result.Skipped)
+	ids := make([]uint64, 0, len(result.IDs))
+	for id := range result.IDs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		fmt.Fprintf(e.stdout, "  %d -> %d\n", id, result.IDs[id])
+	}
+	return nil
+}
+
+// printImportReport lists the items read from the export of another password manager,
+// numbered like the entries of the archive they are imported with, and the items which were skipped.
+func printImportReport(e *env, result importer.Result) {
+	counts := make(map[importer.Kind]int)
+	for i, it := range result.Items {
+		counts[it.Kind]++
+		details := ""
+		if len(it.Tags) > 0 {
+			details += "  tags: " + strings.Join(it.Tags, ", ")
+		}
+		if len(it.Fields) > 0 {
+			details += fmt.Sprintf("  %d custom fields", len(it.Fields))
+		}
+		fmt.Fprintf(e.stdout, "%6d  %-6s  %s%s\n", i+1, it.Kind, it.Key(), details)
+	}
+	for _, w := range result.Warnings {
+		fmt.Fprintf(e.stdout, "Warning: %s\n", w)
+	}
+	fmt.Fprintf(e.stdout, "%s export: %d logins, %d cards, %d notes, %d files, %d skipped\n", result.Format,
+		counts[importer.KindLogin], counts[importer.KindCard], counts[importer.KindNote], counts[importer.KindFile],
+		len(result.Warnings))
+}
+
+// itemsArchive returns an archive of the items, numbered from 1, and the random passphrase it is encrypted with.
+func itemsArchive(items []importer.Item) ([]byte, string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", fmt.Errorf("failed to generate passphrase: %w", err)
+	}
+	passphrase := hex.EncodeToString(random)
+
+	var buf bytes.Buffer
+	w, err := archive.NewWriter(&buf, passphrase, archive.Manifest{CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return nil, "", err
+	}
+	for i, it := range items {
+		value, err := it.Value()
+		if err != nil {
+			return nil, "", err
+		}
+		err = w.WriteEntry(archive.Entry{ID: uint64(i + 1), Key: it.Key(), Value: []byte(value)})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), passphrase, nil
+}
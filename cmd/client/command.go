@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/profile"
+)
+
+// Exit codes of the client.
+const (
+	exitOK       = 0
+	exitError    = 1 // The command failed.
+	exitUsage    = 2 // The command line is invalid.
+	exitAuth     = 3 // The user is not logged in, or the server rejected the token or the credentials.
+	exitNotFound = 4 // The server found no such object.
+)
+
+// access is what a command needs to run.
+type access int
+
+const (
+	accessNone   access = iota // Runs without a server.
+	accessServer               // Needs the server, e.g. to sign in.
+	accessToken                // Needs the server and a token.
+)
+
+// runFunc runs a command with its parsed flags.
+type runFunc func(e *env) error
+
+// command is a command of the client, or a group of subcommands.
+type command struct {
+	name        string
+	summary     string
+	description string // Longer description in the help of the command, optional.
+	access      access
+	// flags defines the flags of the command on the flag set and returns the function running it.
+	flags       func(fs *flag.FlagSet) runFunc
+	subcommands []*command
+	examples    []string
+}
+
+// globalOptions are the flags every command accepts, before or after its name.
+type globalOptions struct {
+	profile string // Name of the selected profile, the current profile if empty.
+	server  string // Server URL overriding the one of the profile.
+	token   string // Token overriding the one of the profile.
+	json    bool   // Print responses as JSON, whatever the output format of the profile.
+}
+
+// env is the environment commands run in. Commands print to stdout and read prompts from stdin,
+// the server, the token and the output format are set up before they run.
+type env struct {
+	stdin  *bufio.Reader
+	stdout io.Writer
+	store  *profile.Store
+	// readPassword reads a line from the terminal without echoing it, nil if stdin is not a terminal.
+	readPassword func() ([]byte, error)
+	// newInvoker returns an Invoker for the server of the profile.
+	newInvoker func(p profile.Profile) (Invoker, error)
+
+	options     globalOptions
+	invoker     Invoker
+	profileName string          // The selected profile.
+	profile     profile.Profile // The selected profile, with the server of --server.
+	token       string
+	tokenStored bool // Whether the token was read from the profile, so that commands replacing it store the new one.
+	json        bool
+}
+
+// usageError is an invalid command line.
+type usageError struct {
+	cmd string // Command line of the command, e.g. "admin user".
+	msg string
+}
+
+// Error implements the error interface.
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// errNotLoggedIn is returned by commands which need a token if there is none.
+var errNotLoggedIn = errors.New("not logged in")
+
+// exitCode returns the exit code for the error of a command.
+func exitCode(err error) int {
+	var usageErr *usageError
+	var httpErr *client.HTTPError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.Is(err, errNotLoggedIn), errors.Is(err, profile.ErrNoToken):
+		return exitAuth
+	case errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden):
+		return exitAuth
+	case errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound:
+		return exitNotFound
+	}
+	return exitError
+}
+
+// run runs the command line and returns the exit code. Errors are printed to stderr.
+func run(e *env, args []string, stderr io.Writer) int {
+	err := execute(e, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%sError: %s%s\n", errorColor, strings.TrimSpace(err.Error()), resetColor)
+		var usageErr *usageError
+		if errors.As(err, &usageErr) {
+			fmt.Fprintf(stderr, "Run '%s' for usage.\n", strings.TrimSpace("./client help "+usageErr.cmd))
+		}
+	}
+	return exitCode(err)
+}
+
+// execute parses the command line and runs the command.
+func execute(e *env, args []string) error {
+	fs := newFlagSet("", &e.options)
+	fs.Usage = func() { printHelp(e.stdout, nil) }
+	version := fs.Bool("version", false, "Show the version of the client")
+	if err := fs.Parse(args); err != nil {
+		return parseError("", err)
+	}
+	if *version {
+		printVersion(e.stdout)
+		return nil
+	}
+	if fs.NArg() == 0 {
+		printHelp(e.stdout, nil)
+		return &usageError{msg: "command is required"}
+	}
+	args = fs.Args()
+	if args[0] == "help" {
+		return help(e, args[1:])
+	}
+
+	cmds := commands()
+	path := []string{}
+	for {
+		cmd := findCommand(cmds, args[0])
+		if cmd == nil {
+			if len(path) == 0 {
+				return &usageError{msg: fmt.Sprintf("unknown command '%s'", args[0])}
+			}
+			return &usageError{cmd: strings.Join(path, " "), msg: fmt.Sprintf("unknown command '%s %s'", strings.Join(path, " "), args[0])}
+		}
+		path = append(path, cmd.name)
+		name := strings.Join(path, " ")
+
+		fs = newFlagSet(name, &e.options)
+		var runCmd runFunc
+		if cmd.flags != nil {
+			runCmd = cmd.flags(fs)
+		}
+		fs.Usage = func() { printCommandHelp(e.stdout, name, cmd, fs) }
+		if err := fs.Parse(args[1:]); err != nil {
+			return parseError(name, err)
+		}
+		args = fs.Args()
+
+		if len(cmd.subcommands) > 0 {
+			if len(args) == 0 {
+				printCommandHelp(e.stdout, name, cmd, fs)
+				return &usageError{cmd: name, msg: fmt.Sprintf("%s requires a command", name)}
+			}
+			cmds = cmd.subcommands
+			continue
+		}
+		if len(args) > 0 {
+			return &usageError{cmd: name, msg: fmt.Sprintf("unexpected argument '%s'", args[0])}
+		}
+		if err := e.connect(cmd.access); err != nil {
+			return err
+		}
+		err := runCmd(e)
+		var usageErr *usageError
+		if errors.As(err, &usageErr) && usageErr.cmd == "" {
+			usageErr.cmd = name
+		}
+		return err
+	}
+}
+
+// help prints the commands, or the help of the command with the names, e.g. "admin", "user".
+func help(e *env, names []string) error {
+	cmds := commands()
+	for i, name := range names {
+		cmd := findCommand(cmds, name)
+		if cmd == nil {
+			return &usageError{msg: fmt.Sprintf("unknown command '%s'", strings.Join(names[:i+1], " "))}
+		}
+		if len(cmd.subcommands) > 0 && i < len(names)-1 {
+			cmds = cmd.subcommands
+			continue
+		}
+		if i < len(names)-1 {
+			return &usageError{msg: fmt.Sprintf("unexpected argument '%s'", names[i+1])}
+		}
+		name = strings.Join(names, " ")
+		fs := newFlagSet(name, &globalOptions{})
+		if cmd.flags != nil {
+			cmd.flags(fs)
+		}
+		printCommandHelp(e.stdout, name, cmd, fs)
+		return nil
+	}
+	printHelp(e.stdout, nil)
+	return nil
+}
+
+// parseError turns the error of parsing the flags of a command into a usage error.
+func parseError(cmd string, err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return &usageError{cmd: cmd, msg: err.Error()}
+}
+
+// findCommand returns the command with the name, or nil.
+func findCommand(cmds []*command, name string) *command {
+	for _, cmd := range cmds {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// globalFlags are the names of the flags defined by newFlagSet for every command.
+var globalFlags = map[string]bool{"profile": true, "server": true, "token": true, "json": true}
+
+// newFlagSet returns a flag set for the command with the global flags, which set the options.
+// The flag set doesn't print anything on errors, they are returned by execute.
+func newFlagSet(name string, options *globalOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&options.profile, "profile", options.profile, "Name of the `profile` to use instead of the current one")
+	fs.StringVar(&options.server, "server", options.server, "`URL` of the server instead of the one of the profile")
+	fs.StringVar(&options.token, "token", options.token, "Token instead of the one of the profile, or set GOPHKEEPER_TOKEN")
+	fs.BoolVar(&options.json, "json", options.json, "Print the responses of the server as JSON")
+	return fs
+}
+
+// required returns a usage error for a flag which is required but was not set.
+func required(name string) error {
+	return &usageError{msg: fmt.Sprintf("--%s is required", name)}
+}
+
+// connect sets up the invoker and the token the command needs.
+// --server and --token take precedence over the profile, the token is also read from GOPHKEEPER_TOKEN.
+func (e *env) connect(needs access) error {
+	if needs == accessNone {
+		return nil
+	}
+	cfg, err := e.store.Load()
+	if err != nil {
+		return err
+	}
+	// A profile which doesn't exist yet is only allowed with --server, e.g. to log in with it.
+	var p profile.Profile
+	e.profileName, p, err = cfg.Profile(e.options.profile)
+	found := err == nil
+	if !found && e.options.server == "" {
+		return fmt.Errorf("%w. Use './client login --server <url> --login <username>' or --server", err)
+	}
+	if e.options.server != "" {
+		p.Server = e.options.server
+	}
+	e.profile = p
+	e.json = e.options.json || p.Output == profile.OutputJSON
+	if e.invoker, err = e.newInvoker(p); err != nil {
+		return err
+	}
+	if needs == accessServer {
+		return nil
+	}
+
+	e.token = e.options.token
+	if e.token == "" {
+		e.token = os.Getenv("GOPHKEEPER_TOKEN")
+	}
+	// The stored token is only sent to another server if the profile was selected explicitly.
+	if e.token == "" && found && (e.options.server == "" || e.options.profile != "") {
+		e.token, err = e.store.Token(e.profileName)
+		if err != nil && !errors.Is(err, profile.ErrNoToken) {
+			return err
+		}
+		e.tokenStored = err == nil
+	}
+	if e.token == "" {
+		return fmt.Errorf("%w, use './client login' or --token", errNotLoggedIn)
+	}
+	return nil
+}
+
+// replaceToken stores a new token of the user for the profile, if the replaced one was read from it.
+// Returns whether it was stored.
+func (e *env) replaceToken(token string) (bool, error) {
+	if !e.tokenStored {
+		return false, nil
+	}
+	if err := e.store.SaveToken(e.profileName, token); err != nil {
+		return false, err
+	}
+	e.token = token
+	return true, nil
+}
+
+// success prints a message about the success of the command, unless the output is JSON.
+func (e *env) success(format string, args ...any) {
+	if e.json {
+		return
+	}
+	fmt.Fprintf(e.stdout, "%s%s%s\n", successColor, fmt.Sprintf(format, args...), resetColor)
+}
+
+// printJSON prints v as JSON if the output is JSON, and reports whether it did.
+func (e *env) printJSON(v any) (bool, error) {
+	if !e.json {
+		return false, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return true, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	_, err = fmt.Fprintln(e.stdout, string(b))
+	return true, err
+}
+
+// prompt prints the prompt and reads a line from stdin.
+func (e *env) prompt(prompt string) (string, error) {
+	fmt.Fprint(e.stdout, prompt)
+	line, err := e.stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// promptSecret prints the prompt and reads a secret without echoing it if stdin is a terminal,
+// or reads a line from stdin like prompt if the input is piped.
+func (e *env) promptSecret(prompt string) (string, error) {
+	if e.readPassword == nil {
+		return e.prompt(prompt)
+	}
+	fmt.Fprint(e.stdout, prompt)
+	secret, err := e.readPassword()
+	// The newline typed by the user isn't echoed either.
+	fmt.Fprintln(e.stdout)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
+
+// promptIfEmpty returns the value of a flag, or asks for it if it is empty. Empty answers are rejected.
+func (e *env) promptIfEmpty(value, prompt string) (string, error) {
+	return askIfEmpty(value, prompt, e.prompt)
+}
+
+// promptSecretIfEmpty is like promptIfEmpty, but reads the answer with promptSecret.
+func (e *env) promptSecretIfEmpty(value, prompt string) (string, error) {
+	return askIfEmpty(value, prompt, e.promptSecret)
+}
+
+// askIfEmpty returns the value, or the answer to the prompt read with ask if it is empty. Empty answers are rejected.
+func askIfEmpty(value, prompt string, ask func(prompt string) (string, error)) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+	value, err := ask(prompt)
+	if err == nil && value == "" {
+		err = errors.New("no input")
+	}
+	return value, err
+}
+
+// printHelp prints the commands, or the subcommands of the group.
+func printHelp(w io.Writer, group *command) {
+	cmds, prefix := commands(), ""
+	if group != nil {
+		cmds, prefix = group.subcommands, group.name+" "
+	}
+	fmt.Fprintln(w, "GophKeeper CLI")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Usage: ./client [global flags] %s<command> [flags]\n", prefix)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	width := 0
+	for _, cmd := range cmds {
+		width = max(width, len(cmd.name))
+	}
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	printFlags(w, newFlagSet("", &globalOptions{}), true)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Run './client help %s<command>' for the flags of a command.\n", prefix)
+}
+
+// printCommandHelp prints the usage, the description, the flags and the examples of the command.
+func printCommandHelp(w io.Writer, name string, cmd *command, fs *flag.FlagSet) {
+	if len(cmd.subcommands) > 0 {
+		printHelp(w, cmd)
+		return
+	}
+	fmt.Fprintf(w, "Usage: ./client %s [flags]\n", name)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, cmd.summary+".")
+	if cmd.description != "" {
+		fmt.Fprintln(w, cmd.description)
+	}
+	if hasFlags(fs) {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Flags:")
+		printFlags(w, fs, false)
+	}
+	if len(cmd.examples) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Examples:")
+		for _, example := range cmd.examples {
+			fmt.Fprintf(w, "  ./client %s\n", example)
+		}
+	}
+}
+
+// hasFlags reports whether the flag set has flags besides the global ones.
+func hasFlags(fs *flag.FlagSet) bool {
+	has := false
+	fs.VisitAll(func(f *flag.Flag) { has = has || !globalFlags[f.Name] })
+	return has
+}
+
+// printFlags prints the global flags, or the other flags of the flag set, sorted by name.
+func printFlags(w io.Writer, fs *flag.FlagSet, global bool) {
+	var lines []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if globalFlags[f.Name] != global {
+			return
+		}
+		name, usage := flag.UnquoteUsage(f)
+		line := "  --" + f.Name
+		if name != "" {
+			line += " " + name
+		}
+		if f.DefValue != "" && f.DefValue != "0" && f.DefValue != "false" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		lines = append(lines, fmt.Sprintf("%-28s %s", line, usage))
+	})
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
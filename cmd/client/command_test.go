@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInvoker records the requests of the commands. Methods which aren't overridden panic.
+type fakeInvoker struct {
+	Invoker
+	server string
+	tokens []string
+	vaults map[string]handlers.VaultResponse
+}
+
+func (f *fakeInvoker) SignIn(login, password string) (string, error) {
+	return "token-" + login, nil
+}
+
+func (f *fakeInvoker) NewVault(token, key, value, vaultID string) (handlers.VaultResponse, error) {
+	f.tokens = append(f.tokens, token)
+	v := handlers.VaultResponse{ID: uint64(len(f.vaults) + 1), Key: key, Value: value}
+	f.vaults[key] = v
+	return v, nil
+}
+
+func (f *fakeInvoker) GetVault(token, vaultID string) (handlers.VaultResponse, error) {
+	f.tokens = append(f.tokens, token)
+	return handlers.VaultResponse{}, &client.HTTPError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+}
+
+// newTestEnv returns an environment with a store in a temporary directory and the fake invoker.
+func newTestEnv(t *testing.T, stdin string) (*env, *fakeInvoker, *bytes.Buffer) {
+	t.Helper()
+	t.Setenv("GOPHKEEPER_TOKEN", "")
+	fake := &fakeInvoker{vaults: make(map[string]handlers.VaultResponse)}
+	stdout := &bytes.Buffer{}
+	e := &env{
+		stdin:  bufio.NewReader(strings.NewReader(stdin)),
+		stdout: stdout,
+		store:  profile.NewStore(filepath.Join(t.TempDir(), "gophkeeper")),
+		newInvoker: func(p profile.Profile) (Invoker, error) {
+			fake.server = p.Server
+			return fake, nil
+		},
+	}
+	return e, fake, stdout
+}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{name: "no command", args: nil, code: exitUsage, stderr: "command is required"},
+		{name: "unknown command", args: []string{"nope"}, code: exitUsage, stderr: "unknown command 'nope'"},
+		{name: "unknown subcommand", args: []string{"admin", "nope"}, code: exitUsage, stderr: "help admin' for usage"},
+		{name: "unknown flag", args: []string{"getvault", "--nope"}, code: exitUsage, stderr: "flag provided but not defined: -nope"},
+		{name: "missing flag", args: []string{"getvault", "--server", "http://localhost:8080", "--token", "t"}, code: exitUsage, stderr: "--id is required"},
+		{name: "password flag", args: []string{"login", "--login", "alice", "--password", "secret"}, code: exitUsage, stderr: "flag provided but not defined: -password"},
+		{name: "unexpected argument", args: []string{"getvault", "--id", "1", "2"}, code: exitUsage, stderr: "unexpected argument '2'"},
+		{name: "help flag", args: []string{"getvault", "--help"}, code: exitOK},
+		{name: "help", args: []string{"help", "admin", "user"}, code: exitOK},
+		{name: "version", args: []string{"--version"}, code: exitOK},
+		{name: "not logged in", args: []string{"getvault", "--server", "http://localhost:8080", "--id", "1"}, code: exitAuth, stderr: "not logged in"},
+		{name: "no profile", args: []string{"getvault", "--id", "1"}, code: exitError, stderr: "profile not found"},
+		{name: "not found", args: []string{"getvault", "--server", "http://localhost:8080", "--token", "t", "--id", "1"}, code: exitNotFound, stderr: "404 Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _, _ := newTestEnv(t, "")
+			stderr := &bytes.Buffer{}
+			assert.Equal(t, tt.code, run(e, tt.args, stderr))
+			assert.Contains(t, stderr.String(), tt.stderr)
+		})
+	}
+}
+
+func TestHelp(t *testing.T) {
+	e, _, stdout := newTestEnv(t, "")
+	require.NoError(t, execute(e, []string{"help"}))
+	for _, cmd := range commands() {
+		assert.Contains(t, stdout.String(), "  "+cmd.name+" ")
+	}
+
+	stdout.Reset()
+	require.NoError(t, execute(e, []string{"help", "store-card"}))
+	assert.Contains(t, stdout.String(), "Usage: ./client store-card [flags]")
+	assert.Contains(t, stdout.String(), "--number string")
+	assert.NotContains(t, stdout.String(), "--profile", "global flags are only listed by help")
+}
+
+func TestLogin(t *testing.T) {
+	e, fake, stdout := newTestEnv(t, "secret\n")
+
+	require.NoError(t, execute(e, []string{"--server", "http://localhost:8080", "login", "--login", "alice"}))
+	assert.Equal(t, "http://localhost:8080", fake.server)
+	assert.Contains(t, stdout.String(), "Logged in to http://localhost:8080 with profile default")
+	token, err := e.store.Token(profile.DefaultName)
+	require.NoError(t, err)
+	assert.Equal(t, "token-alice", token)
+
+	// Later commands read the server and the token from the profile.
+	e.options = globalOptions{}
+	stdout.Reset()
+	require.NoError(t, execute(e, []string{"store-login-password", "--login", `bo"b`, "--password", `p"w`, "--json"}))
+	assert.Equal(t, []string{"token-alice"}, fake.tokens)
+	v := fake.vaults[`login/bo"b`]
+	assert.JSONEq(t, `{"login":"bo\"b","password":"p\"w"}`, v.Value)
+	assert.JSONEq(t, `{"id":1,"key":"login/bo\"b","value":"{\"login\":\"bo\\\"b\",\"password\":\"p\\\"w\"}","user_id":0}`, stdout.String())
+
+	// --token takes precedence over the token of the profile.
+	e.options = globalOptions{}
+	require.NoError(t, execute(e, []string{"savevault", "--key", "k1", "--value", "v1", "--token", "other"}))
+	assert.Equal(t, []string{"token-alice", "other"}, fake.tokens)
+}
+
+func TestPromptSecret(t *testing.T) {
+	e, _, stdout := newTestEnv(t, "piped\n")
+
+	// Piped input is read like any other prompt.
+	secret, err := e.promptSecret("Password: ")
+	require.NoError(t, err)
+	assert.Equal(t, "piped", secret)
+	assert.Equal(t, "Password: ", stdout.String())
+
+	// On a terminal the secret is read without echo, and the line is ended after it.
+	stdout.Reset()
+	e.readPassword = func() ([]byte, error) {
+		return []byte("hidden"), nil
+	}
+	secret, err = e.promptSecretIfEmpty("", "Password: ")
+	require.NoError(t, err)
+	assert.Equal(t, "hidden", secret)
+	assert.Equal(t, "Password: \n", stdout.String())
+
+	secret, err = e.promptSecretIfEmpty("flag", "Password: ")
+	require.NoError(t, err)
+	assert.Equal(t, "flag", secret)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/profile"
+)
+
+// profileCommand is the group of the commands managing the profiles.
+func profileCommand() *command {
+	return &command{
+		name:    "profile",
+		summary: "Manage the profiles of servers",
+		subcommands: []*command{
+			{
+				name:    "list",
+				summary: "List the profiles, marking the current one with *",
+				flags: func(fs *flag.FlagSet) runFunc {
+					return listProfiles
+				},
+			},
+			{
+				name:    "set",
+				summary: "Create a profile, or change its server, CA certificates or output format",
+				flags: func(fs *flag.FlagSet) runFunc {
+					name := fs.String("name", "", "Name of the profile")
+					ca := fs.String("ca", "", "`Path` of a PEM file with the CA certificates of the server, the system's by default")
+					output := fs.String("output", "", "Output format of the profile, text or json")
+					return func(e *env) error {
+						if *name == "" {
+							return required("name")
+						}
+						return setProfile(e, *name, *ca, *output)
+					}
+				},
+				examples: []string{"profile set --name work --server https://keeper.example.com --ca example-ca.pem"},
+			},
+			{
+				name:    "use",
+				summary: "Make a profile the current one",
+				flags: func(fs *flag.FlagSet) runFunc {
+					name := fs.String("name", "", "Name of the profile")
+					return func(e *env) error {
+						if *name == "" {
+							return required("name")
+						}
+						return updateConfig(e, *name, func(cfg *profile.Config) {
+							cfg.Current = *name
+						}, "Using profile %s")
+					}
+				},
+				examples: []string{"profile use --name work"},
+			},
+			{
+				name:    "delete",
+				summary: "Delete a profile with its token",
+				flags: func(fs *flag.FlagSet) runFunc {
+					name := fs.String("name", "", "Name of the profile")
+					return func(e *env) error {
+						if *name == "" {
+							return required("name")
+						}
+						if err := e.store.DeleteToken(*name); err != nil && !errors.Is(err, profile.ErrNoToken) {
+							return err
+						}
+						return updateConfig(e, *name, func(cfg *profile.Config) {
+							delete(cfg.Profiles, *name)
+							if cfg.Current == *name {
+								cfg.Current = ""
+							}
+						}, "Profile %s deleted")
+					}
+				},
+			},
+		},
+	}
+}
+
+// listProfiles lists the profiles.
+func listProfiles(e *env) error {
+	cfg, err := e.store.Load()
+	if err != nil {
+		return err
+	}
+	e.json = e.options.json
+	if ok, err := e.printJSON(cfg); ok {
+		return err
+	}
+	current, _, _ := cfg.Profile("")
+	for _, name := range cfg.Names() {
+		p := cfg.Profiles[name]
+		marker := " "
+		if name == current {
+			marker = "*"
+		}
+		loggedIn := ""
+		if _, err := e.store.Token(name); err == nil {
+			loggedIn = "logged in"
+		}
+		output := p.Output
+		if output == "" {
+			output = profile.OutputText
+		}
+		fmt.Fprintf(e.stdout, "%s %-16s  %-40s  %-4s  %-9s  %s\n", marker, name, p.Server, output, loggedIn, p.CA)
+	}
+	return nil
+}
+
+// setProfile creates or changes the profile with the server of --server.
+func setProfile(e *env, name, ca, output string) error {
+	cfg, err := e.store.Load()
+	if err != nil {
+		return err
+	}
+	p, ok := cfg.Profiles[name]
+	if e.options.server != "" {
+		p.Server = e.options.server
+	} else if !ok {
+		return required("server")
+	}
+	if ca != "" {
+		p.CA = ca
+	}
+	if output != "" {
+		p.Output = output
+	}
+	cfg.Profiles[name] = p
+	if err = e.store.Save(cfg); err != nil {
+		return fmt.Errorf("failed to save profile: %w", err)
+	}
+	e.success("Profile %s saved", name)
+	return nil
+}
+
+// updateConfig changes the configuration with the existing profile of the name and prints the message.
+func updateConfig(e *env, name string, update func(cfg *profile.Config), message string) error {
+	cfg, err := e.store.Load()
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Profiles[name]; !ok {
+		return fmt.Errorf("%w: %s", profile.ErrNotFound, name)
+	}
+	update(&cfg)
+	if err = e.store.Save(cfg); err != nil {
+		return fmt.Errorf("failed to save profile: %w", err)
+	}
+	e.success(message, name)
+	return nil
+}
+
+// login signs in and stores the token encrypted for the profile, which is created or changed with --server.
+func login(e *env, signIn func(e *env) (string, error)) error {
+	if err := profile.ValidateName(e.profileName); err != nil {
+		return err
+	}
+	token, err := signIn(e)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := e.store.Load()
+	if err != nil {
+		return err
+	}
+	cfg.Profiles[e.profileName] = e.profile
+	if err = e.store.Save(cfg); err != nil {
+		return fmt.Errorf("failed to save profile: %w", err)
+	}
+	if err = e.store.SaveToken(e.profileName, token); err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+	e.success("Logged in to %s with profile %s", e.profile.Server, e.profileName)
+	return nil
+}
+
+// logout signs out the session of the profile and deletes its token. The token is deleted
+// even if the session can't be signed out, e.g. because it has expired.
+func logout(e *env) error {
+	token, err := e.store.Token(e.profileName)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := e.invoker.ListSessions(token)
+	for _, s := range sessions {
+		if s.Current {
+			err = e.invoker.RevokeSession(token, fmt.Sprint(s.ID))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(e.stdout, "Warning: Failed to sign out the session: %s\n", err)
+	}
+
+	if err = e.store.DeleteToken(e.profileName); err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	e.success("Logged out of profile %s", e.profileName)
+	return nil
+}
+
+// newInvoker returns a client of the server of the profile, which verifies the server with the CA of the profile.
+func newInvoker(p profile.Profile) (Invoker, error) {
+	if p.CA == "" {
+		return client.NewClient(p.Server), nil
+	}
+	pem, err := os.ReadFile(p.CA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificates found in %s", p.CA)
+	}
+	return client.NewClient(p.Server, client.WithRootCAs(pool)), nil
+}
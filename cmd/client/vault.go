@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+)
+
+// vaultCommands are the commands storing and retrieving vault entries.
+func vaultCommands() []*command {
+	return []*command{
+		{
+			name:    "savevault",
+			summary: "Create a vault entry with a key and a value, or update the entry with --id",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				key := fs.String("key", "", "Key of the entry")
+				value := fs.String("value", "", "Value of the entry")
+				id := idFlag(fs, "`ID` of the entry to update")
+				return func(e *env) error {
+					if *key == "" {
+						return required("key")
+					}
+					return saveVault(e, *key, *value, *id)
+				}
+			},
+			examples: []string{"savevault --key k1 --value v1", "savevault --key k1 --value v2 --id 1"},
+		},
+		{
+			name:    "getvault",
+			summary: "Show a vault entry",
+			access:  accessToken,
+			flags:   getVaultFlags,
+			examples: []string{
+				"getvault --id 1",
+			},
+		},
+		{
+			name:    "uploadfile",
+			summary: "Upload a file to a vault entry, or update the entry with --id",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				key := fs.String("key", "", "Key of the entry, e.g. the file name")
+				path := fs.String("file", "", "`Path` of the file to upload")
+				id := idFlag(fs, "`ID` of the entry to update")
+				return func(e *env) error {
+					if *key == "" {
+						return required("key")
+					}
+					if *path == "" {
+						return required("file")
+					}
+					vault, err := e.invoker.UploadFile(e.token, *key, *path, formatID(*id))
+					if err != nil {
+						return fmt.Errorf("failed to upload file: %w", err)
+					}
+					return printVault(e, vault)
+				}
+			},
+			examples: []string{"uploadfile --key notes.md --file /home/user/notes.md"},
+		},
+		{
+			name:    "downloadfile",
+			summary: "Save the value of a vault entry, e.g. an uploaded file, to a file",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				id := idFlag(fs, "`ID` of the entry")
+				path := fs.String("file", "", "`Path` of the file to write, which must not exist")
+				return func(e *env) error {
+					if *id == 0 {
+						return required("id")
+					}
+					if *path == "" {
+						return required("file")
+					}
+					file, err := os.OpenFile(*path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+					if err != nil {
+						return fmt.Errorf("failed to create file: %w", err)
+					}
+					err = e.invoker.DownloadFile(e.token, formatID(*id), file)
+					if closeErr := file.Close(); err == nil {
+						err = closeErr
+					}
+					if err != nil {
+						os.Remove(*path)
+						return fmt.Errorf("failed to download file: %w", err)
+					}
+					e.success("Vault %d saved to %s", *id, *path)
+					return nil
+				}
+			},
+			examples: []string{"downloadfile --id 1 --file notes.md"},
+		},
+		{
+			name:    "store-login-password",
+			summary: "Store a login and password pair under the key login/<login>",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				login := fs.String("login", "", "Login to store")
+				password := fs.String("password", "", "Password to store, asked for if omitted")
+				id := idFlag(fs, "`ID` of the entry to update")
+				return func(e *env) error {
+					if *login == "" {
+						return required("login")
+					}
+					password, err := e.promptSecretIfEmpty(*password, "Password to store: ")
+					if err != nil {
+						return err
+					}
+					return saveVaultJSON(e, "login/"+*login, map[string]string{"login": *login, "password": password}, *id)
+				}
+			},
+			examples: []string{"store-login-password --login user1"},
+		},
+		{
+			name:     "get-login-password",
+			summary:  "Show a login and password pair",
+			access:   accessToken,
+			flags:    getVaultFlags,
+			examples: []string{"get-login-password --id 1"},
+		},
+		{
+			name:    "store-text",
+			summary: "Store text under the key text/<key>",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				key := fs.String("key", "", "Key of the entry, without the text/ prefix")
+				text := fs.String("text", "", "Text to store")
+				id := idFlag(fs, "`ID` of the entry to update")
+				return func(e *env) error {
+					if *key == "" {
+						return required("key")
+					}
+					return saveVaultJSON(e, "text/"+*key, map[string]string{"text": *text}, *id)
+				}
+			},
+			examples: []string{`store-text --key note --text "This is some text to store"`},
+		},
+		{
+			name:     "get-text",
+			summary:  "Show text",
+			access:   accessToken,
+			flags:    getVaultFlags,
+			examples: []string{"get-text --id 1"},
+		},
+		{
+			name:    "store-binary",
+			summary: "Store the content of a file under the key binary/<key>",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				key := fs.String("key", "", "Key of the entry, without the binary/ prefix")
+				path := fs.String("file", "", "`Path` of the file to store")
+				id := idFlag(fs, "`ID` of the entry to update")
+				return func(e *env) error {
+					if *key == "" {
+						return required("key")
+					}
+					if *path == "" {
+						return required("file")
+					}
+					data, err := os.ReadFile(*path)
+					if err != nil {
+						return fmt.Errorf("failed to read file: %w", err)
+					}
+					return saveVault(e, "binary/"+*key, hex.EncodeToString(data), *id)
+				}
+			},
+			examples: []string{"store-binary --key photo --file /path/to/photo.jpg"},
+		},
+		{
+			name:    "get-binary",
+			summary: "Save binary data to a file",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				id := idFlag(fs, "`ID` of the entry")
+				path := fs.String("file", "", "`Path` of the file to write, which must not exist")
+				return func(e *env) error {
+					if *id == 0 {
+						return required("id")
+					}
+					if *path == "" {
+						return required("file")
+					}
+					vault, err := e.invoker.GetVault(e.token, formatID(*id))
+					if err != nil {
+						return fmt.Errorf("failed to get vault: %w", err)
+					}
+					data, err := hex.DecodeString(vault.Value)
+					if err != nil {
+						return fmt.Errorf("vault %d holds no binary data: %w", vault.ID, err)
+					}
+					file, err := os.OpenFile(*path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+					if err != nil {
+						return fmt.Errorf("failed to create file: %w", err)
+					}
+					_, err = file.Write(data)
+					if closeErr := file.Close(); err == nil {
+						err = closeErr
+					}
+					if err != nil {
+						os.Remove(*path)
+						return fmt.Errorf("failed to write file: %w", err)
+					}
+					e.success("Vault %d saved to %s", vault.ID, *path)
+					return nil
+				}
+			},
+			examples: []string{"get-binary --id 1 --file photo.jpg"},
+		},
+		{
+			name:    "store-card",
+			summary: "Store bank card data under the key card/<key>",
+			access:  accessToken,
+			flags: func(fs *flag.FlagSet) runFunc {
+				key := fs.String("key", "", "Key of the entry, without the card/ prefix")
+				number := fs.String("number", "", "Card number")
+				expiry := fs.String("expiry", "", "Expiry date, e.g. 12/29")
+				cvv := fs.String("cvv", "", "Card verification value, asked for if omitted")
+				id := idFlag(fs, "`ID` of the entry to update")
+				return func(e *env) error {
+					for _, f := range []struct{ name, value string }{{"key", *key}, {"number", *number}, {"expiry", *expiry}} {
+						if f.value == "" {
+							return required(f.name)
+						}
+					}
+					cvv, err := e.promptSecretIfEmpty(*cvv, "CVV: ")
+					if err != nil {
+						return err
+					}
+					value := map[string]string{"card_number": *number, "expiry_date": *expiry, "cvv": cvv}
+					return saveVaultJSON(e, "card/"+*key, value, *id)
+				}
+			},
+			examples: []string{"store-card --key visa --number 1234567890123456 --expiry 12/29"},
+		},
+		{
+			name:     "get-card",
+			summary:  "Show bank card data",
+			access:   accessToken,
+			flags:    getVaultFlags,
+			examples: []string{"get-card --id 1"},
+		},
+	}
+}
+
+// idFlag defines the --id flag of the ID of a vault entry, 0 if it is not set.
+func idFlag(fs *flag.FlagSet, usage string) *uint64 {
+	return fs.Uint64("id", 0, usage)
+}
+
+// formatID formats the ID of a vault entry for the Invoker, which takes an empty ID for new entries.
+func formatID(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+// getVaultFlags defines the flags of the commands showing a vault entry.
+func getVaultFlags(fs *flag.FlagSet) runFunc {
+	id := idFlag(fs, "`ID` of the entry")
+	return func(e *env) error {
+		if *id == 0 {
+			return required("id")
+		}
+		vault, err := e.invoker.GetVault(e.token, formatID(*id))
+		if err != nil {
+			return fmt.Errorf("failed to get vault: %w", err)
+		}
+		return printVault(e, vault)
+	}
+}
+
+// saveVault creates a vault entry, or updates the entry with the ID if it is not 0.
+func saveVault(e *env, key, value string, id uint64) error {
+	vault, err := e.invoker.NewVault(e.token, key, value, formatID(id))
+	if err != nil {
+		return fmt.Errorf("failed to save vault: %w", err)
+	}
+	return printVault(e, vault)
+}
+
+// saveVaultJSON saves the fields as the JSON value of a vault entry.
+func saveVaultJSON(e *env, key string, fields map[string]string, id uint64) error {
+	value, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return saveVault(e, key, string(value), id)
+}
+
+// printVault prints a vault entry.
+func printVault(e *env, v handlers.VaultResponse) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault response: %w", err)
+	}
+	if e.json {
+		_, err = fmt.Fprintln(e.stdout, string(b))
+		return err
+	}
+	e.success("Vault operation successful: %s", b)
+	return nil
+}
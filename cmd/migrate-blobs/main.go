@@ -0,0 +1,79 @@
+// Command migrate-blobs moves vault values kept in PostgreSQL large objects to the blob store of BLOB_STORE_URI.
+// It takes the same configuration as the server and can run while the server is running,
+// which must already be configured with the blob store, so that no new large objects are created.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/andreevym/gophkeeper/internal/config"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/migrations"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+func main() {
+	cfg, err := config.NewServerConfig().Init()
+	if err != nil {
+		log.Fatalf("Error initializing server config: %v", err)
+	}
+
+	_, err = logger.NewLogger(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Error initializing logger with level %s: %v", cfg.LogLevel, err)
+	}
+
+	ctx := context.Background()
+
+	backend, err := cfg.StorageBackend()
+	if err != nil {
+		logger.Logger().Fatal("Invalid storage configuration", zap.Error(err))
+	}
+	if backend != "postgres" {
+		logger.Logger().Fatal("Large objects are only used by PostgreSQL", zap.String("storage", backend))
+	}
+
+	blobs, err := cfg.OpenBlobStore(ctx)
+	if err != nil {
+		logger.Logger().Fatal("Failed to open blob store", zap.String("blobStoreURI", cfg.BlobStoreURI), zap.Error(err))
+	}
+	if blobs == nil {
+		logger.Logger().Fatal("No blob store configured, set BLOB_STORE_URI")
+	}
+
+	db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
+	if err != nil {
+		logger.Logger().Fatal("Failed to connect to database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+	}
+	defer db.Close()
+
+	poolConfig, err := cfg.PoolConfig()
+	if err != nil {
+		logger.Logger().Fatal("Invalid database pool configuration", zap.Error(err))
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		logger.Logger().Fatal("Failed to connect to database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+	}
+	defer pool.Close()
+
+	migrator, err := postgres.NewMigrator(db, migrations.FS)
+	if err != nil {
+		logger.Logger().Fatal("Failed to read migrations", zap.Error(err))
+	}
+	_, err = migrator.Up(ctx)
+	if err != nil {
+		logger.Logger().Fatal("Failed to migrate database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+	}
+
+	moved, err := postgres.NewVaultStorage(pool, postgres.WithBlobStore(blobs)).MoveLargeObjects(ctx)
+	if err != nil {
+		logger.Logger().Fatal("Failed to move large objects", zap.Int("moved", moved), zap.Error(err))
+	}
+	logger.Logger().Info("Moved large objects to the blob store", zap.Int("moved", moved))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/andreevym/gophkeeper/internal/config"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/internal/storage/sqlite"
+	"github.com/jmoiron/sqlx"
+)
+
+const adminUsage = "usage: server [flags] admin <login> [grant | revoke]"
+
+// runAdmin runs the admin subcommand on the database of the configuration: "admin <login>" prints the role
+// of the user, "grant" gives them the admin role and "revoke" takes it away. It is the way to appoint
+// the first administrator, who can manage the other users with the admin API.
+func runAdmin(ctx context.Context, cfg *config.ServerConfig, args []string) error {
+	if len(args) < 1 || len(args) > 2 || len(args) == 2 && args[1] != "grant" && args[1] != "revoke" {
+		return errors.New(adminUsage)
+	}
+
+	userStorage, closeStorage, err := openUserStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	user, err := userStorage.GetUserByLogin(ctx, storage.NormalizeLogin(args[0]))
+	if err != nil {
+		return fmt.Errorf("failed to get user %s: %w", args[0], err)
+	}
+
+	if len(args) == 2 {
+		user.Role = storage.RoleUser
+		if args[1] == "grant" {
+			user.Role = storage.RoleAdmin
+		}
+		err = userStorage.UpdateUser(ctx, user)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("User:     %s (id %d)\n", user.Login, user.ID)
+	fmt.Printf("Role:     %s\n", user.Role)
+	fmt.Printf("Disabled: %t\n", user.Disabled)
+	return nil
+}
+
+// openUserStorage connects to the database of the configuration. The returned function closes the connection.
+func openUserStorage(ctx context.Context, cfg *config.ServerConfig) (storage.UserStorage, func(), error) {
+	backend, err := cfg.StorageBackend()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch backend {
+	case "postgres":
+		db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		return postgres.NewUserStorage(db), func() { db.Close() }, nil
+	case "sqlite":
+		db, err := sqlite.Open(ctx, cfg.DatabaseURI)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sqlite.NewUserStorage(db), func() { db.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("admin is only supported with a database, not with %s storage", backend)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/andreevym/gophkeeper/internal/config"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/internal/storage/sqlite"
+	"github.com/jmoiron/sqlx"
+)
+
+const auditUsage = "usage: server [flags] audit <export | verify>"
+
+// auditExportPageSize is the number of audit events read from the database at once.
+const auditExportPageSize = 1000
+
+// runAudit runs the audit subcommand on the database of the configuration: "export" writes the audit log of all
+// users to stdout as JSON lines, oldest first, and "verify" only checks it. Both verify the chain of hashes
+// and print the number of records and the hash of the latest one, which can be kept elsewhere to detect
+// removal of the latest records later.
+func runAudit(ctx context.Context, cfg *config.ServerConfig, args []string) error {
+	if len(args) != 1 || args[0] != "export" && args[0] != "verify" {
+		return errors.New(auditUsage)
+	}
+
+	auditStorage, closeStorage, err := openAuditStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	out := io.Discard
+	if args[0] == "export" {
+		out = os.Stdout
+	}
+	n, lastHash, err := exportAudit(ctx, auditStorage, out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Audit log of %d records verified, latest hash %s\n", n, lastHash)
+	return nil
+}
+
+// exportAudit writes all audit events to out as JSON lines and verifies their chain.
+// Returns the number of events and the hash of the latest one.
+func exportAudit(ctx context.Context, auditStorage storage.AuditStorage, out io.Writer) (int, string, error) {
+	enc := json.NewEncoder(out)
+	n := 0
+	lastHash := ""
+	var afterID uint64
+	for {
+		events, err := auditStorage.ExportAuditEvents(ctx, afterID, auditExportPageSize)
+		if err != nil {
+			return n, lastHash, err
+		}
+		if len(events) == 0 {
+			return n, lastHash, nil
+		}
+		for _, e := range events {
+			if err = enc.Encode(e); err != nil {
+				return n, lastHash, fmt.Errorf("failed to write audit event %d: %w", e.ID, err)
+			}
+		}
+		lastHash, err = storage.VerifyAuditChain(lastHash, events)
+		if err != nil {
+			return n, lastHash, err
+		}
+		n += len(events)
+		afterID = events[len(events)-1].ID
+	}
+}
+
+// openAuditStorage connects to the database of the configuration. The returned function closes the connection.
+func openAuditStorage(ctx context.Context, cfg *config.ServerConfig) (storage.AuditStorage, func(), error) {
+	backend, err := cfg.StorageBackend()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch backend {
+	case "postgres":
+		db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		return postgres.NewAuditStorage(db), func() { db.Close() }, nil
+	case "sqlite":
+		db, err := sqlite.Open(ctx, cfg.DatabaseURI)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sqlite.NewAuditStorage(db), func() { db.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("audit is only supported with a database, not with %s storage", backend)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/backup"
+	"github.com/andreevym/gophkeeper/internal/config"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/internal/storage/sqlite"
+	"github.com/andreevym/gophkeeper/migrations"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jmoiron/sqlx"
+)
+
+const backupUsage = "usage: server [flags] backup create [file] | verify <file> | restore <file>"
+
+// runBackup runs the backup subcommand: "create" writes an encrypted backup of the database of the configuration,
+// including the values in the blob store, to the file or to stdout, "verify" checks a backup without a database,
+// and "restore" restores a backup into the empty database of the configuration. Backups are encrypted with
+// the passphrase of BACKUP_PASSPHRASE.
+func runBackup(ctx context.Context, cfg *config.ServerConfig, args []string) error {
+	if len(args) == 0 {
+		return errors.New(backupUsage)
+	}
+	switch {
+	case args[0] == "create" && len(args) <= 2:
+	case (args[0] == "verify" || args[0] == "restore") && len(args) == 2:
+	default:
+		return errors.New(backupUsage)
+	}
+	if cfg.BackupPassphrase == "" {
+		return errors.New("BACKUP_PASSPHRASE is not set")
+	}
+
+	switch args[0] {
+	case "create":
+		path := "-"
+		if len(args) == 2 {
+			path = args[1]
+		}
+		return createBackup(ctx, cfg, path)
+	case "verify":
+		f, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer f.Close()
+		m, summary, err := backup.Verify(f, cfg.BackupPassphrase)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup of a %s database with schema version %d created at %s\n",
+			m.Driver, m.Schema, m.CreatedAt.Local().Format(time.DateTime))
+		printBackupSummary(os.Stdout, summary)
+		return nil
+	default:
+		return restoreBackup(ctx, cfg, args[1])
+	}
+}
+
+// createBackup writes a backup of the database to the file at path, or to stdout if the path is "-".
+// A new file is created, an existing one is never overwritten, and it is removed again if the backup fails.
+func createBackup(ctx context.Context, cfg *config.ServerConfig, path string) (err error) {
+	backups, closeStorage, err := openBackupStorage(ctx, cfg, nil)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	out := os.Stdout
+	if path != "-" {
+		out, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create backup: %w", err)
+		}
+		defer func() {
+			if closeErr := out.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("failed to write backup: %w", closeErr)
+			}
+			if err != nil {
+				os.Remove(path)
+			}
+		}()
+	}
+
+	summary, err := backups.Backup(ctx, out, cfg.BackupPassphrase)
+	if err != nil {
+		return err
+	}
+	printBackupSummary(os.Stderr, summary)
+	return nil
+}
+
+// restoreBackup restores the backup in the file at path into the empty database of the configuration
+// and verifies the audit log it restored. A PostgreSQL database is first migrated to the schema version
+// of the backup, the newer migrations are applied when the server starts.
+func restoreBackup(ctx context.Context, cfg *config.ServerConfig, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+	br, err := backup.NewReader(f, cfg.BackupPassphrase)
+	if err != nil {
+		return err
+	}
+	m := br.Manifest()
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	backups, closeStorage, err := openBackupStorage(ctx, cfg, &m)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	summary, err := backups.Restore(ctx, f, cfg.BackupPassphrase)
+	if err != nil {
+		return err
+	}
+	printBackupSummary(os.Stderr, summary)
+
+	auditStorage, closeAudit, err := openAuditStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeAudit()
+	n, lastHash, err := exportAudit(ctx, auditStorage, io.Discard)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Audit log of %d records verified, latest hash %s\n", n, lastHash)
+	return nil
+}
+
+// printBackupSummary prints the number of rows of each table and of values of a backup.
+func printBackupSummary(w io.Writer, summary backup.Summary) {
+	tables := make([]string, 0, len(summary.Rows))
+	for table := range summary.Rows {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Fprintf(w, "%s: %d rows\n", table, summary.Rows[table])
+	}
+	fmt.Fprintf(w, "%d values, %d bytes\n", summary.Values, summary.Bytes)
+}
+
+// openBackupStorage connects to the database of the configuration and opens its blob store.
+// If the manifest of a backup to restore is given, an empty PostgreSQL database is migrated to its schema version.
+// The returned function closes the connection.
+func openBackupStorage(ctx context.Context, cfg *config.ServerConfig, restore *backup.Manifest) (storage.BackupStorage, func(), error) {
+	backend, err := cfg.StorageBackend()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch backend {
+	case "postgres":
+		if restore != nil {
+			if err = migrateTo(ctx, cfg, restore.Schema); err != nil {
+				return nil, nil, err
+			}
+		}
+		poolConfig, err := cfg.PoolConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		var opts []postgres.Option
+		blobs, err := cfg.OpenBlobStore(ctx)
+		if err != nil {
+			pool.Close()
+			return nil, nil, fmt.Errorf("failed to open blob store: %w", err)
+		}
+		if blobs != nil {
+			opts = append(opts, postgres.WithBlobStore(blobs))
+		}
+		return postgres.NewBackupStorage(pool, opts...), pool.Close, nil
+	case "sqlite":
+		db, err := sqlite.Open(ctx, cfg.DatabaseURI)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sqlite.NewBackupStorage(db), func() { db.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("backup is only supported with a database, not with %s storage", backend)
+	}
+}
+
+// migrateTo applies the migrations up to the version to the PostgreSQL database of the configuration.
+func migrateTo(ctx context.Context, cfg *config.ServerConfig, version int64) error {
+	db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	migrator, err := postgres.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	_, err = migrator.UpTo(ctx, version)
+	return err
+}
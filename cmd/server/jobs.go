@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Names of the maintenance jobs run with the admin API.
+const (
+	jobLargeObjectGC   = "large-object-gc"  // Deletes the large objects no vault refers to, PostgreSQL only.
+	jobBlobGC          = "blob-gc"          // Deletes the blobs of replaced and deleted values, PostgreSQL with a blob store only.
+	jobVerifyIntegrity = "verify-integrity" // Verifies the audit log and, with PostgreSQL, the large objects of vaults.
+)
+
+// largeObjectGCResult is the result of the large-object-gc job.
+type largeObjectGCResult struct {
+	Deleted int64 `json:"deleted"` // Number of deleted large objects.
+}
+
+// blobGCResult is the result of the blob-gc job.
+type blobGCResult struct {
+	Deleted int64 `json:"deleted"` // Number of deleted blobs.
+}
+
+// blobGCInterval is how often the server runs the blob-gc job by itself.
+const blobGCInterval = time.Hour
+
+// integrityReport is the result of the verify-integrity job.
+type integrityReport struct {
+	OK                  bool     `json:"ok"`                              // Whether no problem was found.
+	AuditRecords        int      `json:"audit_records"`                   // Number of verified audit log records.
+	AuditLatestHash     string   `json:"audit_latest_hash"`               // Hash of the latest verified record.
+	AuditError          string   `json:"audit_error,omitempty"`           // Why the audit log chain is broken.
+	MissingLargeObjects []uint64 `json:"missing_large_objects,omitempty"` // IDs of vaults whose large object is missing.
+}
+
+// maintenanceJobs returns the maintenance jobs supported by the storages. vaults is nil unless PostgreSQL is used,
+// blobs reports whether it keeps values in a blob store.
+func maintenanceJobs(auditStorage storage.AuditStorage, vaults *postgres.VaultStorage, blobs bool) []handlers.MaintenanceJob {
+	jobs := []handlers.MaintenanceJob{{
+		Name: jobVerifyIntegrity,
+		Run: func(ctx context.Context) (any, error) {
+			var report integrityReport
+			var err error
+			report.AuditRecords, report.AuditLatestHash, err = storage.VerifyAuditLog(ctx, auditStorage, auditExportPageSize)
+			if errors.Is(err, storage.ErrAuditChainBroken) {
+				report.AuditError = err.Error()
+			} else if err != nil {
+				return nil, err
+			}
+			if vaults != nil {
+				report.MissingLargeObjects, err = vaults.VerifyLargeObjects(ctx)
+				if err != nil {
+					return nil, err
+				}
+			}
+			report.OK = report.AuditError == "" && len(report.MissingLargeObjects) == 0
+			return report, nil
+		},
+	}}
+	if vaults != nil {
+		jobs = append(jobs, handlers.MaintenanceJob{
+			Name: jobLargeObjectGC,
+			Run: func(ctx context.Context) (any, error) {
+				deleted, err := vaults.CollectLargeObjects(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return largeObjectGCResult{Deleted: deleted}, nil
+			},
+		})
+	}
+	if vaults != nil && blobs {
+		jobs = append(jobs, handlers.MaintenanceJob{
+			Name: jobBlobGC,
+			Run: func(ctx context.Context) (any, error) {
+				deleted, err := vaults.CollectBlobs(ctx, postgres.BlobDeletionGracePeriod)
+				if err != nil {
+					return nil, err
+				}
+				return blobGCResult{Deleted: deleted}, nil
+			},
+		})
+	}
+	return jobs
+}
+
+// collectBlobs runs the blob-gc job every blobGCInterval until the context is done.
+func collectBlobs(ctx context.Context, vaults *postgres.VaultStorage) {
+	ticker := time.NewTicker(blobGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := vaults.CollectBlobs(ctx, postgres.BlobDeletionGracePeriod)
+			if err != nil {
+				logger.Logger().Warn("Failed to collect blobs", zap.Error(err))
+				continue
+			}
+			logger.Logger().Info("Collected blobs", zap.Int64("deleted", deleted))
+		}
+	}
+}
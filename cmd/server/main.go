@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
@@ -13,11 +15,19 @@ import (
 	"github.com/andreevym/gophkeeper/internal/auth"
 	"github.com/andreevym/gophkeeper/internal/config"
 	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/metrics"
 	"github.com/andreevym/gophkeeper/internal/middleware"
+	"github.com/andreevym/gophkeeper/internal/oidc"
 	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
 	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/internal/storage/sqlite"
+	"github.com/andreevym/gophkeeper/internal/throttle"
+	"github.com/andreevym/gophkeeper/internal/tracing"
+	"github.com/andreevym/gophkeeper/migrations"
 	"github.com/andreevym/gophkeeper/pkg/logger"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
@@ -44,8 +54,6 @@ func printVersion() {
 }
 
 func main() {
-	printVersion()
-
 	cfg, err := config.NewServerConfig().Init()
 	if err != nil {
 		log.Fatalf("Error initializing server config: %v", err)
@@ -56,27 +64,215 @@ func main() {
 		log.Fatalf("Error initializing logger with level %s: %v", cfg.LogLevel, err)
 	}
 
-	db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
-	if err != nil {
-		logger.Logger().Fatal("Failed to connect to database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+	ctx := context.Background()
+
+	switch flag.Arg(0) {
+	case "migrate":
+		err = runMigrate(ctx, cfg, flag.Args()[1:])
+		if err != nil {
+			logger.Logger().Fatal("Failed to migrate database", zap.Error(err))
+		}
+		return
+	case "quota":
+		err = runQuota(ctx, cfg, flag.Args()[1:])
+		if err != nil {
+			logger.Logger().Fatal("Failed to manage quota", zap.Error(err))
+		}
+		return
+	case "audit":
+		err = runAudit(ctx, cfg, flag.Args()[1:])
+		if err != nil {
+			logger.Logger().Fatal("Failed to export audit log", zap.Error(err))
+		}
+		return
+	case "admin":
+		err = runAdmin(ctx, cfg, flag.Args()[1:])
+		if err != nil {
+			logger.Logger().Fatal("Failed to manage admin role", zap.Error(err))
+		}
+		return
+	case "backup":
+		err = runBackup(ctx, cfg, flag.Args()[1:])
+		if err != nil {
+			logger.Logger().Fatal("Failed to back up or restore database", zap.Error(err))
+		}
+		return
 	}
-	defer db.Close()
 
-	ctx := context.Background()
+	printVersion()
 
-	conn, err := pgx.Connect(ctx, cfg.DatabaseURI)
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{Exporter: cfg.TraceExporter, ServiceName: "gophkeeper-server"})
 	if err != nil {
-		logger.Logger().Fatal("Failed to connect to database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+		logger.Logger().Fatal("Failed to set up tracing", zap.Error(err))
 	}
-	defer conn.Close(ctx)
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Logger().Error("Failed to flush traces", zap.Error(err))
+		}
+	}()
 
-	err = postgres.Migration(ctx, "migrations", db)
+	var (
+		dbClient            handlers.DBClient
+		readinessChecks     []handlers.ReadinessCheck
+		vaultStorage        storage.VaultStorage
+		vaultValueStorage   storage.VaultValueStorage
+		postgresVaults      *postgres.VaultStorage
+		postgresBlobs       storage.BlobStore
+		quotaStorage        storage.QuotaStorage
+		auditStorage        storage.AuditStorage
+		userStorage         storage.UserStorage
+		tokenStorage        storage.TokenStorage
+		sessionStorage      storage.SessionStorage
+		srpHandshakeStorage storage.SRPHandshakeStorage
+		oidcStorage         storage.OIDCStorage
+		throttleStorage     interface {
+			storage.ThrottleStorage
+			storage.FailedSignInStorage
+		}
+	)
+	backend, err := cfg.StorageBackend()
 	if err != nil {
-		logger.Logger().Fatal("Failed to migrate database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+		logger.Logger().Fatal("Invalid storage configuration", zap.Error(err))
+	}
+	if backend != "postgres" && cfg.BlobStoreURI != "" {
+		logger.Logger().Fatal("Blob store is only supported with PostgreSQL", zap.String("storage", backend))
+	}
+	// Metrics are only collected if the admin listener serving them is enabled.
+	var serverMetrics *metrics.Metrics
+	if cfg.AdminAddress != "" {
+		serverMetrics = metrics.New()
+	}
+	defaultQuota, err := cfg.DefaultQuota()
+	if err != nil {
+		logger.Logger().Fatal("Invalid quota configuration", zap.Error(err))
+	}
+	switch backend {
+	case "postgres":
+		db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
+		if err != nil {
+			logger.Logger().Fatal("Failed to connect to database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+		}
+		defer db.Close()
+
+		poolConfig, err := cfg.PoolConfig()
+		if err != nil {
+			logger.Logger().Fatal("Invalid database pool configuration", zap.Error(err))
+		}
+		pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+		if err != nil {
+			logger.Logger().Fatal("Failed to connect to database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+		}
+		defer pool.Close()
+
+		migrator, err := postgres.NewMigrator(db, migrations.FS)
+		if err != nil {
+			logger.Logger().Fatal("Failed to read migrations", zap.Error(err))
+		}
+		_, err = migrator.Up(ctx)
+		if err != nil {
+			logger.Logger().Fatal("Failed to migrate database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+		}
+
+		storageOptions := []postgres.Option{postgres.WithDefaultQuota(defaultQuota)}
+		postgresBlobs, err = cfg.OpenBlobStore(ctx)
+		if err != nil {
+			logger.Logger().Fatal("Failed to open blob store", zap.String("blobStoreURI", cfg.BlobStoreURI), zap.Error(err))
+		}
+		if postgresBlobs != nil {
+			storageOptions = append(storageOptions, postgres.WithBlobStore(postgresBlobs))
+		}
+		if serverMetrics != nil {
+			storageOptions = append(storageOptions, postgres.WithLargeObjectObserver(serverMetrics))
+			if err := serverMetrics.RegisterDB("postgres", db.DB); err != nil {
+				logger.Logger().Fatal("Failed to register database metrics", zap.Error(err))
+			}
+			if err := serverMetrics.RegisterPool(pool); err != nil {
+				logger.Logger().Fatal("Failed to register database pool metrics", zap.Error(err))
+			}
+		}
+
+		readinessChecks = append(readinessChecks,
+			handlers.ReadinessCheck{Name: "database", Check: db.PingContext},
+			handlers.ReadinessCheck{Name: "vault_pool", Check: pool.Ping},
+			handlers.ReadinessCheck{Name: "migrations", Check: func(ctx context.Context) error {
+				pending, err := migrator.Pending(ctx)
+				if err != nil {
+					return err
+				}
+				if len(pending) > 0 {
+					return fmt.Errorf("%d migrations are pending, the oldest is %d_%s", len(pending), pending[0].Version, pending[0].Name)
+				}
+				return nil
+			}},
+		)
+
+		postgresVaults = postgres.NewVaultStorage(pool, storageOptions...)
+		if postgresBlobs != nil {
+			go collectBlobs(ctx, postgresVaults)
+		}
+		dbClient = db
+		vaultStorage = postgresVaults
+		quotaStorage = postgresVaults
+		userStorage = postgres.NewUserStorage(db)
+		tokenStorage = postgres.NewTokenStorage(db)
+		sessionStorage = postgres.NewSessionStorage(db)
+		srpHandshakeStorage = postgres.NewSRPHandshakeStorage(db)
+		oidcStorage = postgres.NewOIDCStorage(db)
+		throttleStorage = postgres.NewThrottleStorage(db)
+		auditStorage = postgres.NewAuditStorage(db)
+	case "sqlite":
+		db, err := sqlite.Open(ctx, cfg.DatabaseURI)
+		if err != nil {
+			logger.Logger().Fatal("Failed to open database", zap.String("databaseURI", cfg.DatabaseURI), zap.Error(err))
+		}
+		defer db.Close()
+
+		if serverMetrics != nil {
+			if err := serverMetrics.RegisterDB("sqlite", db.DB); err != nil {
+				logger.Logger().Fatal("Failed to register database metrics", zap.Error(err))
+			}
+		}
+
+		readinessChecks = append(readinessChecks, handlers.ReadinessCheck{Name: "database", Check: db.PingContext})
+
+		sqliteVaultStorage := sqlite.NewVaultStorage(db, sqlite.WithDefaultQuota(defaultQuota))
+		dbClient = db
+		vaultStorage = sqliteVaultStorage
+		vaultValueStorage = sqliteVaultStorage
+		quotaStorage = sqliteVaultStorage
+		userStorage = sqlite.NewUserStorage(db)
+		tokenStorage = sqlite.NewTokenStorage(db)
+		sessionStorage = sqlite.NewSessionStorage(db)
+		srpHandshakeStorage = sqlite.NewSRPHandshakeStorage(db)
+		oidcStorage = sqlite.NewOIDCStorage(db)
+		throttleStorage = sqlite.NewThrottleStorage(db)
+		auditStorage = sqlite.NewAuditStorage(db)
+	case "memory":
+		logger.Logger().Warn("Using in-memory storage, all data is lost when the server stops")
+		memoryVaultStorage := memory.NewVaultStorage(memory.WithDefaultQuota(defaultQuota))
+		memoryTokenStorage := memory.NewTokenStorage()
+		dbClient = memory.DB{}
+		vaultStorage = memoryVaultStorage
+		quotaStorage = memoryVaultStorage
+		userStorage = memory.NewUserStorage(memoryVaultStorage, memoryTokenStorage)
+		tokenStorage = memoryTokenStorage
+		sessionStorage = memory.NewSessionStorage()
+		srpHandshakeStorage = memory.NewSRPHandshakeStorage()
+		oidcStorage = memory.NewOIDCStorage()
+		throttleStorage = memory.NewThrottleStorage()
+		auditStorage = memory.NewAuditStorage()
+	}
+	switch cfg.SignInThrottleStorage {
+	case "", "database", "postgres":
+	case "memory":
+		throttleStorage = memory.NewThrottleStorage()
+	default:
+		logger.Logger().Fatal("Unknown sign-in throttle storage", zap.String("storage", cfg.SignInThrottleStorage))
 	}
 
-	vaultStorage := postgres.NewVaultStorage(db, conn)
-	userStorage := postgres.NewUserStorage(db)
+	if serverMetrics != nil {
+		vaultStorage = metrics.NewVaultStorage(vaultStorage, serverMetrics)
+	}
 
 	if cfg.JWTSecretKey == "" {
 		_, cfg.JWTSecretKey, err = auth.MakeJwtSecretKey()
@@ -90,16 +286,98 @@ func main() {
 		logger.Logger().Fatal("Failed to read JWT secret key", zap.Error(err))
 	}
 
-	authProvider := auth.NewAuthProvider(userStorage, jwtPrivateKey)
-	authMiddleware := auth.NewAuthMiddleware(authProvider, cfg.JWTSecretKey, handlers.AuthSignInURI, handlers.AuthSignUpURI)
-	hashService := pwd.NewHashService()
-	serviceHandlers := handlers.NewServiceHandlers(db, authProvider, vaultStorage, userStorage, hashService)
+	authProvider := auth.NewAuthProvider(userStorage, tokenStorage, jwtPrivateKey, auth.WithSessionStorage(sessionStorage))
+	authMiddleware := auth.NewAuthMiddleware(
+		authProvider,
+		cfg.JWTSecretKey,
+		handlers.AuthSignInURI,
+		handlers.AuthSignUpURI,
+		handlers.AuthSignInTwoFactorURI,
+		handlers.AuthSRPSignUpURI,
+		handlers.AuthSRPChallengeURI,
+		handlers.AuthSRPVerifyURI,
+		handlers.AuthOIDCDeviceURI,
+		handlers.AuthOIDCVerifyURI,
+		handlers.AuthOIDCApproveURI,
+		handlers.AuthOIDCCallbackURI,
+		handlers.AuthOIDCTokenURI,
+		handlers.HealthzURI,
+		handlers.ReadyzURI,
+	)
+	argon2Params, err := cfg.Argon2Params()
+	if err != nil {
+		logger.Logger().Fatal("Invalid password hashing parameters", zap.Error(err))
+	}
+	hashService := pwd.NewHashService(argon2Params)
+
+	signInLoginPolicy, err := cfg.SignInLoginPolicy()
+	if err != nil {
+		logger.Logger().Fatal("Invalid sign-in lockout parameters", zap.Error(err))
+	}
+	signInLimiter := throttle.NewLimiter(throttleStorage, signInLoginPolicy, throttle.DefaultIPPolicy)
+	trustedProxies, err := cfg.TrustedProxyPrefixes()
+	if err != nil {
+		logger.Logger().Fatal("Invalid trusted proxies", zap.Error(err))
+	}
 
-	router := handlers.NewRouter(
-		serviceHandlers,
+	handlerOptions := []handlers.Option{
+		handlers.WithTokenStorage(tokenStorage),
+		handlers.WithSignInLimiter(signInLimiter),
+		handlers.WithFailedSignInStorage(throttleStorage),
+		handlers.WithSessionStorage(sessionStorage),
+		handlers.WithSRPHandshakeStorage(srpHandshakeStorage),
+		handlers.WithQuotaStorage(quotaStorage),
+		handlers.WithAuditStorage(auditStorage),
+		handlers.WithTrustedProxies(trustedProxies...),
+		handlers.WithMaintenanceJobs(maintenanceJobs(auditStorage, postgresVaults, postgresBlobs != nil)...),
+		handlers.WithReadinessChecks(append(readinessChecks, handlers.ReadinessCheck{
+			Name: "signing_key",
+			Check: func(context.Context) error {
+				return authProvider.CheckSigningKey()
+			},
+		})...),
+	}
+	if serverMetrics != nil {
+		handlerOptions = append(handlerOptions, handlers.WithAuthObserver(serverMetrics))
+	}
+	if vaultValueStorage != nil {
+		handlerOptions = append(handlerOptions, handlers.WithVaultValueStorage(vaultValueStorage))
+	}
+
+	oidcConfig, oidcEnabled, err := cfg.OIDCConfig()
+	if err != nil {
+		logger.Logger().Fatal("Invalid OIDC configuration", zap.Error(err))
+	}
+	if oidcEnabled {
+		oidcProvider, err := oidc.NewProvider(ctx, oidcConfig)
+		if err != nil {
+			logger.Logger().Fatal("Failed to discover OIDC provider", zap.String("issuer", oidcConfig.Issuer), zap.Error(err))
+		}
+		// The verification page is served next to the callback, whose public URL is configured.
+		verificationURL, err := url.Parse(cfg.OIDCRedirectURL)
+		if err != nil {
+			logger.Logger().Fatal("Invalid OIDC redirect URL", zap.String("url", cfg.OIDCRedirectURL), zap.Error(err))
+		}
+		handlerOptions = append(handlerOptions, handlers.WithOIDC(handlers.OIDCConfig{
+			Provider:        oidcProvider,
+			Storage:         oidcStorage,
+			LoginClaim:      cfg.OIDCLoginClaim,
+			AutoProvision:   cfg.OIDCAutoProvision,
+			VerificationURL: verificationURL.ResolveReference(&url.URL{Path: "verify"}).String(),
+		}))
+	}
+
+	serviceHandlers := handlers.NewServiceHandlers(dbClient, authProvider, vaultStorage, userStorage, hashService, handlerOptions...)
+
+	routerMiddlewares := []func(http.Handler) http.Handler{
+		tracing.Middleware,
 		authMiddleware.WithAuthentication,
 		middleware.WithRequestLoggerMiddleware,
-	)
+	}
+	if serverMetrics != nil {
+		routerMiddlewares = append([]func(http.Handler) http.Handler{serverMetrics.Middleware}, routerMiddlewares...)
+	}
+	router := handlers.NewRouter(serviceHandlers, routerMiddlewares...)
 
 	logger.Logger().Info("Server listening", zap.String("addr", cfg.Address))
 
@@ -112,11 +390,30 @@ func main() {
 		}
 	}()
 
+	var adminServer *http.Server
+	if serverMetrics != nil {
+		adminRouter := http.NewServeMux()
+		adminRouter.Handle("/metrics", serverMetrics.Handler())
+		adminServer = &http.Server{Addr: cfg.AdminAddress, Handler: adminRouter}
+		go func() {
+			defer logger.Logger().Info("Admin server stopped gracefully")
+			logger.Logger().Info("Listening admin server", zap.String("address", cfg.AdminAddress))
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Logger().Fatal("Admin server listen failed", zap.Error(err))
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	for {
 		select {
 		case <-quit:
+			// Load balancers see the server as not ready and stop sending new requests before the listener closes.
+			serviceHandlers.Drain()
+			logger.Logger().Info("Draining server...", zap.Duration("delay", cfg.ShutdownDrainDelay))
+			time.Sleep(cfg.ShutdownDrainDelay)
+
 			logger.Logger().Info("Shutting down server...")
 			ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 			defer cancel()
@@ -124,6 +421,11 @@ func main() {
 			if err := httpServer.Shutdown(ctx); err != nil {
 				logger.Logger().Fatal("Server shutdown failed", zap.Error(err))
 			}
+			if adminServer != nil {
+				if err := adminServer.Shutdown(ctx); err != nil {
+					logger.Logger().Fatal("Admin server shutdown failed", zap.Error(err))
+				}
+			}
 			return
 		case <-ctx.Done():
 			logger.Logger().Info("Server context done")
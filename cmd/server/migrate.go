@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/config"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/migrations"
+	"github.com/jmoiron/sqlx"
+)
+
+const migrateUsage = "usage: server [flags] migrate up | down [steps] | status"
+
+// runMigrate runs the migrate subcommand on the PostgreSQL database of the configuration:
+// "up" applies all pending migrations, "down" rolls back the latest one or the given number of migrations,
+// and "status" lists the migrations.
+func runMigrate(ctx context.Context, cfg *config.ServerConfig, args []string) error {
+	if len(args) == 0 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		return errors.New(migrateUsage)
+	}
+	backend, err := cfg.StorageBackend()
+	if err != nil {
+		return err
+	}
+	if backend != "postgres" {
+		return fmt.Errorf("migrate is only supported with PostgreSQL, %s is migrated on start", backend)
+	}
+
+	db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	migrator, err := postgres.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migrations\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 2 {
+			return errors.New(migrateUsage)
+		}
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps '%s'", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %d migrations\n", rolledBack)
+	case "status":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		states, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.AppliedAt != nil {
+				appliedAt = state.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", state.Version, state.Name, appliedAt)
+		}
+		return w.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/andreevym/gophkeeper/internal/config"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/internal/storage/sqlite"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jmoiron/sqlx"
+)
+
+const quotaUsage = "usage: server [flags] quota <login> [set <max_bytes> <max_entries> | reset]"
+
+// runQuota runs the quota subcommand on the database of the configuration: "quota <login>" prints the storage
+// usage and the quota of the user, "set" overrides the default quota for the user, 0 meaning unlimited,
+// and "reset" applies the default quota to the user again.
+func runQuota(ctx context.Context, cfg *config.ServerConfig, args []string) error {
+	var q storage.Quota
+	switch {
+	case len(args) == 1:
+	case len(args) == 2 && args[1] == "reset":
+	case len(args) == 4 && args[1] == "set":
+		maxBytes, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || maxBytes < 0 {
+			return fmt.Errorf("invalid max bytes '%s'", args[2])
+		}
+		maxEntries, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil || maxEntries < 0 {
+			return fmt.Errorf("invalid max entries '%s'", args[3])
+		}
+		q = storage.Quota{MaxBytes: maxBytes, MaxEntries: maxEntries}
+	default:
+		return errors.New(quotaUsage)
+	}
+
+	userStorage, quotaStorage, closeStorage, err := openQuotaStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	user, err := userStorage.GetUserByLogin(ctx, storage.NormalizeLogin(args[0]))
+	if err != nil {
+		return fmt.Errorf("failed to get user %s: %w", args[0], err)
+	}
+
+	switch {
+	case len(args) == 2:
+		err = quotaStorage.DeleteQuota(ctx, user.ID)
+	case len(args) == 4:
+		err = quotaStorage.SetQuota(ctx, user.ID, q)
+	}
+	if err != nil {
+		return err
+	}
+
+	usage, err := quotaStorage.GetUsage(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	q, err = quotaStorage.GetQuota(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User:    %s (id %d)\n", user.Login, user.ID)
+	fmt.Printf("Entries: %d of %s\n", usage.Entries, formatLimit(q.MaxEntries))
+	fmt.Printf("Bytes:   %d of %s\n", usage.Bytes, formatLimit(q.MaxBytes))
+	return nil
+}
+
+// openQuotaStorage connects to the database of the configuration. The returned function closes the connections.
+func openQuotaStorage(ctx context.Context, cfg *config.ServerConfig) (storage.UserStorage, storage.QuotaStorage, func(), error) {
+	backend, err := cfg.StorageBackend()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defaultQuota, err := cfg.DefaultQuota()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	switch backend {
+	case "postgres":
+		db, err := sqlx.Connect("postgres", cfg.DatabaseURI)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		poolConfig, err := cfg.PoolConfig()
+		if err != nil {
+			db.Close()
+			return nil, nil, nil, err
+		}
+		pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+		if err != nil {
+			db.Close()
+			return nil, nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		closeStorage := func() {
+			pool.Close()
+			db.Close()
+		}
+		return postgres.NewUserStorage(db), postgres.NewVaultStorage(pool, postgres.WithDefaultQuota(defaultQuota)), closeStorage, nil
+	case "sqlite":
+		db, err := sqlite.Open(ctx, cfg.DatabaseURI)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		closeStorage := func() { db.Close() }
+		return sqlite.NewUserStorage(db), sqlite.NewVaultStorage(db, sqlite.WithDefaultQuota(defaultQuota)), closeStorage, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("quota is only supported with a database, not with %s storage", backend)
+	}
+}
+
+// formatLimit formats a limit of a quota, where zero means unlimited.
+func formatLimit(limit int64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
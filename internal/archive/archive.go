@@ -0,0 +1,580 @@
+// Package archive implements the encrypted archives vaults are exported to and imported from.
+//
+// An archive is a gzip compressed tar stream holding a manifest followed by the metadata and the value of
+// every entry. The stream is encrypted with AES-256-GCM in chunks of 64 KiB, so that archives of any size
+// are written and read without holding them in memory, under a key derived from a passphrase with Argon2id.
+// The cost parameters and the salt of the key derivation are recorded in the header of the archive, which
+// is authenticated together with every chunk, so an archive can be read by any server knowing the passphrase.
+// Encrypt and Decrypt expose the encryption alone, for other streams such as the backups of the server.
+//
+// Deriving the key is deliberately expensive. Readers of untrusted archives bound its cost with WithMaxKDF,
+// and DeriveKey lets them read the same archive repeatedly while deriving the key only once.
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// Version is the version of the archive format written by Writer.
+	Version = 1
+	// MaxValueSize is the largest value of an entry Reader accepts, unless changed with WithMaxValueSize.
+	MaxValueSize = 256 << 20
+
+	// magic starts every archive.
+	magic = "GOPHKEEPER-ARCHIVE"
+	// chunkSize is the size of the plain text chunks the stream is sealed in.
+	chunkSize = 64 * 1024
+	// saltSize is the size of the random salt of the key derivation in bytes.
+	saltSize = 16
+	// noncePrefixSize is the size of the random part of the chunk nonces, followed by a 4 bytes counter
+	// and a byte telling the last chunk apart, so that a truncated archive is detected.
+	noncePrefixSize = 7
+	// headerSize is the size of the header: magic, version, Argon2id memory, iterations and parallelism,
+	// salt and nonce prefix.
+	headerSize = len(magic) + 1 + 4 + 4 + 1 + saltSize + noncePrefixSize
+
+	manifestName = "manifest.json"
+	entriesDir   = "entries"
+)
+
+// KDF holds the cost parameters of the Argon2id key derivation.
+type KDF struct {
+	Memory      uint32 // Memory in KiB.
+	Iterations  uint32 // Number of passes over the memory.
+	Parallelism uint8  // Number of threads.
+}
+
+// DefaultKDF are the parameters Writer derives keys with.
+var DefaultKDF = KDF{Memory: 64 * 1024, Iterations: 3, Parallelism: 4}
+
+// maxKDF bounds the parameters Reader accepts unless changed with WithMaxKDF,
+// so that a crafted archive can't exhaust the memory of the reader.
+var maxKDF = KDF{Memory: 1024 * 1024, Iterations: 16, Parallelism: 16}
+
+// exceeds reports whether any of the parameters is zero or larger than the one of max.
+func (k KDF) exceeds(max KDF) bool {
+	return k.Memory == 0 || k.Memory > max.Memory ||
+		k.Iterations == 0 || k.Iterations > max.Iterations ||
+		k.Parallelism == 0 || k.Parallelism > max.Parallelism
+}
+
+var (
+	// ErrFormat is returned for streams which are not archives, or archives of an unsupported version.
+	ErrFormat = errors.New("not a vault archive")
+	// ErrPassphrase is returned if the archive can't be decrypted, which happens for a wrong passphrase
+	// and for an archive damaged right from its beginning alike.
+	ErrPassphrase = errors.New("wrong passphrase or damaged archive")
+	// ErrDamaged is returned if a part of the archive fails to decrypt or to parse.
+	ErrDamaged = errors.New("damaged archive")
+	// ErrValueTooLarge is returned for an entry with a value larger than the limit of the Reader.
+	ErrValueTooLarge = errors.New("archived value too large")
+)
+
+// ReaderOption changes the limits of reading archives.
+type ReaderOption func(*readerConfig)
+
+type readerConfig struct {
+	maxKDF       KDF
+	maxValueSize int64
+}
+
+func newReaderConfig(opts []ReaderOption) readerConfig {
+	c := readerConfig{maxKDF: maxKDF, maxValueSize: MaxValueSize}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithMaxKDF rejects archives whose key derivation is more expensive than kdf with ErrFormat, before the key
+// is derived. Servers reading archives of their users should accept no more than DefaultKDF.
+func WithMaxKDF(kdf KDF) ReaderOption {
+	return func(c *readerConfig) {
+		c.maxKDF = kdf
+	}
+}
+
+// WithMaxValueSize rejects entries with values larger than size bytes with ErrValueTooLarge,
+// instead of MaxValueSize. Values are held in memory while they are read.
+func WithMaxValueSize(size int64) ReaderOption {
+	return func(c *readerConfig) {
+		c.maxValueSize = size
+	}
+}
+
+// Key is the key of an archive derived from its passphrase by DeriveKey.
+type Key struct {
+	header []byte
+	aead   cipher.AEAD
+}
+
+// DeriveKey reads the header of an archive from r and derives the key of the archive from the passphrase,
+// so that the archive can be read repeatedly with NewReaderWithKey without deriving the key again.
+// Only WithMaxKDF of the options applies. Returns ErrFormat if r is not an archive or its key derivation
+// exceeds the limit. A wrong passphrase is only detected when the archive is read.
+func DeriveKey(r io.Reader, passphrase string, opts ...ReaderOption) (*Key, error) {
+	c := newReaderConfig(opts)
+	header, kdf, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if kdf.exceeds(c.maxKDF) {
+		return nil, fmt.Errorf("%w: key derivation parameters out of range", ErrFormat)
+	}
+	aead, err := newAEAD(passphrase, header, kdf)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{header: header, aead: aead}, nil
+}
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version   int       `json:"version"`    // Version of the archive format.
+	Login     string    `json:"login"`      // Login of the user the vaults were exported from.
+	CreatedAt time.Time `json:"created_at"` // Time the archive was created.
+}
+
+// Entry is a vault entry in an archive.
+type Entry struct {
+	ID    uint64 `json:"id"`   // ID of the vault on the server it was exported from.
+	Key   string `json:"key"`  // Key of the vault.
+	Size  int64  `json:"size"` // Size of the value in bytes.
+	Value []byte `json:"-"`    // Value of the vault, stored next to the metadata.
+}
+
+// Writer writes an encrypted archive.
+type Writer struct {
+	enc *encryptWriter
+	gz  *gzip.Writer
+	tw  *tar.Writer
+}
+
+// NewWriter starts an archive written to w, encrypted with the passphrase, and writes its manifest.
+// The Version of the manifest is set by the Writer.
+// Returns the Writer, which must be closed to complete the archive, and an error if any.
+func NewWriter(w io.Writer, passphrase string, m Manifest) (*Writer, error) {
+	enc, err := newEncryptWriter(w, passphrase, DefaultKDF)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(enc)
+	aw := &Writer{enc: enc, gz: gz, tw: tar.NewWriter(gz)}
+
+	m.Version = Version
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err = aw.writeFile(manifestName, manifest, m.CreatedAt); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// WriteEntry adds an entry to the archive. The Size of the entry is set from its value.
+func (w *Writer) WriteEntry(e Entry) error {
+	e.Size = int64(len(e.Value))
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry %d: %w", e.ID, err)
+	}
+	name := path.Join(entriesDir, strconv.FormatUint(e.ID, 10))
+	if err = w.writeFile(name+".json", meta, time.Time{}); err != nil {
+		return err
+	}
+	return w.writeFile(name+".bin", e.Value, time.Time{})
+}
+
+// Close completes the archive. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+	if err := w.gz.Close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+	return w.enc.Close()
+}
+
+func (w *Writer) writeFile(name string, data []byte, modTime time.Time) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o600,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err = w.tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Reader reads an encrypted archive.
+type Reader struct {
+	gz           *gzip.Reader
+	tr           *tar.Reader
+	manifest     Manifest
+	maxValueSize int64
+}
+
+// NewReader starts reading an archive from r, decrypting it with the passphrase, and reads its manifest.
+// Returns ErrFormat if r is not an archive and ErrPassphrase if the passphrase is wrong.
+func NewReader(r io.Reader, passphrase string, opts ...ReaderOption) (*Reader, error) {
+	key, err := DeriveKey(r, passphrase, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(r, key, opts)
+}
+
+// NewReaderWithKey starts reading an archive from r with the key DeriveKey derived from the same archive,
+// and reads its manifest. Returns ErrFormat if r is not that archive and ErrPassphrase if the passphrase
+// the key was derived from is wrong.
+func NewReaderWithKey(r io.Reader, key *Key, opts ...ReaderOption) (*Reader, error) {
+	header, _, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header, key.header) {
+		return nil, fmt.Errorf("%w: the key belongs to another archive", ErrFormat)
+	}
+	return newReader(r, key, opts)
+}
+
+// newReader reads the manifest of the archive from r, positioned after the header.
+func newReader(r io.Reader, key *Key, opts []ReaderOption) (*Reader, error) {
+	gz, err := gzip.NewReader(newDecryptReader(r, key))
+	if err != nil {
+		return nil, damaged(err)
+	}
+	ar := &Reader{gz: gz, tr: tar.NewReader(gz), maxValueSize: newReaderConfig(opts).maxValueSize}
+
+	name, manifest, err := ar.readFile(1 << 20)
+	if err != nil {
+		return nil, damaged(err)
+	}
+	if name != manifestName {
+		return nil, fmt.Errorf("%w: unexpected %s", ErrDamaged, name)
+	}
+	if err = json.Unmarshal(manifest, &ar.manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDamaged, err)
+	}
+	if ar.manifest.Version != Version {
+		return nil, fmt.Errorf("%w: version %d", ErrFormat, ar.manifest.Version)
+	}
+	return ar, nil
+}
+
+// Manifest returns the manifest of the archive.
+func (r *Reader) Manifest() Manifest {
+	return r.manifest
+}
+
+// Next reads the next entry of the archive.
+// Returns io.EOF after the last entry, which also verifies that the archive is complete.
+func (r *Reader) Next() (Entry, error) {
+	name, meta, err := r.readFile(1 << 20)
+	if errors.Is(err, io.EOF) {
+		// Reading past the end of the tar stream checks the gzip checksum and decrypts the last chunk.
+		if _, err = io.Copy(io.Discard, r.gz); err != nil {
+			return Entry{}, damaged(err)
+		}
+		return Entry{}, io.EOF
+	}
+	if err != nil {
+		return Entry{}, damaged(err)
+	}
+	base, ok := strings.CutSuffix(name, ".json")
+	if !ok || path.Dir(name) != entriesDir {
+		return Entry{}, fmt.Errorf("%w: unexpected %s", ErrDamaged, name)
+	}
+	var e Entry
+	if err = json.Unmarshal(meta, &e); err != nil {
+		return Entry{}, fmt.Errorf("%w: %v", ErrDamaged, err)
+	}
+
+	if e.Size > r.maxValueSize {
+		return Entry{}, fmt.Errorf("%w: entry %d has %d bytes", ErrValueTooLarge, e.ID, e.Size)
+	}
+	name, e.Value, err = r.readFile(r.maxValueSize)
+	if err != nil {
+		return Entry{}, damaged(err)
+	}
+	if name != base+".bin" || int64(len(e.Value)) != e.Size {
+		return Entry{}, fmt.Errorf("%w: unexpected %s", ErrDamaged, name)
+	}
+	return e, nil
+}
+
+// IsArchive reports whether data, the beginning of a file, is the beginning of an archive.
+func IsArchive(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// Verify reads the whole archive from r, decrypting it with the passphrase.
+// Returns the manifest and the number of entries of the archive, or the first error found in it.
+func Verify(r io.Reader, passphrase string) (Manifest, int, error) {
+	ar, err := NewReader(r, passphrase)
+	if err != nil {
+		return Manifest{}, 0, err
+	}
+	for n := 0; ; n++ {
+		_, err = ar.Next()
+		if errors.Is(err, io.EOF) {
+			return ar.Manifest(), n, nil
+		}
+		if err != nil {
+			return ar.Manifest(), n, err
+		}
+	}
+}
+
+// Encrypt returns a writer encrypting the stream written to it to w with the passphrase, in the same format
+// as archives. The writer must be closed to seal the last chunk, which doesn't close w.
+func Encrypt(w io.Writer, passphrase string) (io.WriteCloser, error) {
+	return newEncryptWriter(w, passphrase, DefaultKDF)
+}
+
+// Decrypt returns a reader decrypting the stream read from r with the passphrase, or ErrFormat if r is not
+// encrypted by Encrypt. Reading returns ErrPassphrase if the first chunk fails to decrypt, ErrDamaged for a later
+// one or a truncated stream, and io.EOF only after the last chunk was authenticated.
+func Decrypt(r io.Reader, passphrase string) (io.Reader, error) {
+	key, err := DeriveKey(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return newDecryptReader(r, key), nil
+}
+
+// readFile reads the next file of the tar stream, which must not be larger than limit.
+func (r *Reader) readFile(limit int64) (string, []byte, error) {
+	h, err := r.tr.Next()
+	if err != nil {
+		return "", nil, err
+	}
+	if h.Typeflag != tar.TypeReg || h.Size < 0 || h.Size > limit {
+		return "", nil, fmt.Errorf("unexpected %s of %d bytes", h.Name, h.Size)
+	}
+	data := make([]byte, h.Size)
+	if _, err = io.ReadFull(r.tr, data); err != nil {
+		return "", nil, err
+	}
+	return h.Name, data, nil
+}
+
+// damaged wraps an error of reading the archive into ErrDamaged, unless it is already an error of this package.
+func damaged(err error) error {
+	if errors.Is(err, ErrPassphrase) || errors.Is(err, ErrDamaged) {
+		return err
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %v", ErrDamaged, err)
+}
+
+// encryptWriter seals the stream written to it in chunks.
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	nonce  []byte
+	buf    []byte
+	count  uint32
+}
+
+func newEncryptWriter(w io.Writer, passphrase string, kdf KDF) (*encryptWriter, error) {
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, Version)
+	header = binary.BigEndian.AppendUint32(header, kdf.Memory)
+	header = binary.BigEndian.AppendUint32(header, kdf.Iterations)
+	header = append(header, kdf.Parallelism)
+	random := make([]byte, saltSize+noncePrefixSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("read random salt: %w", err)
+	}
+	header = append(header, random...)
+
+	aead, err := newAEAD(passphrase, header, kdf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write archive header: %w", err)
+	}
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		nonce:  make([]byte, aead.NonceSize()),
+		buf:    make([]byte, 0, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, as the last chunk is sealed apart on Close.
+		if len(e.buf) == chunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the last chunk, which may be empty.
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	chunkNonce(e.nonce, e.header, e.count, last)
+	sealed := e.aead.Seal(e.buf[:0], e.nonce, e.buf, e.header)
+	if _, err := e.w.Write(sealed); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	e.buf = e.buf[:0]
+	e.count++
+	return nil
+}
+
+// decryptReader opens the chunks of the stream read from it.
+type decryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	nonce  []byte
+	chunk  []byte
+	plain  []byte
+	count  uint32
+	done   bool
+}
+
+// readHeader reads the header of an archive and the key derivation parameters recorded in it.
+func readHeader(r io.Reader) ([]byte, KDF, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, KDF{}, ErrFormat
+	}
+	if !bytes.HasPrefix(header, []byte(magic)) {
+		return nil, KDF{}, ErrFormat
+	}
+	rest := header[len(magic):]
+	if rest[0] != Version {
+		return nil, KDF{}, fmt.Errorf("%w: version %d", ErrFormat, rest[0])
+	}
+	kdf := KDF{
+		Memory:      binary.BigEndian.Uint32(rest[1:5]),
+		Iterations:  binary.BigEndian.Uint32(rest[5:9]),
+		Parallelism: rest[9],
+	}
+	return header, kdf, nil
+}
+
+// newDecryptReader decrypts the chunks read from r, positioned after the header, with the key.
+func newDecryptReader(r io.Reader, key *Key) *decryptReader {
+	return &decryptReader{
+		r:      bufio.NewReaderSize(r, chunkSize+key.aead.Overhead()),
+		aead:   key.aead,
+		header: key.header,
+		nonce:  make([]byte, key.aead.NonceSize()),
+		chunk:  make([]byte, chunkSize+key.aead.Overhead()),
+	}
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	last := false
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return fmt.Errorf("failed to read archive: %w", err)
+	default:
+		if _, err = d.r.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		}
+	}
+
+	chunkNonce(d.nonce, d.header, d.count, last)
+	plain, err := d.aead.Open(d.chunk[:0], d.nonce, d.chunk[:n], d.header)
+	if err != nil {
+		if d.count == 0 {
+			return ErrPassphrase
+		}
+		return fmt.Errorf("%w: chunk %d fails to decrypt", ErrDamaged, d.count)
+	}
+	d.plain = plain
+	d.count++
+	d.done = last
+	return nil
+}
+
+// newAEAD derives the key from the passphrase and the salt in the header.
+func newAEAD(passphrase string, header []byte, kdf KDF) (cipher.AEAD, error) {
+	salt := header[headerSize-saltSize-noncePrefixSize : headerSize-noncePrefixSize]
+	key := argon2.IDKey([]byte(passphrase), salt, kdf.Iterations, kdf.Memory, kdf.Parallelism, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// chunkNonce sets nonce to the nonce prefix of the header, the chunk counter and the last chunk flag.
+func chunkNonce(nonce, header []byte, count uint32, last bool) {
+	copy(nonce, header[headerSize-noncePrefixSize:])
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], count)
+	nonce[len(nonce)-1] = 0
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+}
@@ -0,0 +1,156 @@
+package archive_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/archive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeArchive(t *testing.T, passphrase string, entries ...archive.Entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := archive.NewWriter(&buf, passphrase, archive.Manifest{Login: "alice", CreatedAt: time.Unix(1700000000, 0).UTC()})
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NoError(t, w.WriteEntry(e))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func readArchive(data []byte, passphrase string) (archive.Manifest, []archive.Entry, error) {
+	r, err := archive.NewReader(bytes.NewReader(data), passphrase)
+	if err != nil {
+		return archive.Manifest{}, nil, err
+	}
+	var entries []archive.Entry
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return r.Manifest(), entries, nil
+		}
+		if err != nil {
+			return r.Manifest(), entries, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	large := make([]byte, 300*1024)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+	entries := []archive.Entry{
+		{ID: 3, Key: "card/visa", Value: []byte(`{"number":"4111"}`)},
+		{ID: 7, Key: "binary/photo.jpg", Value: large},
+		{ID: 9, Key: "empty"},
+	}
+	data := writeArchive(t, "correct horse", entries...)
+	assert.NotContains(t, string(data), "card/visa")
+
+	m, got, err := readArchive(data, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, archive.Manifest{Version: archive.Version, Login: "alice", CreatedAt: time.Unix(1700000000, 0).UTC()}, m)
+	require.Len(t, got, 3)
+	for i, e := range entries {
+		assert.Equal(t, e.ID, got[i].ID)
+		assert.Equal(t, e.Key, got[i].Key)
+		assert.Equal(t, int64(len(e.Value)), got[i].Size)
+		assert.True(t, bytes.Equal(e.Value, got[i].Value), "value of entry %d differs", e.ID)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	t.Parallel()
+	// Random data doesn't compress, so the archive spans several chunks.
+	large := make([]byte, 200*1024)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+	data := writeArchive(t, "secret", archive.Entry{ID: 1, Key: "k", Value: large})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := readArchive(data, "guess")
+		assert.ErrorIs(t, err, archive.ErrPassphrase)
+	})
+
+	t.Run("not an archive", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := readArchive([]byte("PK\x03\x04 some zip file"), "secret")
+		assert.ErrorIs(t, err, archive.ErrFormat)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		t.Parallel()
+		tampered := bytes.Clone(data)
+		tampered[len(tampered)/2] ^= 1
+		_, _, err := readArchive(tampered, "secret")
+		assert.ErrorIs(t, err, archive.ErrDamaged)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		t.Parallel()
+		// Cutting off the last chunk entirely leaves only valid chunks, which must still be detected.
+		// Chunks of 64 KiB and a 16 bytes tag follow a header of 51 bytes.
+		const header, chunk = 51, 64*1024 + 16
+		for _, size := range []int{len(data) - 1, len(data) - (len(data)-header)%chunk} {
+			_, _, err := readArchive(data[:size], "secret")
+			assert.ErrorIs(t, err, archive.ErrDamaged, size)
+		}
+	})
+}
+
+func TestReadLimits(t *testing.T) {
+	t.Parallel()
+	data := writeArchive(t, "secret", archive.Entry{ID: 1, Key: "k", Value: []byte("0123456789")})
+
+	t.Run("key derivation", func(t *testing.T) {
+		t.Parallel()
+		_, err := archive.NewReader(bytes.NewReader(data), "secret", archive.WithMaxKDF(archive.DefaultKDF))
+		require.NoError(t, err)
+
+		// The memory cost follows the magic and the version in the header.
+		costly := bytes.Clone(data)
+		binary.BigEndian.PutUint32(costly[len("GOPHKEEPER-ARCHIVE")+1:], 2*archive.DefaultKDF.Memory)
+		_, err = archive.DeriveKey(bytes.NewReader(costly), "secret", archive.WithMaxKDF(archive.DefaultKDF))
+		assert.ErrorIs(t, err, archive.ErrFormat)
+	})
+
+	t.Run("value size", func(t *testing.T) {
+		t.Parallel()
+		r, err := archive.NewReader(bytes.NewReader(data), "secret", archive.WithMaxValueSize(9))
+		require.NoError(t, err)
+		_, err = r.Next()
+		assert.ErrorIs(t, err, archive.ErrValueTooLarge)
+	})
+
+	t.Run("key reuse", func(t *testing.T) {
+		t.Parallel()
+		key, err := archive.DeriveKey(bytes.NewReader(data), "secret")
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			r, err := archive.NewReaderWithKey(bytes.NewReader(data), key)
+			require.NoError(t, err)
+			e, err := r.Next()
+			require.NoError(t, err)
+			assert.Equal(t, "0123456789", string(e.Value))
+		}
+
+		other := writeArchive(t, "secret")
+		_, err = archive.NewReaderWithKey(bytes.NewReader(other), key)
+		assert.ErrorIs(t, err, archive.ErrFormat)
+
+		key, err = archive.DeriveKey(bytes.NewReader(data), "guess")
+		require.NoError(t, err)
+		_, err = archive.NewReaderWithKey(bytes.NewReader(data), key)
+		assert.ErrorIs(t, err, archive.ErrPassphrase)
+	})
+}
@@ -8,31 +8,51 @@ import (
 	"strconv"
 
 	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/tracing"
 	"github.com/andreevym/gophkeeper/pkg/logger"
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 // Provider is a structure that handles authentication and authorization.
 // It uses a storage system for user data and an ECDSA private key for JWT signing and verification.
 type Provider struct {
-	userStorage   storage.UserStorage // Storage interface for user data operations
-	jwtPrivateKey *ecdsa.PrivateKey   // ECDSA private key for signing JWTs
+	userStorage    storage.UserStorage    // Storage interface for user data operations
+	tokenStorage   storage.TokenStorage   // Storage interface for personal access tokens
+	sessionStorage storage.SessionStorage // Storage interface for sign-in sessions, optional
+	jwtPrivateKey  *ecdsa.PrivateKey      // ECDSA private key for signing JWTs
 }
 
-// NewAuthProvider creates a new instance of Provider with the given user storage and JWT private key.
+// ProviderOption configures optional dependencies of Provider.
+type ProviderOption func(*Provider)
+
+// NewAuthProvider creates a new instance of Provider with the given storages and JWT private key.
 //
 // Parameters:
 //   - userStorage (storage.UserStorage): The storage interface for user data.
+//   - tokenStorage (storage.TokenStorage): The storage interface for personal access tokens.
 //   - jwtPrivateKey (*ecdsa.PrivateKey): The private key used for signing JWTs.
+//   - opts (...ProviderOption): Optional dependencies.
 //
 // Returns:
 //   - *Provider: A new Provider instance.
-func NewAuthProvider(userStorage storage.UserStorage, jwtPrivateKey *ecdsa.PrivateKey) *Provider {
-	return &Provider{
+func NewAuthProvider(
+	userStorage storage.UserStorage,
+	tokenStorage storage.TokenStorage,
+	jwtPrivateKey *ecdsa.PrivateKey,
+	opts ...ProviderOption,
+) *Provider {
+	p := &Provider{
 		userStorage:   userStorage,
+		tokenStorage:  tokenStorage,
 		jwtPrivateKey: jwtPrivateKey,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // ContextKey is a custom type for context keys used in the authentication process.
@@ -41,27 +61,71 @@ type ContextKey int
 const (
 	// UserIDContextKey is the context key used to store and retrieve user IDs in the context.
 	UserIDContextKey ContextKey = iota
+	// AccessTokenContextKey is the context key used to store the personal access token of the request.
+	AccessTokenContextKey
+	// SessionIDContextKey is the context key used to store the sign-in session ID of the request.
+	SessionIDContextKey
+)
+
+const (
+	// versionClaim holds the token version of the user at the time the JWT was issued.
+	versionClaim = "ver"
+	// sessionClaim holds the ID of the sign-in session the JWT belongs to.
+	sessionClaim = "sid"
 )
 
-// ErrAuthUnauthorized is an error returned when a user is unauthorized.
-var ErrAuthUnauthorized = errors.New("unauthorized")
+// Claims holds the values extracted from a sign-in JWT.
+type Claims struct {
+	UserID       uint64 // The ID of the signed-in user.
+	TokenVersion uint64 // The token version of the user when the token was issued.
+	SessionID    uint64 // The sign-in session, 0 for tokens issued without session tracking.
+}
+
+var (
+	// ErrAuthUnauthorized is an error returned when a user is unauthorized.
+	ErrAuthUnauthorized = errors.New("unauthorized")
+	// ErrTokenRevoked is returned for JWTs issued before the user invalidated all tokens.
+	ErrTokenRevoked = errors.New("token is revoked")
+	// ErrUserDisabled is returned for the tokens of users disabled by an administrator.
+	ErrUserDisabled = errors.New("user is disabled")
+)
 
-// CreateSession creates a new session for the user with the specified userID and stores it in the context.
+// CreateSession creates a new session for the user of a validated JWT and stores it in the context.
+// Tokens issued before the user's token version was incremented, e.g. by a password change, are rejected.
+// If session tracking is enabled, the token must belong to a session which is not revoked.
+// Users disabled by an administrator are rejected.
 //
 // Parameters:
 //   - ctx (context.Context): The context in which the session will be created.
-//   - userID (uint64): The ID of the user for whom the session is being created.
+//   - claims (Claims): The claims of the JWT the request was authenticated with.
 //
 // Returns:
-//   - context.Context: The context with the user ID added.
-//   - error: An error if the user cannot be retrieved or if there is an issue creating the session.
-func (p *Provider) CreateSession(ctx context.Context, userID uint64) (context.Context, error) {
-	_, err := p.userStorage.GetUser(ctx, userID)
+//   - context.Context: The context with the user ID and the session ID added.
+//   - error: An error if the user cannot be retrieved, if the token is revoked or if there is an issue creating the session.
+func (p *Provider) CreateSession(ctx context.Context, claims Claims) (_ context.Context, err error) {
+	spanCtx, span := tracer.Start(ctx, "auth.Provider.CreateSession", trace.WithAttributes(attribute.Int64("user.id", int64(claims.UserID))))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := p.userStorage.GetUser(spanCtx, claims.UserID)
 	if err != nil {
 		return ctx, fmt.Errorf("get user: %w", err)
 	}
+	if user.TokenVersion != claims.TokenVersion {
+		return ctx, ErrTokenRevoked
+	}
+	if user.Disabled {
+		return ctx, ErrUserDisabled
+	}
 
-	ctxWithValue := context.WithValue(ctx, UserIDContextKey, userID)
+	err = p.checkSession(spanCtx, claims)
+	if err != nil {
+		return ctx, err
+	}
+
+	ctxWithValue := context.WithValue(ctx, UserIDContextKey, claims.UserID)
+	if claims.SessionID != 0 {
+		ctxWithValue = context.WithValue(ctxWithValue, SessionIDContextKey, claims.SessionID)
+	}
 	return ctxWithValue, nil
 }
 
@@ -73,7 +137,10 @@ func (p *Provider) CreateSession(ctx context.Context, userID uint64) (context.Co
 // Returns:
 //   - storage.User: The user associated with the session.
 //   - error: An error if the user cannot be retrieved or if there is an issue accessing the session.
-func (p *Provider) GetUserFromSession(ctx context.Context) (storage.User, error) {
+func (p *Provider) GetUserFromSession(ctx context.Context) (_ storage.User, err error) {
+	ctx, span := tracer.Start(ctx, "auth.Provider.GetUserFromSession")
+	defer func() { tracing.End(span, err) }()
+
 	userID := ctx.Value(UserIDContextKey)
 	if userID == nil {
 		return storage.User{}, ErrAuthUnauthorized
@@ -86,54 +153,96 @@ func (p *Provider) GetUserFromSession(ctx context.Context) (storage.User, error)
 	return user, nil
 }
 
-// ValidateToken validates a JWT token and extracts the user ID from it.
+// ValidateToken validates a JWT token and extracts the user ID, the token version and the session ID from it.
 //
 // Parameters:
 //   - tokenString (string): The JWT token to be validated.
 //
 // Returns:
-//   - uint64: The user ID extracted from the token, or 0 if the token is invalid.
+//   - Claims: The claims extracted from the token. Tokens issued before token versions or sessions
+//     were introduced have a zero TokenVersion or SessionID.
 //   - error: An error if the token is invalid or if there is an issue parsing the token.
-func (p *Provider) ValidateToken(tokenString string) (uint64, error) {
+func (p *Provider) ValidateToken(tokenString string) (Claims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		return &p.jwtPrivateKey.PublicKey, nil
 	})
-	notFoundID := uint64(0)
 	if err != nil {
-		return notFoundID, fmt.Errorf("jwt parse: %w", err)
+		return Claims{}, fmt.Errorf("jwt parse: %w", err)
 	}
 
 	// Check if the token is valid
 	if !token.Valid {
-		return notFoundID, errors.New("token is not valid")
+		return Claims{}, errors.New("token is not valid")
 	}
 
 	// Extract the user ID from the token claims
 	mapClaims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return notFoundID, errors.New("invalid token claims")
+		return Claims{}, errors.New("invalid token claims")
+	}
+
+	// Tokens issued for an intermediate step, like the second sign-in factor, don't grant access
+	if _, ok := mapClaims[purposeClaim]; ok {
+		return Claims{}, errors.New("token is not an access token")
+	}
+
+	id, ok := mapClaims["userID"].(string)
+	if !ok {
+		return Claims{}, errors.New("invalid user ID claim")
 	}
-	id := mapClaims["userID"].(string)
 	userID, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
-		return notFoundID, fmt.Errorf("strconv.ParseInt, %s: invalid user ID in token: %w", id, err)
+		return Claims{}, fmt.Errorf("strconv.ParseInt, %s: invalid user ID in token: %w", id, err)
+	}
+
+	version, err := optionalUintClaim(mapClaims, versionClaim)
+	if err != nil {
+		return Claims{}, err
+	}
+	sessionID, err := optionalUintClaim(mapClaims, sessionClaim)
+	if err != nil {
+		return Claims{}, err
 	}
 
-	return userID, nil
+	return Claims{UserID: userID, TokenVersion: version, SessionID: sessionID}, nil
+}
+
+// optionalUintClaim parses a numeric string claim, a missing claim is 0.
+func optionalUintClaim(mapClaims jwt.MapClaims, name string) (uint64, error) {
+	v, ok := mapClaims[name]
+	if !ok {
+		return 0, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid %s claim", name)
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("strconv.ParseUint, %s: invalid %s claim: %w", s, name, err)
+	}
+	return n, nil
 }
 
-// GenerateToken generates a JWT token for a given user ID.
+// GenerateToken generates a JWT token for a given user and sign-in session.
+// The token carries the user's current token version, so that it can be revoked by incrementing it.
 //
 // Parameters:
-//   - userID (uint64): The ID of the user for whom the token is being generated.
+//   - user (storage.User): The user for whom the token is being generated.
+//   - sessionID (uint64): The ID of the sign-in session, 0 if sessions are not tracked.
 //
 // Returns:
 //   - string: The generated JWT token.
 //   - error: An error if token generation fails.
-func (p *Provider) GenerateToken(userID uint64) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodES256, &jwt.MapClaims{
-		"userID": strconv.FormatUint(userID, 10),
-	})
+func (p *Provider) GenerateToken(user storage.User, sessionID uint64) (string, error) {
+	claims := jwt.MapClaims{
+		"userID":     strconv.FormatUint(user.ID, 10),
+		versionClaim: strconv.FormatUint(user.TokenVersion, 10),
+	}
+	if sessionID != 0 {
+		claims[sessionClaim] = strconv.FormatUint(sessionID, 10)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, &claims)
 
 	t, err := token.SignedString(p.jwtPrivateKey)
 	if err != nil {
@@ -142,3 +251,22 @@ func (p *Provider) GenerateToken(userID uint64) (string, error) {
 	}
 	return t, nil
 }
+
+// CheckSigningKey signs a token with the JWT private key and validates it, to check that sign-ins can be completed.
+//
+// Returns:
+//   - error: An error if no key is configured or if tokens signed with the key cannot be validated.
+func (p *Provider) CheckSigningKey() error {
+	if p.jwtPrivateKey == nil {
+		return errors.New("no JWT signing key is configured")
+	}
+	token, err := p.GenerateToken(storage.User{}, 0)
+	if err != nil {
+		return err
+	}
+	_, err = p.ValidateToken(token)
+	if err != nil {
+		return fmt.Errorf("validate token signed with the key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// purposeClaim marks JWTs that are not access tokens.
+	purposeClaim = "purpose"
+	// mfaPurpose is the purpose of tokens issued between the password and the second factor check.
+	mfaPurpose = "mfa"
+	// MFATokenTTL is the time a user has to enter the second factor after the password was accepted.
+	MFATokenTTL = 5 * time.Minute
+)
+
+// GenerateMFAToken generates a short-lived JWT token proving that the user has passed the password check.
+// It is exchanged for an access token once the second factor is verified and is rejected by ValidateToken.
+//
+// Parameters:
+//   - userID (uint64): The ID of the user who passed the password check.
+//
+// Returns:
+//   - string: The generated JWT token.
+//   - error: An error if token generation fails.
+func (p *Provider) GenerateMFAToken(userID uint64) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, &jwt.MapClaims{
+		"userID":     strconv.FormatUint(userID, 10),
+		purposeClaim: mfaPurpose,
+		"exp":        jwt.NewNumericDate(time.Now().Add(MFATokenTTL)),
+	})
+
+	t, err := token.SignedString(p.jwtPrivateKey)
+	if err != nil {
+		logger.Logger().Error("failed to sign mfa token", zap.Error(err))
+		return "", fmt.Errorf("sign the token: %w", err)
+	}
+	return t, nil
+}
+
+// ValidateMFAToken validates a token generated by GenerateMFAToken and extracts the user ID from it.
+//
+// Parameters:
+//   - tokenString (string): The JWT token to be validated.
+//
+// Returns:
+//   - uint64: The user ID extracted from the token.
+//   - error: An error if the token is invalid, expired or not an MFA token.
+func (p *Provider) ValidateMFAToken(tokenString string) (uint64, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return &p.jwtPrivateKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, fmt.Errorf("jwt parse: %w", err)
+	}
+
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || mapClaims[purposeClaim] != mfaPurpose {
+		return 0, errors.New("token is not an mfa token")
+	}
+
+	id, ok := mapClaims["userID"].(string)
+	if !ok {
+		return 0, errors.New("invalid user ID claim")
+	}
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("strconv.ParseUint, %s: invalid user ID in token: %w", id, err)
+	}
+
+	return userID, nil
+}
@@ -1,13 +1,25 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/andreevym/gophkeeper/internal/tracing"
 	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// tracer starts the spans of the authentication of requests.
+var tracer = otel.Tracer("github.com/andreevym/gophkeeper/internal/auth")
+
+// errInvalidToken is the response to tokens which fail validation, the details are only logged.
+var errInvalidToken = errors.New("Invalid token")
+
 // Middleware provides HTTP middleware for authentication using JWT tokens.
 type Middleware struct {
 	authProvider         *Provider           // Provider for authentication and JWT handling
@@ -46,8 +58,8 @@ func NewAuthMiddleware(
 	}
 }
 
-// WithAuthentication returns an HTTP handler that performs authentication based on JWT tokens.
-// Requests to URIs in `allowUnauthorizedURI` are allowed without authentication.
+// WithAuthentication returns an HTTP handler that performs authentication based on JWT tokens
+// or personal access tokens. Requests to URIs in `allowUnauthorizedURI` are allowed without authentication.
 //
 // Parameters:
 //   - next (http.Handler): The next handler to call if authentication is successful.
@@ -56,8 +68,8 @@ func NewAuthMiddleware(
 //   - http.Handler: An HTTP handler with authentication middleware applied.
 func (m *Middleware) WithAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if the request URI is allowed without authentication
-		if _, ok := m.allowUnauthorizedURI[r.RequestURI]; ok {
+		// Check if the request path is allowed without authentication, the query string is ignored
+		if _, ok := m.allowUnauthorizedURI[r.URL.Path]; ok {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -70,21 +82,11 @@ func (m *Middleware) WithAuthentication(next http.Handler) http.Handler {
 		}
 
 		// Remove "Bearer " prefix to get the token string
-		tokenString := authHeader[len("Bearer "):]
-
-		// Validate the token and extract user ID
-		userID, err := m.authProvider.ValidateToken(tokenString)
-		if err != nil {
-			logger.Logger().Warn("jwtService.ValidateToken", zap.Error(err))
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Set the user ID from the token in the request context
-		ctx, err := m.authProvider.CreateSession(r.Context(), userID)
+		ctx, err := m.authenticate(r.Context(), tokenString)
 		if err != nil {
-			logger.Logger().Warn("create session", zap.Error(err))
-			http.Error(w, fmt.Sprintf("failed to create session: %v", err), http.StatusUnauthorized)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
@@ -92,3 +94,56 @@ func (m *Middleware) WithAuthentication(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// authenticate validates a JWT or a personal access token in the auth.Middleware span.
+// Returns the context with the session of the token, or an error to respond with.
+func (m *Middleware) authenticate(ctx context.Context, tokenString string) (context.Context, error) {
+	parent := trace.SpanFromContext(ctx)
+	ctx, span := tracer.Start(ctx, "auth.Middleware")
+	sessionCtx, err := m.authenticateToken(ctx, tokenString)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	// The handlers continue the span of the request, not the ended span of the middleware.
+	return trace.ContextWithSpan(sessionCtx, parent), nil
+}
+
+func (m *Middleware) authenticateToken(ctx context.Context, tokenString string) (context.Context, error) {
+	if IsAccessToken(tokenString) {
+		return m.accessTokenSession(ctx, tokenString)
+	}
+
+	// Validate the token and extract user ID
+	_, span := tracer.Start(ctx, "auth.Provider.ValidateToken")
+	claims, err := m.authProvider.ValidateToken(tokenString)
+	tracing.End(span, err)
+	if err != nil {
+		logger.Logger().Warn("jwtService.ValidateToken", zap.Error(err))
+		return nil, errInvalidToken
+	}
+
+	// Set the user ID from the token in the request context
+	ctx, err = m.authProvider.CreateSession(ctx, claims)
+	if err != nil {
+		logger.Logger().Warn("create session", zap.Error(err))
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return ctx, nil
+}
+
+// accessTokenSession authenticates the request with a personal access token.
+func (m *Middleware) accessTokenSession(ctx context.Context, tokenString string) (context.Context, error) {
+	t, err := m.authProvider.ValidateAccessToken(ctx, tokenString)
+	if err != nil {
+		logger.Logger().Warn("validate access token", zap.Error(err))
+		return nil, errInvalidToken
+	}
+
+	ctx, err = m.authProvider.CreateTokenSession(ctx, t)
+	if err != nil {
+		logger.Logger().Warn("create token session", zap.Error(err))
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return ctx, nil
+}
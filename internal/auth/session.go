@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// SessionTouchInterval limits how often the last-seen time of a session is written.
+const SessionTouchInterval = time.Minute
+
+// ErrSessionRevoked is returned for JWTs whose sign-in session is revoked or unknown.
+var ErrSessionRevoked = errors.New("session is revoked")
+
+// WithSessionStorage enables tracking of sign-in sessions. Every request authenticated with a JWT
+// is checked against its session, tokens without a session are rejected.
+func WithSessionStorage(sessionStorage storage.SessionStorage) ProviderOption {
+	return func(p *Provider) {
+		p.sessionStorage = sessionStorage
+	}
+}
+
+// StartSession records a new sign-in session of the user.
+//
+// Parameters:
+//   - ctx (context.Context): The context of the sign-in request.
+//   - session (storage.Session): The user ID, device name, user agent and IP address of the sign-in.
+//
+// Returns:
+//   - uint64: The ID of the session for GenerateToken, 0 if sessions are not tracked.
+//   - error: An error if the session cannot be stored.
+func (p *Provider) StartSession(ctx context.Context, session storage.Session) (uint64, error) {
+	if p.sessionStorage == nil {
+		return 0, nil
+	}
+
+	session.CreatedAt = time.Now()
+	session, err := p.sessionStorage.CreateSession(ctx, session)
+	if err != nil {
+		return 0, fmt.Errorf("create session: %w", err)
+	}
+	return session.ID, nil
+}
+
+// CurrentSessionID returns the sign-in session the request was authenticated with.
+// The second result is false for personal access tokens and when sessions are not tracked.
+func (p *Provider) CurrentSessionID(ctx context.Context) (uint64, bool) {
+	id, ok := ctx.Value(SessionIDContextKey).(uint64)
+	return id, ok
+}
+
+// checkSession verifies that the session of the JWT exists, belongs to its user and is not revoked,
+// and updates its last-seen time.
+func (p *Provider) checkSession(ctx context.Context, claims Claims) error {
+	if p.sessionStorage == nil {
+		return nil
+	}
+	if claims.SessionID == 0 {
+		return ErrSessionRevoked
+	}
+
+	session, err := p.sessionStorage.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		return fmt.Errorf("get session: %w", err)
+	}
+	if session.UserID != claims.UserID || session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) >= SessionTouchInterval {
+		err = p.sessionStorage.TouchSession(ctx, session.ID, now)
+		if err != nil {
+			logger.Logger().Warn("failed to update session last seen time", zap.Uint64("sessionID", session.ID), zap.Error(err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/tracing"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart from JWTs.
+const AccessTokenPrefix = "gpk_"
+
+// ErrAccessTokenInactive is returned for personal access tokens that are revoked or expired.
+var ErrAccessTokenInactive = errors.New("access token is revoked or expired")
+
+// IsAccessToken reports whether the bearer token is a personal access token rather than a JWT.
+func IsAccessToken(tokenString string) bool {
+	return strings.HasPrefix(tokenString, AccessTokenPrefix)
+}
+
+// HashAccessToken returns the hex encoded SHA-256 hash of a plain personal access token.
+// The tokens carry 256 bits of randomness, so a fast hash is sufficient for storing them.
+func HashAccessToken(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateAccessToken creates a new random personal access token.
+//
+// Returns:
+//   - string: The plain token which is shown to the user once.
+//   - string: The hash of the token which is stored.
+//   - error: An error if the random source fails.
+func (p *Provider) GenerateAccessToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("read random bytes: %w", err)
+	}
+	tokenString := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return tokenString, HashAccessToken(tokenString), nil
+}
+
+// ValidateAccessToken looks up a personal access token by its hash and checks that it is still active.
+// The last-used timestamp of the token is updated on success.
+//
+// Parameters:
+//   - ctx (context.Context): The request context.
+//   - tokenString (string): The plain personal access token.
+//
+// Returns:
+//   - storage.AccessToken: The stored token with its scope.
+//   - error: An error if the token is unknown, revoked or expired.
+func (p *Provider) ValidateAccessToken(ctx context.Context, tokenString string) (_ storage.AccessToken, err error) {
+	ctx, span := tracer.Start(ctx, "auth.Provider.ValidateAccessToken")
+	defer func() { tracing.End(span, err) }()
+
+	if p.tokenStorage == nil {
+		return storage.AccessToken{}, errors.New("personal access tokens are not supported")
+	}
+
+	t, err := p.tokenStorage.GetTokenByHash(ctx, HashAccessToken(tokenString))
+	if err != nil {
+		return storage.AccessToken{}, fmt.Errorf("get token by hash: %w", err)
+	}
+
+	now := time.Now()
+	if !t.IsActive(now) {
+		return storage.AccessToken{}, ErrAccessTokenInactive
+	}
+
+	err = p.tokenStorage.TouchToken(ctx, t.ID, now)
+	if err != nil {
+		logger.Logger().Warn("failed to update token last used time", zap.Uint64("tokenID", t.ID), zap.Error(err))
+	}
+	t.LastUsedAt = &now
+
+	return t, nil
+}
+
+// CreateTokenSession creates a new session for the owner of the personal access token.
+// The token is stored in the context next to the user ID so that handlers can enforce its scope.
+//
+// Parameters:
+//   - ctx (context.Context): The context in which the session will be created.
+//   - t (storage.AccessToken): The validated personal access token.
+//
+// Returns:
+//   - context.Context: The context with the user ID and the token added.
+//   - error: An error if the user cannot be retrieved or is disabled.
+func (p *Provider) CreateTokenSession(ctx context.Context, t storage.AccessToken) (_ context.Context, err error) {
+	spanCtx, span := tracer.Start(ctx, "auth.Provider.CreateTokenSession", trace.WithAttributes(attribute.Int64("user.id", int64(t.UserID))))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := p.userStorage.GetUser(spanCtx, t.UserID)
+	if err != nil {
+		return ctx, fmt.Errorf("get user: %w", err)
+	}
+	if user.Disabled {
+		return ctx, ErrUserDisabled
+	}
+
+	ctx = context.WithValue(ctx, UserIDContextKey, t.UserID)
+	return context.WithValue(ctx, AccessTokenContextKey, t), nil
+}
+
+// GetTokenFromSession returns the personal access token the request was authenticated with.
+// The second result is false when the request was authenticated with a regular JWT.
+func (p *Provider) GetTokenFromSession(ctx context.Context) (storage.AccessToken, bool) {
+	t, ok := ctx.Value(AccessTokenContextKey).(storage.AccessToken)
+	return t, ok
+}
@@ -0,0 +1,393 @@
+// Package backup implements the encrypted backups of the whole server: the rows of its tables and the values
+// of all vaults, written by the storages as one consistent snapshot and restored into an empty database.
+//
+// A backup is a gzip compressed stream of JSON lines, encrypted like vault archives by archive.Encrypt. The first
+// line is the manifest. Rows follow table by table, in an order satisfying their foreign keys, and the value of a
+// vault follows its row as base64 chunks closed by its size and SHA-256 hash. The last line counts the rows of
+// every table and the values, so that a truncated or reordered backup is detected, next to the authentication of
+// the encryption. Backups are written and read without holding more than a chunk of a value in memory.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/archive"
+)
+
+const (
+	// Version is the version of the backup format written by Writer.
+	Version = 1
+	// Format identifies backups in their manifest, telling them apart from vault archives.
+	Format = "gophkeeper-backup"
+
+	// chunkSize is the size of the chunks values are split into.
+	chunkSize = 64 * 1024
+	// maxLineSize bounds the lines Reader accepts: a base64 chunk of a value, or a row.
+	maxLineSize = 1 << 20
+)
+
+// Record types.
+const (
+	typeRow   = "row"
+	typeChunk = "chunk"
+	typeValue = "value"
+	typeEnd   = "end"
+)
+
+var (
+	// ErrFormat is returned for streams which are not backups, or backups of an unsupported version.
+	ErrFormat = errors.New("not a backup")
+	// ErrDamaged is returned if a part of the backup fails to decrypt or to parse, or the backup is incomplete.
+	ErrDamaged = errors.New("damaged backup")
+	// ErrPassphrase is returned if the backup can't be decrypted, which happens for a wrong passphrase
+	// and for a backup damaged right from its beginning alike.
+	ErrPassphrase = archive.ErrPassphrase
+)
+
+// Manifest describes a backup.
+type Manifest struct {
+	Format    string    `json:"format"`     // Format, always Format.
+	Version   int       `json:"version"`    // Version of the backup format.
+	Driver    string    `json:"driver"`     // Database the backup was written from, "postgres" or "sqlite".
+	Schema    int64     `json:"schema"`     // Schema version of the database, which must match on restore.
+	CreatedAt time.Time `json:"created_at"` // Time of the snapshot.
+}
+
+// Summary counts the contents of a backup.
+type Summary struct {
+	Rows   map[string]int64 `json:"rows"`   // Number of rows by table.
+	Values int64            `json:"values"` // Number of vault values.
+	Bytes  int64            `json:"bytes"`  // Total size of the vault values.
+}
+
+// record is a line of the backup after the manifest.
+type record struct {
+	Type    string          `json:"type"`
+	Table   string          `json:"table,omitempty"`    // Table of a row.
+	Row     json.RawMessage `json:"row,omitempty"`      // Row as a JSON object of its columns.
+	VaultID uint64          `json:"vault_id,omitempty"` // Vault of a chunk or a value.
+	Data    []byte          `json:"data,omitempty"`     // Chunk of a value.
+	Size    int64           `json:"size,omitempty"`     // Size of a value.
+	SHA256  string          `json:"sha256,omitempty"`   // Hash of a value.
+	Summary *Summary        `json:"summary,omitempty"`  // Contents of the backup, in the end record.
+}
+
+// Writer writes an encrypted backup.
+type Writer struct {
+	enc     io.WriteCloser
+	gz      *gzip.Writer
+	out     *json.Encoder
+	summary Summary
+}
+
+// NewWriter starts a backup written to w, encrypted with the passphrase, and writes its manifest.
+// The Format and the Version of the manifest are set by the Writer.
+// Returns the Writer, which must be closed to complete the backup, and an error if any.
+func NewWriter(w io.Writer, passphrase string, m Manifest) (*Writer, error) {
+	enc, err := archive.Encrypt(w, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(enc)
+	bw := &Writer{enc: enc, gz: gz, out: json.NewEncoder(gz), summary: Summary{Rows: make(map[string]int64)}}
+
+	m.Format, m.Version = Format, Version
+	if err = bw.out.Encode(m); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return bw, nil
+}
+
+// WriteRow adds a row of a table, a JSON object of its columns, to the backup.
+func (w *Writer) WriteRow(table string, row json.RawMessage) error {
+	if err := w.out.Encode(record{Type: typeRow, Table: table, Row: row}); err != nil {
+		return fmt.Errorf("failed to write row of %s: %w", table, err)
+	}
+	w.summary.Rows[table]++
+	return nil
+}
+
+// WriteValue adds the value of a vault read from r to the backup, which must follow the row of the vault.
+// Returns the size of the value and an error if any.
+func (w *Writer) WriteValue(vaultID uint64, r io.Reader) (int64, error) {
+	h := sha256.New()
+	buf := make([]byte, chunkSize)
+	var size int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			size += int64(n)
+			if err := w.out.Encode(record{Type: typeChunk, VaultID: vaultID, Data: buf[:n]}); err != nil {
+				return size, fmt.Errorf("failed to write value of vault %d: %w", vaultID, err)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return size, fmt.Errorf("failed to read value of vault %d: %w", vaultID, err)
+		}
+	}
+	err := w.out.Encode(record{Type: typeValue, VaultID: vaultID, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))})
+	if err != nil {
+		return size, fmt.Errorf("failed to write value of vault %d: %w", vaultID, err)
+	}
+	w.summary.Values++
+	w.summary.Bytes += size
+	return size, nil
+}
+
+// Summary returns the contents written so far.
+func (w *Writer) Summary() Summary {
+	return w.summary
+}
+
+// Close completes the backup with its summary. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.out.Encode(record{Type: typeEnd, Summary: &w.summary}); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	if err := w.gz.Close(); err != nil {
+		return fmt.Errorf("failed to close backup: %w", err)
+	}
+	return w.enc.Close()
+}
+
+// Record is a row or a vault value read from a backup.
+type Record struct {
+	Table string          // Table of a row, empty for a value.
+	Row   json.RawMessage // Row as a JSON object of its columns.
+
+	VaultID uint64    // Vault of a value.
+	Value   io.Reader // Value, which returns ErrDamaged at its end if it doesn't match its size and hash.
+}
+
+// Reader reads an encrypted backup.
+type Reader struct {
+	gz       *gzip.Reader
+	lines    *bufio.Scanner
+	manifest Manifest
+	summary  Summary
+	value    *valueReader
+	done     bool
+}
+
+// NewReader starts reading a backup from r, decrypting it with the passphrase, and reads its manifest.
+// Returns ErrFormat if r is not a backup and ErrPassphrase if the passphrase is wrong.
+func NewReader(r io.Reader, passphrase string) (*Reader, error) {
+	dec, err := archive.Decrypt(r, passphrase)
+	if errors.Is(err, archive.ErrFormat) {
+		return nil, ErrFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(dec)
+	if err != nil {
+		return nil, damaged(err)
+	}
+	lines := bufio.NewScanner(gz)
+	lines.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	br := &Reader{gz: gz, lines: lines, summary: Summary{Rows: make(map[string]int64)}}
+
+	if !lines.Scan() {
+		return nil, damaged(lines.Err())
+	}
+	if err = json.Unmarshal(lines.Bytes(), &br.manifest); err != nil || br.manifest.Format != Format {
+		// Vault archives are encrypted alike, but hold a tar stream.
+		return nil, ErrFormat
+	}
+	if br.manifest.Version != Version {
+		return nil, fmt.Errorf("%w: version %d", ErrFormat, br.manifest.Version)
+	}
+	return br, nil
+}
+
+// Manifest returns the manifest of the backup.
+func (r *Reader) Manifest() Manifest {
+	return r.manifest
+}
+
+// Summary returns the contents read so far, which is the summary of the whole backup after Next returned io.EOF.
+func (r *Reader) Summary() Summary {
+	return r.summary
+}
+
+// Next reads the next row or value of the backup. The value of the previous record is skipped if it wasn't
+// read to its end. Returns io.EOF after the last record, once the summary at the end of the backup matched
+// its contents and the whole stream was authenticated.
+func (r *Reader) Next() (Record, error) {
+	if r.done {
+		return Record{}, io.EOF
+	}
+	if r.value != nil {
+		if _, err := io.Copy(io.Discard, r.value); err != nil {
+			return Record{}, err
+		}
+		r.value = nil
+	}
+
+	rec, err := r.read()
+	if err != nil {
+		return Record{}, err
+	}
+	switch rec.Type {
+	case typeRow:
+		if rec.Table == "" || len(rec.Row) == 0 {
+			return Record{}, fmt.Errorf("%w: row without table", ErrDamaged)
+		}
+		r.summary.Rows[rec.Table]++
+		return Record{Table: rec.Table, Row: rec.Row}, nil
+	case typeChunk, typeValue:
+		r.value = &valueReader{r: r, vaultID: rec.VaultID, hash: sha256.New(), next: &rec}
+		return Record{VaultID: rec.VaultID, Value: r.value}, nil
+	case typeEnd:
+		if err = r.finish(rec.Summary); err != nil {
+			return Record{}, err
+		}
+		return Record{}, io.EOF
+	default:
+		return Record{}, fmt.Errorf("%w: unexpected %q record", ErrDamaged, rec.Type)
+	}
+}
+
+// finish compares the summary of the backup with its contents and checks that nothing follows it.
+func (r *Reader) finish(want *Summary) error {
+	if want == nil {
+		return fmt.Errorf("%w: end without summary", ErrDamaged)
+	}
+	if want.Values != r.summary.Values || want.Bytes != r.summary.Bytes || len(want.Rows) != len(r.summary.Rows) {
+		return fmt.Errorf("%w: %d values of %d bytes expected, %d of %d bytes read",
+			ErrDamaged, want.Values, want.Bytes, r.summary.Values, r.summary.Bytes)
+	}
+	for table, n := range want.Rows {
+		if r.summary.Rows[table] != n {
+			return fmt.Errorf("%w: %d rows of %s expected, %d read", ErrDamaged, n, table, r.summary.Rows[table])
+		}
+	}
+	if r.lines.Scan() {
+		return fmt.Errorf("%w: data after the end", ErrDamaged)
+	}
+	if err := r.lines.Err(); err != nil {
+		return damaged(err)
+	}
+	// Reading to the end checks the gzip checksum and decrypts the last chunk.
+	if _, err := io.Copy(io.Discard, r.gz); err != nil {
+		return damaged(err)
+	}
+	r.done = true
+	return nil
+}
+
+// read reads the next record.
+func (r *Reader) read() (record, error) {
+	if !r.lines.Scan() {
+		err := r.lines.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return record{}, damaged(err)
+	}
+	var rec record
+	if err := json.Unmarshal(r.lines.Bytes(), &rec); err != nil {
+		return record{}, fmt.Errorf("%w: %v", ErrDamaged, err)
+	}
+	return rec, nil
+}
+
+// valueReader reads the chunks of a value and verifies them against the size and the hash closing them.
+type valueReader struct {
+	r       *Reader
+	vaultID uint64
+	hash    hash.Hash
+	size    int64
+	next    *record // Record read by Next, not consumed yet.
+	chunk   []byte
+	done    bool
+}
+
+// Read implements io.Reader, reading the next chunk when the current one is consumed.
+func (v *valueReader) Read(p []byte) (int, error) {
+	for len(v.chunk) == 0 {
+		if v.done {
+			return 0, io.EOF
+		}
+		if err := v.advance(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, v.chunk)
+	v.chunk = v.chunk[n:]
+	return n, nil
+}
+
+func (v *valueReader) advance() error {
+	rec := v.next
+	v.next = nil
+	if rec == nil {
+		read, err := v.r.read()
+		if err != nil {
+			return err
+		}
+		rec = &read
+	}
+	if rec.VaultID != v.vaultID || rec.Type != typeChunk && rec.Type != typeValue {
+		return fmt.Errorf("%w: unexpected %q record in the value of vault %d", ErrDamaged, rec.Type, v.vaultID)
+	}
+	if rec.Type == typeChunk {
+		v.hash.Write(rec.Data)
+		v.size += int64(len(rec.Data))
+		v.chunk = rec.Data
+		return nil
+	}
+
+	if rec.Size != v.size || rec.SHA256 != hex.EncodeToString(v.hash.Sum(nil)) {
+		return fmt.Errorf("%w: value of vault %d doesn't match its size or hash", ErrDamaged, v.vaultID)
+	}
+	v.r.summary.Values++
+	v.r.summary.Bytes += v.size
+	v.done = true
+	return nil
+}
+
+// Verify reads the whole backup from r, decrypting it with the passphrase.
+// Returns the manifest and the summary of the backup, or the first error found in it.
+func Verify(r io.Reader, passphrase string) (Manifest, Summary, error) {
+	br, err := NewReader(r, passphrase)
+	if err != nil {
+		return Manifest{}, Summary{}, err
+	}
+	for {
+		_, err = br.Next()
+		if errors.Is(err, io.EOF) {
+			return br.Manifest(), br.Summary(), nil
+		}
+		if err != nil {
+			return br.Manifest(), br.Summary(), err
+		}
+	}
+}
+
+// damaged wraps an error of reading the backup into ErrDamaged, unless it is already an error of the encryption.
+func damaged(err error) error {
+	if errors.Is(err, ErrPassphrase) || errors.Is(err, ErrDamaged) {
+		return err
+	}
+	if errors.Is(err, archive.ErrDamaged) {
+		return fmt.Errorf("%w: %v", ErrDamaged, err)
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %v", ErrDamaged, err)
+}
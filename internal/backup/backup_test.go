@@ -0,0 +1,128 @@
+package backup_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/archive"
+	"github.com/andreevym/gophkeeper/internal/backup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var manifest = backup.Manifest{Driver: "postgres", Schema: 14, CreatedAt: time.Unix(1700000000, 0).UTC()}
+
+func writeBackup(t *testing.T, large []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := backup.NewWriter(&buf, "correct horse", manifest)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteRow("users", json.RawMessage(`{"id": 1, "login": "alice"}`)))
+	require.NoError(t, w.WriteRow("vault", json.RawMessage(`{"id": 3, "user_id": 1}`)))
+	size, err := w.WriteValue(3, bytes.NewReader(large))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(large)), size)
+	require.NoError(t, w.WriteRow("vault", json.RawMessage(`{"id": 4, "user_id": 1}`)))
+	_, err = w.WriteValue(4, bytes.NewReader(nil))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	large := make([]byte, 200*1024)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+	data := writeBackup(t, large)
+	assert.NotContains(t, string(data), "alice")
+
+	r, err := backup.NewReader(bytes.NewReader(data), "correct horse")
+	require.NoError(t, err)
+	want := manifest
+	want.Format, want.Version = backup.Format, backup.Version
+	assert.Equal(t, want, r.Manifest())
+
+	rec, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "users", rec.Table)
+	assert.JSONEq(t, `{"id": 1, "login": "alice"}`, string(rec.Row))
+	rec, err = r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "vault", rec.Table)
+	rec, err = r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), rec.VaultID)
+	value, err := io.ReadAll(rec.Value)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(large, value), "value differs")
+
+	// A value which isn't read is skipped.
+	_, err = r.Next()
+	require.NoError(t, err)
+	rec, err = r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), rec.VaultID)
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, backup.Summary{Rows: map[string]int64{"users": 1, "vault": 2}, Values: 2, Bytes: int64(len(large))}, r.Summary())
+}
+
+func TestReadErrors(t *testing.T) {
+	t.Parallel()
+	// Random values don't compress, so the backup spans several chunks and a truncated one fails after the first.
+	large := make([]byte, 200*1024)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+	data := writeBackup(t, large)
+
+	_, _, err = backup.Verify(bytes.NewReader(data), "wrong")
+	assert.ErrorIs(t, err, backup.ErrPassphrase)
+
+	_, _, err = backup.Verify(bytes.NewReader(data[:len(data)-1]), "correct horse")
+	assert.ErrorIs(t, err, backup.ErrDamaged)
+
+	_, _, err = backup.Verify(bytes.NewReader([]byte("pg_dump output")), "correct horse")
+	assert.ErrorIs(t, err, backup.ErrFormat)
+
+	var archived bytes.Buffer
+	w, err := archive.NewWriter(&archived, "correct horse", archive.Manifest{Login: "alice"})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	_, _, err = backup.Verify(&archived, "correct horse")
+	assert.ErrorIs(t, err, backup.ErrFormat, "vault archives are not backups")
+
+	// The summary at the end detects missing rows, even if the stream itself is intact.
+	var buf bytes.Buffer
+	enc, err := archive.Encrypt(&buf, "correct horse")
+	require.NoError(t, err)
+	plain := gzipLines(t,
+		`{"format": "gophkeeper-backup", "version": 1, "driver": "postgres"}`,
+		`{"type": "row", "table": "users", "row": {"id": 1}}`,
+		`{"type": "end", "summary": {"rows": {"users": 2}}}`,
+	)
+	_, err = enc.Write(plain)
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+	_, summary, err := backup.Verify(&buf, "correct horse")
+	assert.ErrorIs(t, err, backup.ErrDamaged)
+	assert.ErrorContains(t, err, "2 rows of users expected, 1 read")
+	assert.Equal(t, int64(1), summary.Rows["users"])
+}
+
+func gzipLines(t *testing.T, lines ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for _, line := range lines {
+		_, err := io.WriteString(gz, line+"\n")
+		require.NoError(t, err)
+	}
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
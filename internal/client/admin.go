@@ -0,0 +1,73 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+)
+
+// adminUserPath returns the path of an admin API endpoint of the user with the given ID.
+func adminUserPath(userID, action string) string {
+	path := handlers.AdminURI + "/users/" + url.PathEscape(userID)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
+
+// AdminListUsers retrieves the users whose login contains the query, all users if it is empty, ordered by ID.
+// If afterID is not 0, only the users following the user with this ID are retrieved.
+func (c *Client) AdminListUsers(token, query string, afterID uint64) ([]handlers.AdminUserResponse, error) {
+	params := url.Values{}
+	if query != "" {
+		params.Set("q", query)
+	}
+	if afterID != 0 {
+		params.Set("after", strconv.FormatUint(afterID, 10))
+	}
+	path := handlers.AdminURI + "/users"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	var users []handlers.AdminUserResponse
+	_, err := c.doJSON(http.MethodGet, path, token, nil, &users, http.StatusOK)
+	return users, err
+}
+
+// AdminGetUser retrieves the user with the given ID.
+func (c *Client) AdminGetUser(token, userID string) (handlers.AdminUserResponse, error) {
+	var user handlers.AdminUserResponse
+	_, err := c.doJSON(http.MethodGet, adminUserPath(userID, ""), token, nil, &user, http.StatusOK)
+	return user, err
+}
+
+// AdminGetUsage retrieves the vault storage used by the user with the given ID and their quota.
+func (c *Client) AdminGetUsage(token, userID string) (handlers.UsageResponse, error) {
+	var usage handlers.UsageResponse
+	_, err := c.doJSON(http.MethodGet, adminUserPath(userID, "usage"), token, nil, &usage, http.StatusOK)
+	return usage, err
+}
+
+// AdminUpdateUser runs an action changing the user with the given ID: "disable", "enable", "logout" or "reset-2fa".
+// Returns the updated user.
+func (c *Client) AdminUpdateUser(token, userID, action string) (handlers.AdminUserResponse, error) {
+	var user handlers.AdminUserResponse
+	_, err := c.doJSON(http.MethodPost, adminUserPath(userID, action), token, nil, &user, http.StatusOK)
+	return user, err
+}
+
+// AdminListJobs retrieves the names of the maintenance jobs of the server.
+func (c *Client) AdminListJobs(token string) ([]string, error) {
+	var jobs []string
+	_, err := c.doJSON(http.MethodGet, handlers.AdminURI+"/jobs", token, nil, &jobs, http.StatusOK)
+	return jobs, err
+}
+
+// AdminRunJob runs the maintenance job with the given name and waits for its result.
+func (c *Client) AdminRunJob(token, job string) (handlers.MaintenanceJobResponse, error) {
+	var result handlers.MaintenanceJobResponse
+	_, err := c.doJSON(http.MethodPost, handlers.AdminURI+"/jobs/"+url.PathEscape(job), token, nil, &result, http.StatusOK)
+	return result, err
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+)
+
+// ExportVault exports all vault entries of the user to an archive encrypted with the passphrase
+// and writes it to w. The archive may be incomplete if the server fails while sending it,
+// which archive.Verify detects.
+func (c *Client) ExportVault(token, passphrase string, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodPost, c.serverAddress+handlers.ExportURI, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(handlers.ArchivePassphraseHeader, passphrase)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return handleErrorResponse(resp)
+	}
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	return nil
+}
+
+// ImportVault imports the vault entries of the archive read from r, encrypted with the passphrase.
+// The duplicates policy is one of handlers.DuplicatesSkip, handlers.DuplicatesOverwrite and
+// handlers.DuplicatesKeep, the server's default if it is empty.
+func (c *Client) ImportVault(token, passphrase string, r io.Reader, duplicates string) (handlers.ImportResponse, error) {
+	path := handlers.ImportURI
+	if duplicates != "" {
+		path += "?duplicates=" + url.QueryEscape(duplicates)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.serverAddress+path, r)
+	if err != nil {
+		return handlers.ImportResponse{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(handlers.ArchivePassphraseHeader, passphrase)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return handlers.ImportResponse{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return handlers.ImportResponse{}, handleErrorResponse(resp)
+	}
+	var result handlers.ImportResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return handlers.ImportResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result, nil
+}
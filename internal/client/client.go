@@ -4,6 +4,8 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,19 +14,49 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/tracing"
 )
 
 // Client represents a client that communicates with the GophKeeper service.
 type Client struct {
 	serverAddress string
+	deviceName    string       // Sent on sign-in to name the session, the host name by default.
+	httpClient    *http.Client // Sends the W3C trace context of the global tracer provider with every request.
+}
+
+// Option configures a Client.
+type Option func(*http.Transport)
+
+// WithRootCAs verifies the certificate of the server with the CA certificates of the pool
+// instead of those of the system.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(t *http.Transport) {
+		t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
 }
 
 // NewClient creates a new instance of Client with the provided server address.
-func NewClient(serverAddress string) *Client {
-	return &Client{serverAddress: serverAddress}
+func NewClient(serverAddress string, opts ...Option) *Client {
+	deviceName, _ := os.Hostname()
+	var transport http.RoundTripper = http.DefaultTransport
+	if len(opts) > 0 {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		for _, opt := range opts {
+			opt(t)
+		}
+		transport = t
+	}
+	return &Client{
+		serverAddress: serverAddress,
+		deviceName:    deviceName,
+		httpClient:    &http.Client{Transport: tracing.NewTransport(transport)},
+	}
 }
 
 // CreateUser registers a new user with the GophKeeper service.
@@ -35,7 +67,7 @@ func (c *Client) CreateUser(login, password string) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
-	resp, err := http.Post(c.serverAddress+handlers.AuthSignUpURI, "application/json", bytes.NewBuffer(b))
+	resp, err := c.httpClient.Post(c.serverAddress+handlers.AuthSignUpURI, "application/json", bytes.NewBuffer(b))
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -51,16 +83,24 @@ func (c *Client) CreateUser(login, password string) error {
 // It sends a POST request to the /signin endpoint with the provided login and password.
 // Returns the token if successful, or an error if the request fails or if the server responds with a non-200 status code.
 func (c *Client) SignIn(login, password string) (string, error) {
-	b, err := json.Marshal(handlers.SignInRequest{Login: login, Password: password})
+	b, err := json.Marshal(handlers.SignInRequest{Login: login, Password: password, Device: c.deviceName})
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
-	resp, err := http.Post(c.serverAddress+handlers.AuthSignInURI, "application/json", bytes.NewBuffer(b))
+	resp, err := c.httpClient.Post(c.serverAddress+handlers.AuthSignInURI, "application/json", bytes.NewBuffer(b))
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusAccepted {
+		var signInResponse handlers.SignInResponse
+		if err := json.NewDecoder(resp.Body).Decode(&signInResponse); err != nil {
+			return "", fmt.Errorf("failed to decode response: %w", err)
+		}
+		return "", &TwoFactorRequiredError{MFAToken: signInResponse.MFAToken}
+	}
+
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		return "", handleErrorResponse(resp)
 	}
@@ -69,6 +109,57 @@ func (c *Client) SignIn(login, password string) (string, error) {
 	return strings.TrimPrefix(token, "Bearer "), nil
 }
 
+// TwoFactorRequiredError is returned by SignIn when the user has enabled two-factor authentication.
+// The sign-in is completed by SignInTwoFactor with the MFAToken and a code from the authenticator app.
+type TwoFactorRequiredError struct {
+	MFAToken string
+}
+
+// Error implements the error interface.
+func (e *TwoFactorRequiredError) Error() string {
+	return "two-factor authentication code is required"
+}
+
+// SignInTwoFactor completes the sign-in of a user with two-factor authentication.
+// Either code or recoveryCode must be set. Returns the token if successful.
+func (c *Client) SignInTwoFactor(mfaToken, code, recoveryCode string) (string, error) {
+	header, err := c.doJSON(http.MethodPost, handlers.AuthSignInTwoFactorURI, "", handlers.TwoFactorSignInRequest{
+		MFAToken:     mfaToken,
+		Code:         code,
+		RecoveryCode: recoveryCode,
+		Device:       c.deviceName,
+	}, nil, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(header.Get("Authorization"), "Bearer "), nil
+}
+
+// EnrollTwoFactor starts the TOTP enrollment and returns the secret and the provisioning URI.
+// Two-factor authentication is enabled only after ActivateTwoFactor succeeds.
+func (c *Client) EnrollTwoFactor(token string) (handlers.TwoFactorEnrollResponse, error) {
+	var enrollResponse handlers.TwoFactorEnrollResponse
+	_, err := c.doJSON(http.MethodPost, handlers.TwoFactorEnrollURI, token, nil, &enrollResponse, http.StatusOK)
+	return enrollResponse, err
+}
+
+// ActivateTwoFactor verifies the first code of the authenticator app and enables two-factor authentication.
+// Returns the single-use recovery codes.
+func (c *Client) ActivateTwoFactor(token, code string) ([]string, error) {
+	var activateResponse handlers.TwoFactorActivateResponse
+	_, err := c.doJSON(http.MethodPost, handlers.TwoFactorActivateURI, token, handlers.TwoFactorCodeRequest{Code: code}, &activateResponse, http.StatusOK)
+	return activateResponse.RecoveryCodes, err
+}
+
+// DisableTwoFactor disables two-factor authentication. Either code or recoveryCode must be set.
+func (c *Client) DisableTwoFactor(token, code, recoveryCode string) error {
+	_, err := c.doJSON(http.MethodPost, handlers.TwoFactorDisableURI, token, handlers.TwoFactorCodeRequest{
+		Code:         code,
+		RecoveryCode: recoveryCode,
+	}, nil, http.StatusNoContent)
+	return err
+}
+
 // GetVault retrieves a vault by its ID using the provided authentication token.
 // It sends a GET request to the /vault/{vaultID} endpoint with the token in the Authorization header.
 // Returns the vault if successful, or an error if the request fails, the server responds with a non-200 status code, or if the vaultID is empty.
@@ -86,7 +177,7 @@ func (c *Client) GetVault(token, vaultID string) (handlers.VaultResponse, error)
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return handlers.VaultResponse{}, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -119,7 +210,7 @@ func (c *Client) NewVault(token, key, value, vaultID string) (handlers.VaultResp
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return handlers.VaultResponse{}, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -182,7 +273,7 @@ func (c *Client) UploadFile(token, filename, filePath, vaultID string) (handlers
 	req.Header.Set("Authorization", "Bearer "+token)
 
 	// Send the request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return handlers.VaultResponse{}, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -202,12 +293,257 @@ func (c *Client) UploadFile(token, filename, filePath, vaultID string) (handlers
 	return vault, nil
 }
 
-// handleErrorResponse handles HTTP errors by reading the response body and returning a formatted error message.
+// DownloadFile downloads the value of a vault entry and writes it to w.
+// Returns an error if the request fails, the server responds with a non-200 status code, or if the vaultID is empty.
+// The value may be incomplete if the download fails while it is written to w.
+func (c *Client) DownloadFile(token, vaultID string, w io.Writer) error {
+	if vaultID == "" {
+		return errors.New("vaultID is empty")
+	}
+	req, err := http.NewRequest(http.MethodGet, c.serverAddress+handlers.FileDownloadURI+"/"+url.PathEscape(vaultID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return handleErrorResponse(resp)
+	}
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	return nil
+}
+
+// CreateToken creates a personal access token using the provided authentication token.
+// It sends a POST request to the /tokens endpoint with the token in the Authorization header.
+// Returns the created token including its plain value, which the server never shows again.
+func (c *Client) CreateToken(token string, tokenRequest handlers.TokenRequest) (handlers.TokenResponse, error) {
+	b, err := json.Marshal(tokenRequest)
+	if err != nil {
+		return handlers.TokenResponse{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.serverAddress+handlers.TokensURI, bytes.NewBuffer(b))
+	if err != nil {
+		return handlers.TokenResponse{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return handlers.TokenResponse{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return handlers.TokenResponse{}, handleErrorResponse(resp)
+	}
+
+	var tokenResponse handlers.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return handlers.TokenResponse{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return tokenResponse, nil
+}
+
+// ListTokens retrieves the personal access tokens of the user using the provided authentication token.
+// It sends a GET request to the /tokens endpoint with the token in the Authorization header.
+func (c *Client) ListTokens(token string) ([]handlers.TokenResponse, error) {
+	req, err := http.NewRequest(http.MethodGet, c.serverAddress+handlers.TokensURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, handleErrorResponse(resp)
+	}
+
+	var tokens []handlers.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return tokens, nil
+}
+
+// RevokeToken revokes a personal access token by its ID using the provided authentication token.
+// It sends a DELETE request to the /tokens/{tokenID} endpoint with the token in the Authorization header.
+func (c *Client) RevokeToken(token, tokenID string) error {
+	if tokenID == "" {
+		return errors.New("tokenID is empty")
+	}
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s%s/%s", c.serverAddress, handlers.TokensURI, tokenID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return handleErrorResponse(resp)
+	}
+	return nil
+}
+
+// ChangePassword changes the password of the user. All existing tokens are revoked by the server.
+// Returns the new token for the current client.
+func (c *Client) ChangePassword(token, currentPassword, newPassword string) (string, error) {
+	header, err := c.doJSON(http.MethodPost, handlers.AccountPasswordURI, token, handlers.ChangePasswordRequest{
+		CurrentPassword: currentPassword,
+		NewPassword:     newPassword,
+	}, nil, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(header.Get("Authorization"), "Bearer "), nil
+}
+
+// ChangeLogin renames the login of the user.
+func (c *Client) ChangeLogin(token, login string) error {
+	_, err := c.doJSON(http.MethodPost, handlers.AccountLoginURI, token, handlers.ChangeLoginRequest{Login: login}, nil, http.StatusNoContent)
+	return err
+}
+
+// DeleteAccount deletes the account of the user with all vault entries. The password must be confirmed.
+func (c *Client) DeleteAccount(token, password string) error {
+	_, err := c.doJSON(http.MethodDelete, handlers.AccountURI, token, handlers.DeleteAccountRequest{Password: password}, nil, http.StatusNoContent)
+	return err
+}
+
+// ListSessions retrieves the active sign-in sessions of the user, the current one is marked.
+func (c *Client) ListSessions(token string) ([]handlers.SessionResponse, error) {
+	var sessions []handlers.SessionResponse
+	_, err := c.doJSON(http.MethodGet, handlers.SessionsURI, token, nil, &sessions, http.StatusOK)
+	return sessions, err
+}
+
+// RevokeSession signs out the session with the given ID.
+func (c *Client) RevokeSession(token, sessionID string) error {
+	if sessionID == "" {
+		return errors.New("sessionID is empty")
+	}
+	_, err := c.doJSON(http.MethodDelete, handlers.SessionsURI+"/"+url.PathEscape(sessionID), token, nil, nil, http.StatusNoContent)
+	return err
+}
+
+// RevokeOtherSessions signs out all sessions except the one of the token.
+func (c *Client) RevokeOtherSessions(token string) error {
+	_, err := c.doJSON(http.MethodDelete, handlers.SessionsURI, token, nil, nil, http.StatusNoContent)
+	return err
+}
+
+// ListFailedSignIns retrieves the most recent failed sign-ins into the account of the user, newest first.
+func (c *Client) ListFailedSignIns(token string) ([]storage.FailedSignIn, error) {
+	var attempts []storage.FailedSignIn
+	_, err := c.doJSON(http.MethodGet, handlers.FailedSignInsURI, token, nil, &attempts, http.StatusOK)
+	return attempts, err
+}
+
+// GetUsage retrieves the vault storage used by the user and their quota.
+func (c *Client) GetUsage(token string) (handlers.UsageResponse, error) {
+	var usage handlers.UsageResponse
+	_, err := c.doJSON(http.MethodGet, handlers.UsageURI, token, nil, &usage, http.StatusOK)
+	return usage, err
+}
+
+// ListAuditEvents retrieves the audit log of the user, newest first.
+// If beforeID is not 0, only the events older than the event with this ID are retrieved.
+func (c *Client) ListAuditEvents(token string, beforeID uint64) ([]storage.AuditEvent, error) {
+	path := handlers.AuditURI
+	if beforeID != 0 {
+		path += "?before=" + strconv.FormatUint(beforeID, 10)
+	}
+	var events []storage.AuditEvent
+	_, err := c.doJSON(http.MethodGet, path, token, nil, &events, http.StatusOK)
+	return events, err
+}
+
+// doJSON sends a request with an optional JSON body and an optional bearer token to the server.
+// If the response has one of the expected status codes, its JSON body is decoded into out unless out is nil.
+// Returns the response headers, or an error if the request fails or the server responds with another status code.
+func (c *Client) doJSON(method, path, token string, in, out any, expected ...int) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewBuffer(b)
+	}
+	req, err := http.NewRequest(method, c.serverAddress+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if !slices.Contains(expected, resp.StatusCode) {
+		return nil, handleErrorResponse(resp)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// HTTPError is returned for a response of the server with an unexpected status code.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	RetryAfter string // Seconds to wait before retrying, if the server asked for it.
+	Body       string
+}
+
+// Error implements the error interface.
+func (e *HTTPError) Error() string {
+	if e.RetryAfter != "" {
+		return fmt.Sprintf("HTTP error: %s, retry after %s seconds, body: %s", e.Status, e.RetryAfter, e.Body)
+	}
+	return fmt.Sprintf("HTTP error: %s, body: %s", e.Status, e.Body)
+}
+
+// handleErrorResponse handles HTTP errors by reading the response body and returning an *HTTPError.
 // It is used internally by the client methods to provide detailed error information when an HTTP request fails.
 func handleErrorResponse(resp *http.Response) error {
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("failed to read response body: %w", err)
 	}
-	return fmt.Errorf("HTTP error: %s, body: %s", resp.Status, string(body))
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: resp.Header.Get("Retry-After"),
+		Body:       string(body),
+	}
 }
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+)
+
+// ErrAuthorizationPending is returned by PollOIDCSignIn while the user has not signed in at the identity provider yet.
+var ErrAuthorizationPending = errors.New("authorization pending")
+
+// StartOIDCSignIn starts a sign-in with the identity provider of the server.
+// The user must open the returned VerificationURI in a browser and enter the UserCode there,
+// meanwhile the client waits with WaitOIDCSignIn. A relative VerificationURI is resolved against the server address.
+func (c *Client) StartOIDCSignIn() (handlers.OIDCDeviceResponse, error) {
+	var deviceResponse handlers.OIDCDeviceResponse
+	_, err := c.doJSON(http.MethodPost, handlers.AuthOIDCDeviceURI, "", handlers.OIDCDeviceRequest{Device: c.deviceName}, &deviceResponse, http.StatusOK)
+	if err != nil {
+		return deviceResponse, err
+	}
+	if strings.HasPrefix(deviceResponse.VerificationURI, "/") {
+		deviceResponse.VerificationURI = c.serverAddress + deviceResponse.VerificationURI
+	}
+	return deviceResponse, nil
+}
+
+// PollOIDCSignIn checks once whether the user has signed in at the identity provider and returns the token if so.
+// It returns ErrAuthorizationPending while the sign-in is pending and a *TwoFactorRequiredError
+// if the user has enabled two-factor authentication.
+func (c *Client) PollOIDCSignIn(deviceCode string) (string, error) {
+	b, err := json.Marshal(handlers.OIDCTokenRequest{DeviceCode: deviceCode})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	resp, err := c.httpClient.Post(c.serverAddress+handlers.AuthOIDCTokenURI, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return strings.TrimPrefix(resp.Header.Get("Authorization"), "Bearer "), nil
+	case http.StatusAccepted:
+		var signInResponse handlers.SignInResponse
+		if err := json.NewDecoder(resp.Body).Decode(&signInResponse); err != nil {
+			return "", fmt.Errorf("failed to decode response: %w", err)
+		}
+		return "", &TwoFactorRequiredError{MFAToken: signInResponse.MFAToken}
+	case http.StatusBadRequest:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read response body: %w", err)
+		}
+		if strings.TrimSpace(string(body)) == handlers.OIDCAuthorizationPending {
+			return "", ErrAuthorizationPending
+		}
+		return "", &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+	return "", handleErrorResponse(resp)
+}
+
+// WaitOIDCSignIn polls until the user has signed in at the identity provider or the sign-in expires.
+func (c *Client) WaitOIDCSignIn(start handlers.OIDCDeviceResponse) (string, error) {
+	interval := time.Duration(start.Interval) * time.Second
+	if interval <= 0 {
+		interval = handlers.OIDCPollInterval
+	}
+	deadline := time.Now().Add(time.Duration(start.ExpiresIn) * time.Second)
+
+	for {
+		token, err := c.PollOIDCSignIn(start.DeviceCode)
+		if !errors.Is(err, ErrAuthorizationPending) {
+			return token, err
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return "", errors.New("sign-in at the identity provider expired")
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/srp"
+)
+
+// ErrInvalidServerProof is returned by SignInSRP when the server can't prove that it knows the verifier,
+// which means the client is not talking to the real server.
+var ErrInvalidServerProof = errors.New("server failed to prove knowledge of the verifier")
+
+// CreateUserSRP registers a new user with zero-knowledge sign-in.
+// Only a salt and a verifier derived from the password are sent, the password never leaves the client.
+func (c *Client) CreateUserSRP(login, password string) error {
+	salt, verifier, err := srp.NewVerifier(password)
+	if err != nil {
+		return fmt.Errorf("failed to create verifier: %w", err)
+	}
+	_, err = c.doJSON(http.MethodPost, handlers.AuthSRPSignUpURI, "", handlers.SRPSignUpRequest{
+		Login:    login,
+		Salt:     salt,
+		Verifier: verifier,
+	}, nil, http.StatusCreated)
+	return err
+}
+
+// SignInSRP authenticates a user with zero-knowledge sign-in and retrieves an authentication token.
+// If the user has enabled two-factor authentication, a *TwoFactorRequiredError is returned
+// and the sign-in is completed by SignInTwoFactor.
+func (c *Client) SignInSRP(login, password string) (string, error) {
+	session, err := srp.NewClient(password)
+	if err != nil {
+		return "", fmt.Errorf("failed to start sign-in: %w", err)
+	}
+
+	var challenge handlers.SRPChallengeResponse
+	_, err = c.doJSON(http.MethodPost, handlers.AuthSRPChallengeURI, "", handlers.SRPChallengeRequest{
+		Login:     login,
+		PublicKey: session.PublicKey(),
+	}, &challenge, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+
+	proof, err := session.Proof(challenge.Salt, challenge.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute proof: %w", err)
+	}
+
+	var verifyResponse handlers.SRPVerifyResponse
+	header, err := c.doJSON(http.MethodPost, handlers.AuthSRPVerifyURI, "", handlers.SRPVerifyRequest{
+		HandshakeID: challenge.HandshakeID,
+		ClientProof: proof,
+		Device:      c.deviceName,
+	}, &verifyResponse, http.StatusOK, http.StatusAccepted)
+	if err != nil {
+		return "", err
+	}
+
+	if !session.VerifyServer(verifyResponse.ServerProof) {
+		return "", ErrInvalidServerProof
+	}
+	if verifyResponse.TwoFactorRequired {
+		return "", &TwoFactorRequiredError{MFAToken: verifyResponse.MFAToken}
+	}
+	return strings.TrimPrefix(header.Get("Authorization"), "Bearer "), nil
+}
+
+// EnableSRP switches the account to zero-knowledge sign-in with the given password, or changes the password
+// of an account which already uses it. currentPassword is required only while the account still has a password.
+// All sessions are signed out, the returned token replaces the current one.
+func (c *Client) EnableSRP(token, currentPassword, password string) (string, error) {
+	salt, verifier, err := srp.NewVerifier(password)
+	if err != nil {
+		return "", fmt.Errorf("failed to create verifier: %w", err)
+	}
+	header, err := c.doJSON(http.MethodPost, handlers.SRPVerifierURI, token, handlers.SRPVerifierRequest{
+		CurrentPassword: currentPassword,
+		Salt:            salt,
+		Verifier:        verifier,
+	}, nil, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(header.Get("Authorization"), "Bearer "), nil
+}
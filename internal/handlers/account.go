@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ChangePasswordRequest represents the payload for changing the password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"` // The password the user signed in with.
+	NewPassword     string `json:"new_password"`     // The new password.
+}
+
+// ChangeLoginRequest represents the payload for renaming the login.
+type ChangeLoginRequest struct {
+	Login string `json:"login"` // The new login.
+}
+
+// DeleteAccountRequest represents the payload confirming the deletion of the account.
+type DeleteAccountRequest struct {
+	Password string `json:"password"` // The current password.
+}
+
+// PostAccountPassword handles changing the password of the current user.
+//
+// The current password is verified first, failures count towards the sign-in limits.
+// Afterwards all sign-in sessions and personal access tokens are revoked,
+// and a new sign-in token for the calling client is returned.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is an error in the request, the current password is wrong
+//     or the account uses zero-knowledge sign-in.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 409 Conflict if the user was changed concurrently, the request can be retried.
+//   - HTTP 429 Too Many Requests with a Retry-After header if there were too many failed attempts.
+//   - HTTP 500 Internal Server Error if the tokens cannot be revoked, the password is unchanged then.
+//   - HTTP 200 OK with the new JWT token in the Authorization header.
+func (h *ServiceHandlers) PostAccountPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	request := ChangePasswordRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	if isZeroKnowledgeAccount(user) {
+		http.Error(w, "zero-knowledge sign-in is enabled, change the verifier instead", http.StatusBadRequest)
+		return
+	}
+
+	if !h.verifyPassword(w, r, user, request.CurrentPassword) {
+		return
+	}
+
+	if request.NewPassword == "" || len(request.NewPassword) > 50 {
+		http.Error(w, fmt.Sprintf("password is empty or too long more than 50 characters but actual len is %d", len(request.NewPassword)), http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := h.hashService.Hash(request.NewPassword)
+	if err != nil {
+		logger.Logger().Warn("failed to generate hash from password", zap.String("login", user.Login), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Tokens are revoked first, a failure then leaves the old password in place rather than valid tokens behind.
+	device := h.currentDeviceName(ctx)
+	err = h.revokeCredentials(ctx, user.ID)
+	if err != nil {
+		logger.Logger().Error("failed to revoke tokens", zap.String("login", user.Login), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user.Password = hashedPassword
+	user.TokenVersion++
+	err = h.userStorage.UpdateUser(ctx, user)
+	if err != nil {
+		updateUserFailed(w, err, http.StatusBadRequest)
+		return
+	}
+	logger.Logger().Info("password changed", zap.String("login", user.Login))
+
+	h.issueToken(w, r, user, device)
+}
+
+// PostAccountLogin handles renaming the login of the current user.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is an error in the request or the login is invalid.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 409 Conflict if the login is already taken by another user, ignoring case,
+//     or the user was changed concurrently, the request can be retried then.
+//   - HTTP 204 No Content on success.
+func (h *ServiceHandlers) PostAccountLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	request := ChangeLoginRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	request.Login = storage.NormalizeLogin(request.Login)
+	if request.Login == "" || len(request.Login) > 50 {
+		http.Error(w, fmt.Sprintf("login is empty or too long more than 50 characters but actual len is %d", len(request.Login)), http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.userStorage.GetUserByLogin(ctx, request.Login)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == nil && existing.ID != user.ID {
+		http.Error(w, "user already exists", http.StatusConflict)
+		return
+	}
+
+	oldLogin := user.Login
+	user.Login = request.Login
+	err = h.userStorage.UpdateUser(ctx, user)
+	if errors.Is(err, storage.ErrLoginTaken) {
+		http.Error(w, "user already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		updateUserFailed(w, err, http.StatusBadRequest)
+		return
+	}
+	logger.Logger().Info("login changed", zap.String("oldLogin", oldLogin), zap.String("login", user.Login))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteAccount handles deleting the account of the current user.
+//
+// The current password must be confirmed, accounts without a password must have signed in recently. The user is deleted together with all vault entries
+// and personal access tokens in a single transaction.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is an error in the request or the password is wrong.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token or the sign-in is not recent.
+//   - HTTP 429 Too Many Requests with a Retry-After header if there were too many failed attempts.
+//   - HTTP 204 No Content on success.
+func (h *ServiceHandlers) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	request := DeleteAccountRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	if !h.verifyPassword(w, r, user, request.Password) {
+		return
+	}
+
+	err := h.userStorage.DeleteUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Logger().Warn("failed to delete user", zap.String("login", user.Login), zap.Error(err))
+		http.Error(w, fmt.Sprintf("failed to delete user: %v", err), http.StatusBadRequest)
+		return
+	}
+	logger.Logger().Info("account deleted", zap.String("login", user.Login))
+	_ = h.audit(r, storage.AuditEvent{Action: storage.AuditAccountDelete, UserID: user.ID, Login: user.Login})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyPassword checks the password of a signed-in user confirming a sensitive operation.
+// A stolen session must not allow guessing the password, so the check is throttled like a sign-in.
+// Accounts without a password, using zero-knowledge sign-in or an identity provider, must have signed in recently instead.
+// It writes an error response and returns false if the password doesn't match.
+func (h *ServiceHandlers) verifyPassword(w http.ResponseWriter, r *http.Request, user storage.User, password string) bool {
+	if user.Password == "" {
+		return h.verifyRecentSignIn(w, r)
+	}
+
+	release, ok := h.reserveSignIn(w, r, user.Login)
+	if !ok {
+		return false
+	}
+	defer release()
+
+	if !h.hashService.Match(user.Password, password) {
+		h.signInFailed(r.Context(), r, user.ID, user.Login, SignInFailureInvalidPassword)
+		http.Error(w, "invalid password", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// revokeCredentials revokes all sign-in sessions and personal access tokens of the user.
+func (h *ServiceHandlers) revokeCredentials(ctx context.Context, userID uint64) error {
+	now := time.Now()
+	if h.sessionStorage != nil {
+		err := h.sessionStorage.RevokeOtherSessions(ctx, userID, 0, now)
+		if err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+	}
+
+	if h.tokenStorage == nil {
+		return nil
+	}
+
+	tokens, err := h.tokenStorage.ListTokens(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list access tokens: %w", err)
+	}
+
+	for _, t := range tokens {
+		if t.RevokedAt != nil {
+			continue
+		}
+		err = h.tokenStorage.RevokeToken(ctx, t.ID, now)
+		if err != nil {
+			return fmt.Errorf("failed to revoke access token %d: %w", t.ID, err)
+		}
+	}
+
+	return nil
+}
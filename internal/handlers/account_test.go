@@ -0,0 +1,103 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountManagement(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+
+	hashService := pwd.NewHashService(pwd.DefaultArgon2Params)
+	hashedPassword, err := hashService.Hash("password")
+	require.NoError(t, err)
+
+	stored := storage.User{ID: 1, Login: "user", Password: hashedPassword}
+	deleted := false
+	userStorage := mock.NewMockUserStorage(ctrl)
+	userStorage.EXPECT().GetUser(gomock.Any(), stored.ID).DoAndReturn(func(context.Context, uint64) (storage.User, error) {
+		if deleted {
+			return storage.User{}, storage.ErrUserNotFound
+		}
+		return stored, nil
+	}).AnyTimes()
+	userStorage.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, login string) (storage.User, error) {
+		switch login {
+		case stored.Login:
+			return stored, nil
+		case "taken":
+			return storage.User{ID: 2, Login: "taken"}, nil
+		}
+		return storage.User{}, storage.ErrUserNotFound
+	}).AnyTimes()
+	userStorage.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, u storage.User) error {
+		stored = u
+		return nil
+	}).AnyTimes()
+	userStorage.EXPECT().DeleteUser(gomock.Any(), stored.ID).DoAndReturn(func(context.Context, uint64) error {
+		deleted = true
+		return nil
+	})
+
+	tokenStorage := mock.NewMockTokenStorage(ctrl)
+	tokenStorage.EXPECT().ListTokens(gomock.Any(), stored.ID).Return([]storage.AccessToken{
+		{ID: 7, UserID: stored.ID},
+		{ID: 8, UserID: stored.ID, RevokedAt: &time.Time{}},
+	}, nil).AnyTimes()
+	tokenStorage.EXPECT().RevokeToken(gomock.Any(), uint64(7), gomock.Any()).Return(nil)
+
+	ts := newTestServer(t, withStorages(userStorage, nil, tokenStorage), withHashService(hashService))
+
+	do := func(method, uri string, header http.Header, body any) (int, http.Header, string) {
+		reqBody, err := json.Marshal(body)
+		require.NoError(t, err)
+		return testRequest(t, ts.Server, method, uri, bytes.NewBuffer(reqBody), header)
+	}
+
+	statusCode, header, got := do(http.MethodPost, handlers.AuthSignInURI, http.Header{}, handlers.SignInRequest{Login: "user", Password: "password"})
+	require.Equal(t, http.StatusOK, statusCode, got)
+	oldAuth := http.Header{"Authorization": header.Values("Authorization")}
+
+	// Changing the password requires the current one.
+	statusCode, _, got = do(http.MethodPost, handlers.AccountPasswordURI, oldAuth, handlers.ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "new"})
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+
+	statusCode, header, got = do(http.MethodPost, handlers.AccountPasswordURI, oldAuth, handlers.ChangePasswordRequest{CurrentPassword: "password", NewPassword: "new"})
+	require.Equal(t, http.StatusOK, statusCode, got)
+	newAuth := http.Header{"Authorization": header.Values("Authorization")}
+	assert.True(t, hashService.Match(stored.Password, "new"))
+
+	// The token used before the change is revoked, the returned one works.
+	statusCode, _, got = testRequest(t, ts.Server, http.MethodGet, handlers.TokensURI, nil, oldAuth)
+	require.Equal(t, http.StatusUnauthorized, statusCode, got)
+	statusCode, _, got = testRequest(t, ts.Server, http.MethodGet, handlers.TokensURI, nil, newAuth)
+	require.Equal(t, http.StatusOK, statusCode, got)
+
+	statusCode, _, got = do(http.MethodPost, handlers.AccountLoginURI, newAuth, handlers.ChangeLoginRequest{Login: " Taken"})
+	require.Equal(t, http.StatusConflict, statusCode, got)
+	statusCode, _, got = do(http.MethodPost, handlers.AccountLoginURI, newAuth, handlers.ChangeLoginRequest{Login: "Renamed"})
+	require.Equal(t, http.StatusNoContent, statusCode, got)
+	assert.Equal(t, "renamed", stored.Login)
+
+	statusCode, _, got = do(http.MethodDelete, handlers.AccountURI, newAuth, handlers.DeleteAccountRequest{Password: "password"})
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+	statusCode, _, got = do(http.MethodDelete, handlers.AccountURI, newAuth, handlers.DeleteAccountRequest{Password: "new"})
+	require.Equal(t, http.StatusNoContent, statusCode, got)
+	assert.True(t, deleted)
+
+	statusCode, _, got = testRequest(t, ts.Server, http.MethodGet, handlers.TokensURI, nil, newAuth)
+	require.Equal(t, http.StatusUnauthorized, statusCode, got)
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Limits of the number of users returned by GetAdminUsers.
+const (
+	AdminUsersLimit    = 100  // AdminUsersLimit is the number of users returned without the limit parameter.
+	MaxAdminUsersLimit = 1000 // MaxAdminUsersLimit is the largest accepted limit parameter.
+)
+
+// AdminUserResponse represents a user in the admin API, without their credentials.
+type AdminUserResponse struct {
+	ID          uint64 `json:"id"`           // Unique identifier of the user.
+	Login       string `json:"login"`        // Login of the user.
+	Role        string `json:"role"`         // storage.RoleUser or storage.RoleAdmin.
+	Disabled    bool   `json:"disabled"`     // Whether the account is disabled.
+	TOTPEnabled bool   `json:"totp_enabled"` // Whether sign-in requires a TOTP code.
+	SRPEnabled  bool   `json:"srp_enabled"`  // Whether zero-knowledge sign-in is enabled.
+}
+
+// newAdminUserResponse returns the AdminUserResponse of a user.
+func newAdminUserResponse(u storage.User) AdminUserResponse {
+	return AdminUserResponse{
+		ID:          u.ID,
+		Login:       u.Login,
+		Role:        u.Role,
+		Disabled:    u.Disabled,
+		TOTPEnabled: u.TOTPEnabled,
+		SRPEnabled:  len(u.SRPVerifier) > 0,
+	}
+}
+
+// MaintenanceJob is a job administrators can run with the admin API, like the collection of unused large objects.
+type MaintenanceJob struct {
+	Name string                                 // Name of the job in the URI.
+	Run  func(ctx context.Context) (any, error) // Run runs the job and returns its result, encoded as JSON.
+}
+
+// MaintenanceJobResponse represents the result of a maintenance job.
+type MaintenanceJobResponse struct {
+	Job      string `json:"job"`      // Name of the job.
+	Result   any    `json:"result"`   // Result of the job, specific to the job.
+	Duration string `json:"duration"` // How long the job took.
+}
+
+// WithMaintenanceJobs sets the jobs run by PostAdminJob.
+func WithMaintenanceJobs(jobs ...MaintenanceJob) Option {
+	return func(h *ServiceHandlers) {
+		h.maintenanceJobs = jobs
+	}
+}
+
+// adminUser returns the user of the request if they are an administrator.
+// Personal access tokens are rejected, the admin API requires a sign-in session.
+// It writes an error response and returns false otherwise.
+func (h *ServiceHandlers) adminUser(w http.ResponseWriter, r *http.Request) (storage.User, bool) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return storage.User{}, false
+	}
+	if !user.IsAdmin() {
+		http.Error(w, "this operation requires the admin role", http.StatusForbidden)
+		return storage.User{}, false
+	}
+	return user, true
+}
+
+// adminTargetUser returns the user of the userID URL parameter.
+// It writes an error response and returns false if the parameter is invalid or the user does not exist.
+func (h *ServiceHandlers) adminTargetUser(w http.ResponseWriter, r *http.Request) (storage.User, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse param userID: %v", err), http.StatusBadRequest)
+		return storage.User{}, false
+	}
+
+	user, err := h.userStorage.GetUser(r.Context(), id)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return storage.User{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return storage.User{}, false
+	}
+	return user, true
+}
+
+// GetAdminUsers handles listing and searching users.
+//
+// The optional query parameters are "q", a part of the login to search for ignoring case,
+// "after", the ID of a user to list the following users of, and "limit", the maximum number of users,
+// AdminUsersLimit by default.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the query parameters are invalid.
+//   - HTTP 403 Forbidden if the user is not an administrator or the request is authenticated with a personal access token.
+//   - HTTP 500 Internal Server Error if the users cannot be retrieved.
+//   - HTTP 200 OK with the list of users, ordered by ID.
+func (h *ServiceHandlers) GetAdminUsers(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.adminUser(w, r); !ok {
+		return
+	}
+
+	var afterID uint64
+	if after := r.URL.Query().Get("after"); after != "" {
+		var err error
+		afterID, err = strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse param after: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := AdminUsersLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > MaxAdminUsersLimit {
+			http.Error(w, fmt.Sprintf("param limit must be a number from 1 to %d", MaxAdminUsersLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	users, err := h.userStorage.ListUsers(r.Context(), r.URL.Query().Get("q"), afterID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]AdminUserResponse, 0, len(users))
+	for _, u := range users {
+		response = append(response, newAdminUserResponse(u))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetAdminUser handles retrieving a user by ID.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the user ID is invalid.
+//   - HTTP 403 Forbidden if the user is not an administrator or the request is authenticated with a personal access token.
+//   - HTTP 404 Not Found if the user does not exist.
+//   - HTTP 200 OK with an AdminUserResponse.
+func (h *ServiceHandlers) GetAdminUser(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.adminUser(w, r); !ok {
+		return
+	}
+	user, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAdminUserResponse(user))
+}
+
+// GetAdminUserUsage handles reporting the vault storage used by a user and their quota.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the user ID is invalid.
+//   - HTTP 403 Forbidden if the user is not an administrator or the request is authenticated with a personal access token.
+//   - HTTP 404 Not Found if the user does not exist.
+//   - HTTP 500 Internal Server Error if the usage cannot be retrieved.
+//   - HTTP 200 OK with a UsageResponse.
+func (h *ServiceHandlers) GetAdminUserUsage(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.adminUser(w, r); !ok {
+		return
+	}
+	user, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := h.quotaStorage.GetUsage(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	quota, err := h.quotaStorage.GetQuota(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UsageResponse{Usage: usage, Quota: quota})
+}
+
+// PostAdminDisableUser handles disabling an account. The user is signed out of all sessions
+// and can neither sign in nor use their personal access tokens until the account is enabled again.
+// Administrators can't disable their own account.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the user ID is invalid or is the ID of the administrator.
+//   - HTTP 403 Forbidden if the user is not an administrator or the request is authenticated with a personal access token.
+//   - HTTP 404 Not Found if the user does not exist.
+//   - HTTP 409 Conflict if the user was changed concurrently, the request can be retried.
+//   - HTTP 500 Internal Server Error if the user cannot be updated.
+//   - HTTP 200 OK with the updated AdminUserResponse.
+func (h *ServiceHandlers) PostAdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	h.adminUpdateUser(w, r, storage.AuditAdminDisable, true, func(admin storage.User, u *storage.User) error {
+		if u.ID == admin.ID {
+			return errors.New("administrators can't disable their own account")
+		}
+		u.Disabled = true
+		return nil
+	})
+}
+
+// PostAdminEnableUser handles enabling an account disabled with PostAdminDisableUser.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the user ID is invalid.
+//   - HTTP 403 Forbidden if the user is not an administrator or the request is authenticated with a personal access token.
+//   - HTTP 404 Not Found if the user does not exist.
+//   - HTTP 409 Conflict if the user was changed concurrently, the request can be retried.
+//   - HTTP 500 Internal Server Error if the user cannot be updated.
+//   - HTTP 200 OK with the updated AdminUserResponse.
+func (h *ServiceHandlers) PostAdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	h.adminUpdateUser(w, r, storage.AuditAdminEnable, false, func(_ storage.User, u *storage.User) error {
+		u.Disabled = false
+		return nil
+	})
+}
+
+// PostAdminLogoutUser handles signing a user out of all sessions. Their personal access tokens stay valid,
+// they can be blocked by disabling the account.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the user ID is invalid.
+//   - HTTP 403 Forbidden if the user is not an administrator or the request is authenticated with a personal access token.
+//   - HTTP 404 Not Found if the user does not exist.
+//   - HTTP 409 Conflict if the user was changed concurrently, the request can be retried.
+//   - HTTP 500 Internal Server Error if the user cannot be updated.
+//   - HTTP 200 OK with the AdminUserResponse.
+func (h *ServiceHandlers) PostAdminLogoutUser(w http.ResponseWriter, r *http.Request) {
+	h.adminUpdateUser(w, r, storage.AuditAdminLogout, true, func(storage.User, *storage.User) error { return nil })
+}
+
+// PostAdminResetTwoFactor handles disabling two-factor authentication of a user who lost their authenticator
+// and recovery codes, so that they can sign in with their password and enroll again.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the user ID is invalid.
+//   - HTTP 403 Forbidden if the user is not an administrator or the request is authenticated with a personal access token.
+//   - HTTP 404 Not Found if the user does not exist.
+//   - HTTP 409 Conflict if the user was changed concurrently, the request can be retried.
+//   - HTTP 500 Internal Server Error if the user cannot be updated.
+//   - HTTP 200 OK with the updated AdminUserResponse.
+func (h *ServiceHandlers) PostAdminResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	h.adminUpdateUser(w, r, storage.AuditAdminResetTwoFactor, false, func(_ storage.User, u *storage.User) error {
+		u.TOTPSecret = ""
+		u.TOTPEnabled = false
+		u.TOTPLastStep = 0
+		u.RecoveryCodes = nil
+		return nil
+	})
+}
+
+// adminUpdateUser applies an administrator's change to the user of the userID URL parameter and records it
+// in the audit log first, the change is refused if it cannot be recorded. An error of the change is reported
+// as HTTP 400 Bad Request. If signOut is set, all sign-in tokens of the user are revoked and their sessions are ended.
+func (h *ServiceHandlers) adminUpdateUser(
+	w http.ResponseWriter,
+	r *http.Request,
+	action string,
+	signOut bool,
+	change func(admin storage.User, u *storage.User) error,
+) {
+	ctx := r.Context()
+	admin, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+	user, ok := h.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := change(admin, &user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.audit(r, storage.AuditEvent{Action: action, UserID: user.ID, Login: user.Login, Detail: admin.Login})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if signOut {
+		user.TokenVersion++
+	}
+	err = h.userStorage.UpdateUser(ctx, user)
+	if err != nil {
+		updateUserFailed(w, err, http.StatusInternalServerError)
+		return
+	}
+	if signOut && h.sessionStorage != nil {
+		err = h.sessionStorage.RevokeOtherSessions(ctx, user.ID, 0, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	logger.Logger().Info("admin action", zap.String("action", action), zap.String("admin", admin.Login), zap.String("login", user.Login))
+	writeJSON(w, http.StatusOK, newAdminUserResponse(user))
+}
+
+// GetAdminJobs handles listing the names of the maintenance jobs.
+//
+// The handler responds with:
+//   - HTTP 403 Forbidden if the user is not an administrator or the request is authenticated with a personal access token.
+//   - HTTP 200 OK with the sorted list of names.
+func (h *ServiceHandlers) GetAdminJobs(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.adminUser(w, r); !ok {
+		return
+	}
+
+	names := make([]string, 0, len(h.maintenanceJobs))
+	for _, j := range h.maintenanceJobs {
+		names = append(names, j.Name)
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, names)
+}
+
+// PostAdminJob handles running a maintenance job. The job runs while the request is served,
+// so it is limited by the timeout of requests.
+//
+// The handler responds with:
+//   - HTTP 403 Forbidden if the user is not an administrator or the request is authenticated with a personal access token.
+//   - HTTP 404 Not Found if there is no job with the name.
+//   - HTTP 500 Internal Server Error if the job failed.
+//   - HTTP 200 OK with a MaintenanceJobResponse.
+func (h *ServiceHandlers) PostAdminJob(w http.ResponseWriter, r *http.Request) {
+	admin, ok := h.adminUser(w, r)
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "job")
+	var job *MaintenanceJob
+	for i := range h.maintenanceJobs {
+		if h.maintenanceJobs[i].Name == name {
+			job = &h.maintenanceJobs[i]
+		}
+	}
+	if job == nil {
+		http.Error(w, fmt.Sprintf("unknown job %s", name), http.StatusNotFound)
+		return
+	}
+
+	err := h.audit(r, storage.AuditEvent{Action: storage.AuditAdminJob, UserID: admin.ID, Login: admin.Login, Detail: name})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	start := time.Now()
+	result, err := job.Run(r.Context())
+	if err != nil {
+		logger.Logger().Error("maintenance job failed", zap.String("job", name), zap.Error(err))
+		http.Error(w, fmt.Sprintf("job %s failed: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+	logger.Logger().Info("maintenance job finished", zap.String("job", name), zap.String("admin", admin.Login))
+
+	writeJSON(w, http.StatusOK, MaintenanceJobResponse{Job: name, Result: result, Duration: time.Since(start).String()})
+}
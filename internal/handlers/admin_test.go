@@ -0,0 +1,144 @@
+package handlers_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/auth"
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	vaultStorage := memory.NewVaultStorage()
+	tokenStorage := memory.NewTokenStorage()
+	userStorage := memory.NewUserStorage(vaultStorage, tokenStorage)
+	sessionStorage := memory.NewSessionStorage()
+	auditStorage := memory.NewAuditStorage()
+
+	jobRuns := 0
+	ts := newTestServer(t,
+		withStorages(userStorage, vaultStorage, tokenStorage),
+		withProviderOptions(auth.WithSessionStorage(sessionStorage)),
+		withHandlerOptions(
+			handlers.WithSessionStorage(sessionStorage),
+			handlers.WithQuotaStorage(vaultStorage),
+			handlers.WithAuditStorage(auditStorage),
+			handlers.WithMaintenanceJobs(handlers.MaintenanceJob{Name: "count", Run: func(context.Context) (any, error) {
+				jobRuns++
+				return map[string]int{"runs": jobRuns}, nil
+			}}),
+		),
+	)
+	c := client.NewClient(ts.URL)
+
+	for _, login := range []string{"root", "alice", "bob"} {
+		require.NoError(t, c.CreateUser(login, "password"))
+	}
+	root, err := userStorage.GetUserByLogin(ctx, "root")
+	require.NoError(t, err)
+	alice, err := userStorage.GetUserByLogin(ctx, "alice")
+	require.NoError(t, err)
+	aliceID := strconv.FormatUint(alice.ID, 10)
+
+	// Regular users and personal access tokens of administrators are rejected.
+	aliceToken, err := c.SignIn("alice", "password")
+	require.NoError(t, err)
+	_, err = c.AdminListUsers(aliceToken, "", 0)
+	assert.ErrorContains(t, err, "403")
+
+	root.Role = storage.RoleAdmin
+	require.NoError(t, userStorage.UpdateUser(ctx, root))
+	rootToken, err := c.SignIn("root", "password")
+	require.NoError(t, err)
+	pat, err := c.CreateToken(rootToken, handlers.TokenRequest{Name: "ci", Permission: "write"})
+	require.NoError(t, err)
+	_, err = c.AdminListUsers(pat.Token, "", 0)
+	assert.ErrorContains(t, err, "403")
+
+	users, err := c.AdminListUsers(rootToken, "", 0)
+	require.NoError(t, err)
+	require.Len(t, users, 3)
+	assert.Equal(t, handlers.AdminUserResponse{ID: root.ID, Login: "root", Role: storage.RoleAdmin}, users[0])
+	users, err = c.AdminListUsers(rootToken, "LIC", 0)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "alice", users[0].Login)
+	users, err = c.AdminListUsers(rootToken, "", alice.ID)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "bob", users[0].Login)
+
+	usage, err := c.AdminGetUsage(rootToken, aliceID)
+	require.NoError(t, err)
+	assert.Zero(t, usage.Usage.Entries)
+	_, err = c.AdminGetUser(rootToken, "999")
+	assert.ErrorContains(t, err, "404")
+
+	// Disabling signs the user out and rejects their sign-ins until the account is enabled again.
+	_, err = c.AdminUpdateUser(rootToken, strconv.FormatUint(root.ID, 10), "disable")
+	assert.ErrorContains(t, err, "400", "administrators can't lock themselves out")
+	u, err := c.AdminUpdateUser(rootToken, aliceID, "disable")
+	require.NoError(t, err)
+	assert.True(t, u.Disabled)
+	_, err = c.GetUsage(aliceToken)
+	assert.ErrorContains(t, err, "401")
+	_, err = c.SignIn("alice", "password")
+	assert.ErrorContains(t, err, "403")
+	_, err = c.SignIn("alice", "wrong")
+	assert.ErrorContains(t, err, "400", "the state of the account is only revealed to the owner")
+
+	u, err = c.AdminUpdateUser(rootToken, aliceID, "enable")
+	require.NoError(t, err)
+	assert.False(t, u.Disabled)
+	aliceToken, err = c.SignIn("alice", "password")
+	require.NoError(t, err)
+
+	_, err = c.AdminUpdateUser(rootToken, aliceID, "logout")
+	require.NoError(t, err)
+	_, err = c.GetUsage(aliceToken)
+	assert.ErrorContains(t, err, "401")
+	sessions, err := sessionStorage.ListSessions(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	alice, err = userStorage.GetUser(ctx, alice.ID)
+	require.NoError(t, err)
+	alice.TOTPSecret, alice.TOTPEnabled, alice.RecoveryCodes = "SECRET", true, []string{"hash"}
+	require.NoError(t, userStorage.UpdateUser(ctx, alice))
+	u, err = c.AdminUpdateUser(rootToken, aliceID, "reset-2fa")
+	require.NoError(t, err)
+	assert.False(t, u.TOTPEnabled)
+	_, err = c.SignIn("alice", "password")
+	require.NoError(t, err, "no second factor is required")
+
+	jobs, err := c.AdminListJobs(rootToken)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"count"}, jobs)
+	result, err := c.AdminRunJob(rootToken, "count")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"runs": float64(1)}, result.Result)
+	_, err = c.AdminRunJob(rootToken, "unknown")
+	assert.ErrorContains(t, err, "404")
+
+	// The actions are recorded in the audit log of the users.
+	events, err := auditStorage.ListAuditEvents(ctx, alice.ID, 0, 100)
+	require.NoError(t, err)
+	var actions []string
+	for _, e := range events {
+		if e.Detail == "root" {
+			actions = append(actions, e.Action)
+		}
+	}
+	assert.Equal(t, []string{
+		storage.AuditAdminResetTwoFactor, storage.AuditAdminLogout, storage.AuditAdminEnable, storage.AuditAdminDisable,
+	}, actions)
+}
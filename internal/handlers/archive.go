@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/andreevym/gophkeeper/internal/archive"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ArchivePassphraseHeader is the request header holding the passphrase the archive is encrypted with.
+// The passphrase is sent in a header rather than in the URL, which may end up in access logs.
+const ArchivePassphraseHeader = "X-Archive-Passphrase"
+
+// ImportLimits bound the resources PostImport uses, so that imports can't exhaust the server.
+// The key derivation of imported archives is bounded by archive.DefaultKDF.
+type ImportLimits struct {
+	MaxArchiveSize int64 // Size limit of the archives, which are kept in a temporary file while they are imported.
+	MaxValueSize   int64 // Size limit of the values of the entries, which are held in memory one at a time.
+	MaxConcurrent  int   // Number of imports running at the same time, further imports are rejected.
+}
+
+// DefaultImportLimits are the limits of PostImport unless changed with WithImportLimits.
+var DefaultImportLimits = ImportLimits{MaxArchiveSize: 256 << 20, MaxValueSize: 64 << 20, MaxConcurrent: 2}
+
+// WithImportLimits replaces DefaultImportLimits.
+func WithImportLimits(limits ImportLimits) Option {
+	return func(h *ServiceHandlers) {
+		h.importLimits = limits
+	}
+}
+
+// Policies of PostImport for archived entries with the key of an existing entry.
+const (
+	DuplicatesSkip      = "skip"      // DuplicatesSkip keeps the existing entry and ignores the archived one.
+	DuplicatesOverwrite = "overwrite" // DuplicatesOverwrite replaces the value of the existing entry.
+	DuplicatesKeep      = "keep"      // DuplicatesKeep creates the archived entry next to the existing one.
+)
+
+// ImportResponse reports the outcome of an import.
+type ImportResponse struct {
+	Created     int               `json:"created"`     // Number of entries created.
+	Overwritten int               `json:"overwritten"` // Number of existing entries overwritten.
+	Skipped     int               `json:"skipped"`     // Number of archived entries skipped as duplicates.
+	IDs         map[uint64]uint64 `json:"ids"`         // IDs of the created and overwritten entries by their ID in the archive.
+}
+
+// PostExport handles exporting all vault entries of the current user, their keys and values,
+// to an archive encrypted with the passphrase in the ArchivePassphraseHeader header.
+// The archive is streamed as the response body and can be imported with PostImport into any server.
+// The export is recorded in the audit log before any value is sent.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the passphrase is missing.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 500 Internal Server Error if the entries cannot be listed or the export cannot be recorded.
+//   - HTTP 200 OK with the archive. If an entry fails to be read afterwards, the archive is left incomplete,
+//     which is detected when it is read.
+func (h *ServiceHandlers) PostExport(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+	passphrase := r.Header.Get(ArchivePassphraseHeader)
+	if passphrase == "" {
+		http.Error(w, fmt.Sprintf("header %s is required", ArchivePassphraseHeader), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	vaults, err := h.vaultStorage.ListVaults(ctx, user.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list vaults: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = h.audit(r, storage.AuditEvent{Action: storage.AuditVaultExport, UserID: user.ID, Login: user.Login, Detail: strconv.Itoa(len(vaults))})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.gkarchive"`, user.Login))
+	aw, err := archive.NewWriter(w, passphrase, archive.Manifest{Login: user.Login, CreatedAt: h.now().UTC()})
+	if err != nil {
+		logger.Logger().Error("failed to export vaults", zap.Uint64("userID", user.ID), zap.Error(err))
+		return
+	}
+	for _, v := range vaults {
+		v, err = h.vaultStorage.GetVault(ctx, v.ID)
+		if errors.Is(err, storage.ErrVaultNotFound) {
+			// Deleted since it was listed.
+			continue
+		}
+		if err == nil {
+			err = aw.WriteEntry(archive.Entry{ID: v.ID, Key: v.Key, Value: v.Value})
+		}
+		if err != nil {
+			logger.Logger().Error("failed to export vaults", zap.Uint64("userID", user.ID), zap.Uint64("vaultID", v.ID), zap.Error(err))
+			return
+		}
+	}
+	if err = aw.Close(); err != nil {
+		logger.Logger().Error("failed to export vaults", zap.Uint64("userID", user.ID), zap.Error(err))
+	}
+}
+
+// PostImport handles importing the vault entries of an archive created by PostExport into the account of
+// the current user. The archive is the request body, decrypted with the passphrase in the
+// ArchivePassphraseHeader header, and is verified completely before any entry is written.
+// Imported entries get new IDs, ImportResponse maps the IDs in the archive to them.
+// Imports are bounded by the ImportLimits, and only archives with the key derivation parameters of
+// archive.DefaultKDF or cheaper ones are accepted.
+//
+// The optional query parameter "duplicates" decides what happens to an archived entry with the key of an
+// existing entry: DuplicatesSkip, the default, DuplicatesOverwrite or DuplicatesKeep. Each existing entry
+// matches a single archived entry, so importing an archive twice with DuplicatesSkip creates nothing the second time.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the passphrase or the duplicates parameter is invalid, or the archive is damaged.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 413 Request Entity Too Large if the archive or the value of an entry exceeds the ImportLimits,
+//     or an entry is larger than the storage quota of the user.
+//   - HTTP 507 Insufficient Storage if the entries don't fit into the remaining storage quota of the user.
+//     The entries imported before are kept.
+//   - HTTP 500 Internal Server Error if the entries cannot be stored.
+//   - HTTP 503 Service Unavailable with a Retry-After header if too many imports are running.
+//   - HTTP 200 OK with the ImportResponse.
+func (h *ServiceHandlers) PostImport(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+	passphrase := r.Header.Get(ArchivePassphraseHeader)
+	if passphrase == "" {
+		http.Error(w, fmt.Sprintf("header %s is required", ArchivePassphraseHeader), http.StatusBadRequest)
+		return
+	}
+	duplicates := r.URL.Query().Get("duplicates")
+	switch duplicates {
+	case "":
+		duplicates = DuplicatesSkip
+	case DuplicatesSkip, DuplicatesOverwrite, DuplicatesKeep:
+	default:
+		http.Error(w, fmt.Sprintf("param duplicates must be %s, %s or %s", DuplicatesSkip, DuplicatesOverwrite, DuplicatesKeep), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.imports <- struct{}{}:
+		defer func() { <-h.imports }()
+	default:
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "too many imports are running, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The archive is read twice, to verify it and to import it, so it is kept in a temporary file meanwhile.
+	file, err := os.CreateTemp("", "gophkeeper-import-*")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create temporary file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err = io.Copy(file, http.MaxBytesReader(w, r.Body, h.importLimits.MaxArchiveSize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, fmt.Sprintf("archive is larger than %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read archive: %v", err), http.StatusBadRequest)
+		return
+	}
+	// The key is derived once for both passes, deriving it is the expensive part of reading an archive.
+	readerOpts := []archive.ReaderOption{archive.WithMaxKDF(archive.DefaultKDF), archive.WithMaxValueSize(h.importLimits.MaxValueSize)}
+	key, err := deriveArchiveKey(file, passphrase, readerOpts)
+	if err == nil {
+		err = readArchive(file, key, readerOpts, func(archive.Entry) error { return nil })
+	}
+	if errors.Is(err, archive.ErrValueTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	existing, err := h.vaultStorage.ListVaults(ctx, user.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list vaults: %v", err), http.StatusInternalServerError)
+		return
+	}
+	byKey := make(map[string][]uint64)
+	for _, v := range existing {
+		byKey[v.Key] = append(byKey[v.Key], v.ID)
+	}
+
+	resp := ImportResponse{IDs: make(map[uint64]uint64)}
+	err = readArchive(file, key, readerOpts, func(e archive.Entry) error {
+		v := storage.Vault{Key: e.Key, Value: e.Value, UserID: user.ID}
+		if ids := byKey[e.Key]; len(ids) > 0 && duplicates != DuplicatesKeep {
+			byKey[e.Key] = ids[1:]
+			if duplicates == DuplicatesSkip {
+				resp.Skipped++
+				return nil
+			}
+			v.ID = ids[0]
+			if err := h.vaultStorage.UpdateVault(ctx, v); err != nil {
+				return err
+			}
+			resp.Overwritten++
+		} else {
+			created, err := h.vaultStorage.CreateVault(ctx, v)
+			if err != nil {
+				return err
+			}
+			v.ID = created.ID
+			resp.Created++
+		}
+		resp.IDs[e.ID] = v.ID
+		return nil
+	})
+	detail := fmt.Sprintf("created %d, overwritten %d, skipped %d", resp.Created, resp.Overwritten, resp.Skipped)
+	_ = h.audit(r, storage.AuditEvent{Action: storage.AuditVaultImport, UserID: user.ID, Login: user.Login, Detail: detail})
+	if writeQuotaError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to import vaults: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// deriveArchiveKey derives the key of the archive in file from the passphrase.
+func deriveArchiveKey(file *os.File, passphrase string, opts []archive.ReaderOption) (*archive.Key, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return archive.DeriveKey(file, passphrase, opts...)
+}
+
+// readArchive reads the archive in file from its beginning and calls fn with every entry.
+// The archive errors are returned as they are, the errors of fn are wrapped.
+func readArchive(file *os.File, key *archive.Key, opts []archive.ReaderOption, fn func(archive.Entry) error) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	ar, err := archive.NewReaderWithKey(file, key, opts...)
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := ar.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(e); err != nil {
+			return fmt.Errorf("failed to import entry %d: %w", e.ID, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/archive"
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newArchiveServer starts a server backed by the memory storage with the user "alice" signed in.
+// Returns the client, the session token of alice and the vault and audit storages.
+func newArchiveServer(t *testing.T, opts ...handlers.Option) (*client.Client, string, *memory.VaultStorage, *memory.AuditStorage) {
+	t.Helper()
+	vaultStorage := memory.NewVaultStorage()
+	tokenStorage := memory.NewTokenStorage()
+	userStorage := memory.NewUserStorage(vaultStorage, tokenStorage)
+	auditStorage := memory.NewAuditStorage()
+	ts := newTestServer(t,
+		withStorages(userStorage, vaultStorage, tokenStorage),
+		withHandlerOptions(append([]handlers.Option{handlers.WithAuditStorage(auditStorage)}, opts...)...),
+	)
+
+	c := client.NewClient(ts.URL)
+	require.NoError(t, c.CreateUser("alice", "password"))
+	token, err := c.SignIn("alice", "password")
+	require.NoError(t, err)
+	return c, token, vaultStorage, auditStorage
+}
+
+// vaultValues returns the values of the vaults of the first user by their keys, joined if a key repeats.
+func vaultValues(t *testing.T, vaultStorage *memory.VaultStorage) map[string]string {
+	t.Helper()
+	ctx := context.Background()
+	vaults, err := vaultStorage.ListVaults(ctx, 1)
+	require.NoError(t, err)
+	values := make(map[string]string)
+	for _, v := range vaults {
+		v, err = vaultStorage.GetVault(ctx, v.ID)
+		require.NoError(t, err)
+		values[v.Key] += string(v.Value)
+	}
+	return values
+}
+
+func TestArchive(t *testing.T) {
+	t.Parallel()
+	c, token, _, auditStorage := newArchiveServer(t)
+	note, err := c.NewVault(token, "note", "meet at noon", "")
+	require.NoError(t, err)
+	_, err = c.NewVault(token, "card/visa", `{"number":"4111111111111111"}`, "")
+	require.NoError(t, err)
+	_, err = c.NewVault(token, "binary/key.bin", "00ff10", "")
+	require.NoError(t, err)
+
+	// Exports require the passphrase and a sign-in session.
+	var buf bytes.Buffer
+	assert.ErrorContains(t, c.ExportVault(token, "", &buf), "400")
+	pat, err := c.CreateToken(token, handlers.TokenRequest{Name: "ci", Permission: "write"})
+	require.NoError(t, err)
+	assert.ErrorContains(t, c.ExportVault(pat.Token, "passphrase", &buf), "403")
+
+	require.NoError(t, c.ExportVault(token, "passphrase", &buf))
+	exported := buf.Bytes()
+	manifest, entries, err := archive.Verify(bytes.NewReader(exported), "passphrase")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", manifest.Login)
+	assert.Equal(t, 3, entries)
+	events, err := auditStorage.ListAuditEvents(context.Background(), 1, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, storage.AuditVaultExport, events[0].Action)
+	assert.Equal(t, "3", events[0].Detail)
+
+	// Another server, where alice already has a different note.
+	c2, token2, vaultStorage2, _ := newArchiveServer(t)
+	_, err = c2.NewVault(token2, "note", "old note", "")
+	require.NoError(t, err)
+
+	t.Run("invalid archives change nothing", func(t *testing.T) {
+		_, err := c2.ImportVault(token2, "guess", bytes.NewReader(exported), "")
+		assert.ErrorContains(t, err, archive.ErrPassphrase.Error())
+		damaged := bytes.Clone(exported)
+		damaged[len(damaged)-1] ^= 1
+		_, err = c2.ImportVault(token2, "passphrase", bytes.NewReader(damaged), "")
+		assert.ErrorContains(t, err, "400")
+		_, err = c2.ImportVault(token2, "passphrase", bytes.NewReader(exported), "merge")
+		assert.ErrorContains(t, err, "400")
+		assert.Equal(t, map[string]string{"note": "old note"}, vaultValues(t, vaultStorage2))
+	})
+
+	result, err := c2.ImportVault(token2, "passphrase", bytes.NewReader(exported), "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Len(t, result.IDs, 2)
+	assert.NotContains(t, result.IDs, note.ID)
+	assert.Equal(t, map[string]string{
+		"note":           "old note",
+		"card/visa":      `{"number":"4111111111111111"}`,
+		"binary/key.bin": "00ff10",
+	}, vaultValues(t, vaultStorage2))
+
+	// Importing again skips every entry, each existing entry matches one archived entry.
+	result, err = c2.ImportVault(token2, "passphrase", bytes.NewReader(exported), handlers.DuplicatesSkip)
+	require.NoError(t, err)
+	assert.Equal(t, handlers.ImportResponse{Skipped: 3, IDs: map[uint64]uint64{}}, result)
+
+	result, err = c2.ImportVault(token2, "passphrase", bytes.NewReader(exported), handlers.DuplicatesOverwrite)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Overwritten)
+	got, err := c2.GetVault(token2, strconv.FormatUint(result.IDs[note.ID], 10))
+	require.NoError(t, err)
+	assert.Equal(t, "note", got.Key)
+	assert.Equal(t, "meet at noon", got.Value)
+
+	result, err = c2.ImportVault(token2, "passphrase", bytes.NewReader(exported), handlers.DuplicatesKeep)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Created)
+	assert.Equal(t, "meet at noonmeet at noon", vaultValues(t, vaultStorage2)["note"])
+}
+
+func TestImportLimits(t *testing.T) {
+	t.Parallel()
+	limits := handlers.ImportLimits{MaxArchiveSize: 64 << 10, MaxValueSize: 10, MaxConcurrent: 1}
+	c, token, vaultStorage, _ := newArchiveServer(t, handlers.WithImportLimits(limits))
+
+	writeArchive := func(kdfMemory uint32, values ...string) []byte {
+		var buf bytes.Buffer
+		w, err := archive.NewWriter(&buf, "passphrase", archive.Manifest{Login: "alice"})
+		require.NoError(t, err)
+		for i, v := range values {
+			require.NoError(t, w.WriteEntry(archive.Entry{ID: uint64(i + 1), Key: "k" + strconv.Itoa(i), Value: []byte(v)}))
+		}
+		require.NoError(t, w.Close())
+		data := buf.Bytes()
+		if kdfMemory != 0 {
+			// The memory cost follows the magic and the version in the header.
+			binary.BigEndian.PutUint32(data[len("GOPHKEEPER-ARCHIVE")+1:], kdfMemory)
+		}
+		return data
+	}
+
+	// Archives deriving their key with more memory than archive.DefaultKDF are refused before the key is derived.
+	_, err := c.ImportVault(token, "passphrase", bytes.NewReader(writeArchive(2*archive.DefaultKDF.Memory, "value")), "")
+	assert.ErrorContains(t, err, "400")
+
+	_, err = c.ImportVault(token, "passphrase", bytes.NewReader(writeArchive(0, "short", "much too long")), "")
+	assert.ErrorContains(t, err, "413")
+	random := make([]byte, limits.MaxArchiveSize+1)
+	_, err = rand.Read(random)
+	require.NoError(t, err)
+	_, err = c.ImportVault(token, "passphrase", bytes.NewReader(random), "")
+	assert.ErrorContains(t, err, "413")
+	assert.Empty(t, vaultValues(t, vaultStorage))
+
+	// While an import is uploading, a second one is refused.
+	body, upload := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.ImportVault(token, "passphrase", body, "")
+		done <- err
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := c.ImportVault(token, "passphrase", bytes.NewReader(nil), "")
+		return err != nil && strings.Contains(err.Error(), "503")
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = upload.Write(writeArchive(0, "value"))
+	require.NoError(t, err)
+	require.NoError(t, upload.Close())
+	require.NoError(t, <-done)
+	assert.Equal(t, map[string]string{"k0": "value"}, vaultValues(t, vaultStorage))
+}
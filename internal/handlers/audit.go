@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// Limits of the number of audit events returned by GetAudit.
+const (
+	AuditEventsLimit    = 100  // AuditEventsLimit is the number of events returned without the limit parameter.
+	MaxAuditEventsLimit = 1000 // MaxAuditEventsLimit is the largest accepted limit parameter.
+)
+
+// GetAudit handles listing the audit log of the current user: sign-ins, failed sign-ins into the account,
+// reads and writes of vault entries and changes of personal access tokens, newest first.
+//
+// The optional query parameters are "before", the ID of an event to list the older events of,
+// and "limit", the maximum number of events, AuditEventsLimit by default.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the query parameters are invalid.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 500 Internal Server Error if the events cannot be retrieved.
+//   - HTTP 200 OK with the list of events.
+func (h *ServiceHandlers) GetAudit(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var beforeID uint64
+	if before := r.URL.Query().Get("before"); before != "" {
+		var err error
+		beforeID, err = strconv.ParseUint(before, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse param before: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := AuditEventsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > MaxAuditEventsLimit {
+			http.Error(w, fmt.Sprintf("param limit must be a number from 1 to %d", MaxAuditEventsLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := h.auditStorage.ListAuditEvents(r.Context(), user.ID, beforeID, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
+
+// audit appends an event of the request to the audit log, if enabled. The time, the client and the request ID
+// are taken from the request, the personal access token from the session unless set.
+// Failures are logged and returned, callers refuse access to secrets if the access cannot be recorded.
+func (h *ServiceHandlers) audit(r *http.Request, e storage.AuditEvent) error {
+	if h.auditStorage == nil {
+		return nil
+	}
+
+	e.CreatedAt = h.now()
+	e.IP = clientIP(r)
+	e.UserAgent = r.UserAgent()
+	if len(e.UserAgent) > 512 {
+		e.UserAgent = e.UserAgent[:512]
+	}
+	e.RequestID = middleware.GetReqID(r.Context())
+	if e.TokenID == 0 {
+		if t, ok := h.authProvider.GetTokenFromSession(r.Context()); ok {
+			e.TokenID = t.ID
+		}
+	}
+
+	_, err := h.auditStorage.AppendAuditEvent(r.Context(), e)
+	if err != nil {
+		logger.Logger().Error("failed to write audit log", zap.String("action", e.Action), zap.Uint64("userID", e.UserID), zap.Error(err))
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+
+	auditStorage := memory.NewAuditStorage()
+	ts := newTestServer(t, withHandlerOptions(handlers.WithAuditStorage(auditStorage)))
+
+	do := func(method, uri string, header http.Header, body any) (int, http.Header, string) {
+		reqBody, err := json.Marshal(body)
+		require.NoError(t, err)
+		return testRequest(t, ts.Server, method, uri, bytes.NewBuffer(reqBody), header)
+	}
+
+	statusCode, _, got := do(http.MethodPost, handlers.AuthSignUpURI, http.Header{}, handlers.SignUpRequest{Login: "user", Password: "password"})
+	require.Equal(t, http.StatusCreated, statusCode, got)
+	statusCode, _, got = do(http.MethodPost, handlers.AuthSignInURI, http.Header{}, handlers.SignInRequest{Login: "user", Password: "wrong"})
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+	statusCode, header, got := do(http.MethodPost, handlers.AuthSignInURI, http.Header{}, handlers.SignInRequest{Login: "user", Password: "password", Device: "laptop"})
+	require.Equal(t, http.StatusOK, statusCode, got)
+	authHeader := http.Header{"Authorization": []string{header.Get("Authorization")}}
+
+	statusCode, _, got = do(http.MethodPost, handlers.VaultURI, authHeader, handlers.VaultRequest{Key: "k", Value: "secret"})
+	require.Equal(t, http.StatusCreated, statusCode, got)
+	v := handlers.VaultResponse{}
+	require.NoError(t, json.Unmarshal([]byte(got), &v))
+	statusCode, _, got = do(http.MethodGet, handlers.VaultURI+"/"+strconv.FormatUint(v.ID, 10), authHeader, nil)
+	require.Equal(t, http.StatusOK, statusCode, got)
+
+	statusCode, _, got = do(http.MethodGet, handlers.AuditURI, authHeader, nil)
+	require.Equal(t, http.StatusOK, statusCode, got)
+	var events []storage.AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(got), &events))
+	require.Len(t, events, 4)
+	actions := make([]string, 0, len(events))
+	for _, e := range events {
+		actions = append(actions, e.Action)
+		assert.Equal(t, "user", e.Login)
+		assert.NotEmpty(t, e.RequestID)
+		assert.Equal(t, "127.0.0.1", e.IP)
+	}
+	assert.Equal(t, []string{storage.AuditVaultRead, storage.AuditVaultCreate, storage.AuditSignIn, storage.AuditSignInFailed}, actions)
+	assert.Equal(t, v.ID, events[0].VaultID)
+	assert.Equal(t, "laptop", events[2].Detail)
+	assert.Equal(t, handlers.SignInFailureInvalidPassword, events[3].Detail)
+
+	exported, err := auditStorage.ExportAuditEvents(context.Background(), 0, 10)
+	require.NoError(t, err)
+	_, err = storage.VerifyAuditChain("", exported)
+	assert.NoError(t, err)
+
+	statusCode, _, got = do(http.MethodGet, handlers.AuditURI+"?limit=2&before="+strconv.FormatUint(events[1].ID, 10), authHeader, nil)
+	require.Equal(t, http.StatusOK, statusCode, got)
+	require.NoError(t, json.Unmarshal([]byte(got), &events))
+	require.Len(t, events, 2)
+	assert.Equal(t, storage.AuditSignIn, events[0].Action)
+
+	statusCode, _, _ = do(http.MethodGet, handlers.AuditURI+"?limit=0", authHeader, nil)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	statusCode, _, _ = do(http.MethodGet, handlers.AuditURI, http.Header{}, nil)
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
 
@@ -18,7 +22,15 @@ import (
 // Depending on whether a vault ID is provided, this handler either creates a new vault entry or
 // updates an existing one. The uploaded file will be saved to the server's storage system. The handler
 // processes the file from the request's multipart form data and performs the appropriate action based on
-// the presence of a vault ID.
+// the presence of a vault ID. With WithVaultValueStorage, the file is copied into the storage piece by piece
+// instead of being read into memory.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there are errors in request processing or validation.
+//   - HTTP 413 Request Entity Too Large if the file is larger than 10MB or the storage quota of the user.
+//   - HTTP 507 Insufficient Storage if the file doesn't fit into the remaining storage quota of the user.
+//   - HTTP 201 Created if a new vault entry is created successfully.
+//   - HTTP 200 OK if an existing vault entry is updated successfully.
 func (h *ServiceHandlers) FileUploadHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -33,8 +45,15 @@ func (h *ServiceHandlers) FileUploadHandler(w http.ResponseWriter, r *http.Reque
 	const maxUploadSize = 10 << 20 // 10MB
 	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 
-	// Parse the form to retrieve file information.
-	err = r.ParseMultipartForm(maxUploadSize)
+	// Parse the form to retrieve file information. Files larger than maxUploadMemory are buffered in
+	// temporary files, which the server removes after the request.
+	const maxUploadMemory = 1 << 20 // 1MB
+	err = r.ParseMultipartForm(maxUploadMemory)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, fmt.Sprintf("file is larger than %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to parse form: %v", err), http.StatusBadRequest)
 		return
@@ -48,27 +67,32 @@ func (h *ServiceHandlers) FileUploadHandler(w http.ResponseWriter, r *http.Reque
 	}
 	defer file.Close()
 
-	// Read the file content.
-	bytes, err := io.ReadAll(file)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to read file from form: %v", err), http.StatusInternalServerError)
-		return
-	}
-
 	vaultID := chi.URLParam(r, "vaultID")
 
 	var v storage.Vault
 	if vaultID == "" {
 		// Create a new vault entry if no ID is provided.
-		v, err = h.vaultStorage.CreateVault(ctx, storage.Vault{
+		v = storage.Vault{
 			Key:    header.Filename,
-			Value:  bytes,
 			UserID: user.ID,
-		})
+		}
+		if err = h.checkTokenScope(ctx, v, true); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if h.vaultValueStorage != nil {
+			v, err = h.vaultValueStorage.CreateVaultFrom(ctx, v, file, header.Size)
+		} else if v.Value, err = io.ReadAll(file); err == nil {
+			v, err = h.vaultStorage.CreateVault(ctx, v)
+		}
+		if writeQuotaError(w, err) {
+			return
+		}
 		if err != nil {
 			http.Error(w, fmt.Sprintf("failed to create vault: %v", err), http.StatusInternalServerError)
 			return
 		}
+		_ = h.audit(r, storage.AuditEvent{Action: storage.AuditVaultCreate, UserID: user.ID, Login: user.Login, VaultID: v.ID})
 		w.WriteHeader(http.StatusCreated)
 	} else {
 		id, err := strconv.ParseUint(vaultID, 10, 64)
@@ -76,18 +100,43 @@ func (h *ServiceHandlers) FileUploadHandler(w http.ResponseWriter, r *http.Reque
 			http.Error(w, fmt.Sprintf("failed to parse param vaultID '%s': %v", vaultID, err), http.StatusBadRequest)
 			return
 		}
+		// Only the owner may overwrite an existing entry, within the scope of the token if any.
+		existing, err := h.vaultStorage.GetVault(ctx, id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get vault: %v", err), http.StatusBadRequest)
+			return
+		}
+		if existing.UserID != user.ID {
+			http.Error(w, "access denied", http.StatusBadRequest)
+			return
+		}
+		if err = h.checkTokenScope(ctx, existing, true); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		// Update an existing vault entry if an ID is provided.
 		v = storage.Vault{
 			ID:     id,
 			Key:    header.Filename,
-			Value:  bytes,
 			UserID: user.ID,
 		}
-		err = h.vaultStorage.UpdateVault(ctx, v)
+		if err = h.checkTokenScope(ctx, v, true); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if h.vaultValueStorage != nil {
+			err = h.vaultValueStorage.UpdateVaultFrom(ctx, v, file, header.Size)
+		} else if v.Value, err = io.ReadAll(file); err == nil {
+			err = h.vaultStorage.UpdateVault(ctx, v)
+		}
+		if writeQuotaError(w, err) {
+			return
+		}
 		if err != nil {
 			http.Error(w, fmt.Sprintf("failed to update vault: %v", err), http.StatusInternalServerError)
 			return
 		}
+		_ = h.audit(r, storage.AuditEvent{Action: storage.AuditVaultUpdate, UserID: user.ID, Login: user.Login, VaultID: v.ID})
 		w.WriteHeader(http.StatusOK)
 	}
 
@@ -107,3 +156,91 @@ func (h *ServiceHandlers) FileUploadHandler(w http.ResponseWriter, r *http.Reque
 		logger.Logger().Warn("failed to write response", zap.Error(err))
 	}
 }
+
+// FileDownloadHandler handles the downloading of the value of a vault entry as a file named after its key.
+//
+// With WithVaultValueStorage, the value is copied from the storage piece by piece instead of being read into memory.
+// If the value is replaced while it is sent, the connection is aborted, so that the client doesn't take the
+// partial file for a complete one.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there are errors in request processing or validation.
+//   - HTTP 403 Forbidden if the vault entry is outside of the scope of the personal access token.
+//   - HTTP 500 Internal Server Error if the read cannot be recorded in the audit log.
+//   - HTTP 200 OK with the value of the vault entry.
+func (h *ServiceHandlers) FileDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := h.authProvider.GetUserFromSession(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to validate user session: %v", err), http.StatusUnauthorized)
+		return
+	}
+
+	vaultID := chi.URLParam(r, "vaultID")
+	id, err := strconv.ParseUint(vaultID, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse param vaultID '%s': %v", vaultID, err), http.StatusBadRequest)
+		return
+	}
+
+	v, err := h.vaultInfo(ctx, user.ID, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get vault: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err = h.checkTokenScope(ctx, v, false); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var value io.Reader = bytes.NewReader(v.Value)
+	if h.vaultValueStorage != nil {
+		rc, err := h.vaultValueStorage.OpenVaultValue(ctx, id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get vault: %v", err), http.StatusBadRequest)
+			return
+		}
+		defer rc.Close()
+		value = rc
+	}
+
+	// The value is only sent if the read is recorded.
+	err = h.audit(r, storage.AuditEvent{Action: storage.AuditVaultRead, UserID: user.ID, Login: user.Login, VaultID: v.ID})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": v.Key}))
+	if _, err = io.Copy(w, value); err != nil {
+		logger.Logger().Warn("failed to send vault value", zap.Uint64("vaultID", v.ID), zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// vaultInfo returns the vault entry of the user with the ID. With WithVaultValueStorage the value is left empty,
+// as it is read separately.
+func (h *ServiceHandlers) vaultInfo(ctx context.Context, userID, id uint64) (storage.Vault, error) {
+	if h.vaultValueStorage == nil {
+		v, err := h.vaultStorage.GetVault(ctx, id)
+		if err != nil {
+			return storage.Vault{}, err
+		}
+		if v.UserID != userID {
+			return storage.Vault{}, errors.New("access denied")
+		}
+		return v, nil
+	}
+
+	vaults, err := h.vaultStorage.ListVaults(ctx, userID)
+	if err != nil {
+		return storage.Vault{}, err
+	}
+	for _, v := range vaults {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+	return storage.Vault{}, storage.ErrVaultNotFound
+}
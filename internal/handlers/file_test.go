@@ -0,0 +1,77 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/storage/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTransfer(t *testing.T) {
+	t.Parallel()
+
+	db, err := sqlite.Open(context.Background(), "sqlite://"+filepath.Join(t.TempDir(), "gophkeeper.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	sqliteVaults := sqlite.NewVaultStorage(db)
+
+	tests := []struct {
+		name string
+		opts []testServerOption
+	}{
+		{name: "buffered"},
+		{name: "streamed", opts: []testServerOption{
+			withStorages(sqlite.NewUserStorage(db), sqliteVaults, sqlite.NewTokenStorage(db)),
+			withHandlerOptions(handlers.WithVaultValueStorage(sqliteVaults)),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, tt.opts...)
+			c := client.NewClient(ts.URL)
+			require.NoError(t, c.CreateUser("alice", "password"))
+			token, err := c.SignIn("alice", "password")
+			require.NoError(t, err)
+			require.NoError(t, c.CreateUser("bob", "password"))
+			bobToken, err := c.SignIn("bob", "password")
+			require.NoError(t, err)
+
+			// Larger than the part of the form kept in memory.
+			content := make([]byte, 3<<20)
+			_, err = rand.Read(content)
+			require.NoError(t, err)
+			path := filepath.Join(t.TempDir(), "upload")
+			require.NoError(t, os.WriteFile(path, content, 0o600))
+
+			v, err := c.UploadFile(token, "photo.jpg", path, "")
+			require.NoError(t, err)
+			vaultID := strconv.FormatUint(v.ID, 10)
+			var got bytes.Buffer
+			require.NoError(t, c.DownloadFile(token, vaultID, &got))
+			assert.True(t, bytes.Equal(content, got.Bytes()), "downloaded file differs")
+
+			content = content[:1000]
+			require.NoError(t, os.WriteFile(path, content, 0o600))
+			_, err = c.UploadFile(token, "photo.jpg", path, vaultID)
+			require.NoError(t, err)
+			got.Reset()
+			require.NoError(t, c.DownloadFile(token, vaultID, &got))
+			assert.Equal(t, content, got.Bytes())
+
+			assert.ErrorContains(t, c.DownloadFile(bobToken, vaultID, &got), "400")
+			assert.ErrorContains(t, c.DownloadFile(token, "999", &got), "400")
+			pat, err := c.CreateToken(token, handlers.TokenRequest{Name: "docs", Permission: "read", KeyPrefix: "docs/"})
+			require.NoError(t, err)
+			assert.ErrorContains(t, c.DownloadFile(pat.Token, vaultID, &got), "403")
+		})
+	}
+}
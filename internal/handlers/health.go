@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ReadinessCheckTimeout is the time every readiness check may take before its component is reported as failed.
+const ReadinessCheckTimeout = 2 * time.Second
+
+// Statuses of the readiness response and its components.
+const (
+	StatusOK       = "ok"       // StatusOK is the status of a ready server and of a healthy component.
+	StatusError    = "error"    // StatusError is the status of a failed component, or of a server with failed components.
+	StatusDraining = "draining" // StatusDraining is the status of a server shutting down.
+)
+
+// ReadinessCheck is a dependency the server needs to serve requests, like the database or the JWT signing key.
+type ReadinessCheck struct {
+	Name  string                          // Name of the component in the readiness response.
+	Check func(ctx context.Context) error // Check returns an error if the component is not usable.
+}
+
+// ComponentStatus is the result of a readiness check.
+type ComponentStatus struct {
+	Status   string `json:"status"`          // StatusOK or StatusError.
+	Error    string `json:"error,omitempty"` // The error of a failed check.
+	Duration string `json:"duration"`        // How long the check took.
+}
+
+// ReadinessResponse represents the response of the readiness endpoint.
+type ReadinessResponse struct {
+	Status     string                     `json:"status"`     // StatusOK, StatusError or StatusDraining.
+	Components map[string]ComponentStatus `json:"components"` // Results of the readiness checks by component name.
+}
+
+// WithReadinessChecks sets the dependencies checked by GetReadyz.
+func WithReadinessChecks(checks ...ReadinessCheck) Option {
+	return func(h *ServiceHandlers) {
+		h.readinessChecks = checks
+	}
+}
+
+// Drain makes GetReadyz report the server as not ready, so that load balancers stop sending it new requests
+// before it shuts down. Requests already being served are not affected.
+func (h *ServiceHandlers) Drain() {
+	h.draining.Store(true)
+}
+
+// GetHealthz handles the liveness probe. It only reports that the process is alive and serving requests,
+// the dependencies are checked by GetReadyz.
+//
+// The handler responds with:
+//   - HTTP 200 OK with the status "ok".
+func (h *ServiceHandlers) GetHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+}
+
+// GetReadyz handles the readiness probe. All readiness checks run at the same time, each with
+// ReadinessCheckTimeout, and the status of every component is reported.
+//
+// The handler responds with:
+//   - HTTP 503 Service Unavailable if a check failed or the server is draining before a shutdown.
+//   - HTTP 200 OK if all components are healthy.
+func (h *ServiceHandlers) GetReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := ReadinessResponse{Status: StatusOK, Components: make(map[string]ComponentStatus, len(h.readinessChecks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range h.readinessChecks {
+		wg.Add(1)
+		go func(c ReadinessCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), ReadinessCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.Check(ctx)
+			status := ComponentStatus{Status: StatusOK, Duration: time.Since(start).String()}
+			if err != nil {
+				status.Status = StatusError
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Components[c.Name] = status
+			if err != nil {
+				resp.Status = StatusError
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if h.draining.Load() {
+		resp.Status = StatusDraining
+	}
+	if resp.Status != StatusOK {
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
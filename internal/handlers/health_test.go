@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+
+	var dbErr error
+	serviceHandlers := handlers.NewServiceHandlers(nil, nil, nil, nil, nil, handlers.WithReadinessChecks(
+		handlers.ReadinessCheck{Name: "database", Check: func(context.Context) error { return dbErr }},
+		handlers.ReadinessCheck{Name: "signing_key", Check: func(context.Context) error { return nil }},
+	))
+	ts := httptest.NewServer(handlers.NewRouter(serviceHandlers))
+	defer ts.Close()
+
+	readyz := func() (int, handlers.ReadinessResponse) {
+		statusCode, _, got := testRequest(t, ts, http.MethodGet, handlers.ReadyzURI, nil, http.Header{})
+		var resp handlers.ReadinessResponse
+		require.NoError(t, json.Unmarshal([]byte(got), &resp), got)
+		return statusCode, resp
+	}
+
+	statusCode, _, got := testRequest(t, ts, http.MethodGet, handlers.HealthzURI, nil, http.Header{})
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.JSONEq(t, `{"status":"ok"}`, got)
+
+	statusCode, resp := readyz()
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, handlers.StatusOK, resp.Status)
+	require.Len(t, resp.Components, 2)
+	assert.Equal(t, handlers.StatusOK, resp.Components["database"].Status)
+	assert.NotEmpty(t, resp.Components["database"].Duration)
+
+	dbErr = errors.New("connection refused")
+	statusCode, resp = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode)
+	assert.Equal(t, handlers.StatusError, resp.Status)
+	assert.Equal(t, handlers.ComponentStatus{Status: handlers.StatusError, Error: "connection refused", Duration: resp.Components["database"].Duration},
+		resp.Components["database"])
+	assert.Equal(t, handlers.StatusOK, resp.Components["signing_key"].Status)
+
+	dbErr = nil
+	serviceHandlers.Drain()
+	statusCode, resp = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode)
+	assert.Equal(t, handlers.StatusDraining, resp.Status)
+	assert.Equal(t, handlers.StatusOK, resp.Components["database"].Status, "the components are still reported")
+
+	statusCode, _, _ = testRequest(t, ts, http.MethodGet, handlers.HealthzURI, nil, http.Header{})
+	assert.Equal(t, http.StatusOK, statusCode, "a draining server is alive")
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	t.Parallel()
+
+	serviceHandlers := handlers.NewServiceHandlers(nil, nil, nil, nil, nil, handlers.WithReadinessChecks(
+		handlers.ReadinessCheck{Name: "vault_pool", Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	))
+	ts := httptest.NewServer(handlers.NewRouter(serviceHandlers))
+	defer ts.Close()
+
+	start := time.Now()
+	statusCode, _, got := testRequest(t, ts, http.MethodGet, handlers.ReadyzURI, nil, http.Header{})
+	assert.Less(t, time.Since(start), 2*handlers.ReadinessCheckTimeout)
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode)
+	var resp handlers.ReadinessResponse
+	require.NoError(t, json.Unmarshal([]byte(got), &resp), got)
+	assert.Equal(t, context.DeadlineExceeded.Error(), resp.Components["vault_pool"].Error)
+}
@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/auth"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer is a server of the handlers started by newTestServer, closed when the test ends.
+type testServer struct {
+	*httptest.Server
+	authProvider *auth.Provider // Issues the tokens accepted by the server.
+}
+
+// testServerConfig holds the dependencies of a test server.
+type testServerConfig struct {
+	userStorage     storage.UserStorage
+	vaultStorage    storage.VaultStorage
+	tokenStorage    storage.TokenStorage
+	hashService     handlers.Hasher
+	providerOptions []auth.ProviderOption
+	handlerOptions  []handlers.Option
+	middlewares     []func(http.Handler) http.Handler
+	publicURIs      []string
+}
+
+// testServerOption changes the dependencies of a test server.
+type testServerOption func(*testServerConfig)
+
+// withStorages replaces the memory user, vault and token storages, e.g. with mocks. A nil storage isn't used.
+func withStorages(userStorage storage.UserStorage, vaultStorage storage.VaultStorage, tokenStorage storage.TokenStorage) testServerOption {
+	return func(c *testServerConfig) {
+		c.userStorage, c.vaultStorage, c.tokenStorage = userStorage, vaultStorage, tokenStorage
+	}
+}
+
+// withHashService replaces the fast hash service, e.g. with the one that hashed the passwords of mocked users.
+func withHashService(hashService handlers.Hasher) testServerOption {
+	return func(c *testServerConfig) {
+		c.hashService = hashService
+	}
+}
+
+// withProviderOptions adds options of the auth provider.
+func withProviderOptions(opts ...auth.ProviderOption) testServerOption {
+	return func(c *testServerConfig) {
+		c.providerOptions = append(c.providerOptions, opts...)
+	}
+}
+
+// withHandlerOptions adds options of the handlers.
+func withHandlerOptions(opts ...handlers.Option) testServerOption {
+	return func(c *testServerConfig) {
+		c.handlerOptions = append(c.handlerOptions, opts...)
+	}
+}
+
+// withMiddlewares adds middlewares running before the authentication.
+func withMiddlewares(m ...func(http.Handler) http.Handler) testServerOption {
+	return func(c *testServerConfig) {
+		c.middlewares = append(c.middlewares, m...)
+	}
+}
+
+// withPublicURIs adds URIs which can be accessed without authentication to those of signing up and in.
+func withPublicURIs(uris ...string) testServerOption {
+	return func(c *testServerConfig) {
+		c.publicURIs = append(c.publicURIs, uris...)
+	}
+}
+
+// newTestServer starts a server of the handlers with authentication. By default it is backed by the memory
+// storages, with the token storage enabled, and hashes passwords with cheap parameters.
+func newTestServer(t *testing.T, opts ...testServerOption) *testServer {
+	t.Helper()
+	vaultStorage := memory.NewVaultStorage()
+	tokenStorage := memory.NewTokenStorage()
+	c := testServerConfig{
+		userStorage:  memory.NewUserStorage(vaultStorage, tokenStorage),
+		vaultStorage: vaultStorage,
+		tokenStorage: tokenStorage,
+		hashService:  pwd.NewHashService(pwd.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}),
+		publicURIs:   []string{handlers.AuthSignInURI, handlers.AuthSignUpURI, handlers.AuthSignInTwoFactorURI},
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	jwtPrivateKey, jwtSecretKey, err := auth.MakeJwtSecretKey()
+	require.NoError(t, err)
+	authProvider := auth.NewAuthProvider(c.userStorage, c.tokenStorage, jwtPrivateKey, c.providerOptions...)
+	authMiddleware := auth.NewAuthMiddleware(authProvider, jwtSecretKey, c.publicURIs...)
+	handlerOptions := c.handlerOptions
+	if c.tokenStorage != nil {
+		handlerOptions = append([]handlers.Option{handlers.WithTokenStorage(c.tokenStorage)}, handlerOptions...)
+	}
+	serviceHandlers := handlers.NewServiceHandlers(nil, authProvider, c.vaultStorage, c.userStorage, c.hashService, handlerOptions...)
+	ts := httptest.NewServer(handlers.NewRouter(serviceHandlers, append(c.middlewares, authMiddleware.WithAuthentication)...))
+	t.Cleanup(ts.Close)
+	return &testServer{Server: ts, authProvider: authProvider}
+}
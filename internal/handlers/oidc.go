@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/oidc"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// OIDCLoginTTL is how long the user has to sign in at the identity provider after the client started the sign-in.
+	OIDCLoginTTL = 10 * time.Minute
+	// OIDCPollInterval is how often the client should poll for the result of the sign-in.
+	OIDCPollInterval = 5 * time.Second
+	// OIDCAuthorizationPending is the error returned while the user has not signed in at the identity provider yet.
+	OIDCAuthorizationPending = "authorization_pending"
+	// DefaultOIDCLoginClaim is the claim used as the login of users signing in with the identity provider.
+	DefaultOIDCLoginClaim = "email"
+
+	// oidcBrowserCookie binds a sign-in to the browser which approved it.
+	oidcBrowserCookie = "gophkeeper_oidc"
+	// userCodeAlphabet has no vowels, so that user codes don't spell words, and no characters which are easily confused.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	// userCodeLength is the number of characters of a user code, which is shown as two groups of four.
+	userCodeLength = 8
+)
+
+// OIDCConfig configures sign-in with an external OpenID Connect identity provider.
+type OIDCConfig struct {
+	Provider      OIDCAuthenticator   // The identity provider.
+	Storage       storage.OIDCStorage // Storage for pending sign-ins and linked identities.
+	LoginClaim    string              // Claim used as the login, "email", "preferred_username" or "sub". Defaults to DefaultOIDCLoginClaim.
+	AutoProvision bool                // Whether users without an account are created on their first sign-in.
+	// Public URL of AuthOIDCVerifyURI returned to clients. Defaults to AuthOIDCVerifyURI relative to the server address.
+	VerificationURL string
+}
+
+// OIDCDeviceRequest represents the payload starting a sign-in with the identity provider.
+type OIDCDeviceRequest struct {
+	Device string `json:"device"` // Optional name of the device, shown in the list of sessions.
+}
+
+// OIDCDeviceResponse tells the client where the user signs in and how to poll for the result.
+type OIDCDeviceResponse struct {
+	DeviceCode      string `json:"device_code"`      // Secret code for polling AuthOIDCTokenURI.
+	UserCode        string `json:"user_code"`        // Code the user enters at the verification page, shown by the client.
+	VerificationURI string `json:"verification_uri"` // URL of the verification page, relative to the server address unless configured.
+	ExpiresIn       int    `json:"expires_in"`       // Seconds until the sign-in expires.
+	Interval        int    `json:"interval"`         // Seconds to wait between polls.
+}
+
+// OIDCTokenRequest represents a poll for the result of a sign-in with the identity provider.
+type OIDCTokenRequest struct {
+	DeviceCode string `json:"device_code"` // The device code from OIDCDeviceResponse.
+}
+
+// PostOIDCDevice handles the start of a sign-in with the identity provider from a terminal client.
+//
+// Like the OAuth2 device authorization grant, the client shows the returned URL and user code to the user and
+// polls AuthOIDCTokenURI with the device code. The URL leads to the verification page of the server, where the user
+// enters the code, checks the name of the device and approves the sign-in, which sends the browser on to the
+// identity provider. The provider redirects the browser to AuthOIDCCallbackURI after the sign-in.
+// The authorization code flow uses PKCE, the code verifier never leaves the server.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is an error in the request.
+//   - HTTP 200 OK with an OIDCDeviceResponse.
+func (h *ServiceHandlers) PostOIDCDevice(w http.ResponseWriter, r *http.Request) {
+	request := OIDCDeviceRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	deviceCode, err := randomHex(32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state, err := randomHex(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	device := request.Device
+	if len(device) > MaxDeviceNameLength {
+		device = device[:MaxDeviceNameLength]
+	}
+	login := storage.OIDCLogin{
+		DeviceCodeHash: hashSecret(deviceCode),
+		UserCodeHash:   hashUserCode(userCode),
+		State:          state,
+		Nonce:          nonce,
+		CodeVerifier:   oidc.GenerateVerifier(),
+		Device:         device,
+		ExpiresAt:      h.now().Add(OIDCLoginTTL),
+	}
+	err = h.oidc.Storage.CreateOIDCLogin(r.Context(), login)
+	if err != nil {
+		logger.Logger().Warn("failed to create oidc login", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	verificationURI := h.oidc.VerificationURL
+	if verificationURI == "" {
+		verificationURI = AuthOIDCVerifyURI
+	}
+	writeJSON(w, http.StatusOK, OIDCDeviceResponse{
+		DeviceCode:      deviceCode,
+		UserCode:        userCode,
+		VerificationURI: verificationURI,
+		ExpiresIn:       int(OIDCLoginTTL / time.Second),
+		Interval:        int(OIDCPollInterval / time.Second),
+	})
+}
+
+// oidcVerifyPage is the verification page: the form for the user code, and after it is entered,
+// the device which started the sign-in with the button approving it.
+var oidcVerifyPage = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>GophKeeper sign-in</title></head>
+<body>
+<h1>GophKeeper sign-in</h1>
+{{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+{{if .Device}}
+<p>A sign-in with the code <strong>{{.UserCode}}</strong> was started on the device <strong>{{.Device}}</strong>.</p>
+<p>Approve it only if you started it yourself on this device and the code matches the one shown there.
+Whoever started it gets access to your account and your vault.</p>
+<form method="post" action="approve">
+<input type="hidden" name="user_code" value="{{.UserCode}}">
+<button type="submit">Approve and sign in</button>
+</form>
+{{else}}
+<p>Enter the code shown by the client which is signing in.</p>
+<form method="post" action="verify">
+<input name="user_code" autocomplete="off" autofocus required>
+<button type="submit">Continue</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// oidcVerifyData is the data of oidcVerifyPage.
+type oidcVerifyData struct {
+	Error    string
+	UserCode string
+	Device   string
+}
+
+// GetOIDCVerify handles the verification page, where the user enters the user code shown by the client.
+//
+// The handler responds with:
+//   - HTTP 200 OK with the form for the user code.
+func (h *ServiceHandlers) GetOIDCVerify(w http.ResponseWriter, _ *http.Request) {
+	writeOIDCVerifyPage(w, http.StatusOK, oidcVerifyData{})
+}
+
+// PostOIDCVerify handles a user code entered at the verification page and shows the name of the device
+// which started the sign-in, so that the user can check it before approving the sign-in.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request with the form for the user code if the code is unknown or expired.
+//   - HTTP 409 Conflict if the sign-in was approved before.
+//   - HTTP 200 OK with the device and the button approving the sign-in.
+func (h *ServiceHandlers) PostOIDCVerify(w http.ResponseWriter, r *http.Request) {
+	userCode := r.PostFormValue("user_code")
+	login, statusCode, err := h.pendingOIDCLogin(r.Context(), userCode)
+	if err != nil {
+		writeOIDCVerifyPage(w, statusCode, oidcVerifyData{Error: err.Error()})
+		return
+	}
+
+	device := login.Device
+	if device == "" {
+		device = "unnamed device"
+	}
+	writeOIDCVerifyPage(w, http.StatusOK, oidcVerifyData{UserCode: strings.ToUpper(strings.TrimSpace(userCode)), Device: device})
+}
+
+// PostOIDCApprove handles the approval of a sign-in at the verification page.
+//
+// The approving browser gets a cookie binding the sign-in to it and is redirected to the identity provider.
+// A sign-in is approved once, and only by a form submitted from the verification page itself.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request with the form for the user code if the code is unknown or expired.
+//   - HTTP 403 Forbidden if the form was submitted from another site.
+//   - HTTP 409 Conflict if the sign-in was approved before.
+//   - HTTP 303 See Other to the identity provider.
+func (h *ServiceHandlers) PostOIDCApprove(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "the sign-in must be approved at the verification page", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	userCode := r.PostFormValue("user_code")
+	login, statusCode, err := h.pendingOIDCLogin(ctx, userCode)
+	if err != nil {
+		writeOIDCVerifyPage(w, statusCode, oidcVerifyData{Error: err.Error()})
+		return
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	approved, err := h.oidc.Storage.ApproveOIDCLogin(ctx, login.UserCodeHash, hashSecret(secret))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !approved {
+		writeOIDCVerifyPage(w, http.StatusConflict, oidcVerifyData{Error: "this sign-in was approved before, start the sign-in again"})
+		return
+	}
+
+	// Lax, as the identity provider redirects the browser back to the callback with a top-level navigation.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcBrowserCookie,
+		Value:    secret,
+		Path:     "/",
+		MaxAge:   int(OIDCLoginTTL / time.Second),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.oidc.Provider.AuthCodeURL(login.State, login.Nonce, login.CodeVerifier), http.StatusSeeOther)
+}
+
+// pendingOIDCLogin returns the sign-in of a user code if it can still be approved.
+// On failure it returns the status code of the error response.
+func (h *ServiceHandlers) pendingOIDCLogin(ctx context.Context, userCode string) (storage.OIDCLogin, int, error) {
+	login, err := h.oidc.Storage.GetOIDCLoginByUserCode(ctx, hashUserCode(userCode))
+	if err != nil && !errors.Is(err, storage.ErrOIDCLoginNotFound) {
+		return storage.OIDCLogin{}, http.StatusInternalServerError, err
+	}
+	if err != nil || !h.now().Before(login.ExpiresAt) {
+		return storage.OIDCLogin{}, http.StatusBadRequest, errors.New("unknown or expired code, check the code or start the sign-in again")
+	}
+	if login.BrowserHash != "" || login.UserID != 0 {
+		return storage.OIDCLogin{}, http.StatusConflict, errors.New("this sign-in was approved before, start the sign-in again")
+	}
+	return login, http.StatusOK, nil
+}
+
+// writeOIDCVerifyPage renders the verification page, which must not be framed by other sites.
+func writeOIDCVerifyPage(w http.ResponseWriter, statusCode int, data oidcVerifyData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	if err := oidcVerifyPage.Execute(w, data); err != nil {
+		logger.Logger().Warn("failed to write response", zap.Error(err))
+	}
+}
+
+// GetOIDCCallback handles the redirect of the browser back from the identity provider.
+//
+// Only the browser which approved the sign-in at AuthOIDCApproveURI completes it, so that a link to the identity
+// provider passed on to someone else doesn't sign them in on the device which started the sign-in.
+// The authorization code is exchanged for an ID token, whose identity is mapped to a user:
+// an identity linked before signs in to its user. Otherwise the login claim is looked up,
+// an existing user with this login is linked only if the claim is a verified email address,
+// and new users are created if auto-provisioning is enabled.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the sign-in at the provider failed, or the sign-in is unknown or expired.
+//   - HTTP 401 Unauthorized if the authorization code or the ID token is invalid.
+//   - HTTP 403 Forbidden if the sign-in was not approved in this browser,
+//     or there is no account for the identity and auto-provisioning is disabled.
+//   - HTTP 409 Conflict if the login is taken by an account which can't be linked.
+//   - HTTP 200 OK with a message asking the user to return to the terminal.
+func (h *ServiceHandlers) GetOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		http.Error(w, fmt.Sprintf("sign-in at the identity provider failed: %s %s", providerErr, query.Get("error_description")), http.StatusBadRequest)
+		return
+	}
+
+	login, err := h.oidc.Storage.GetOIDCLoginByState(ctx, query.Get("state"))
+	if err != nil && !errors.Is(err, storage.ErrOIDCLoginNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil || !h.now().Before(login.ExpiresAt) || login.UserID != 0 {
+		http.Error(w, "unknown or expired sign-in, start the sign-in again", http.StatusBadRequest)
+		return
+	}
+	cookie, err := r.Cookie(oidcBrowserCookie)
+	if err != nil || login.BrowserHash == "" ||
+		subtle.ConstantTimeCompare([]byte(hashSecret(cookie.Value)), []byte(login.BrowserHash)) != 1 {
+		http.Error(w, "the sign-in was not approved in this browser, enter the code shown by the client at the verification page", http.StatusForbidden)
+		return
+	}
+
+	identity, err := h.oidc.Provider.Exchange(ctx, query.Get("code"), login.Nonce, login.CodeVerifier)
+	if err != nil {
+		logger.Logger().Warn("failed to exchange oidc authorization code", zap.Error(err))
+		http.Error(w, "invalid authorization code", http.StatusUnauthorized)
+		return
+	}
+
+	user, statusCode, err := h.oidcUser(ctx, identity)
+	if err != nil {
+		logger.Logger().Warn("failed to map oidc identity", zap.String("subject", identity.Subject), zap.Error(err))
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	err = h.oidc.Storage.CompleteOIDCLogin(ctx, login.State, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Logger().Info("oidc sign-in completed", zap.String("login", user.Login), zap.String("subject", identity.Subject))
+
+	http.SetCookie(w, &http.Cookie{Name: oidcBrowserCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, err = fmt.Fprintf(w, "Signed in as %s. You can close this window and return to the terminal.\n", user.Login)
+	if err != nil {
+		logger.Logger().Warn("failed to write response", zap.Error(err))
+	}
+}
+
+// PostOIDCToken handles polls of the client for the result of a sign-in with the identity provider.
+//
+// Once the user has signed in, a JWT token is issued like a regular sign-in and the device code becomes invalid.
+// Users with two-factor authentication enabled must complete the sign-in at AuthSignInTwoFactorURI.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request with OIDCAuthorizationPending while the user has not signed in yet.
+//   - HTTP 401 Unauthorized if the device code is unknown or expired.
+//   - HTTP 202 Accepted with a SignInResponse if a second factor is required.
+//   - HTTP 200 OK with the JWT token in the Authorization header on successful sign-in.
+func (h *ServiceHandlers) PostOIDCToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	request := OIDCTokenRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	hash := hashSecret(request.DeviceCode)
+	login, err := h.oidc.Storage.GetOIDCLogin(ctx, hash)
+	if err != nil && !errors.Is(err, storage.ErrOIDCLoginNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil || !h.now().Before(login.ExpiresAt) {
+		http.Error(w, "invalid or expired device code", http.StatusUnauthorized)
+		return
+	}
+
+	if login.UserID == 0 {
+		http.Error(w, OIDCAuthorizationPending, http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.oidc.Storage.DeleteOIDCLogin(ctx, hash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "invalid or expired device code", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userStorage.GetUser(ctx, login.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get user: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, err := h.authProvider.GenerateMFAToken(user.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to generate mfa token: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, SignInResponse{TwoFactorRequired: true, MFAToken: mfaToken})
+		return
+	}
+
+	h.issueToken(w, r, user, login.Device)
+}
+
+// oidcUser finds, links or creates the user of an identity of the provider.
+// On failure it returns the status code of the error response.
+func (h *ServiceHandlers) oidcUser(ctx context.Context, identity oidc.Identity) (storage.User, int, error) {
+	userID, err := h.oidc.Storage.GetOIDCIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		user, err := h.userStorage.GetUser(ctx, userID)
+		if err != nil {
+			return storage.User{}, http.StatusInternalServerError, fmt.Errorf("failed to get user: %w", err)
+		}
+		return user, http.StatusOK, nil
+	}
+	if !errors.Is(err, storage.ErrOIDCIdentityNotFound) {
+		return storage.User{}, http.StatusInternalServerError, err
+	}
+
+	claim := h.oidc.LoginClaim
+	if claim == "" {
+		claim = DefaultOIDCLoginClaim
+	}
+	login := storage.NormalizeLogin(identity.Claim(claim))
+	if login == "" || len(login) > 50 {
+		return storage.User{}, http.StatusForbidden, fmt.Errorf("identity has no %s claim usable as a login", claim)
+	}
+
+	provisioned := false
+	user, err := h.userStorage.GetUserByLogin(ctx, login)
+	switch {
+	case err == nil:
+		// Only a verified email address proves that the identity belongs to the owner of the account.
+		if claim != "email" || !identity.EmailVerified {
+			return storage.User{}, http.StatusConflict, fmt.Errorf("login %s is taken by an account not linked to this identity", login)
+		}
+	case errors.Is(err, storage.ErrUserNotFound):
+		if !h.oidc.AutoProvision {
+			return storage.User{}, http.StatusForbidden, errors.New("no account for this identity")
+		}
+		user, err = h.userStorage.CreateUser(ctx, storage.User{Login: login})
+		if errors.Is(err, storage.ErrLoginTaken) {
+			return storage.User{}, http.StatusConflict, fmt.Errorf("login %s was taken while the account was provisioned", login)
+		}
+		if err != nil {
+			return storage.User{}, http.StatusInternalServerError, fmt.Errorf("failed to create user: %w", err)
+		}
+		provisioned = true
+		logger.Logger().Info("user provisioned from oidc identity", zap.String("login", login), zap.String("subject", identity.Subject))
+	default:
+		return storage.User{}, http.StatusInternalServerError, fmt.Errorf("failed to get user by login: %w", err)
+	}
+
+	err = h.oidc.Storage.CreateOIDCIdentity(ctx, identity.Issuer, identity.Subject, user.ID)
+	if err != nil {
+		// A provisioned user nobody can sign in as would block the login for the next attempt.
+		if provisioned {
+			if deleteErr := h.userStorage.DeleteUser(ctx, user.ID); deleteErr != nil {
+				logger.Logger().Error("failed to delete provisioned user", zap.String("login", login), zap.Error(deleteErr))
+			}
+		}
+		return storage.User{}, http.StatusInternalServerError, fmt.Errorf("failed to link identity: %w", err)
+	}
+	return user, http.StatusOK, nil
+}
+
+// hashDeviceCode returns the hex encoded SHA-256 hash under which a device code is stored.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateUserCode returns a random user code formatted as XXXX-XXXX.
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", fmt.Errorf("failed to read random bytes: %w", err)
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code[:userCodeLength/2]) + "-" + string(code[userCodeLength/2:]), nil
+}
+
+// hashUserCode returns the hash under which a user code is stored, ignoring case, spaces and dashes as typed by the user.
+func hashUserCode(userCode string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(userCode))
+	return hashSecret(normalized)
+}
+
+// sameOrigin reports whether a form was submitted from a page of the server itself, so that another site
+// can't approve a sign-in in the browser of a user who visits it.
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin"
+	}
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && origin.Host != "" && origin.Host == r.Host
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
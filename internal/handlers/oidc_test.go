@@ -0,0 +1,371 @@
+package handlers_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/auth"
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/oidc"
+	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fakeOIDCClientID = "gophkeeper"
+
+// fakeOIDCProvider is a minimal OpenID Connect identity provider.
+// Its authorization endpoint signs in the configured identity without asking the user.
+type fakeOIDCProvider struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu       sync.Mutex
+	identity jwt.MapClaims
+	codes    map[string]url.Values
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &fakeOIDCProvider{t: t, key: key, codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/keys", p.keys)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+// signInAs sets the claims of the identity signed in by the next authorization.
+func (p *fakeOIDCProvider) signInAs(sub, email string, emailVerified bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.identity = jwt.MapClaims{"sub": sub, "email": email, "email_verified": emailVerified}
+}
+
+func (p *fakeOIDCProvider) discovery(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                p.srv.URL,
+		"authorization_endpoint":                p.srv.URL + "/authorize",
+		"token_endpoint":                        p.srv.URL + "/token",
+		"jwks_uri":                              p.srv.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *fakeOIDCProvider) keys(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *fakeOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != fakeOIDCClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	require.NoError(p.t, err)
+	code := hex.EncodeToString(b)
+	p.mu.Lock()
+	p.codes[code] = query
+	p.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *fakeOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	require.NoError(p.t, r.ParseForm())
+	p.mu.Lock()
+	authorization, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	identity := p.identity
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.Get("code_challenge") {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.srv.URL,
+		"aud":   fakeOIDCClientID,
+		"nonce": authorization.Get("nonce"),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range identity {
+		claims[k] = v
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(p.key)
+	require.NoError(p.t, err)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	t.Parallel()
+
+	hashService := pwd.NewHashService(pwd.DefaultArgon2Params)
+	hashedPassword, err := hashService.Hash("password")
+	require.NoError(t, err)
+
+	userStorage := memory.NewUserStorage(nil, nil)
+	for _, login := range []string{"alice@example.com", "bob@example.com"} {
+		_, err = userStorage.CreateUser(context.Background(), storage.User{Login: login, Password: hashedPassword})
+		require.NoError(t, err)
+	}
+
+	provider := newFakeOIDCProvider(t)
+
+	// The redirect URL must be known before the provider is discovered, so the router is set afterwards.
+	var router atomic.Value
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.Load().(http.Handler).ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	oidcProvider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:      provider.srv.URL,
+		ClientID:    fakeOIDCClientID,
+		RedirectURL: ts.URL + handlers.AuthOIDCCallbackURI,
+		Scopes:      []string{"email"},
+	})
+	require.NoError(t, err)
+
+	sessionStorage := memory.NewSessionStorage()
+	jwtPrivateKey, jwtSecretKey, err := auth.MakeJwtSecretKey()
+	require.NoError(t, err)
+	authProvider := auth.NewAuthProvider(userStorage, nil, jwtPrivateKey, auth.WithSessionStorage(sessionStorage))
+	authMiddleware := auth.NewAuthMiddleware(
+		authProvider, jwtSecretKey,
+		handlers.AuthSignInURI, handlers.AuthSignUpURI, handlers.AuthSignInTwoFactorURI,
+		handlers.AuthOIDCDeviceURI, handlers.AuthOIDCVerifyURI, handlers.AuthOIDCApproveURI,
+		handlers.AuthOIDCCallbackURI, handlers.AuthOIDCTokenURI,
+	)
+	oidcConfig := handlers.OIDCConfig{Provider: oidcProvider, Storage: memory.NewOIDCStorage()}
+	newRouter := func(autoProvision bool) http.Handler {
+		oidcConfig.AutoProvision = autoProvision
+		serviceHandlers := handlers.NewServiceHandlers(nil, authProvider, nil, userStorage, hashService,
+			handlers.WithSessionStorage(sessionStorage),
+			handlers.WithOIDC(oidcConfig),
+		)
+		return handlers.NewRouter(serviceHandlers, authMiddleware.WithAuthentication)
+	}
+	router.Store(newRouter(true))
+	c := client.NewClient(ts.URL)
+
+	authorized := func(token string) int {
+		statusCode, _, _ := testRequest(t, ts, http.MethodGet, handlers.SessionsURI, nil, http.Header{"Authorization": {"Bearer " + token}})
+		return statusCode
+	}
+	device, _ := os.Hostname()
+	if device == "" {
+		device = "unnamed device"
+	}
+	// newBrowser returns a client keeping cookies like a browser.
+	newBrowser := func(t *testing.T) *http.Client {
+		jar, err := cookiejar.New(nil)
+		require.NoError(t, err)
+		return &http.Client{Jar: jar}
+	}
+	// submit posts the user code to the verification page or approves the sign-in, from a page of the origin.
+	submit := func(t *testing.T, browser *http.Client, uri, userCode, origin string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodPost, uri, strings.NewReader(url.Values{"user_code": {userCode}}.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", origin)
+		resp, err := browser.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+	// signIn starts a sign-in and approves it at the verification page like the browser of the user,
+	// which is then signed in by the provider. Returns the response of the callback.
+	signIn := func(t *testing.T) (handlers.OIDCDeviceResponse, int, string) {
+		start, err := c.StartOIDCSignIn()
+		require.NoError(t, err)
+		browser := newBrowser(t)
+		resp, err := browser.Get(start.VerificationURI)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// The code is typed by the user, who may not care about case and dashes.
+		userCode := strings.ToLower(strings.ReplaceAll(start.UserCode, "-", " "))
+		resp, body := submit(t, browser, start.VerificationURI, userCode, ts.URL)
+		require.Equal(t, http.StatusOK, resp.StatusCode, body)
+		assert.Contains(t, body, device)
+
+		resp, body = submit(t, browser, ts.URL+handlers.AuthOIDCApproveURI, userCode, ts.URL)
+		return start, resp.StatusCode, body
+	}
+
+	t.Run("sign in provisions a user", func(t *testing.T) {
+		start, err := c.StartOIDCSignIn()
+		require.NoError(t, err)
+		assert.Equal(t, ts.URL+handlers.AuthOIDCVerifyURI, start.VerificationURI)
+		assert.Regexp(t, `^[B-Z]{4}-[B-Z]{4}$`, start.UserCode)
+		_, err = c.PollOIDCSignIn(start.DeviceCode)
+		assert.ErrorIs(t, err, client.ErrAuthorizationPending)
+
+		provider.signInAs("carol-id", "carol@example.com", false)
+		start, statusCode, body := signIn(t)
+		require.Equal(t, http.StatusOK, statusCode, body)
+		assert.Contains(t, body, "Signed in as carol@example.com")
+
+		token, err := c.WaitOIDCSignIn(start)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, authorized(token))
+		carol, err := userStorage.GetUserByLogin(context.Background(), "carol@example.com")
+		require.NoError(t, err)
+		assert.Empty(t, carol.Password)
+
+		// The device code can be used once.
+		_, err = c.PollOIDCSignIn(start.DeviceCode)
+		assert.ErrorContains(t, err, "invalid or expired device code")
+
+		// The linked identity signs in to the same user even if its email changes.
+		provider.signInAs("carol-id", "carol@example.org", false)
+		start, statusCode, body = signIn(t)
+		require.Equal(t, http.StatusOK, statusCode, body)
+		assert.Contains(t, body, "Signed in as carol@example.com")
+		_, err = c.WaitOIDCSignIn(start)
+		require.NoError(t, err)
+	})
+
+	t.Run("verified email links an existing user", func(t *testing.T) {
+		provider.signInAs("alice-id", "alice@example.com", true)
+		start, statusCode, body := signIn(t)
+		require.Equal(t, http.StatusOK, statusCode, body)
+
+		token, err := c.WaitOIDCSignIn(start)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, authorized(token))
+		userID, err := oidcConfig.Storage.GetOIDCIdentity(context.Background(), provider.srv.URL, "alice-id")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), userID)
+	})
+
+	t.Run("unverified email does not take over an existing user", func(t *testing.T) {
+		provider.signInAs("mallory-id", "bob@example.com", false)
+		start, statusCode, body := signIn(t)
+		assert.Equal(t, http.StatusConflict, statusCode, body)
+		_, err := c.PollOIDCSignIn(start.DeviceCode)
+		assert.ErrorIs(t, err, client.ErrAuthorizationPending)
+	})
+
+	t.Run("unknown users are rejected without auto-provisioning", func(t *testing.T) {
+		router.Store(newRouter(false))
+		defer router.Store(newRouter(true))
+
+		provider.signInAs("dave-id", "dave@example.com", true)
+		_, statusCode, body := signIn(t)
+		assert.Equal(t, http.StatusForbidden, statusCode, body)
+		_, err := userStorage.GetUserByLogin(context.Background(), "dave@example.com")
+		assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	})
+
+	t.Run("sign-in must be approved in the browser", func(t *testing.T) {
+		provider.signInAs("carol-id", "carol@example.com", false)
+		start, err := c.StartOIDCSignIn()
+		require.NoError(t, err)
+
+		// The link to the provider, passed on by whoever approved the sign-in, doesn't sign in anyone else.
+		attacker := newBrowser(t)
+		attacker.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		resp, body := submit(t, attacker, ts.URL+handlers.AuthOIDCApproveURI, start.UserCode, ts.URL)
+		require.Equal(t, http.StatusSeeOther, resp.StatusCode, body)
+		assert.True(t, strings.HasPrefix(resp.Header.Get("Location"), provider.srv.URL+"/authorize?"))
+		resp, err = newBrowser(t).Get(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		_, err = c.PollOIDCSignIn(start.DeviceCode)
+		assert.ErrorIs(t, err, client.ErrAuthorizationPending)
+
+		// A sign-in is approved once.
+		resp, body = submit(t, newBrowser(t), start.VerificationURI, start.UserCode, ts.URL)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, body)
+		resp, body = submit(t, newBrowser(t), ts.URL+handlers.AuthOIDCApproveURI, start.UserCode, ts.URL)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, body)
+
+		resp, body = submit(t, newBrowser(t), start.VerificationURI, "BCDF-GHJK", ts.URL)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+	})
+
+	t.Run("approval from another site is rejected", func(t *testing.T) {
+		start, err := c.StartOIDCSignIn()
+		require.NoError(t, err)
+		resp, body := submit(t, newBrowser(t), ts.URL+handlers.AuthOIDCApproveURI, start.UserCode, "https://evil.example")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, body)
+		resp, body = submit(t, newBrowser(t), ts.URL+handlers.AuthOIDCApproveURI, start.UserCode, "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, body)
+
+		// The sign-in can still be approved at the verification page.
+		resp, body = submit(t, newBrowser(t), ts.URL+handlers.AuthOIDCVerifyURI, start.UserCode, ts.URL)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, body)
+	})
+
+	t.Run("callback requires a pending sign-in", func(t *testing.T) {
+		statusCode, _, body := testRequest(t, ts, http.MethodGet, handlers.AuthOIDCCallbackURI+"?state=unknown&code=x", nil, http.Header{})
+		assert.Equal(t, http.StatusBadRequest, statusCode, body)
+		statusCode, _, body = testRequest(t, ts, http.MethodGet, handlers.AuthOIDCCallbackURI+"?error=access_denied", nil, http.Header{})
+		assert.Equal(t, http.StatusBadRequest, statusCode, body)
+	})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// WithTrustedProxies sets the reverse proxies whose X-Forwarded-For header is trusted.
+// Without trusted proxies the address of the client is always the address of the connection,
+// so that clients can't evade the sign-in throttling or forge the audit log with a spoofed header.
+func WithTrustedProxies(proxies ...netip.Prefix) Option {
+	return func(h *ServiceHandlers) {
+		h.trustedProxies = proxies
+	}
+}
+
+// realIP replaces the remote address of requests forwarded by a trusted proxy with the address of the client.
+// X-Forwarded-For is read from right to left, skipping the trusted proxies, because only the entries
+// appended by them can be trusted. Requests from other peers are left untouched.
+func (h *ServiceHandlers) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(h.trustedProxies) > 0 && h.isTrustedProxy(clientIP(r)) {
+			if ip := h.forwardedFor(r.Header.Values("X-Forwarded-For")); ip != "" {
+				r.RemoteAddr = ip
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor returns the rightmost address of the X-Forwarded-For header values which isn't a trusted proxy,
+// or the leftmost address if all of them are. Returns an empty string if the header is missing or malformed.
+func (h *ServiceHandlers) forwardedFor(values []string) string {
+	var hops []string
+	for _, v := range values {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	ip := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return ip
+		}
+		ip = addr.Unmap().String()
+		if !h.isTrustedProxy(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// isTrustedProxy reports whether the address belongs to one of the trusted proxies.
+func (h *ServiceHandlers) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range h.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client without the port.
+// The router's realIP middleware has already replaced it with the forwarded address if the peer is a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// writeJSON marshals the value and writes it as the response body with the given status code.
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, err = w.Write(bytes)
+	if err != nil {
+		logger.Logger().Warn("failed to write response", zap.Error(err))
+	}
+}
+
+// readJSON reads the request body and unmarshals it into the value.
+// It writes a 400 Bad Request response and returns false if the body is not valid JSON.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		logger.Logger().Warn("failed to unmarshal request", zap.String("URI", r.RequestURI), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
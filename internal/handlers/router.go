@@ -3,8 +3,11 @@ package handlers
 import (
 	"context"
 	"net/http"
+	"net/netip"
+	"sync/atomic"
 	"time"
 
+	"github.com/andreevym/gophkeeper/internal/oidc"
 	"github.com/andreevym/gophkeeper/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -14,22 +17,80 @@ import (
 type Hasher interface {
 	Hash(password string) (string, error)       // Hash generates a hash of the password.
 	Match(hashedPassword, password string) bool // Match checks if the provided password matches the hashed password.
+	NeedsRehash(hashedPassword string) bool     // NeedsRehash checks if the hash uses an outdated algorithm or parameters.
 }
 
 // UserSessionExtractor defines methods for handling user sessions and JWT tokens.
 type UserSessionExtractor interface {
-	GenerateToken(userID uint64) (string, error)                  // GenerateToken generates a JWT token for the given user ID.
-	GetUserFromSession(ctx context.Context) (storage.User, error) // GetUserFromSession retrieves the user from the session context.
+	GenerateToken(user storage.User, sessionID uint64) (string, error)   // GenerateToken generates a JWT token for the given user and session.
+	StartSession(ctx context.Context, s storage.Session) (uint64, error) // StartSession records a sign-in session, returns 0 if sessions are not tracked.
+	CurrentSessionID(ctx context.Context) (uint64, bool)                 // CurrentSessionID retrieves the sign-in session of the request, if any.
+	GenerateAccessToken() (string, string, error)                        // GenerateAccessToken generates a personal access token and its hash.
+	GetUserFromSession(ctx context.Context) (storage.User, error)        // GetUserFromSession retrieves the user from the session context.
+	GetTokenFromSession(ctx context.Context) (storage.AccessToken, bool) // GetTokenFromSession retrieves the personal access token used by the session, if any.
+	GenerateMFAToken(userID uint64) (string, error)                      // GenerateMFAToken generates a token for the second sign-in step.
+	ValidateMFAToken(tokenString string) (uint64, error)                 // ValidateMFAToken validates a second sign-in step token and returns the user ID.
+}
+
+// SignInLimiter defines methods for throttling sign-in attempts.
+type SignInLimiter interface {
+	Reserve(ctx context.Context, login, ip string, now time.Time) (time.Duration, error) // Reserve counts an attempt in progress and returns how long the client has to wait, 0 if it may proceed.
+	Release(ctx context.Context, login, ip string) error                                 // Release ends an attempt allowed by Reserve.
+	Fail(ctx context.Context, login, ip string, now time.Time) error                     // Fail records a failed attempt.
+	Reset(ctx context.Context, login string) error                                       // Reset forgets the failures of the login after a successful sign-in.
+}
+
+// AuthObserver is notified of the results of sign-in attempts, for example to export them as metrics.
+type AuthObserver interface {
+	SignInSucceeded()           // SignInSucceeded is called when a sign-in session is started.
+	SignInFailed(reason string) // SignInFailed is called with one of the SignInFailure* reasons when a sign-in is rejected.
+}
+
+// OIDCAuthenticator defines methods for sign-in with an external OpenID Connect identity provider.
+type OIDCAuthenticator interface {
+	AuthCodeURL(state, nonce, codeVerifier string) string                                  // AuthCodeURL returns the sign-in URL at the provider.
+	Exchange(ctx context.Context, code, nonce, codeVerifier string) (oidc.Identity, error) // Exchange redeems an authorization code and verifies the ID token.
 }
 
 // Constants for various URI paths used in the application.
 const (
-	RootURI       = "/"                // RootURI is the root endpoint.
-	AuthSignInURI = "/api/auth/signin" // AuthSignInURI is the endpoint for user sign-in.
-	AuthSignUpURI = "/api/auth/signup" // AuthSignUpURI is the endpoint for user sign-up.
-	VaultURI      = "/api/vault"       // VaultURI is the endpoint for vault operations.
-	PingURI       = "/api/ping"        // PingURI is the endpoint for health checks.
-	FileUploadURI = "/api/upload"      // FileUploadURI is the endpoint for upload file.
+	RootURI         = "/"                // RootURI is the root endpoint.
+	AuthSignInURI   = "/api/auth/signin" // AuthSignInURI is the endpoint for user sign-in.
+	AuthSignUpURI   = "/api/auth/signup" // AuthSignUpURI is the endpoint for user sign-up.
+	VaultURI        = "/api/vault"       // VaultURI is the endpoint for vault operations.
+	PingURI         = "/api/ping"        // PingURI is the endpoint for health checks.
+	FileUploadURI   = "/api/upload"      // FileUploadURI is the endpoint for upload file.
+	FileDownloadURI = "/api/download"    // FileDownloadURI is the endpoint for downloading the value of a vault entry.
+	TokensURI       = "/api/tokens"      // TokensURI is the endpoint for personal access tokens.
+	UsageURI        = "/api/usage"       // UsageURI is the endpoint for the storage usage and quota.
+	AuditURI        = "/api/audit"       // AuditURI is the endpoint for the audit log of the user.
+	ExportURI       = "/api/export"      // ExportURI is the endpoint for exporting the vault to an encrypted archive.
+	ImportURI       = "/api/import"      // ImportURI is the endpoint for importing an encrypted archive into the vault.
+	HealthzURI      = "/healthz"         // HealthzURI is the endpoint for the liveness probe.
+	ReadyzURI       = "/readyz"          // ReadyzURI is the endpoint for the readiness probe.
+	AdminURI        = "/api/admin"       // AdminURI is the prefix of the admin API endpoints.
+
+	AuthSignInTwoFactorURI = "/api/auth/signin/2fa"   // AuthSignInTwoFactorURI is the endpoint for the second sign-in step.
+	TwoFactorEnrollURI     = "/api/auth/2fa/enroll"   // TwoFactorEnrollURI is the endpoint for starting TOTP enrollment.
+	TwoFactorActivateURI   = "/api/auth/2fa/activate" // TwoFactorActivateURI is the endpoint for verifying and enabling TOTP.
+	TwoFactorDisableURI    = "/api/auth/2fa/disable"  // TwoFactorDisableURI is the endpoint for disabling TOTP.
+	FailedSignInsURI       = "/api/auth/failures"     // FailedSignInsURI is the endpoint for reviewing failed sign-ins.
+
+	AccountURI         = "/api/account"          // AccountURI is the endpoint for deleting the account.
+	AccountPasswordURI = "/api/account/password" // AccountPasswordURI is the endpoint for changing the password.
+	AccountLoginURI    = "/api/account/login"    // AccountLoginURI is the endpoint for renaming the login.
+	SessionsURI        = "/api/sessions"         // SessionsURI is the endpoint for sign-in sessions.
+
+	AuthSRPSignUpURI    = "/api/auth/srp/signup"    // AuthSRPSignUpURI is the endpoint for sign-up with zero-knowledge sign-in.
+	AuthSRPChallengeURI = "/api/auth/srp/challenge" // AuthSRPChallengeURI is the endpoint for the first zero-knowledge sign-in step.
+	AuthSRPVerifyURI    = "/api/auth/srp/verify"    // AuthSRPVerifyURI is the endpoint for the second zero-knowledge sign-in step.
+	SRPVerifierURI      = "/api/auth/srp/verifier"  // SRPVerifierURI is the endpoint for enabling zero-knowledge sign-in.
+
+	AuthOIDCDeviceURI   = "/api/auth/oidc/device"   // AuthOIDCDeviceURI is the endpoint for starting a sign-in with the identity provider.
+	AuthOIDCVerifyURI   = "/api/auth/oidc/verify"   // AuthOIDCVerifyURI is the page where the user enters the user code.
+	AuthOIDCApproveURI  = "/api/auth/oidc/approve"  // AuthOIDCApproveURI is the endpoint for approving the sign-in in the browser.
+	AuthOIDCCallbackURI = "/api/auth/oidc/callback" // AuthOIDCCallbackURI is the redirect URI registered at the identity provider.
+	AuthOIDCTokenURI    = "/api/auth/oidc/token"    // AuthOIDCTokenURI is the endpoint for polling the result of the sign-in.
 )
 
 // ServiceHandlers manages HTTP request handlers for the service.
@@ -39,6 +100,101 @@ type ServiceHandlers struct {
 	userStorage  storage.UserStorage  // UserStorage for user-related operations.
 	vaultStorage storage.VaultStorage // VaultStorage for vault-related operations.
 	hashService  Hasher               // Hasher for password hashing and verification.
+	tokenStorage storage.TokenStorage // TokenStorage for personal access tokens, optional.
+	now          func() time.Time     // Clock used for time-based one-time passwords.
+
+	signInLimiter       SignInLimiter               // SignInLimiter for brute-force protection, optional.
+	failedSignInStorage storage.FailedSignInStorage // FailedSignInStorage for the log of failed sign-ins, optional.
+	sessionStorage      storage.SessionStorage      // SessionStorage for listing and revoking sign-in sessions, optional.
+	srpHandshakeStorage storage.SRPHandshakeStorage // SRPHandshakeStorage for zero-knowledge sign-in, optional.
+	oidc                OIDCConfig                  // OIDCConfig for sign-in with an identity provider, optional.
+	trustedProxies      []netip.Prefix              // Reverse proxies whose X-Forwarded-For header is trusted, optional.
+	importLimits        ImportLimits                // ImportLimits bounding PostImport.
+	imports             chan struct{}               // Holds a value for every running import, up to importLimits.MaxConcurrent.
+	quotaStorage        storage.QuotaStorage        // QuotaStorage for reporting the storage usage, optional.
+	vaultValueStorage   storage.VaultValueStorage   // VaultValueStorage for copying files piece by piece, optional.
+	auditStorage        storage.AuditStorage        // AuditStorage for the audit log, optional.
+	authObserver        AuthObserver                // AuthObserver for monitoring sign-ins, optional.
+	readinessChecks     []ReadinessCheck            // Dependencies checked by the readiness probe.
+	maintenanceJobs     []MaintenanceJob            // Jobs administrators can run with the admin API.
+	draining            atomic.Bool                 // Set by Drain when the server is shutting down.
+}
+
+// Option configures optional dependencies of ServiceHandlers.
+type Option func(*ServiceHandlers)
+
+// WithTokenStorage enables personal access token management endpoints backed by the given storage.
+func WithTokenStorage(tokenStorage storage.TokenStorage) Option {
+	return func(h *ServiceHandlers) {
+		h.tokenStorage = tokenStorage
+	}
+}
+
+// WithSignInLimiter enables brute-force protection of the sign-in endpoints.
+func WithSignInLimiter(limiter SignInLimiter) Option {
+	return func(h *ServiceHandlers) {
+		h.signInLimiter = limiter
+	}
+}
+
+// WithFailedSignInStorage enables logging of failed sign-ins and the endpoint for reviewing them.
+func WithFailedSignInStorage(failedSignInStorage storage.FailedSignInStorage) Option {
+	return func(h *ServiceHandlers) {
+		h.failedSignInStorage = failedSignInStorage
+	}
+}
+
+// WithSessionStorage enables the endpoints for listing and revoking sign-in sessions.
+// The auth provider must track sessions in the same storage.
+func WithSessionStorage(sessionStorage storage.SessionStorage) Option {
+	return func(h *ServiceHandlers) {
+		h.sessionStorage = sessionStorage
+	}
+}
+
+// WithSRPHandshakeStorage enables the zero-knowledge sign-in endpoints.
+func WithSRPHandshakeStorage(srpHandshakeStorage storage.SRPHandshakeStorage) Option {
+	return func(h *ServiceHandlers) {
+		h.srpHandshakeStorage = srpHandshakeStorage
+	}
+}
+
+// WithOIDC enables sign-in with an external OpenID Connect identity provider.
+func WithOIDC(cfg OIDCConfig) Option {
+	return func(h *ServiceHandlers) {
+		h.oidc = cfg
+	}
+}
+
+// WithQuotaStorage enables the endpoint reporting the storage usage and quota of the user.
+// Quotas are enforced by the vault storage, which should be the same.
+func WithQuotaStorage(quotaStorage storage.QuotaStorage) Option {
+	return func(h *ServiceHandlers) {
+		h.quotaStorage = quotaStorage
+	}
+}
+
+// WithVaultValueStorage makes the file upload and download endpoints copy values piece by piece instead of
+// holding them in memory. It should be the vault storage itself.
+func WithVaultValueStorage(vaultValueStorage storage.VaultValueStorage) Option {
+	return func(h *ServiceHandlers) {
+		h.vaultValueStorage = vaultValueStorage
+	}
+}
+
+// WithAuditStorage enables recording sign-ins and accesses to vault entries in the audit log
+// and the endpoint for reviewing it.
+func WithAuditStorage(auditStorage storage.AuditStorage) Option {
+	return func(h *ServiceHandlers) {
+		h.auditStorage = auditStorage
+	}
+}
+
+// WithAuthObserver notifies the observer of successful and failed sign-ins.
+func WithAuthObserver(authObserver AuthObserver) Option {
+	return func(h *ServiceHandlers) {
+		h.authObserver = authObserver
+	}
 }
 
 // DBClient defines methods for database operations.
@@ -46,6 +202,13 @@ type DBClient interface {
 	PingContext(ctx context.Context) error // PingContext checks the database connection.
 }
 
+// WithClock replaces the clock used for time-based checks, for example with a fake one in tests.
+func WithClock(now func() time.Time) Option {
+	return func(h *ServiceHandlers) {
+		h.now = now
+	}
+}
+
 // NewServiceHandlers creates a new instance of ServiceHandlers with the given dependencies.
 // It initializes the ServiceHandlers with the provided DBClient, UserSessionExtractor,
 // VaultStorage, UserStorage, and Hasher.
@@ -56,6 +219,7 @@ type DBClient interface {
 //   - vaultStorage (storage.VaultStorage): Interface for vault operations.
 //   - userStorage (storage.UserStorage): Interface for user operations.
 //   - hashService (Hasher): Interface for password hashing.
+//   - opts (...Option): Optional dependencies enabling additional endpoints.
 //
 // Returns:
 //   - *ServiceHandlers: A new instance of ServiceHandlers with the provided dependencies.
@@ -65,14 +229,22 @@ func NewServiceHandlers(
 	vaultStorage storage.VaultStorage,
 	userStorage storage.UserStorage,
 	hashService Hasher,
+	opts ...Option,
 ) *ServiceHandlers {
-	return &ServiceHandlers{
+	h := &ServiceHandlers{
 		dbClient:     dbClient,
 		authProvider: authProvider,
 		vaultStorage: vaultStorage,
 		userStorage:  userStorage,
 		hashService:  hashService,
+		now:          time.Now,
+		importLimits: DefaultImportLimits,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	h.imports = make(chan struct{}, max(h.importLimits.MaxConcurrent, 1))
+	return h
 }
 
 // NewRouter creates a new HTTP router with the specified handlers and middleware.
@@ -88,7 +260,7 @@ func NewRouter(s *ServiceHandlers, m ...func(http.Handler) http.Handler) *chi.Mu
 
 	// Middleware stack
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(s.realIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
@@ -97,14 +269,82 @@ func NewRouter(s *ServiceHandlers, m ...func(http.Handler) http.Handler) *chi.Mu
 	// Route handlers
 	r.Post(AuthSignInURI, s.PostSignIn)
 	r.Post(AuthSignUpURI, s.PostSignUp)
+	r.Post(AuthSignInTwoFactorURI, s.PostSignInTwoFactor)
+
+	r.Post(TwoFactorEnrollURI, s.PostTwoFactorEnroll)
+	r.Post(TwoFactorActivateURI, s.PostTwoFactorActivate)
+	r.Post(TwoFactorDisableURI, s.PostTwoFactorDisable)
+
+	r.Post(AccountPasswordURI, s.PostAccountPassword)
+	r.Post(AccountLoginURI, s.PostAccountLogin)
+	r.Delete(AccountURI, s.DeleteAccount)
 
 	r.Post(VaultURI, s.PostVault)
 	r.Get(VaultURI+"/{vaultID}", s.GetVault)
+	r.Post(ExportURI, s.PostExport)
+	r.Post(ImportURI, s.PostImport)
 
 	r.Get(PingURI, s.GetPingHandler)
+	r.Get(HealthzURI, s.GetHealthz)
+	r.Get(ReadyzURI, s.GetReadyz)
 
 	r.Post(FileUploadURI, s.FileUploadHandler)
 	r.Post(FileUploadURI+"/{vaultID}", s.FileUploadHandler)
+	r.Get(FileDownloadURI+"/{vaultID}", s.FileDownloadHandler)
+
+	if s.tokenStorage != nil {
+		r.Post(TokensURI, s.PostToken)
+		r.Get(TokensURI, s.GetTokens)
+		r.Delete(TokensURI+"/{tokenID}", s.DeleteToken)
+	}
+
+	if s.sessionStorage != nil {
+		r.Get(SessionsURI, s.GetSessions)
+		r.Delete(SessionsURI, s.DeleteOtherSessions)
+		r.Delete(SessionsURI+"/{sessionID}", s.DeleteSession)
+	}
+
+	if s.srpHandshakeStorage != nil {
+		r.Post(AuthSRPSignUpURI, s.PostSRPSignUp)
+		r.Post(AuthSRPChallengeURI, s.PostSRPChallenge)
+		r.Post(AuthSRPVerifyURI, s.PostSRPVerify)
+		r.Post(SRPVerifierURI, s.PostSRPVerifier)
+	}
+
+	if s.oidc.Provider != nil {
+		r.Post(AuthOIDCDeviceURI, s.PostOIDCDevice)
+		r.Get(AuthOIDCVerifyURI, s.GetOIDCVerify)
+		r.Post(AuthOIDCVerifyURI, s.PostOIDCVerify)
+		r.Post(AuthOIDCApproveURI, s.PostOIDCApprove)
+		r.Get(AuthOIDCCallbackURI, s.GetOIDCCallback)
+		r.Post(AuthOIDCTokenURI, s.PostOIDCToken)
+	}
+
+	if s.failedSignInStorage != nil {
+		r.Get(FailedSignInsURI, s.GetFailedSignIns)
+	}
+
+	if s.quotaStorage != nil {
+		r.Get(UsageURI, s.GetUsage)
+	}
+
+	if s.auditStorage != nil {
+		r.Get(AuditURI, s.GetAudit)
+	}
+
+	r.Route(AdminURI, func(r chi.Router) {
+		r.Get("/users", s.GetAdminUsers)
+		r.Get("/users/{userID}", s.GetAdminUser)
+		r.Post("/users/{userID}/disable", s.PostAdminDisableUser)
+		r.Post("/users/{userID}/enable", s.PostAdminEnableUser)
+		r.Post("/users/{userID}/logout", s.PostAdminLogoutUser)
+		r.Post("/users/{userID}/reset-2fa", s.PostAdminResetTwoFactor)
+		if s.quotaStorage != nil {
+			r.Get("/users/{userID}/usage", s.GetAdminUserUsage)
+		}
+		r.Get("/jobs", s.GetAdminJobs)
+		r.Post("/jobs/{job}", s.PostAdminJob)
+	})
 
 	r.Get(RootURI, func(writer http.ResponseWriter, request *http.Request) {
 		writer.Header().Set("Content-Type", "text/html")
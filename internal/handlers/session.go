@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// SessionResponse represents a sign-in session in the list of sessions.
+type SessionResponse struct {
+	storage.Session
+	Current bool `json:"current"` // Whether the request was authenticated with this session.
+}
+
+// GetSessions handles listing the active sign-in sessions of the current user.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the sessions cannot be retrieved.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 200 OK with the list of sessions, most recently seen first.
+func (h *ServiceHandlers) GetSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessionStorage.ListSessions(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currentID, _ := h.authProvider.CurrentSessionID(r.Context())
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, SessionResponse{Session: s, Current: s.ID == currentID})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// DeleteSession handles the revocation of a sign-in session. Revoking the current session signs out.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the session ID is invalid.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 404 Not Found if the session does not exist or belongs to another user.
+//   - HTTP 204 No Content on successful revocation.
+func (h *ServiceHandlers) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse param sessionID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s, err := h.sessionStorage.GetSession(ctx, id)
+	if err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil || s.UserID != user.ID {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.sessionStorage.RevokeSession(ctx, id, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteOtherSessions handles signing out all devices except the one making the request.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the sessions cannot be revoked.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 204 No Content on success.
+func (h *ServiceHandlers) DeleteOtherSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	currentID, _ := h.authProvider.CurrentSessionID(ctx)
+	err := h.sessionStorage.RevokeOtherSessions(ctx, user.ID, currentID, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentDeviceName returns the device name of the session the request was authenticated with, if any.
+func (h *ServiceHandlers) currentDeviceName(ctx context.Context) string {
+	id, ok := h.authProvider.CurrentSessionID(ctx)
+	if !ok || h.sessionStorage == nil {
+		return ""
+	}
+	s, err := h.sessionStorage.GetSession(ctx, id)
+	if err != nil {
+		return ""
+	}
+	return s.DeviceName
+}
@@ -0,0 +1,106 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/auth"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/andreevym/gophkeeper/internal/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+
+	hashService := pwd.NewHashService(pwd.DefaultArgon2Params)
+	hashedPassword, err := hashService.Hash("password")
+	require.NoError(t, err)
+
+	user := storage.User{ID: 1, Login: "user", Password: hashedPassword}
+	other := storage.User{ID: 2, Login: "other", Password: hashedPassword}
+	userStorage := mock.NewMockUserStorage(ctrl)
+	for _, u := range []storage.User{user, other} {
+		userStorage.EXPECT().GetUser(gomock.Any(), u.ID).Return(u, nil).AnyTimes()
+		userStorage.EXPECT().GetUserByLogin(gomock.Any(), u.Login).Return(u, nil).AnyTimes()
+	}
+
+	sessionStorage := memory.NewSessionStorage()
+	ts := newTestServer(t,
+		withStorages(userStorage, nil, nil),
+		withHashService(hashService),
+		withProviderOptions(auth.WithSessionStorage(sessionStorage)),
+		withHandlerOptions(
+			handlers.WithSessionStorage(sessionStorage),
+			handlers.WithTrustedProxies(netip.MustParsePrefix("127.0.0.1/32")),
+		),
+	)
+
+	signIn := func(login, device string) http.Header {
+		reqBody, err := json.Marshal(handlers.SignInRequest{Login: login, Password: "password", Device: device})
+		require.NoError(t, err)
+		statusCode, header, got := testRequest(t, ts.Server, http.MethodPost, handlers.AuthSignInURI, bytes.NewBuffer(reqBody), http.Header{
+			"User-Agent":      {"session-test"},
+			"X-Forwarded-For": {"203.0.113.7"},
+		})
+		require.Equal(t, http.StatusOK, statusCode, got)
+		return http.Header{"Authorization": header.Values("Authorization")}
+	}
+	list := func(header http.Header) []handlers.SessionResponse {
+		statusCode, _, got := testRequest(t, ts.Server, http.MethodGet, handlers.SessionsURI, nil, header)
+		require.Equal(t, http.StatusOK, statusCode, got)
+		var sessions []handlers.SessionResponse
+		require.NoError(t, json.Unmarshal([]byte(got), &sessions))
+		return sessions
+	}
+	status := func(method, uri string, header http.Header) int {
+		statusCode, _, _ := testRequest(t, ts.Server, method, uri, nil, header)
+		return statusCode
+	}
+
+	laptop := signIn("user", "laptop")
+	phone := signIn("user", "phone")
+	otherLaptop := signIn("other", "laptop")
+
+	sessions := list(laptop)
+	require.Len(t, sessions, 2)
+	var phoneID uint64
+	for _, s := range sessions {
+		assert.Equal(t, "203.0.113.7", s.IP)
+		assert.Equal(t, "session-test", s.UserAgent)
+		assert.Equal(t, s.DeviceName == "laptop", s.Current)
+		if s.DeviceName == "phone" {
+			phoneID = s.ID
+		}
+	}
+	require.NotZero(t, phoneID)
+
+	// Sessions of other users can't be revoked.
+	assert.Equal(t, http.StatusNotFound, status(http.MethodDelete, fmt.Sprintf("%s/%d", handlers.SessionsURI, phoneID), otherLaptop))
+	assert.Equal(t, http.StatusOK, status(http.MethodGet, handlers.SessionsURI, phone))
+
+	assert.Equal(t, http.StatusNoContent, status(http.MethodDelete, fmt.Sprintf("%s/%d", handlers.SessionsURI, phoneID), laptop))
+	assert.Equal(t, http.StatusUnauthorized, status(http.MethodGet, handlers.SessionsURI, phone))
+
+	// Signing out all other sessions keeps the current one and doesn't affect other users.
+	desktop := signIn("user", "desktop")
+	assert.Equal(t, http.StatusNoContent, status(http.MethodDelete, handlers.SessionsURI, laptop))
+	assert.Equal(t, http.StatusUnauthorized, status(http.MethodGet, handlers.SessionsURI, desktop))
+	assert.Len(t, list(laptop), 1)
+	assert.Len(t, list(otherLaptop), 1)
+
+	// Tokens without a session are not accepted while sessions are tracked.
+	token, err := ts.authProvider.GenerateToken(user, 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status(http.MethodGet, handlers.SessionsURI, http.Header{"Authorization": {"Bearer " + token}}))
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/srp"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// SRPHandshakeTTL is how long the client has to answer a zero-knowledge sign-in challenge.
+	SRPHandshakeTTL = time.Minute
+	// ReauthenticationWindow is how recent the sign-in of an account without a password must be
+	// to confirm sensitive operations, since there is no password the server could check.
+	ReauthenticationWindow = 5 * time.Minute
+	// SignInFailureInvalidProof is the reason of failed zero-knowledge sign-ins stored in the log.
+	SignInFailureInvalidProof = "invalid zero-knowledge proof"
+)
+
+// SRPSignUpRequest represents the payload for signing up with zero-knowledge sign-in.
+type SRPSignUpRequest struct {
+	Login    string `json:"login"`    // The login username for the new user.
+	Salt     []byte `json:"salt"`     // The random salt the verifier was computed with.
+	Verifier []byte `json:"verifier"` // The SRP verifier of the password.
+}
+
+// SRPVerifierRequest represents the payload for enabling zero-knowledge sign-in or replacing its verifier.
+type SRPVerifierRequest struct {
+	CurrentPassword string `json:"current_password"` // The current password, if the account still has one.
+	Salt            []byte `json:"salt"`             // The random salt the verifier was computed with.
+	Verifier        []byte `json:"verifier"`         // The SRP verifier of the new password.
+}
+
+// SRPChallengeRequest represents the first step of a zero-knowledge sign-in.
+type SRPChallengeRequest struct {
+	Login     string `json:"login"`      // The login username for the user.
+	PublicKey []byte `json:"public_key"` // The public ephemeral A of the client.
+}
+
+// SRPChallengeResponse represents the server answer to SRPChallengeRequest.
+type SRPChallengeResponse struct {
+	HandshakeID string `json:"handshake_id"` // Identifies the handshake in SRPVerifyRequest.
+	Salt        []byte `json:"salt"`         // The salt of the verifier.
+	PublicKey   []byte `json:"public_key"`   // The public ephemeral B of the server.
+}
+
+// SRPVerifyRequest represents the second step of a zero-knowledge sign-in.
+type SRPVerifyRequest struct {
+	HandshakeID string `json:"handshake_id"` // The handshake ID from SRPChallengeResponse.
+	ClientProof []byte `json:"client_proof"` // The proof M1 that the client knows the password.
+	Device      string `json:"device"`       // Optional name of the device, shown in the list of sessions.
+}
+
+// SRPVerifyResponse represents the server answer to SRPVerifyRequest.
+type SRPVerifyResponse struct {
+	ServerProof       []byte `json:"server_proof"`        // The proof M2 that the server knows the verifier.
+	TwoFactorRequired bool   `json:"two_factor_required"` // Whether a TOTP or recovery code must be sent to AuthSignInTwoFactorURI.
+	MFAToken          string `json:"mfa_token,omitempty"` // Short-lived token for the second sign-in step.
+}
+
+// PostSRPSignUp handles sign-up of users who only use zero-knowledge sign-in.
+//
+// The client computes the salt and the verifier from the password, the password itself is never sent.
+// Such accounts can't sign in with AuthSignInURI.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is an error in the request or the verifier is malformed.
+//   - HTTP 409 Conflict if the login is already taken, ignoring case.
+//   - HTTP 201 Created on successful user creation.
+func (h *ServiceHandlers) PostSRPSignUp(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	request := SRPSignUpRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	request.Login = storage.NormalizeLogin(request.Login)
+	if request.Login == "" || len(request.Login) > 50 {
+		http.Error(w, fmt.Sprintf("login is empty or too long more than 50 characters but actual len is %d", len(request.Login)), http.StatusBadRequest)
+		return
+	}
+
+	err := srp.ValidateVerifier(request.Salt, request.Verifier)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.userStorage.GetUserByLogin(ctx, request.Login)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		http.Error(w, "user already exists", http.StatusConflict)
+		return
+	}
+
+	createdUser, err := h.userStorage.CreateUser(ctx, storage.User{
+		Login:       request.Login,
+		SRPSalt:     request.Salt,
+		SRPVerifier: request.Verifier,
+	})
+	if errors.Is(err, storage.ErrLoginTaken) {
+		http.Error(w, "user already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Logger().Warn("failed to create user", zap.String("login", request.Login), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, SignUpResponse{ID: createdUser.ID, Login: createdUser.Login})
+}
+
+// PostSRPVerifier handles enabling zero-knowledge sign-in for the current user or replacing the verifier,
+// which is how zero-knowledge accounts change their password.
+//
+// An account with a password must confirm it one last time, the password hash is removed afterwards,
+// so that clients can't fall back to sending the password. Zero-knowledge accounts must have signed in
+// within ReauthenticationWindow instead. Like a password change, all sign-in sessions and
+// personal access tokens are revoked and a new sign-in token for the calling client is returned.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is an error in the request, the verifier is malformed or the password is wrong.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token or the sign-in is not recent.
+//   - HTTP 409 Conflict if the user was changed concurrently, the request can be retried.
+//   - HTTP 429 Too Many Requests with a Retry-After header if there were too many failed attempts.
+//   - HTTP 500 Internal Server Error if the tokens cannot be revoked, the account is unchanged then.
+//   - HTTP 200 OK with the new JWT token in the Authorization header.
+func (h *ServiceHandlers) PostSRPVerifier(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	request := SRPVerifierRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	if !h.verifyPassword(w, r, user, request.CurrentPassword) {
+		return
+	}
+
+	err := srp.ValidateVerifier(request.Salt, request.Verifier)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	device := h.currentDeviceName(ctx)
+	err = h.revokeCredentials(ctx, user.ID)
+	if err != nil {
+		logger.Logger().Error("failed to revoke tokens", zap.String("login", user.Login), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user.Password = ""
+	user.SRPSalt = request.Salt
+	user.SRPVerifier = request.Verifier
+	user.TokenVersion++
+	err = h.userStorage.UpdateUser(ctx, user)
+	if err != nil {
+		updateUserFailed(w, err, http.StatusBadRequest)
+		return
+	}
+	logger.Logger().Info("zero-knowledge verifier changed", zap.String("login", user.Login))
+
+	h.issueToken(w, r, user, device)
+}
+
+// PostSRPChallenge handles the first step of a zero-knowledge sign-in.
+//
+// The server answers the public ephemeral of the client with the salt and its own public ephemeral.
+// The expected proofs are kept for SRPHandshakeTTL, the secret ephemeral is discarded.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is an error in the request, the login is unknown
+//     or zero-knowledge sign-in is not enabled for it.
+//   - HTTP 429 Too Many Requests with a Retry-After header if there were too many failed attempts.
+//   - HTTP 200 OK with an SRPChallengeResponse.
+func (h *ServiceHandlers) PostSRPChallenge(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	request := SRPChallengeRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	request.Login = storage.NormalizeLogin(request.Login)
+	release, ok := h.reserveSignIn(w, r, request.Login)
+	if !ok {
+		return
+	}
+	defer release()
+
+	user, err := h.userStorage.GetUserByLogin(ctx, request.Login)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			h.signInFailed(ctx, r, 0, request.Login, SignInFailureUnknownLogin)
+		}
+		logger.Logger().Warn("failed to get user by login", zap.String("login", request.Login), zap.Error(err))
+		http.Error(w, fmt.Sprintf("failed to get user by login %s: %v", request.Login, err), http.StatusBadRequest)
+		return
+	}
+
+	if len(user.SRPVerifier) == 0 {
+		http.Error(w, "zero-knowledge sign-in is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	server, err := srp.NewServer(user.SRPVerifier, request.PublicKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := randomHex(32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	handshake := storage.SRPHandshake{
+		ID:          id,
+		UserID:      user.ID,
+		ClientProof: server.ClientProof(),
+		ServerProof: server.ServerProof(),
+		ExpiresAt:   h.now().Add(SRPHandshakeTTL),
+	}
+	err = h.srpHandshakeStorage.CreateSRPHandshake(ctx, handshake)
+	if err != nil {
+		logger.Logger().Warn("failed to create srp handshake", zap.String("login", user.Login), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SRPChallengeResponse{
+		HandshakeID: handshake.ID,
+		Salt:        user.SRPSalt,
+		PublicKey:   server.PublicKey(),
+	})
+}
+
+// PostSRPVerify handles the second step of a zero-knowledge sign-in.
+//
+// Every handshake can be completed once. On a valid client proof a JWT token is issued like a regular sign-in,
+// and the server proof is returned so that the client can check that it talks to a server knowing the verifier.
+// Invalid proofs count towards the same sign-in limits as invalid passwords.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is an error in the request.
+//   - HTTP 401 Unauthorized if the handshake is unknown or expired, or the proof is invalid.
+//   - HTTP 429 Too Many Requests with a Retry-After header if there were too many failed attempts.
+//   - HTTP 202 Accepted with an SRPVerifyResponse carrying an MFA token if a second factor is required.
+//   - HTTP 200 OK with an SRPVerifyResponse and the JWT token in the Authorization header on successful sign-in.
+func (h *ServiceHandlers) PostSRPVerify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	request := SRPVerifyRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	handshake, err := h.srpHandshakeStorage.TakeSRPHandshake(ctx, request.HandshakeID)
+	if err != nil && !errors.Is(err, storage.ErrSRPHandshakeNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil || !h.now().Before(handshake.ExpiresAt) {
+		http.Error(w, "invalid or expired handshake", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userStorage.GetUser(ctx, handshake.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get user: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	release, ok := h.reserveSignIn(w, r, user.Login)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if !srp.VerifyProof(handshake.ClientProof, request.ClientProof) {
+		h.signInFailed(ctx, r, user.ID, user.Login, SignInFailureInvalidProof)
+		logger.Logger().Warn("failed to verify zero-knowledge proof", zap.String("login", user.Login))
+		http.Error(w, "invalid proof", http.StatusUnauthorized)
+		return
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, err := h.authProvider.GenerateMFAToken(user.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to generate mfa token: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, SRPVerifyResponse{ServerProof: handshake.ServerProof, TwoFactorRequired: true, MFAToken: mfaToken})
+		return
+	}
+
+	h.signInSucceeded(ctx, user.Login)
+	if !h.setTokenHeader(w, r, user, request.Device) {
+		return
+	}
+	writeJSON(w, http.StatusOK, SRPVerifyResponse{ServerProof: handshake.ServerProof})
+}
+
+// isZeroKnowledgeAccount reports whether the user signs in with SRP only and has no password the server could check.
+func isZeroKnowledgeAccount(user storage.User) bool {
+	return user.Password == "" && len(user.SRPVerifier) > 0
+}
+
+// verifyRecentSignIn confirms a sensitive operation of an account without a password,
+// signing in with zero-knowledge sign-in or an identity provider, by the age of its sign-in session.
+// It writes an error response and returns false if the session is older than ReauthenticationWindow.
+func (h *ServiceHandlers) verifyRecentSignIn(w http.ResponseWriter, r *http.Request) bool {
+	ctx := r.Context()
+	id, ok := h.authProvider.CurrentSessionID(ctx)
+	if !ok || h.sessionStorage == nil {
+		http.Error(w, "sign in again to confirm this operation", http.StatusForbidden)
+		return false
+	}
+
+	session, err := h.sessionStorage.GetSession(ctx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if h.now().Sub(session.CreatedAt) > ReauthenticationWindow {
+		http.Error(w, "sign in again to confirm this operation", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
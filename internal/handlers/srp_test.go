@@ -0,0 +1,146 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/auth"
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/andreevym/gophkeeper/internal/srp"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSRPSignIn(t *testing.T) {
+	t.Parallel()
+
+	hashService := pwd.NewHashService(pwd.DefaultArgon2Params)
+	hashedPassword, err := hashService.Hash("password")
+	require.NoError(t, err)
+
+	userStorage := memory.NewUserStorage(nil, nil)
+	_, err = userStorage.CreateUser(context.Background(), storage.User{Login: "user", Password: hashedPassword})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	sessionStorage := memory.NewSessionStorage()
+	ts := newTestServer(t,
+		withStorages(userStorage, nil, nil),
+		withHashService(hashService),
+		withProviderOptions(auth.WithSessionStorage(sessionStorage)),
+		withPublicURIs(handlers.AuthSRPSignUpURI, handlers.AuthSRPChallengeURI, handlers.AuthSRPVerifyURI),
+		withHandlerOptions(
+			handlers.WithClock(clock),
+			handlers.WithSessionStorage(sessionStorage),
+			handlers.WithSRPHandshakeStorage(memory.NewSRPHandshakeStorage()),
+		),
+	)
+	c := client.NewClient(ts.URL)
+
+	authorized := func(token string) int {
+		statusCode, _, _ := testRequest(t, ts.Server, http.MethodGet, handlers.SessionsURI, nil, http.Header{"Authorization": {"Bearer " + token}})
+		return statusCode
+	}
+	post := func(uri string, body any) (int, string) {
+		reqBody, err := json.Marshal(body)
+		require.NoError(t, err)
+		statusCode, _, got := testRequest(t, ts.Server, http.MethodPost, uri, bytes.NewBuffer(reqBody), http.Header{})
+		return statusCode, got
+	}
+
+	t.Run("sign up and sign in without a password", func(t *testing.T) {
+		require.NoError(t, c.CreateUserSRP("zk", "secret"))
+		zk, err := userStorage.GetUserByLogin(context.Background(), "zk")
+		require.NoError(t, err)
+		assert.Empty(t, zk.Password)
+		assert.NoError(t, srp.ValidateVerifier(zk.SRPSalt, zk.SRPVerifier))
+
+		token, err := c.SignInSRP("zk", "secret")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, authorized(token))
+
+		_, err = c.SignInSRP("zk", "wrong")
+		assert.ErrorContains(t, err, "invalid proof")
+		_, err = c.SignIn("zk", "")
+		assert.Error(t, err)
+
+		// Changing the password of a zero-knowledge account requires a recent sign-in, not a password.
+		_, err = c.ChangePassword(token, "", "password")
+		assert.ErrorContains(t, err, "change the verifier instead")
+		token, err = c.EnableSRP(token, "", "secret2")
+		require.NoError(t, err)
+		_, err = c.SignInSRP("zk", "secret")
+		assert.Error(t, err)
+
+		mu.Lock()
+		now = now.Add(handlers.ReauthenticationWindow + time.Minute)
+		mu.Unlock()
+		_, err = c.EnableSRP(token, "", "secret3")
+		assert.ErrorContains(t, err, "sign in again")
+		token, err = c.SignInSRP("zk", "secret2")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, authorized(token))
+	})
+
+	t.Run("handshakes can be completed once", func(t *testing.T) {
+		session, err := srp.NewClient("secret2")
+		require.NoError(t, err)
+		statusCode, got := post(handlers.AuthSRPChallengeURI, handlers.SRPChallengeRequest{Login: "zk", PublicKey: session.PublicKey()})
+		require.Equal(t, http.StatusOK, statusCode, got)
+		var challenge handlers.SRPChallengeResponse
+		require.NoError(t, json.Unmarshal([]byte(got), &challenge))
+
+		proof, err := session.Proof(challenge.Salt, challenge.PublicKey)
+		require.NoError(t, err)
+		verify := handlers.SRPVerifyRequest{HandshakeID: challenge.HandshakeID, ClientProof: proof}
+		statusCode, got = post(handlers.AuthSRPVerifyURI, verify)
+		require.Equal(t, http.StatusOK, statusCode, got)
+		var verifyResponse handlers.SRPVerifyResponse
+		require.NoError(t, json.Unmarshal([]byte(got), &verifyResponse))
+		assert.True(t, session.VerifyServer(verifyResponse.ServerProof))
+
+		statusCode, got = post(handlers.AuthSRPVerifyURI, verify)
+		assert.Equal(t, http.StatusUnauthorized, statusCode, got)
+
+		statusCode, got = post(handlers.AuthSRPChallengeURI, handlers.SRPChallengeRequest{Login: "zk", PublicKey: srp.Group2048.N.Bytes()})
+		assert.Equal(t, http.StatusBadRequest, statusCode, got)
+		statusCode, got = post(handlers.AuthSRPChallengeURI, handlers.SRPChallengeRequest{Login: "zk", PublicKey: bytes.Repeat([]byte{0xff}, 300)})
+		assert.Equal(t, http.StatusBadRequest, statusCode, got)
+	})
+
+	t.Run("switch a password account to zero-knowledge sign-in", func(t *testing.T) {
+		_, err := c.SignInSRP("user", "password")
+		assert.ErrorContains(t, err, "not enabled")
+
+		token, err := c.SignIn("user", "password")
+		require.NoError(t, err)
+		_, err = c.EnableSRP(token, "wrong", "secret")
+		assert.ErrorContains(t, err, "invalid password")
+		newToken, err := c.EnableSRP(token, "password", "secret")
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusUnauthorized, authorized(token))
+		assert.Equal(t, http.StatusOK, authorized(newToken))
+		_, err = c.SignIn("user", "password")
+		assert.Error(t, err)
+		token, err = c.SignInSRP("user", "secret")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, authorized(token))
+	})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// FailedSignInsLimit is the maximum number of failed sign-ins returned by GetFailedSignIns.
+const FailedSignInsLimit = 100
+
+// Reasons of failed sign-ins stored in the log.
+const (
+	SignInFailureUnknownLogin     = "unknown login"
+	SignInFailureInvalidPassword  = "invalid password"
+	SignInFailureInvalidTwoFactor = "invalid two-factor code"
+	SignInFailureDisabled         = "account disabled"
+	SignInFailureThrottled        = "throttled" // Only reported to the AuthObserver, throttled attempts are not logged.
+)
+
+// GetFailedSignIns handles listing the most recent failed sign-ins into the account of the current user,
+// so that the user can notice attempts to guess the password.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the attempts cannot be retrieved.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 200 OK with the list of attempts, newest first.
+func (h *ServiceHandlers) GetFailedSignIns(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	attempts, err := h.failedSignInStorage.ListFailedSignIns(r.Context(), user.ID, FailedSignInsLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, attempts)
+}
+
+// reserveSignIn reserves a sign-in attempt with the limiter before the credentials are verified.
+// If the login or the client address is blocked, or too many attempts are in progress, it writes
+// HTTP 429 Too Many Requests with a Retry-After header and returns false. Otherwise the returned
+// function must be called to release the attempt once it has succeeded or failed.
+func (h *ServiceHandlers) reserveSignIn(w http.ResponseWriter, r *http.Request, login string) (func(), bool) {
+	if h.signInLimiter == nil {
+		return func() {}, true
+	}
+
+	ip := clientIP(r)
+	retryAfter, err := h.signInLimiter.Reserve(r.Context(), login, ip, h.now())
+	if err != nil {
+		logger.Logger().Error("failed to check sign-in limiter", zap.String("login", login), zap.Error(err))
+		http.Error(w, "failed to check sign-in limiter", http.StatusInternalServerError)
+		return nil, false
+	}
+	if retryAfter > 0 {
+		logger.Logger().Warn("sign-in throttled", zap.String("login", login), zap.Duration("retryAfter", retryAfter))
+		if h.authObserver != nil {
+			h.authObserver.SignInFailed(SignInFailureThrottled)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "too many failed sign-in attempts, try again later", http.StatusTooManyRequests)
+		return nil, false
+	}
+
+	release := func() {
+		// The attempt is released even if the request has been cancelled meanwhile.
+		if err := h.signInLimiter.Release(context.WithoutCancel(r.Context()), login, ip); err != nil {
+			logger.Logger().Error("failed to release sign-in attempt", zap.String("login", login), zap.Error(err))
+		}
+	}
+	return release, true
+}
+
+// signInFailed counts a failed sign-in towards the limits and stores it in the log and the audit log.
+// userID is 0 if the login is unknown. Failures are logged and don't affect the response.
+func (h *ServiceHandlers) signInFailed(ctx context.Context, r *http.Request, userID uint64, login, reason string) {
+	now := h.now()
+	ip := clientIP(r)
+	if h.authObserver != nil {
+		h.authObserver.SignInFailed(reason)
+	}
+	if h.signInLimiter != nil {
+		if err := h.signInLimiter.Fail(ctx, login, ip, now); err != nil {
+			logger.Logger().Error("failed to record sign-in failure", zap.String("login", login), zap.Error(err))
+		}
+	}
+
+	if h.failedSignInStorage != nil {
+		err := h.failedSignInStorage.CreateFailedSignIn(ctx, storage.FailedSignIn{
+			UserID:    userID,
+			Login:     login,
+			IP:        ip,
+			UserAgent: r.UserAgent(),
+			Reason:    reason,
+			CreatedAt: now,
+		})
+		if err != nil {
+			logger.Logger().Error("failed to store failed sign-in", zap.String("login", login), zap.Error(err))
+		}
+	}
+
+	_ = h.audit(r, storage.AuditEvent{Action: storage.AuditSignInFailed, UserID: userID, Login: login, Detail: reason})
+}
+
+// signInSucceeded resets the failures of the login once the sign-in is complete.
+func (h *ServiceHandlers) signInSucceeded(ctx context.Context, login string) {
+	if h.signInLimiter == nil {
+		return
+	}
+	if err := h.signInLimiter.Reset(ctx, login); err != nil {
+		logger.Logger().Error("failed to reset sign-in failures", zap.String("login", login), zap.Error(err))
+	}
+}
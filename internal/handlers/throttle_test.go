@@ -0,0 +1,216 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/andreevym/gophkeeper/internal/storage/mock"
+	"github.com/andreevym/gophkeeper/internal/throttle"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignInThrottling(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+
+	hashService := pwd.NewHashService(pwd.DefaultArgon2Params)
+	hashedPassword, err := hashService.Hash("password")
+	require.NoError(t, err)
+
+	user := storage.User{ID: 1, Login: "user", Password: hashedPassword}
+	userStorage := mock.NewMockUserStorage(ctrl)
+	userStorage.EXPECT().GetUser(gomock.Any(), user.ID).Return(user, nil).AnyTimes()
+	userStorage.EXPECT().GetUserByLogin(gomock.Any(), user.Login).Return(user, nil).AnyTimes()
+	userStorage.EXPECT().GetUserByLogin(gomock.Any(), gomock.Any()).Return(storage.User{}, storage.ErrUserNotFound).AnyTimes()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	throttleStorage := memory.NewThrottleStorage()
+	policy := throttle.Policy{FreeFailures: 2, BaseDelay: 10 * time.Second, MaxDelay: time.Minute, LockoutFailures: 5, LockoutDuration: time.Hour, Window: 2 * time.Hour}
+	limiter := throttle.NewLimiter(throttleStorage, policy, throttle.DefaultIPPolicy)
+
+	ts := newTestServer(t,
+		withStorages(userStorage, nil, nil),
+		withHashService(hashService),
+		withHandlerOptions(
+			handlers.WithClock(clock),
+			handlers.WithSignInLimiter(limiter),
+			handlers.WithFailedSignInStorage(throttleStorage),
+		),
+	)
+
+	signIn := func(login, password string) (int, http.Header, string) {
+		reqBody, err := json.Marshal(handlers.SignInRequest{Login: login, Password: password})
+		require.NoError(t, err)
+		return testRequest(t, ts.Server, http.MethodPost, handlers.AuthSignInURI, bytes.NewBuffer(reqBody), http.Header{"User-Agent": {"throttle-test"}})
+	}
+
+	statusCode, _, got := signIn("user", "wrong")
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+	statusCode, _, got = signIn("unknown", "wrong")
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+	statusCode, _, got = signIn("user", "wrong")
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+	statusCode, _, got = signIn("user", "wrong")
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+
+	// The third failure of the login starts the backoff, even the right password is rejected now.
+	statusCode, header, got := signIn("user", "password")
+	require.Equal(t, http.StatusTooManyRequests, statusCode, got)
+	assert.Equal(t, "10", header.Get("Retry-After"))
+
+	now = now.Add(10 * time.Second)
+	statusCode, _, got = signIn("user", "wrong")
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+	now = now.Add(20 * time.Second)
+	statusCode, _, got = signIn("user", "wrong")
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+
+	// The fifth failure locks the account.
+	statusCode, header, got = signIn("user", "password")
+	require.Equal(t, http.StatusTooManyRequests, statusCode, got)
+	assert.Equal(t, "3600", header.Get("Retry-After"))
+
+	now = now.Add(time.Hour)
+	statusCode, header, got = signIn("user", "password")
+	require.Equal(t, http.StatusOK, statusCode, got)
+	authHeader := http.Header{"Authorization": header.Values("Authorization")}
+
+	// A successful sign-in resets the counter.
+	statusCode, _, got = signIn("user", "wrong")
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+	statusCode, _, got = signIn("user", "password")
+	require.Equal(t, http.StatusOK, statusCode, got)
+
+	// The user sees the failures against the own account only.
+	statusCode, _, got = testRequest(t, ts.Server, http.MethodGet, handlers.FailedSignInsURI, nil, authHeader)
+	require.Equal(t, http.StatusOK, statusCode, got)
+	var attempts []storage.FailedSignIn
+	require.NoError(t, json.Unmarshal([]byte(got), &attempts))
+	require.Len(t, attempts, 6)
+	for _, a := range attempts {
+		assert.Equal(t, user.ID, a.UserID)
+		assert.Equal(t, handlers.SignInFailureInvalidPassword, a.Reason)
+		assert.Equal(t, "127.0.0.1", a.IP)
+		assert.Equal(t, "throttle-test", a.UserAgent)
+	}
+	assert.Equal(t, now, attempts[0].CreatedAt)
+
+	unknown, err := throttleStorage.ListFailedSignIns(context.Background(), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, unknown, 1)
+	assert.Equal(t, handlers.SignInFailureUnknownLogin, unknown[0].Reason)
+}
+
+// blockingHasher holds password checks until unblock is closed, so that sign-in attempts overlap.
+type blockingHasher struct {
+	handlers.Hasher
+	unblock chan struct{}
+}
+
+func (h blockingHasher) Match(hashedPassword, password string) bool {
+	<-h.unblock
+	return h.Hasher.Match(hashedPassword, password)
+}
+
+func TestSignInThrottlingParallel(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+
+	hashService := blockingHasher{Hasher: pwd.NewHashService(pwd.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}), unblock: make(chan struct{})}
+	hashedPassword, err := hashService.Hash("password")
+	require.NoError(t, err)
+
+	user := storage.User{ID: 1, Login: "user", Password: hashedPassword}
+	userStorage := mock.NewMockUserStorage(ctrl)
+	userStorage.EXPECT().GetUserByLogin(gomock.Any(), user.Login).Return(user, nil).AnyTimes()
+
+	policy := throttle.Policy{FreeFailures: 2, BaseDelay: 10 * time.Second, MaxDelay: time.Minute, Window: time.Hour}
+	ts := newTestServer(t,
+		withStorages(userStorage, nil, nil),
+		withHashService(hashService),
+		withHandlerOptions(handlers.WithSignInLimiter(throttle.NewLimiter(memory.NewThrottleStorage(), policy, throttle.DefaultIPPolicy))),
+	)
+
+	reqBody, err := json.Marshal(handlers.SignInRequest{Login: user.Login, Password: "wrong"})
+	require.NoError(t, err)
+	const attempts = 10
+	results := make(chan int, attempts)
+	for i := 0; i < attempts; i++ {
+		go func() {
+			resp, err := ts.Client().Post(ts.URL+handlers.AuthSignInURI, "application/json", bytes.NewReader(reqBody))
+			if err != nil {
+				results <- 0
+				return
+			}
+			_ = resp.Body.Close()
+			results <- resp.StatusCode
+		}()
+	}
+
+	// Only as many attempts may verify the password at once as could fail without a delay,
+	// the others are rejected before any of them has failed.
+	allowed := policy.FreeFailures + 1
+	for i := 0; i < attempts-allowed; i++ {
+		select {
+		case statusCode := <-results:
+			require.Equal(t, http.StatusTooManyRequests, statusCode)
+		case <-time.After(10 * time.Second):
+			t.Fatal("parallel sign-in attempts were not throttled")
+		}
+	}
+	close(hashService.unblock)
+	for i := 0; i < allowed; i++ {
+		assert.Equal(t, http.StatusBadRequest, <-results)
+	}
+}
+
+func TestSignInClientIP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		trustedProxies []netip.Prefix
+		forwardedFor   []string
+		want           string
+	}{
+		{name: "spoofed header without trusted proxies", forwardedFor: []string{"203.0.113.7"}, want: "127.0.0.1"},
+		{name: "spoofed header from an untrusted peer", trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, forwardedFor: []string{"203.0.113.7"}, want: "127.0.0.1"},
+		{name: "trusted proxy", trustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, forwardedFor: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "spoofed entry before the trusted proxy", trustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, forwardedFor: []string{"198.51.100.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "chain of trusted proxies", trustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("10.0.0.0/8")}, forwardedFor: []string{"198.51.100.1, 203.0.113.7", "10.1.2.3"}, want: "203.0.113.7"},
+		{name: "malformed header from a trusted proxy", trustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}, forwardedFor: []string{"unknown"}, want: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			throttleStorage := memory.NewThrottleStorage()
+			ts := newTestServer(t, withHandlerOptions(
+				handlers.WithFailedSignInStorage(throttleStorage),
+				handlers.WithTrustedProxies(tt.trustedProxies...),
+			))
+
+			reqBody, err := json.Marshal(handlers.SignInRequest{Login: "unknown", Password: "wrong"})
+			require.NoError(t, err)
+			statusCode, _, got := testRequest(t, ts.Server, http.MethodPost, handlers.AuthSignInURI, bytes.NewBuffer(reqBody), http.Header{"X-Forwarded-For": tt.forwardedFor})
+			require.Equal(t, http.StatusBadRequest, statusCode, got)
+
+			attempts, err := throttleStorage.ListFailedSignIns(context.Background(), 0, 10)
+			require.NoError(t, err)
+			require.Len(t, attempts, 1)
+			assert.Equal(t, tt.want, attempts[0].IP)
+		})
+	}
+}
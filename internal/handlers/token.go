@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// DefaultAccessTokenTTL is the lifetime of a personal access token created without an explicit expiry date.
+const DefaultAccessTokenTTL = 30 * 24 * time.Hour
+
+// TokenRequest represents the payload for creating a personal access token.
+type TokenRequest struct {
+	Name       string     `json:"name"`                 // Human readable name of the token.
+	Permission string     `json:"permission"`           // Either "read" or "write".
+	KeyPrefix  string     `json:"key_prefix"`           // Optional key prefix the token is limited to.
+	VaultIDs   []uint64   `json:"vault_ids"`            // Optional vault entries the token is bound to.
+	Tag        string     `json:"tag,omitempty"`        // Rejected, vault entries have no tags to limit a token to.
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // Optional expiry date, DefaultAccessTokenTTL from now if empty.
+}
+
+// TokenResponse represents a personal access token. The plain Token is only filled in on creation.
+type TokenResponse struct {
+	storage.AccessToken
+	Token string `json:"token,omitempty"`
+}
+
+// PostToken handles the creation of personal access tokens.
+//
+// Tokens can only be managed with a regular sign-in session, never with another personal access token.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there are errors in request processing or validation, or if a tag scope is requested.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 201 Created with the plain token, which is not retrievable afterwards.
+func (h *ServiceHandlers) PostToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokenRequest := TokenRequest{}
+	if !readJSON(w, r, &tokenRequest) {
+		return
+	}
+
+	tokenRequest.Name = strings.TrimSpace(tokenRequest.Name)
+	if tokenRequest.Name == "" || len(tokenRequest.Name) > 200 {
+		http.Error(w, fmt.Sprintf("token name is empty or too long more than 200 characters but actual len is %d", len(tokenRequest.Name)), http.StatusBadRequest)
+		return
+	}
+
+	permission := storage.TokenPermission(tokenRequest.Permission)
+	if permission != storage.TokenPermissionRead && permission != storage.TokenPermissionWrite {
+		http.Error(w, fmt.Sprintf("unknown token permission '%s', expected '%s' or '%s'", tokenRequest.Permission, storage.TokenPermissionRead, storage.TokenPermissionWrite), http.StatusBadRequest)
+		return
+	}
+
+	// Vault entries carry no tags, so a tag scope could never be enforced. It is refused instead of being
+	// ignored, which would issue a token wider than the one asked for.
+	if tokenRequest.Tag != "" {
+		http.Error(w, "tag scopes are not supported, limit the token to a key prefix such as 'tag/' instead", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(DefaultAccessTokenTTL)
+	if tokenRequest.ExpiresAt != nil {
+		expiresAt = *tokenRequest.ExpiresAt
+	}
+	if !expiresAt.After(now) {
+		http.Error(w, "token expiry date must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	for _, id := range tokenRequest.VaultIDs {
+		v, err := h.vaultStorage.GetVault(ctx, id)
+		if err != nil || v.UserID != user.ID {
+			http.Error(w, fmt.Sprintf("vault %d is not found", id), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tokenString, hash, err := h.authProvider.GenerateAccessToken()
+	if err != nil {
+		logger.Logger().Error("failed to generate access token", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err := h.tokenStorage.CreateToken(ctx, storage.AccessToken{
+		UserID:     user.ID,
+		Name:       tokenRequest.Name,
+		Hash:       hash,
+		Permission: permission,
+		KeyPrefix:  tokenRequest.KeyPrefix,
+		VaultIDs:   tokenRequest.VaultIDs,
+		ExpiresAt:  &expiresAt,
+	})
+	if err != nil {
+		logger.Logger().Warn("failed to create access token", zap.Uint64("userID", user.ID), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_ = h.audit(r, storage.AuditEvent{
+		Action: storage.AuditTokenCreate, UserID: user.ID, Login: user.Login, TokenID: t.ID,
+		Detail: fmt.Sprintf("%s, key prefix '%s', vault entries %v", t.Permission, t.KeyPrefix, t.VaultIDs),
+	})
+
+	writeJSON(w, http.StatusCreated, TokenResponse{AccessToken: t, Token: tokenString})
+}
+
+// GetTokens handles listing the personal access tokens of the current user.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the tokens cannot be retrieved.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 200 OK with the list of tokens without their plain values.
+func (h *ServiceHandlers) GetTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.tokenStorage.ListTokens(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := make([]TokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		response = append(response, TokenResponse{AccessToken: t})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// DeleteToken handles the revocation of a personal access token.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if the token ID is invalid.
+//   - HTTP 403 Forbidden if the request is authenticated with a personal access token.
+//   - HTTP 404 Not Found if the token does not exist or belongs to another user.
+//   - HTTP 204 No Content on successful revocation.
+func (h *ServiceHandlers) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse param tokenID: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.tokenStorage.GetToken(ctx, id)
+	if err != nil && !errors.Is(err, storage.ErrTokenNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil || t.UserID != user.ID {
+		http.Error(w, "token not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.tokenStorage.RevokeToken(ctx, id, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_ = h.audit(r, storage.AuditEvent{Action: storage.AuditTokenRevoke, UserID: user.ID, Login: user.Login, TokenID: id})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// interactiveSessionUser returns the user of a regular sign-in session.
+// Account and token management is not available to personal access tokens, so it writes
+// an error response and returns false for them as well as for unauthenticated requests.
+func (h *ServiceHandlers) interactiveSessionUser(w http.ResponseWriter, r *http.Request) (storage.User, bool) {
+	user, err := h.authProvider.GetUserFromSession(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to validate user session: %v", err), http.StatusUnauthorized)
+		return storage.User{}, false
+	}
+
+	if _, ok := h.authProvider.GetTokenFromSession(r.Context()); ok {
+		http.Error(w, "this operation requires a sign-in session, personal access tokens are not allowed", http.StatusForbidden)
+		return storage.User{}, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,168 @@
+package handlers_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/auth"
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessTokens(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	vaultStorage := memory.NewVaultStorage()
+	tokenStorage := memory.NewTokenStorage()
+	userStorage := memory.NewUserStorage(vaultStorage, tokenStorage)
+	ts := newTestServer(t, withStorages(userStorage, vaultStorage, tokenStorage))
+	c := client.NewClient(ts.URL)
+
+	require.NoError(t, c.CreateUser("alice", "password"))
+	token, err := c.SignIn("alice", "password")
+	require.NoError(t, err)
+	alice, err := userStorage.GetUserByLogin(ctx, "alice")
+	require.NoError(t, err)
+
+	ci, err := c.NewVault(token, "ci/deploy", "secret", "")
+	require.NoError(t, err)
+	ciID := strconv.FormatUint(ci.ID, 10)
+	other, err := c.NewVault(token, "ci/other", "secret", "")
+	require.NoError(t, err)
+	otherID := strconv.FormatUint(other.ID, 10)
+	personal, err := c.NewVault(token, "personal", "secret", "")
+	require.NoError(t, err)
+	personalID := strconv.FormatUint(personal.ID, 10)
+
+	upload := filepath.Join(t.TempDir(), "upload")
+	require.NoError(t, os.WriteFile(upload, []byte("file"), 0o600))
+
+	createToken := func(r handlers.TokenRequest) string {
+		t.Helper()
+		pat, err := c.CreateToken(token, r)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(pat.Token, auth.AccessTokenPrefix))
+		return pat.Token
+	}
+
+	t.Run("authenticates", func(t *testing.T) {
+		pat := createToken(handlers.TokenRequest{Name: "read", Permission: "read"})
+		v, err := c.GetVault(pat, personalID)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", v.Value)
+
+		tokens, err := c.ListTokens(token)
+		require.NoError(t, err)
+		require.NotEmpty(t, tokens)
+		assert.NotNil(t, tokens[len(tokens)-1].LastUsedAt)
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		pat := createToken(handlers.TokenRequest{Name: "read only", Permission: "read"})
+		_, err := c.NewVault(pat, "new", "value", "")
+		assert.ErrorContains(t, err, "403")
+		_, err = c.NewVault(pat, "", "value", personalID)
+		assert.ErrorContains(t, err, "403")
+		_, err = c.UploadFile(pat, "new", upload, "")
+		assert.ErrorContains(t, err, "403")
+		_, err = c.UploadFile(pat, "personal", upload, personalID)
+		assert.ErrorContains(t, err, "403")
+	})
+
+	t.Run("key prefix", func(t *testing.T) {
+		pat := createToken(handlers.TokenRequest{Name: "prefix", Permission: "write", KeyPrefix: "ci"})
+		_, err := c.GetVault(pat, ciID)
+		require.NoError(t, err)
+		_, err = c.GetVault(pat, personalID)
+		assert.ErrorContains(t, err, "403")
+
+		_, err = c.NewVault(pat, "", "changed", ciID)
+		require.NoError(t, err)
+		_, err = c.NewVault(pat, "", "changed", personalID)
+		assert.ErrorContains(t, err, "403")
+		_, err = c.NewVault(pat, "personal/moved", "", ciID)
+		assert.ErrorContains(t, err, "403", "entries can't be moved out of the prefix")
+		_, err = c.NewVault(pat, "ci/new", "value", "")
+		require.NoError(t, err)
+		_, err = c.NewVault(pat, "new", "value", "")
+		assert.ErrorContains(t, err, "403")
+
+		_, err = c.UploadFile(pat, "ci_file", upload, "")
+		require.NoError(t, err)
+		_, err = c.UploadFile(pat, "file", upload, "")
+		assert.ErrorContains(t, err, "403")
+		_, err = c.UploadFile(pat, "ci_personal", upload, personalID)
+		assert.ErrorContains(t, err, "403")
+	})
+
+	t.Run("vault ids", func(t *testing.T) {
+		pat := createToken(handlers.TokenRequest{Name: "ids", Permission: "write", VaultIDs: []uint64{ci.ID}})
+		_, err := c.GetVault(pat, ciID)
+		require.NoError(t, err)
+		_, err = c.GetVault(pat, otherID)
+		assert.ErrorContains(t, err, "403")
+
+		_, err = c.NewVault(pat, "", "changed", ciID)
+		require.NoError(t, err)
+		_, err = c.NewVault(pat, "", "changed", otherID)
+		assert.ErrorContains(t, err, "403")
+		_, err = c.NewVault(pat, "ci/new", "value", "")
+		assert.ErrorContains(t, err, "403", "tokens bound to entries can't create new ones")
+
+		_, err = c.UploadFile(pat, "ci_deploy", upload, ciID)
+		require.NoError(t, err)
+		_, err = c.UploadFile(pat, "ci_other", upload, otherID)
+		assert.ErrorContains(t, err, "403")
+		_, err = c.UploadFile(pat, "ci_file", upload, "")
+		assert.ErrorContains(t, err, "403")
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		pat, err := c.CreateToken(token, handlers.TokenRequest{Name: "revoked", Permission: "read"})
+		require.NoError(t, err)
+		require.NoError(t, c.RevokeToken(token, strconv.FormatUint(pat.ID, 10)))
+		_, err = c.GetVault(pat.Token, personalID)
+		assert.ErrorContains(t, err, "401")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		plain, hash, err := ts.authProvider.GenerateAccessToken()
+		require.NoError(t, err)
+		expiresAt := time.Now().Add(-time.Minute)
+		_, err = tokenStorage.CreateToken(ctx, storage.AccessToken{
+			UserID: alice.ID, Name: "expired", Hash: hash, Permission: storage.TokenPermissionRead,
+			ExpiresAt: &expiresAt, CreatedAt: time.Now().Add(-time.Hour),
+		})
+		require.NoError(t, err)
+		_, err = c.GetVault(plain, personalID)
+		assert.ErrorContains(t, err, "401")
+	})
+
+	t.Run("no token or account management", func(t *testing.T) {
+		pat := createToken(handlers.TokenRequest{Name: "write", Permission: "write"})
+		_, err := c.CreateToken(pat, handlers.TokenRequest{Name: "nested", Permission: "write"})
+		assert.ErrorContains(t, err, "403")
+		_, err = c.ListTokens(pat)
+		assert.ErrorContains(t, err, "403")
+		assert.ErrorContains(t, c.RevokeToken(pat, "1"), "403")
+		assert.ErrorContains(t, c.ChangeLogin(pat, "mallory"), "403")
+		assert.ErrorContains(t, c.DeleteAccount(pat, "password"), "403")
+		_, err = userStorage.GetUserByLogin(ctx, "alice")
+		assert.NoError(t, err)
+	})
+
+	t.Run("tag scope", func(t *testing.T) {
+		_, err := c.CreateToken(token, handlers.TokenRequest{Name: "tag", Permission: "read", Tag: "ci"})
+		assert.ErrorContains(t, err, "400")
+	})
+}
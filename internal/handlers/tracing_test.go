@@ -0,0 +1,62 @@
+package handlers_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/client"
+	"github.com/andreevym/gophkeeper/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTracing must not run in parallel, it installs the global tracer provider.
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ts := newTestServer(t, withMiddlewares(tracing.Middleware))
+
+	c := client.NewClient(ts.URL)
+	require.NoError(t, c.CreateUser("user", "password"))
+	token, err := c.SignIn("user", "password")
+	require.NoError(t, err)
+	v, err := c.NewVault(token, "k", "secret", "")
+	require.NoError(t, err)
+	_, err = c.GetVault(token, strconv.FormatUint(v.ID, 10))
+	require.NoError(t, err)
+
+	var server sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.Name() == "GET /api/vault/{vaultID}" {
+			server = s
+		}
+	}
+	require.NotNil(t, server, "the request is traced with the route pattern")
+
+	// Collect the spans of the trace of the request by name.
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		if s.SpanContext().TraceID() == server.SpanContext().TraceID() {
+			spans[s.Name()] = s
+		}
+	}
+	require.Contains(t, spans, "HTTP GET", "the client propagates the trace context")
+	assert.Equal(t, spans["HTTP GET"].SpanContext().SpanID(), server.Parent().SpanID())
+
+	require.Contains(t, spans, "auth.Middleware")
+	middleware := spans["auth.Middleware"]
+	assert.Equal(t, server.SpanContext().SpanID(), middleware.Parent().SpanID())
+	for _, name := range []string{"auth.Provider.ValidateToken", "auth.Provider.CreateSession"} {
+		require.Contains(t, spans, name)
+		assert.Equal(t, middleware.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+	require.Contains(t, spans, "auth.Provider.GetUserFromSession")
+	assert.Equal(t, server.SpanContext().SpanID(), spans["auth.Provider.GetUserFromSession"].Parent().SpanID(),
+		"the handler continues the span of the request, not the span of the middleware")
+}
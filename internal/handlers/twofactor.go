@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/totp"
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// TOTPIssuer is the service name shown in authenticator apps.
+	TOTPIssuer = "GophKeeper"
+	// RecoveryCodesCount is the number of recovery codes issued when two-factor authentication is enabled.
+	RecoveryCodesCount = 10
+)
+
+// TwoFactorSignInRequest represents the payload of the second sign-in step.
+// Either Code or RecoveryCode must be set.
+type TwoFactorSignInRequest struct {
+	MFAToken     string `json:"mfa_token"`     // The token returned by the first sign-in step.
+	Code         string `json:"code"`          // The current TOTP code.
+	RecoveryCode string `json:"recovery_code"` // A single-use recovery code.
+	Device       string `json:"device"`        // Optional name of the device, shown in the list of sessions.
+}
+
+// TwoFactorEnrollResponse represents the response of the TOTP enrollment.
+type TwoFactorEnrollResponse struct {
+	Secret          string `json:"secret"`           // The base32 encoded TOTP secret for manual entry.
+	ProvisioningURI string `json:"provisioning_uri"` // The otpauth:// URI for authenticator apps.
+}
+
+// TwoFactorCodeRequest represents a payload confirming an operation with a second factor.
+// Either Code or RecoveryCode must be set, activation accepts a Code only.
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`          // The current TOTP code.
+	RecoveryCode string `json:"recovery_code"` // A single-use recovery code.
+}
+
+// TwoFactorActivateResponse represents the response of the TOTP activation.
+type TwoFactorActivateResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"` // Single-use recovery codes, shown only once.
+}
+
+// PostSignInTwoFactor handles the second step of the sign-in of users with two-factor authentication.
+//
+// It validates the MFA token returned by PostSignIn and the TOTP or recovery code,
+// and issues a JWT token like a regular sign-in. Used recovery codes are removed.
+// Invalid codes count towards the same sign-in limits as invalid passwords.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is an error in the request.
+//   - HTTP 401 Unauthorized if the MFA token or the code is invalid.
+//   - HTTP 409 Conflict if the user was changed concurrently, e.g. by a parallel sign-in with the same code.
+//   - HTTP 429 Too Many Requests with a Retry-After header if there were too many failed attempts.
+//   - HTTP 200 OK with the JWT token in the Authorization header on successful sign-in.
+func (h *ServiceHandlers) PostSignInTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	request := TwoFactorSignInRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	userID, err := h.authProvider.ValidateMFAToken(request.MFAToken)
+	if err != nil {
+		logger.Logger().Warn("failed to validate mfa token", zap.Error(err))
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userStorage.GetUser(ctx, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get user: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	release, ok := h.reserveSignIn(w, r, user.Login)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if !user.TOTPEnabled || !h.verifySecondFactor(&user, request.Code, request.RecoveryCode) {
+		h.signInFailed(ctx, r, user.ID, user.Login, SignInFailureInvalidTwoFactor)
+		logger.Logger().Warn("failed to verify second factor", zap.String("login", user.Login))
+		http.Error(w, "invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.userStorage.UpdateUser(ctx, user)
+	if err != nil {
+		updateUserFailed(w, err, http.StatusBadRequest)
+		return
+	}
+
+	h.signInSucceeded(ctx, user.Login)
+	h.issueToken(w, r, user, request.Device)
+}
+
+// PostTwoFactorEnroll handles the start of the TOTP enrollment.
+//
+// It generates a new secret which stays pending until it is confirmed with PostTwoFactorActivate,
+// so sign-in is not affected until the user has proven to have set up the authenticator app.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if two-factor authentication is already enabled.
+//   - HTTP 409 Conflict if the user was changed concurrently, the request can be retried.
+//   - HTTP 200 OK with the secret and the provisioning URI.
+func (h *ServiceHandlers) PostTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled {
+		http.Error(w, "two-factor authentication is already enabled", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	err = h.userStorage.UpdateUser(r.Context(), user)
+	if err != nil {
+		updateUserFailed(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TwoFactorEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(TOTPIssuer, user.Login, secret),
+	})
+}
+
+// PostTwoFactorActivate handles the verification of a pending TOTP secret.
+//
+// On a valid code two-factor authentication is enabled and a new set of recovery codes is returned.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if there is no pending enrollment or the code is invalid.
+//   - HTTP 409 Conflict if the user was changed concurrently, the request can be retried.
+//   - HTTP 200 OK with the recovery codes.
+func (h *ServiceHandlers) PostTwoFactorActivate(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	request := TwoFactorCodeRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		http.Error(w, "two-factor enrollment is not started", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, request.Code, h.now(), user.TOTPLastStep)
+	if !ok {
+		http.Error(w, "invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(RecoveryCodesCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashes = append(hashes, totp.HashRecoveryCode(c))
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.RecoveryCodes = hashes
+	err = h.userStorage.UpdateUser(r.Context(), user)
+	if err != nil {
+		updateUserFailed(w, err, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TwoFactorActivateResponse{RecoveryCodes: codes})
+}
+
+// PostTwoFactorDisable handles disabling two-factor authentication.
+// It requires a valid TOTP or recovery code.
+//
+// The handler responds with:
+//   - HTTP 400 Bad Request if two-factor authentication is not enabled or the code is invalid.
+//   - HTTP 409 Conflict if the user was changed concurrently, the request can be retried.
+//   - HTTP 204 No Content on success.
+func (h *ServiceHandlers) PostTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.interactiveSessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	request := TwoFactorCodeRequest{}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		http.Error(w, "two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if !h.verifySecondFactor(&user, request.Code, request.RecoveryCode) {
+		http.Error(w, "invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+	err := h.userStorage.UpdateUser(r.Context(), user)
+	if err != nil {
+		updateUserFailed(w, err, http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifySecondFactor checks a TOTP code or, if no code is given, a recovery code.
+// On success the user is updated in place to mark the code as used, the caller must store the user.
+func (h *ServiceHandlers) verifySecondFactor(user *storage.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, code, h.now(), user.TOTPLastStep)
+		if ok {
+			user.TOTPLastStep = step
+		}
+		return ok
+	}
+
+	if recoveryCode != "" {
+		remaining, ok := totp.UseRecoveryCode(user.RecoveryCodes, recoveryCode)
+		if ok {
+			user.RecoveryCodes = remaining
+		}
+		return ok
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/mock"
+	"github.com/andreevym/gophkeeper/internal/totp"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoFactorSignIn(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+
+	hashService := pwd.NewHashService(pwd.DefaultArgon2Params)
+	hashedPassword, err := hashService.Hash("password")
+	require.NoError(t, err)
+
+	// The mocked storage keeps a single user which is updated by the handlers.
+	stored := storage.User{ID: 1, Login: "user", Password: hashedPassword}
+	userStorage := mock.NewMockUserStorage(ctrl)
+	userStorage.EXPECT().GetUser(gomock.Any(), stored.ID).DoAndReturn(func(context.Context, uint64) (storage.User, error) {
+		return stored, nil
+	}).AnyTimes()
+	userStorage.EXPECT().GetUserByLogin(gomock.Any(), stored.Login).DoAndReturn(func(context.Context, string) (storage.User, error) {
+		return stored, nil
+	}).AnyTimes()
+	userStorage.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, u storage.User) error {
+		stored = u
+		return nil
+	}).AnyTimes()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	ts := newTestServer(t, withStorages(userStorage, nil, nil), withHashService(hashService), withHandlerOptions(handlers.WithClock(clock)))
+
+	post := func(uri string, header http.Header, body any) (int, http.Header, string) {
+		reqBody, err := json.Marshal(body)
+		require.NoError(t, err)
+		return testRequest(t, ts.Server, http.MethodPost, uri, bytes.NewBuffer(reqBody), header)
+	}
+	signIn := func() (int, http.Header, string) {
+		return post(handlers.AuthSignInURI, http.Header{}, handlers.SignInRequest{Login: "user", Password: "password"})
+	}
+
+	// Without 2FA the token is issued right away.
+	statusCode, header, got := signIn()
+	require.Equal(t, http.StatusOK, statusCode, got)
+	authHeader := http.Header{"Authorization": header.Values("Authorization")}
+
+	// Enrollment doesn't change sign-in until activated.
+	statusCode, _, got = post(handlers.TwoFactorEnrollURI, authHeader, nil)
+	require.Equal(t, http.StatusOK, statusCode, got)
+	enrollment := handlers.TwoFactorEnrollResponse{}
+	require.NoError(t, json.Unmarshal([]byte(got), &enrollment))
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/GophKeeper:user?")
+	assert.False(t, stored.TOTPEnabled)
+
+	statusCode, _, got = post(handlers.TwoFactorActivateURI, authHeader, handlers.TwoFactorCodeRequest{Code: "000000"})
+	require.Equal(t, http.StatusBadRequest, statusCode, got)
+
+	code, err := totp.GenerateCode(enrollment.Secret, totp.Step(now))
+	require.NoError(t, err)
+	statusCode, _, got = post(handlers.TwoFactorActivateURI, authHeader, handlers.TwoFactorCodeRequest{Code: code})
+	require.Equal(t, http.StatusOK, statusCode, got)
+	activation := handlers.TwoFactorActivateResponse{}
+	require.NoError(t, json.Unmarshal([]byte(got), &activation))
+	require.Len(t, activation.RecoveryCodes, handlers.RecoveryCodesCount)
+	assert.True(t, stored.TOTPEnabled)
+
+	// Now the password alone yields only an MFA token, which is not accepted as an access token.
+	statusCode, header, got = signIn()
+	require.Equal(t, http.StatusAccepted, statusCode, got)
+	assert.Empty(t, header.Get("Authorization"))
+	signInResponse := handlers.SignInResponse{}
+	require.NoError(t, json.Unmarshal([]byte(got), &signInResponse))
+	require.True(t, signInResponse.TwoFactorRequired)
+
+	statusCode, _, got = post(handlers.TwoFactorEnrollURI, http.Header{"Authorization": {"Bearer " + signInResponse.MFAToken}}, nil)
+	require.Equal(t, http.StatusUnauthorized, statusCode, got)
+
+	// The code used for activation can't be replayed.
+	statusCode, _, got = post(handlers.AuthSignInTwoFactorURI, http.Header{}, handlers.TwoFactorSignInRequest{MFAToken: signInResponse.MFAToken, Code: code})
+	require.Equal(t, http.StatusUnauthorized, statusCode, got)
+
+	now = now.Add(totp.Period)
+	code, err = totp.GenerateCode(enrollment.Secret, totp.Step(now))
+	require.NoError(t, err)
+	statusCode, header, got = post(handlers.AuthSignInTwoFactorURI, http.Header{}, handlers.TwoFactorSignInRequest{MFAToken: signInResponse.MFAToken, Code: code})
+	require.Equal(t, http.StatusOK, statusCode, got)
+	assert.NotEmpty(t, header.Get("Authorization"))
+
+	// A recovery code works exactly once.
+	recovery := handlers.TwoFactorSignInRequest{MFAToken: signInResponse.MFAToken, RecoveryCode: activation.RecoveryCodes[0]}
+	statusCode, _, got = post(handlers.AuthSignInTwoFactorURI, http.Header{}, recovery)
+	require.Equal(t, http.StatusOK, statusCode, got)
+	statusCode, _, got = post(handlers.AuthSignInTwoFactorURI, http.Header{}, recovery)
+	require.Equal(t, http.StatusUnauthorized, statusCode, got)
+	assert.Len(t, stored.RecoveryCodes, handlers.RecoveryCodesCount-1)
+}
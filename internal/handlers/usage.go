@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// UsageResponse represents the vault storage used by the current user and their quota.
+type UsageResponse struct {
+	Usage storage.Usage `json:"usage"` // The storage used by all vault entries.
+	Quota storage.Quota `json:"quota"` // The limits of the storage, zero means unlimited.
+}
+
+// GetUsage handles reporting the vault storage used by the current user.
+//
+// The handler responds with:
+//   - HTTP 401 Unauthorized if the user session is invalid.
+//   - HTTP 500 Internal Server Error if the usage cannot be retrieved.
+//   - HTTP 200 OK with a UsageResponse.
+func (h *ServiceHandlers) GetUsage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := h.authProvider.GetUserFromSession(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to validate user session: %v", err), http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := h.quotaStorage.GetUsage(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	quota, err := h.quotaStorage.GetQuota(ctx, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UsageResponse{Usage: usage, Quota: quota})
+}
+
+// writeQuotaError writes the response to a vault write rejected because it exceeds the quota of the user:
+// 413 Request Entity Too Large if the value alone is larger than the quota, 507 Insufficient Storage otherwise.
+// Returns false if the error is not a quota error and no response was written.
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, storage.ErrEntryTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/handlers"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuota(t *testing.T) {
+	t.Parallel()
+
+	vaultStorage := memory.NewVaultStorage(memory.WithDefaultQuota(storage.Quota{MaxBytes: 10, MaxEntries: 2}))
+	tokenStorage := memory.NewTokenStorage()
+	userStorage := memory.NewUserStorage(vaultStorage, tokenStorage)
+	ts := newTestServer(t,
+		withStorages(userStorage, vaultStorage, tokenStorage),
+		withHandlerOptions(handlers.WithQuotaStorage(vaultStorage)),
+	)
+
+	do := func(method, uri string, header http.Header, body any) (int, string) {
+		reqBody, err := json.Marshal(body)
+		require.NoError(t, err)
+		statusCode, _, got := testRequest(t, ts.Server, method, uri, bytes.NewBuffer(reqBody), header)
+		return statusCode, got
+	}
+
+	statusCode, got := do(http.MethodPost, handlers.AuthSignUpURI, http.Header{}, handlers.SignUpRequest{Login: "user", Password: "password"})
+	require.Equal(t, http.StatusCreated, statusCode, got)
+	reqBody, err := json.Marshal(handlers.SignInRequest{Login: "user", Password: "password"})
+	require.NoError(t, err)
+	statusCode, header, got := testRequest(t, ts.Server, http.MethodPost, handlers.AuthSignInURI, bytes.NewBuffer(reqBody), http.Header{})
+	require.Equal(t, http.StatusOK, statusCode, got)
+	authHeader := http.Header{"Authorization": []string{header.Get("Authorization")}}
+
+	statusCode, got = do(http.MethodPost, handlers.VaultURI, authHeader, handlers.VaultRequest{Key: "a", Value: "12345678901"})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode, got)
+
+	statusCode, got = do(http.MethodPost, handlers.VaultURI, authHeader, handlers.VaultRequest{Key: "a", Value: "123456"})
+	require.Equal(t, http.StatusCreated, statusCode, got)
+	statusCode, got = do(http.MethodPost, handlers.VaultURI, authHeader, handlers.VaultRequest{Key: "b", Value: "123456"})
+	assert.Equal(t, http.StatusInsufficientStorage, statusCode, got)
+	statusCode, got = do(http.MethodPost, handlers.VaultURI, authHeader, handlers.VaultRequest{Key: "b", Value: "1234"})
+	require.Equal(t, http.StatusCreated, statusCode, got)
+	statusCode, got = do(http.MethodPost, handlers.VaultURI, authHeader, handlers.VaultRequest{Key: "c", Value: ""})
+	assert.Equal(t, http.StatusInsufficientStorage, statusCode, got)
+
+	statusCode, got = do(http.MethodGet, handlers.UsageURI, authHeader, nil)
+	require.Equal(t, http.StatusOK, statusCode, got)
+	usage := handlers.UsageResponse{}
+	require.NoError(t, json.Unmarshal([]byte(got), &usage))
+	assert.Equal(t, handlers.UsageResponse{
+		Usage: storage.Usage{Bytes: 10, Entries: 2},
+		Quota: storage.Quota{MaxBytes: 10, MaxEntries: 2},
+	}, usage)
+
+	statusCode, got = do(http.MethodGet, handlers.UsageURI, http.Header{}, nil)
+	assert.Equal(t, http.StatusUnauthorized, statusCode, got)
+}
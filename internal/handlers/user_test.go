@@ -7,15 +7,21 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/andreevym/gophkeeper/internal/auth"
 	"github.com/andreevym/gophkeeper/internal/handlers"
 	"github.com/andreevym/gophkeeper/internal/middleware"
 	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/andreevym/gophkeeper/internal/storage/mock"
 	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestUserHandler(t *testing.T) {
@@ -97,18 +103,19 @@ func TestUserHandler(t *testing.T) {
 			_, jwtSecretKey, err := auth.MakeJwtSecretKey()
 			require.NoError(t, err)
 
-			vaultStorage := postgres.NewVaultStorage(db.DB, db.Conn)
+			vaultStorage := postgres.NewVaultStorage(db.Pool)
 			userStorage := postgres.NewUserStorage(db.DB)
+			tokenStorage := postgres.NewTokenStorage(db.DB)
 
 			jwtPrivateKey, err := auth.ReadJwtSecretKey(jwtSecretKey)
 			require.NoError(t, err)
 
-			authProvider := auth.NewAuthProvider(userStorage, jwtPrivateKey)
+			authProvider := auth.NewAuthProvider(userStorage, tokenStorage, jwtPrivateKey)
 
-			authMiddleware := auth.NewAuthMiddleware(authProvider, jwtSecretKey, handlers.AuthSignInURI, handlers.AuthSignUpURI)
+			authMiddleware := auth.NewAuthMiddleware(authProvider, jwtSecretKey, handlers.AuthSignInURI, handlers.AuthSignUpURI, handlers.AuthSignInTwoFactorURI)
 
-			hashService := pwd.NewHashService()
-			serviceHandlers := handlers.NewServiceHandlers(db.DB, authProvider, vaultStorage, userStorage, hashService)
+			hashService := pwd.NewHashService(pwd.DefaultArgon2Params)
+			serviceHandlers := handlers.NewServiceHandlers(db.DB, authProvider, vaultStorage, userStorage, hashService, handlers.WithTokenStorage(tokenStorage))
 
 			router := handlers.NewRouter(
 				serviceHandlers,
@@ -131,3 +138,97 @@ func TestUserHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestSignInRehashesLegacyPassword(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := storage.User{ID: 1, Login: "user", Password: string(legacyHash)}
+
+	hashService := pwd.NewHashService(pwd.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1})
+	userStorage := mock.NewMockUserStorage(ctrl)
+	userStorage.EXPECT().GetUserByLogin(gomock.Any(), user.Login).Return(user, nil)
+	userStorage.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, u storage.User) error {
+		assert.True(t, strings.HasPrefix(u.Password, "$argon2id$"), u.Password)
+		assert.True(t, hashService.Match(u.Password, "password"))
+		assert.False(t, hashService.NeedsRehash(u.Password))
+		return nil
+	})
+
+	ts := newTestServer(t, withStorages(userStorage, nil, nil), withHashService(hashService))
+
+	reqBody, err := json.Marshal(handlers.SignInRequest{Login: user.Login, Password: "password"})
+	require.NoError(t, err)
+	statusCode, header, got := testRequest(t, ts.Server, http.MethodPost, handlers.AuthSignInURI, bytes.NewBuffer(reqBody), http.Header{})
+	require.Equal(t, http.StatusOK, statusCode, got)
+	assert.NotEmpty(t, header.Get("Authorization"))
+}
+
+// disablingUserStorage disables every user right after the sign-in read them, like an administrator at the same time.
+type disablingUserStorage struct {
+	*memory.UserStorage
+}
+
+func (s disablingUserStorage) GetUserByLogin(ctx context.Context, login string) (storage.User, error) {
+	u, err := s.UserStorage.GetUserByLogin(ctx, login)
+	if err != nil {
+		return u, err
+	}
+	disabled := u
+	disabled.Disabled = true
+	disabled.TokenVersion++
+	return u, s.UserStorage.UpdateUser(ctx, disabled)
+}
+
+func TestSignInRehashKeepsConcurrentChanges(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	userStorage := memory.NewUserStorage(nil, nil)
+	user, err := userStorage.CreateUser(ctx, storage.User{Login: "user", Password: string(legacyHash)})
+	require.NoError(t, err)
+
+	ts := newTestServer(t, withStorages(disablingUserStorage{userStorage}, nil, nil))
+
+	reqBody, err := json.Marshal(handlers.SignInRequest{Login: user.Login, Password: "password"})
+	require.NoError(t, err)
+	statusCode, _, got := testRequest(t, ts.Server, http.MethodPost, handlers.AuthSignInURI, bytes.NewBuffer(reqBody), http.Header{})
+	require.Equal(t, http.StatusOK, statusCode, got)
+
+	// The upgraded hash is not stored over the newer change, which would enable the account again.
+	stored, err := userStorage.GetUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Disabled)
+	assert.Equal(t, uint64(1), stored.TokenVersion)
+	assert.Equal(t, string(legacyHash), stored.Password)
+}
+
+func TestSignUpLoginConflict(t *testing.T) {
+	t.Parallel()
+
+	ts := newTestServer(t)
+
+	post := func(uri string, v any) (int, string) {
+		reqBody, err := json.Marshal(v)
+		require.NoError(t, err)
+		statusCode, _, got := testRequest(t, ts.Server, http.MethodPost, uri, bytes.NewBuffer(reqBody), http.Header{})
+		return statusCode, got
+	}
+
+	statusCode, got := post(handlers.AuthSignUpURI, handlers.SignUpRequest{Login: " Alice ", Password: "password"})
+	require.Equal(t, http.StatusCreated, statusCode, got)
+	assert.Equal(t, `{"id":1,"login":"alice"}`, got)
+
+	for _, login := range []string{"alice", "ALICE", "  alice"} {
+		statusCode, got = post(handlers.AuthSignUpURI, handlers.SignUpRequest{Login: login, Password: "other"})
+		assert.Equal(t, http.StatusConflict, statusCode, login)
+		assert.Equal(t, "user already exists\n", got)
+	}
+
+	statusCode, got = post(handlers.AuthSignInURI, handlers.SignInRequest{Login: "Alice", Password: "password"})
+	assert.Equal(t, http.StatusOK, statusCode, got)
+}
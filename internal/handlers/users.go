@@ -1,17 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/andreevym/gophkeeper/internal/storage"
-	storage2 "github.com/andreevym/gophkeeper/internal/storage/postgres"
 	"github.com/andreevym/gophkeeper/pkg/logger"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // SignUpRequest represents the payload for user sign-up requests.
@@ -30,6 +30,13 @@ type SignUpResponse struct {
 type SignInRequest struct {
 	Login    string `json:"login"`    // The login username for the user.
 	Password string `json:"password"` // The password for the user.
+	Device   string `json:"device"`   // Optional name of the device, shown in the list of sessions.
+}
+
+// SignInResponse is returned by the sign-in endpoint when a second factor is required.
+type SignInResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"` // Whether a TOTP or recovery code must be sent to AuthSignInTwoFactorURI.
+	MFAToken          string `json:"mfa_token"`           // Short-lived token proving that the password check has passed.
 }
 
 // PostSignUp handles user sign-up requests.
@@ -39,6 +46,7 @@ type SignInRequest struct {
 //
 // The handler responds with:
 //   - HTTP 400 Bad Request if there is an error in the request or processing.
+//   - HTTP 409 Conflict if the login is already taken, ignoring case.
 //   - HTTP 201 Created on successful user creation.
 func (h *ServiceHandlers) PostSignUp(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -57,6 +65,7 @@ func (h *ServiceHandlers) PostSignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	signUpRequest.Login = storage.NormalizeLogin(signUpRequest.Login)
 	if signUpRequest.Login == "" || len(signUpRequest.Login) > 50 {
 		logger.Logger().Warn("login is empty or too long more than 50 characters", zap.Int("LoginLen", len(signUpRequest.Login)))
 		http.Error(w, fmt.Sprintf("login is empty or too long more than 50 characters but actual len is %d", len(signUpRequest.Login)), http.StatusBadRequest)
@@ -70,18 +79,18 @@ func (h *ServiceHandlers) PostSignUp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	_, err = h.userStorage.GetUserByLogin(ctx, signUpRequest.Login)
-	if err != nil && !errors.Is(storage2.ErrUserNotFound, err) {
+	if err != nil && !errors.Is(storage.ErrUserNotFound, err) {
 		logger.Logger().Warn("failed to get user by login", zap.String("login", signUpRequest.Login), zap.Error(err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	if err == nil {
 		logger.Logger().Info("user already exists", zap.String("login", signUpRequest.Login))
-		http.Error(w, "user already exists", http.StatusBadRequest)
+		http.Error(w, "user already exists", http.StatusConflict)
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(signUpRequest.Password), bcrypt.MinCost)
+	hashedPassword, err := h.hashService.Hash(signUpRequest.Password)
 	if err != nil {
 		logger.Logger().Warn("failed to generate hash from password", zap.String("login", signUpRequest.Login), zap.Error(err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -90,9 +99,14 @@ func (h *ServiceHandlers) PostSignUp(w http.ResponseWriter, r *http.Request) {
 
 	user := storage.User{
 		Login:    signUpRequest.Login,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 	}
 	createdUser, err := h.userStorage.CreateUser(ctx, user)
+	if errors.Is(err, storage.ErrLoginTaken) {
+		logger.Logger().Info("user already exists", zap.String("login", signUpRequest.Login))
+		http.Error(w, "user already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		logger.Logger().Warn("failed to create user", zap.String("login", signUpRequest.Login), zap.Error(err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -120,8 +134,18 @@ func (h *ServiceHandlers) PostSignUp(w http.ResponseWriter, r *http.Request) {
 // It reads the user credentials from the request body, validates the user,
 // and generates a JWT token if the credentials are correct.
 //
+// If the user has enabled two-factor authentication, no access token is issued yet.
+// Instead the response carries an MFA token which must be sent to AuthSignInTwoFactorURI
+// together with a TOTP or recovery code.
+//
+// Failed attempts are counted per login and per client address. Once a limit is exceeded,
+// further attempts are rejected without checking the credentials until the backoff has passed.
+//
 // The handler responds with:
 //   - HTTP 400 Bad Request if there is an error in the request or credentials are invalid.
+//   - HTTP 403 Forbidden if the account was disabled by an administrator.
+//   - HTTP 429 Too Many Requests with a Retry-After header if there were too many failed attempts.
+//   - HTTP 202 Accepted with a SignInResponse if a second factor is required.
 //   - HTTP 200 OK with the JWT token in the Authorization header on successful sign-in.
 func (h *ServiceHandlers) PostSignIn(writer http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
@@ -141,8 +165,18 @@ func (h *ServiceHandlers) PostSignIn(writer http.ResponseWriter, request *http.R
 		return
 	}
 
+	signInRequest.Login = storage.NormalizeLogin(signInRequest.Login)
+	release, ok := h.reserveSignIn(writer, request, signInRequest.Login)
+	if !ok {
+		return
+	}
+	defer release()
+
 	user, err := h.userStorage.GetUserByLogin(ctx, signInRequest.Login)
 	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			h.signInFailed(ctx, request, 0, signInRequest.Login, SignInFailureUnknownLogin)
+		}
 		err = fmt.Errorf("failed to get user by login %s: %w", signInRequest.Login, err)
 		logger.Logger().Warn("failed to get user by login", zap.String("login", signInRequest.Login), zap.Error(err))
 		http.Error(writer, err.Error(), http.StatusBadRequest)
@@ -150,20 +184,126 @@ func (h *ServiceHandlers) PostSignIn(writer http.ResponseWriter, request *http.R
 	}
 
 	if !h.hashService.Match(user.Password, signInRequest.Password) {
+		h.signInFailed(ctx, request, user.ID, signInRequest.Login, SignInFailureInvalidPassword)
 		msg := fmt.Sprintf("failed to match password %s", signInRequest.Login)
 		logger.Logger().Warn(msg, zap.String("login", signInRequest.Login))
 		http.Error(writer, msg, http.StatusBadRequest)
 		return
 	}
 
-	authToken, err := h.authProvider.GenerateToken(user.ID)
+	h.rehashPassword(ctx, user, signInRequest.Password)
+
+	if user.TOTPEnabled {
+		mfaToken, err := h.authProvider.GenerateMFAToken(user.ID)
+		if err != nil {
+			err = fmt.Errorf("failed to generate mfa token %s: %w", signInRequest.Login, err)
+			logger.Logger().Warn("failed to generate mfa token", zap.String("login", signInRequest.Login), zap.Error(err))
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(writer, http.StatusAccepted, SignInResponse{TwoFactorRequired: true, MFAToken: mfaToken})
+		return
+	}
+
+	h.signInSucceeded(ctx, signInRequest.Login)
+	h.issueToken(writer, request, user, signInRequest.Device)
+}
+
+// updateUserFailed writes the response of a failed UpdateUser: HTTP 409 Conflict if the user was changed
+// concurrently, so that the client can retry with the current state, otherwise the given status code.
+func updateUserFailed(w http.ResponseWriter, err error, statusCode int) {
+	if errors.Is(err, storage.ErrUserConflict) {
+		http.Error(w, "user was changed concurrently, try again", http.StatusConflict)
+		return
+	}
+	http.Error(w, fmt.Sprintf("failed to update user: %v", err), statusCode)
+}
+
+// rehashPassword replaces the stored password hash if it was created with an outdated algorithm or parameters.
+// It must only be called after the password has been verified. Failures are logged and don't affect the sign-in.
+func (h *ServiceHandlers) rehashPassword(ctx context.Context, user storage.User, password string) {
+	if !h.hashService.NeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := h.hashService.Hash(password)
 	if err != nil {
-		err = fmt.Errorf("failed to generate token %s: %w", signInRequest.Login, err)
-		logger.Logger().Warn("failed to generate token", zap.String("login", signInRequest.Login), zap.Error(err))
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		logger.Logger().Warn("failed to rehash password", zap.String("login", user.Login), zap.Error(err))
 		return
 	}
 
-	writer.Header().Add("Authorization", fmt.Sprintf("Bearer %s", authToken))
+	// The user may have been changed since the sign-in read it, e.g. disabled by an administrator.
+	// The update is then refused rather than reverting that change, and the hash is upgraded on the next sign-in.
+	user.Password = hashedPassword
+	err = h.userStorage.UpdateUser(ctx, user)
+	if err != nil {
+		logger.Logger().Warn("failed to store rehashed password", zap.String("login", user.Login), zap.Error(err))
+		return
+	}
+	logger.Logger().Info("password hash upgraded", zap.String("login", user.Login))
+}
+
+// MaxDeviceNameLength is the maximum length of a device name, longer names are truncated.
+const MaxDeviceNameLength = 100
+
+// issueToken starts a sign-in session, generates a JWT token for it and writes the token
+// to the Authorization header of the response.
+func (h *ServiceHandlers) issueToken(writer http.ResponseWriter, request *http.Request, user storage.User, device string) {
+	if !h.setTokenHeader(writer, request, user, device) {
+		return
+	}
 	writer.WriteHeader(http.StatusOK)
 }
+
+// setTokenHeader records the sign-in in the audit log, starts a sign-in session, generates a JWT token for it
+// and sets the Authorization header, leaving the status code and the body of the response to the caller.
+// It writes an error response and returns false if the token cannot be issued or the account is disabled.
+func (h *ServiceHandlers) setTokenHeader(writer http.ResponseWriter, request *http.Request, user storage.User, device string) bool {
+	// Disabled users are rejected only after their credentials have been verified, not to reveal the state of accounts.
+	if user.Disabled {
+		h.signInFailed(request.Context(), request, user.ID, user.Login, SignInFailureDisabled)
+		http.Error(writer, "account is disabled", http.StatusForbidden)
+		return false
+	}
+
+	device = strings.TrimSpace(device)
+	if len(device) > MaxDeviceNameLength {
+		device = device[:MaxDeviceNameLength]
+	}
+	userAgent := request.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	err := h.audit(request, storage.AuditEvent{Action: storage.AuditSignIn, UserID: user.ID, Login: user.Login, Detail: device})
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	sessionID, err := h.authProvider.StartSession(request.Context(), storage.Session{
+		UserID:     user.ID,
+		DeviceName: device,
+		UserAgent:  userAgent,
+		IP:         clientIP(request),
+	})
+	if err != nil {
+		logger.Logger().Warn("failed to start session", zap.String("login", user.Login), zap.Error(err))
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	authToken, err := h.authProvider.GenerateToken(user, sessionID)
+	if err != nil {
+		err = fmt.Errorf("failed to generate token %s: %w", user.Login, err)
+		logger.Logger().Warn("failed to generate token", zap.String("login", user.Login), zap.Error(err))
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	writer.Header().Add("Authorization", fmt.Sprintf("Bearer %s", authToken))
+	if h.authObserver != nil {
+		h.authObserver.SignInSucceeded()
+	}
+	return true
+}
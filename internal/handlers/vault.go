@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -28,6 +30,22 @@ type VaultResponse struct {
 	UserID uint64 `json:"user_id"`
 }
 
+// errTokenScope is returned when the personal access token of the request does not cover a vault entry.
+var errTokenScope = errors.New("access denied by token scope")
+
+// checkTokenScope verifies that the personal access token the request was authenticated with,
+// if any, allows reading or writing the vault entry. Sign-in sessions are not restricted.
+func (h *ServiceHandlers) checkTokenScope(ctx context.Context, v storage.Vault, write bool) error {
+	t, ok := h.authProvider.GetTokenFromSession(ctx)
+	if !ok {
+		return nil
+	}
+	if write && !t.CanWrite(v) || !write && !t.CanRead(v) {
+		return errTokenScope
+	}
+	return nil
+}
+
 // PostVault handles both the creation and update of vault entries.
 //
 // If the ID is empty, a new vault entry is created with the provided Key and Value.
@@ -35,6 +53,8 @@ type VaultResponse struct {
 //
 // The handler responds with:
 //   - HTTP 400 Bad Request if there are errors in request processing or validation.
+//   - HTTP 413 Request Entity Too Large if the value is larger than the storage quota of the user.
+//   - HTTP 507 Insufficient Storage if the entry doesn't fit into the remaining storage quota of the user.
 //   - HTTP 201 Created if a new vault entry is created successfully.
 //   - HTTP 200 OK if an existing vault entry is updated successfully.
 func (h *ServiceHandlers) PostVault(w http.ResponseWriter, r *http.Request) {
@@ -64,11 +84,19 @@ func (h *ServiceHandlers) PostVault(w http.ResponseWriter, r *http.Request) {
 			Value:  []byte(vaultRequest.Value),
 			UserID: user.ID,
 		}
+		if err := h.checkTokenScope(ctx, vault, true); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		v, err := h.vaultStorage.CreateVault(ctx, vault)
+		if writeQuotaError(w, err) {
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		_ = h.audit(r, storage.AuditEvent{Action: storage.AuditVaultCreate, UserID: user.ID, Login: user.Login, VaultID: v.ID})
 
 		bytes, err := json.Marshal(VaultResponse{
 			ID:     v.ID,
@@ -105,6 +133,11 @@ func (h *ServiceHandlers) PostVault(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = h.checkTokenScope(ctx, v, true); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	if vaultRequest.Key != "" {
 		v.Key = vaultRequest.Key
 	}
@@ -113,11 +146,20 @@ func (h *ServiceHandlers) PostVault(w http.ResponseWriter, r *http.Request) {
 		v.Value = []byte(vaultRequest.Value)
 	}
 
+	if err = h.checkTokenScope(ctx, v, true); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	err = h.vaultStorage.UpdateVault(ctx, v)
+	if writeQuotaError(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	_ = h.audit(r, storage.AuditEvent{Action: storage.AuditVaultUpdate, UserID: user.ID, Login: user.Login, VaultID: v.ID})
 
 	bytes, err = json.Marshal(VaultResponse{
 		ID:     v.ID,
@@ -143,6 +185,7 @@ func (h *ServiceHandlers) PostVault(w http.ResponseWriter, r *http.Request) {
 //
 // The handler responds with:
 //   - HTTP 400 Bad Request if there are errors in request processing or validation.
+//   - HTTP 500 Internal Server Error if the read cannot be recorded in the audit log.
 //   - HTTP 200 OK with the vault entry details if successfully retrieved.
 func (h *ServiceHandlers) GetVault(writer http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
@@ -174,6 +217,18 @@ func (h *ServiceHandlers) GetVault(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
+	if err = h.checkTokenScope(ctx, v, false); err != nil {
+		http.Error(writer, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// The value is only returned if the read is recorded.
+	err = h.audit(request, storage.AuditEvent{Action: storage.AuditVaultRead, UserID: user.ID, Login: user.Login, VaultID: v.ID})
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	bytes, err := json.Marshal(VaultResponse{
 		ID:     v.ID,
 		Key:    v.Key,
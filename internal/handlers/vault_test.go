@@ -33,18 +33,19 @@ func TestVaultHandler(t *testing.T) {
 	_, jwtSecretKey, err := auth.MakeJwtSecretKey()
 	require.NoError(t, err)
 
-	vaultStorage := postgres.NewVaultStorage(db.DB, db.Conn)
+	vaultStorage := postgres.NewVaultStorage(db.Pool)
 	userStorage := postgres.NewUserStorage(db.DB)
+	tokenStorage := postgres.NewTokenStorage(db.DB)
 
 	jwtPrivateKey, err := auth.ReadJwtSecretKey(jwtSecretKey)
 	require.NoError(t, err)
 
-	authProvider := auth.NewAuthProvider(userStorage, jwtPrivateKey)
+	authProvider := auth.NewAuthProvider(userStorage, tokenStorage, jwtPrivateKey)
 
-	authMiddleware := auth.NewAuthMiddleware(authProvider, jwtSecretKey, handlers.AuthSignInURI, handlers.AuthSignUpURI)
+	authMiddleware := auth.NewAuthMiddleware(authProvider, jwtSecretKey, handlers.AuthSignInURI, handlers.AuthSignUpURI, handlers.AuthSignInTwoFactorURI)
 
-	hashService := pwd.NewHashService()
-	serviceHandlers := handlers.NewServiceHandlers(db.DB, authProvider, vaultStorage, userStorage, hashService)
+	hashService := pwd.NewHashService(pwd.DefaultArgon2Params)
+	serviceHandlers := handlers.NewServiceHandlers(db.DB, authProvider, vaultStorage, userStorage, hashService, handlers.WithTokenStorage(tokenStorage))
 
 	router := handlers.NewRouter(
 		serviceHandlers,
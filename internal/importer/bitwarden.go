@@ -0,0 +1,163 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Item types of Bitwarden.
+const (
+	bitwardenTypeLogin    = 1
+	bitwardenTypeNote     = 2
+	bitwardenTypeCard     = 3
+	bitwardenTypeIdentity = 4
+	bitwardenTypeSSHKey   = 5
+)
+
+// bitwardenFieldLinked is the type of custom fields which refer to another field and have no value.
+const bitwardenFieldLinked = 3
+
+type bitwardenExport struct {
+	Encrypted   bool              `json:"encrypted"`
+	Folders     []bitwardenFolder `json:"folders"`
+	Collections []bitwardenFolder `json:"collections"`
+	Items       []bitwardenItem   `json:"items"`
+}
+
+type bitwardenFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type bitwardenItem struct {
+	Type          int              `json:"type"`
+	Name          string           `json:"name"`
+	Notes         *string          `json:"notes"`
+	FolderID      *string          `json:"folderId"`
+	CollectionIDs []string         `json:"collectionIds"`
+	Fields        []bitwardenField `json:"fields"`
+	Login         *bitwardenLogin  `json:"login"`
+	Card          *bitwardenCard   `json:"card"`
+	Identity      map[string]any   `json:"identity"`
+	SSHKey        map[string]any   `json:"sshKey"`
+}
+
+type bitwardenField struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value"`
+	Type  int     `json:"type"`
+}
+
+type bitwardenLogin struct {
+	URIs []struct {
+		URI string `json:"uri"`
+	} `json:"uris"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	TOTP     string `json:"totp"`
+}
+
+type bitwardenCard struct {
+	CardholderName string `json:"cardholderName"`
+	Number         string `json:"number"`
+	ExpMonth       string `json:"expMonth"`
+	ExpYear        string `json:"expYear"`
+	Code           string `json:"code"`
+	Brand          string `json:"brand"`
+}
+
+// identityFields are the properties of Bitwarden identities in the order they are kept as fields.
+var identityFields = []string{
+	"title", "firstName", "middleName", "lastName", "username", "company", "email", "phone",
+	"address1", "address2", "address3", "city", "state", "postalCode", "country",
+	"ssn", "passportNumber", "licenseNumber",
+}
+
+// sshKeyFields are the properties of Bitwarden SSH keys in the order they are kept as fields.
+var sshKeyFields = []string{"privateKey", "publicKey", "keyFingerprint"}
+
+// parseBitwarden reads the unencrypted JSON export of a Bitwarden vault or organization.
+// Folders and collections become tags. Identities and SSH keys become notes with their properties as fields.
+func parseBitwarden(data []byte, r *Result) error {
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return err
+	}
+	if export.Encrypted {
+		return errors.New("encrypted exports are not supported, export the vault as unencrypted JSON")
+	}
+	folders := make(map[string]string)
+	for _, f := range append(export.Folders, export.Collections...) {
+		folders[f.ID] = f.Name
+	}
+
+	for i, bi := range export.Items {
+		it := Item{Name: itemName(bi.Name, "", "", i)}
+		if bi.Notes != nil {
+			it.Notes = *bi.Notes
+		}
+		if bi.FolderID != nil && folders[*bi.FolderID] != "" {
+			it.Tags = append(it.Tags, folders[*bi.FolderID])
+		}
+		for _, id := range bi.CollectionIDs {
+			if folders[id] != "" {
+				it.Tags = append(it.Tags, folders[id])
+			}
+		}
+		for _, f := range bi.Fields {
+			if f.Type == bitwardenFieldLinked || f.Value == nil {
+				continue
+			}
+			it.Fields = append(it.Fields, Field{Name: f.Name, Value: *f.Value})
+		}
+
+		switch bi.Type {
+		case bitwardenTypeLogin:
+			it.Kind = KindLogin
+			if bi.Login != nil {
+				it.Login, it.Password, it.TOTP = bi.Login.Username, bi.Login.Password, bi.Login.TOTP
+				for j, u := range bi.Login.URIs {
+					if j == 0 {
+						it.URL = u.URI
+					} else {
+						it.Fields = append(it.Fields, Field{Name: "url", Value: u.URI})
+					}
+				}
+			}
+		case bitwardenTypeNote:
+			it.Kind = KindNote
+		case bitwardenTypeCard:
+			it.Kind = KindCard
+			if bi.Card != nil {
+				it.Cardholder, it.CardNumber, it.CVV = bi.Card.CardholderName, bi.Card.Number, bi.Card.Code
+				it.ExpiryDate = expiryDate(bi.Card.ExpMonth, bi.Card.ExpYear)
+				if bi.Card.Brand != "" {
+					it.Fields = append(it.Fields, Field{Name: "brand", Value: bi.Card.Brand})
+				}
+			}
+		case bitwardenTypeIdentity:
+			it.Kind = KindNote
+			it.Fields = append(propertyFields(bi.Identity, identityFields), it.Fields...)
+		case bitwardenTypeSSHKey:
+			it.Kind = KindNote
+			it.Fields = append(propertyFields(bi.SSHKey, sshKeyFields), it.Fields...)
+		default:
+			r.warnf("skipped %q: unsupported Bitwarden item type %d", it.Name, bi.Type)
+			continue
+		}
+		r.Items = append(r.Items, it)
+	}
+	return nil
+}
+
+// propertyFields returns the non-empty string properties with the given names as fields.
+func propertyFields(properties map[string]any, names []string) []Field {
+	var fields []Field
+	for _, name := range names {
+		if s, ok := properties[name].(string); ok && strings.TrimSpace(s) != "" {
+			fields = append(fields, Field{Name: name, Value: s})
+		}
+	}
+	return fields
+}
@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// CSV columns mapped onto the properties of a login.
+const (
+	columnName = iota
+	columnURL
+	columnLogin
+	columnPassword
+	columnTOTP
+	columnNotes
+	columnTags
+	columnField // columnField is kept as a custom field.
+	columnIgnored
+)
+
+// csvColumns maps the lowercase column names of the CSV exports onto login properties.
+// Columns missing here are kept as custom fields by 1Password imports and ignored by browser imports,
+// whose other columns are bookkeeping such as the times of the last use.
+var csvColumns = map[string]int{
+	"title":          columnName,
+	"name":           columnName,
+	"url":            columnURL,
+	"website":        columnURL,
+	"login_uri":      columnURL,
+	"username":       columnLogin,
+	"login_username": columnLogin,
+	"password":       columnPassword,
+	"login_password": columnPassword,
+	"otpauth":        columnTOTP,
+	"notes":          columnNotes,
+	"note":           columnNotes,
+	"tags":           columnTags,
+	"favorite":       columnIgnored,
+	"archived":       columnIgnored,
+	"type":           columnIgnored,
+}
+
+// parseCSV reads a CSV export of 1Password or of a browser, which only holds logins.
+// The first line names the columns. 1Password tags are separated by commas.
+func parseCSV(data []byte, format Format, r *Result) error {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return errors.New("missing header")
+	}
+	header := records[0]
+	columns := make([]int, len(header))
+	hasPassword := false
+	for i, name := range header {
+		column, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]
+		switch {
+		case ok:
+			columns[i] = column
+			hasPassword = hasPassword || column == columnPassword
+		case format == FormatOnePassword:
+			columns[i] = columnField
+		default:
+			columns[i] = columnIgnored
+		}
+	}
+	if !hasPassword {
+		return errors.New("missing password column")
+	}
+
+	for line, record := range records[1:] {
+		it := Item{Kind: KindLogin}
+		name := ""
+		for i, value := range record {
+			if i >= len(columns) || value == "" {
+				continue
+			}
+			switch columns[i] {
+			case columnName:
+				name = value
+			case columnURL:
+				it.URL = value
+			case columnLogin:
+				it.Login = value
+			case columnPassword:
+				it.Password = value
+			case columnTOTP:
+				it.TOTP = value
+			case columnNotes:
+				it.Notes = value
+			case columnTags:
+				for _, tag := range strings.Split(value, ",") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						it.Tags = append(it.Tags, tag)
+					}
+				}
+			case columnField:
+				it.Fields = append(it.Fields, Field{Name: header[i], Value: value})
+			}
+		}
+		if it.Login == "" && it.Password == "" && it.URL == "" {
+			if it.Notes == "" {
+				r.warnf("skipped line %d: no login, password or URL", line+2)
+				continue
+			}
+			it.Kind = KindNote
+		}
+		it.Name = itemName(name, it.Login, hostOf(it.URL), len(r.Items))
+		r.Items = append(r.Items, it)
+	}
+	return nil
+}
+
+// hostOf returns the host of a URL, or the URL if it has none, to name logins exported without a name.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
@@ -0,0 +1,237 @@
+// Package importer reads the exports of other password managers and maps their items onto the vault entry types
+// of the client: logins, cards, notes and files. Folders and groups become tags, custom fields are kept as fields.
+package importer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Format is a supported export format.
+type Format string
+
+// Supported formats.
+const (
+	FormatBitwarden   Format = "bitwarden" // FormatBitwarden is the unencrypted JSON export of Bitwarden.
+	FormatKeePass     Format = "keepass"   // FormatKeePass is the XML export of KeePass 2.x and KeePassXC.
+	FormatOnePassword Format = "1password" // FormatOnePassword is the CSV export of 1Password.
+	FormatBrowser     Format = "browser"   // FormatBrowser is the password CSV export of Chrome, Edge, Firefox or Safari.
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatBitwarden, FormatKeePass, FormatOnePassword, FormatBrowser}
+
+// Kind is the type of a vault entry, which is the prefix of its key.
+type Kind string
+
+// Entry types of the client.
+const (
+	KindLogin Kind = "login"  // KindLogin is a login with a password.
+	KindCard  Kind = "card"   // KindCard is a bank card.
+	KindNote  Kind = "text"   // KindNote is a text note.
+	KindFile  Kind = "binary" // KindFile is a file, stored hex encoded.
+)
+
+// ErrUnknownFormat is returned by Detect if the data is in none of the supported formats.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Field is a custom field of an item.
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Item is an item of a password manager mapped onto a vault entry.
+type Item struct {
+	Kind   Kind
+	Name   string
+	Tags   []string // Folders or groups the item was in, and its own tags.
+	Fields []Field  // Custom fields, in their original order.
+	Notes  string
+
+	Login    string // Login of KindLogin.
+	Password string // Password of KindLogin.
+	URL      string // URL of KindLogin.
+	TOTP     string // Secret or otpauth URI of KindLogin.
+
+	Cardholder string // Cardholder of KindCard.
+	CardNumber string // Number of KindCard.
+	ExpiryDate string // Expiry date of KindCard as MM/YY.
+	CVV        string // Security code of KindCard.
+
+	Data []byte // Content of KindFile.
+}
+
+// loginValue, cardValue and noteValue are the values of the entry types, compatible with the entries
+// stored by the client commands, which only set the first fields.
+type loginValue struct {
+	Login    string   `json:"login"`
+	Password string   `json:"password"`
+	URL      string   `json:"url,omitempty"`
+	TOTP     string   `json:"totp,omitempty"`
+	Notes    string   `json:"notes,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Fields   []Field  `json:"fields,omitempty"`
+}
+
+type cardValue struct {
+	CardNumber string   `json:"card_number"`
+	ExpiryDate string   `json:"expiry_date"`
+	CVV        string   `json:"cvv"`
+	Cardholder string   `json:"cardholder,omitempty"`
+	Notes      string   `json:"notes,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Fields     []Field  `json:"fields,omitempty"`
+}
+
+type noteValue struct {
+	Text   string   `json:"text"`
+	Tags   []string `json:"tags,omitempty"`
+	Fields []Field  `json:"fields,omitempty"`
+}
+
+// Key returns the key of the vault entry: the kind and the name of the item.
+func (it Item) Key() string {
+	return string(it.Kind) + "/" + it.Name
+}
+
+// Value returns the value of the vault entry in the format of its kind.
+func (it Item) Value() (string, error) {
+	var v any
+	switch it.Kind {
+	case KindLogin:
+		v = loginValue{Login: it.Login, Password: it.Password, URL: it.URL, TOTP: it.TOTP, Notes: it.Notes, Tags: it.Tags, Fields: it.Fields}
+	case KindCard:
+		v = cardValue{
+			CardNumber: it.CardNumber, ExpiryDate: it.ExpiryDate, CVV: it.CVV, Cardholder: it.Cardholder,
+			Notes: it.Notes, Tags: it.Tags, Fields: it.Fields,
+		}
+	case KindNote:
+		v = noteValue{Text: it.Notes, Tags: it.Tags, Fields: it.Fields}
+	case KindFile:
+		return hex.EncodeToString(it.Data), nil
+	default:
+		return "", fmt.Errorf("unknown kind %q", it.Kind)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s: %w", it.Key(), err)
+	}
+	return string(b), nil
+}
+
+// Result holds the items read from an export.
+type Result struct {
+	Format   Format
+	Items    []Item
+	Warnings []string // Items which were skipped or only partly imported.
+}
+
+// warnf records a warning.
+func (r *Result) warnf(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Detect guesses the format of an export from its content.
+func Detect(data []byte) (Format, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var probe struct {
+			Items json.RawMessage `json:"items"`
+		}
+		if json.Unmarshal(trimmed, &probe) == nil && probe.Items != nil {
+			return FormatBitwarden, nil
+		}
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		if bytes.Contains(trimmed, []byte("<KeePassFile")) {
+			return FormatKeePass, nil
+		}
+	default:
+		header, _, _ := bytes.Cut(trimmed, []byte("\n"))
+		columns := strings.Split(strings.ToLower(string(bytes.TrimSpace(header))), ",")
+		has := func(name string) bool {
+			for _, c := range columns {
+				if strings.Trim(c, `" `) == name {
+					return true
+				}
+			}
+			return false
+		}
+		switch {
+		case has("password") && has("otpauth") && has("archived"):
+			return FormatOnePassword, nil
+		case has("password") && has("url"):
+			return FormatBrowser, nil
+		}
+	}
+	return "", ErrUnknownFormat
+}
+
+// Parse reads the items of an export in the given format, or in the detected format if it is empty.
+// Items which can't be mapped are skipped with a warning.
+func Parse(data []byte, format Format) (Result, error) {
+	if format == "" {
+		var err error
+		format, err = Detect(data)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	r := Result{Format: format}
+	var err error
+	switch format {
+	case FormatBitwarden:
+		err = parseBitwarden(data, &r)
+	case FormatKeePass:
+		err = parseKeePass(data, &r)
+	case FormatOnePassword, FormatBrowser:
+		err = parseCSV(data, format, &r)
+	default:
+		return Result{}, fmt.Errorf("unsupported format %q, supported formats are %s", format, joinFormats())
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read %s export: %w", format, err)
+	}
+	return r, nil
+}
+
+func joinFormats() string {
+	names := make([]string, len(Formats))
+	for i, f := range Formats {
+		names[i] = string(f)
+	}
+	return strings.Join(names, ", ")
+}
+
+// itemName returns the name of an item, falling back to its URL or login, then to a numbered name.
+func itemName(name, login, url string, index int) string {
+	for _, s := range []string{name, url, login} {
+		if s = strings.TrimSpace(s); s != "" {
+			return s
+		}
+	}
+	return fmt.Sprintf("item %d", index+1)
+}
+
+// expiryDate formats the month and the year of a card as MM/YY.
+func expiryDate(month, year string) string {
+	month, year = strings.TrimSpace(month), strings.TrimSpace(year)
+	if month == "" && year == "" {
+		return ""
+	}
+	if len(month) == 1 {
+		month = "0" + month
+	}
+	if len(year) == 4 {
+		year = year[2:]
+	}
+	return month + "/" + year
+}
@@ -0,0 +1,142 @@
+package importer_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/importer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseFile(t *testing.T, name string) importer.Result {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	result, err := importer.Parse(data, "")
+	require.NoError(t, err)
+	return result
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+	for name, want := range map[string]importer.Format{
+		"bitwarden.json": importer.FormatBitwarden,
+		"keepass.xml":    importer.FormatKeePass,
+		"1password.csv":  importer.FormatOnePassword,
+		"chrome.csv":     importer.FormatBrowser,
+		"firefox.csv":    importer.FormatBrowser,
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+		got, err := importer.Detect(data)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+
+	_, err := importer.Detect([]byte("just some text"))
+	assert.ErrorIs(t, err, importer.ErrUnknownFormat)
+}
+
+func TestBitwarden(t *testing.T) {
+	t.Parallel()
+	result := parseFile(t, "bitwarden.json")
+	assert.Equal(t, []string{`skipped "Future": unsupported Bitwarden item type 9`}, result.Warnings)
+	assert.Equal(t, []importer.Item{
+		{
+			Kind: importer.KindLogin, Name: "GitHub", Tags: []string{"Work"}, Notes: "recovery codes in the safe",
+			Fields: []importer.Field{{Name: "PIN", Value: "1234"}, {Name: "url", Value: "https://gist.github.com"}},
+			Login:  "octocat", Password: "hunter2", URL: "https://github.com", TOTP: "JBSWY3DPEHPK3PXP",
+		},
+		{
+			Kind: importer.KindCard, Name: "Visa", Fields: []importer.Field{{Name: "brand", Value: "Visa"}},
+			Cardholder: "Jane Doe", CardNumber: "4111111111111111", ExpiryDate: "03/27", CVV: "123",
+		},
+		{Kind: importer.KindNote, Name: "Wi-Fi", Tags: []string{"Work"}, Notes: "password: correct horse"},
+		{
+			Kind: importer.KindNote, Name: "Me",
+			Fields: []importer.Field{
+				{Name: "title", Value: "Ms"}, {Name: "firstName", Value: "Jane"},
+				{Name: "lastName", Value: "Doe"}, {Name: "email", Value: "jane@example.com"},
+			},
+		},
+	}, result.Items)
+
+	_, err := importer.Parse([]byte(`{"encrypted": true, "items": []}`), importer.FormatBitwarden)
+	assert.ErrorContains(t, err, "encrypted exports are not supported")
+}
+
+func TestKeePass(t *testing.T) {
+	t.Parallel()
+	result := parseFile(t, "keepass.xml")
+	assert.Empty(t, result.Warnings)
+	// The history and the recycle bin are skipped.
+	assert.Equal(t, []importer.Item{
+		{
+			Kind: importer.KindLogin, Name: "Mail", Tags: []string{"personal", "mail"},
+			Fields: []importer.Field{{Name: "Security question", Value: "Rex"}},
+			Login:  "jane", Password: "s3cret", URL: "https://mail.example.com",
+			TOTP: "otpauth://totp/mail?secret=JBSWY3DPEHPK3PXP",
+		},
+		{Kind: importer.KindNote, Name: "Deploy key", Tags: []string{"Work/Servers"}, Notes: "rotate yearly"},
+		{Kind: importer.KindFile, Name: "Deploy key/id_ed25519.pub", Data: []byte("ssh-ed25519 AAAA key")},
+	}, result.Items)
+}
+
+func TestCSV(t *testing.T) {
+	t.Parallel()
+	result := parseFile(t, "1password.csv")
+	assert.Equal(t, []importer.Item{
+		{
+			Kind: importer.KindLogin, Name: "Dropbox", Tags: []string{"Work", "Cloud"}, Notes: "two\nlines",
+			Fields: []importer.Field{{Name: "Recovery email", Value: "backup@example.com"}},
+			Login:  "jane@example.com", Password: "pa55word", URL: "https://www.dropbox.com",
+			TOTP: "otpauth://totp/Dropbox?secret=JBSWY3DPEHPK3PXP",
+		},
+		{Kind: importer.KindNote, Name: "Server notes", Notes: "rack 4"},
+	}, result.Items)
+
+	// Logins without a name are named after the host of their URL, the bookkeeping columns are ignored.
+	result = parseFile(t, "chrome.csv")
+	assert.Equal(t, []importer.Item{
+		{Kind: importer.KindLogin, Name: "example.com", Login: "jane", Password: "p1", URL: "https://example.com/login"},
+		{Kind: importer.KindLogin, Name: "shop.example.org", Password: "p2", URL: "https://shop.example.org/", Notes: "gift card inside"},
+	}, result.Items)
+	result = parseFile(t, "firefox.csv")
+	assert.Equal(t, []importer.Item{
+		{Kind: importer.KindLogin, Name: "accounts.example.net", Login: "jane", Password: "p3", URL: "https://accounts.example.net"},
+	}, result.Items)
+
+	_, err := importer.Parse([]byte("name,url\nexample,https://example.com\n"), importer.FormatBrowser)
+	assert.ErrorContains(t, err, "missing password column")
+}
+
+func TestValue(t *testing.T) {
+	t.Parallel()
+	login := importer.Item{Kind: importer.KindLogin, Name: "GitHub", Login: "octocat", Password: `p"w`, Tags: []string{"Work"}}
+	assert.Equal(t, "login/GitHub", login.Key())
+	value, err := login.Value()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"login": "octocat", "password": "p\"w", "tags": ["Work"]}`, value)
+
+	card := importer.Item{Kind: importer.KindCard, Name: "Visa", CardNumber: "4111", ExpiryDate: "03/27", CVV: "123"}
+	value, err = card.Value()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"card_number": "4111", "expiry_date": "03/27", "cvv": "123"}`, value)
+
+	note := importer.Item{Kind: importer.KindNote, Name: "Wi-Fi", Notes: "text", Fields: []importer.Field{{Name: "ssid", Value: "home"}}}
+	assert.Equal(t, "text/Wi-Fi", note.Key())
+	value, err = note.Value()
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal([]byte(value), &decoded))
+	assert.Equal(t, "text", decoded["text"])
+
+	file := importer.Item{Kind: importer.KindFile, Name: "key.pub", Data: []byte{0, 0xff}}
+	assert.Equal(t, "binary/key.pub", file.Key())
+	value, err = file.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "00ff", value)
+}
@@ -0,0 +1,171 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type keePassFile struct {
+	Meta struct {
+		RecycleBinEnabled bool   `xml:"RecycleBinEnabled"`
+		RecycleBinUUID    string `xml:"RecycleBinUUID"`
+		Binaries          []struct {
+			ID         string `xml:"ID,attr"`
+			Compressed bool   `xml:"Compressed,attr"`
+			Data       string `xml:",chardata"`
+		} `xml:"Binaries>Binary"`
+	} `xml:"Meta"`
+	Root struct {
+		Groups []keePassGroup `xml:"Group"`
+	} `xml:"Root"`
+}
+
+type keePassGroup struct {
+	UUID    string         `xml:"UUID"`
+	Name    string         `xml:"Name"`
+	Entries []keePassEntry `xml:"Entry"`
+	Groups  []keePassGroup `xml:"Group"`
+}
+
+// keePassEntry is an entry with its current values, the History element holding the previous versions is ignored.
+type keePassEntry struct {
+	Tags    string `xml:"Tags"`
+	Strings []struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	} `xml:"String"`
+	Binaries []struct {
+		Key   string `xml:"Key"`
+		Value struct {
+			Ref  string `xml:"Ref,attr"`
+			Data string `xml:",chardata"`
+		} `xml:"Value"`
+	} `xml:"Binary"`
+}
+
+// keePassStandardFields are the strings of every KeePass entry, the others are custom fields.
+var keePassStandardFields = map[string]bool{"Title": true, "UserName": true, "Password": true, "URL": true, "Notes": true}
+
+// keePassTOTPFields are the custom fields KeePass and KeePassXC keep one-time password secrets in.
+var keePassTOTPFields = []string{"otp", "TimeOtp-Secret-Base32"}
+
+// parseKeePass reads the XML export of a KeePass 2.x or KeePassXC database, which holds the passwords unencrypted.
+// The path of the group of an entry, without the root group, becomes a tag. Entries without user name, password
+// and URL become notes. Attachments become files named after the entry and the attachment.
+// The recycle bin is skipped.
+func parseKeePass(data []byte, r *Result) error {
+	var file keePassFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	binaries := make(map[string][]byte)
+	for _, b := range file.Meta.Binaries {
+		content, err := decodeKeePassBinary(b.Data, b.Compressed)
+		if err != nil {
+			return fmt.Errorf("failed to decode attachment %s: %w", b.ID, err)
+		}
+		binaries[b.ID] = content
+	}
+	recycleBin := ""
+	if file.Meta.RecycleBinEnabled {
+		recycleBin = file.Meta.RecycleBinUUID
+	}
+
+	var walk func(g keePassGroup, path string)
+	walk = func(g keePassGroup, path string) {
+		if recycleBin != "" && g.UUID == recycleBin {
+			return
+		}
+		for _, e := range g.Entries {
+			r.addKeePassEntry(e, path, binaries)
+		}
+		for _, sub := range g.Groups {
+			subPath := sub.Name
+			if path != "" {
+				subPath = path + "/" + sub.Name
+			}
+			walk(sub, subPath)
+		}
+	}
+	for _, root := range file.Root.Groups {
+		walk(root, "")
+	}
+	return nil
+}
+
+func (r *Result) addKeePassEntry(e keePassEntry, group string, binaries map[string][]byte) {
+	values := make(map[string]string)
+	it := Item{}
+	for _, s := range e.Strings {
+		values[s.Key] = s.Value
+		if !keePassStandardFields[s.Key] {
+			it.Fields = append(it.Fields, Field{Name: s.Key, Value: s.Value})
+		}
+	}
+	for _, name := range keePassTOTPFields {
+		if values[name] != "" && it.TOTP == "" {
+			it.TOTP = values[name]
+			it.Fields = removeField(it.Fields, name)
+		}
+	}
+	it.Name = itemName(values["Title"], values["UserName"], values["URL"], len(r.Items))
+	it.Login, it.Password, it.URL, it.Notes = values["UserName"], values["Password"], values["URL"], values["Notes"]
+	if group != "" {
+		it.Tags = append(it.Tags, group)
+	}
+	for _, tag := range strings.FieldsFunc(e.Tags, func(c rune) bool { return c == ';' || c == ',' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			it.Tags = append(it.Tags, tag)
+		}
+	}
+
+	it.Kind = KindLogin
+	if it.Login == "" && it.Password == "" && it.URL == "" && it.TOTP == "" {
+		it.Kind = KindNote
+	}
+	r.Items = append(r.Items, it)
+
+	for _, b := range e.Binaries {
+		content, ok := binaries[b.Value.Ref]
+		if b.Value.Ref == "" {
+			// KeePass 1.x style exports keep the attachment inline.
+			var err error
+			content, err = decodeKeePassBinary(b.Value.Data, false)
+			ok = err == nil
+		}
+		if !ok {
+			r.warnf("skipped attachment %q of %q: its content is missing", b.Key, it.Name)
+			continue
+		}
+		r.Items = append(r.Items, Item{Kind: KindFile, Name: it.Name + "/" + b.Key, Data: content})
+	}
+}
+
+// decodeKeePassBinary decodes the base64 content of an attachment, which may be gzip compressed.
+func decodeKeePassBinary(data string, compressed bool) ([]byte, error) {
+	content, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil || !compressed {
+		return content, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+// removeField returns the fields without the fields with the given name.
+func removeField(fields []Field, name string) []Field {
+	kept := fields[:0]
+	for _, f := range fields {
+		if f.Name != name {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,155 @@
+// Package metrics collects Prometheus metrics of the server: HTTP requests, sign-ins, vault operations
+// and database connections, served on the admin listener.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gophkeeper"
+
+// UnmatchedRoute is the route label of requests that match no route, so that unknown paths
+// do not create new series.
+const UnmatchedRoute = "unmatched"
+
+// OtherMethod is the method label of requests with a non-standard method, so that arbitrary methods
+// sent by clients do not create new series.
+const OtherMethod = "OTHER"
+
+// Metrics holds the collectors of the server and the registry they are exported from.
+type Metrics struct {
+	registry          *prometheus.Registry
+	requests          *prometheus.CounterVec
+	requestDuration   *prometheus.HistogramVec
+	signIns           *prometheus.CounterVec
+	vaultDuration     *prometheus.HistogramVec
+	largeObjectsBytes *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them, along with the Go runtime and process collectors,
+// in a new registry.
+// Returns a pointer to the Metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route pattern, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route pattern, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		signIns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sign_ins_total",
+			Help:      "Number of sign-in attempts by result and reason of the failure.",
+		}, []string{"result", "reason"}),
+		vaultDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "vault_operation_duration_seconds",
+			Help:      "Duration of vault storage operations by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		largeObjectsBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "large_object_bytes_total",
+			Help:      "Number of bytes of vault values read from and written to PostgreSQL large objects.",
+		}, []string{"direction"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.signIns,
+		m.vaultDuration,
+		m.largeObjectsBytes,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts the requests and observes their durations, labelled with the chi route pattern
+// rather than the path, so that IDs in paths do not create new series.
+// It must be used by a chi router, the route pattern is read after the request has been routed.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := UnmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := prometheus.Labels{"route": route, "method": methodLabel(r.Method), "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel returns the method label of a request method, OtherMethod unless it is a standard method.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return OtherMethod
+}
+
+// SignInSucceeded counts a successful sign-in.
+func (m *Metrics) SignInSucceeded() {
+	m.signIns.WithLabelValues("success", "").Inc()
+}
+
+// SignInFailed counts a rejected sign-in with the reason of the failure.
+func (m *Metrics) SignInFailed(reason string) {
+	m.signIns.WithLabelValues("failure", reason).Inc()
+}
+
+// LargeObjectRead counts the bytes read from a large object.
+func (m *Metrics) LargeObjectRead(n int64) {
+	m.largeObjectsBytes.WithLabelValues("read").Add(float64(n))
+}
+
+// LargeObjectWritten counts the bytes written to a large object.
+func (m *Metrics) LargeObjectWritten(n int64) {
+	m.largeObjectsBytes.WithLabelValues("written").Add(float64(n))
+}
+
+// RegisterDB exports the connection statistics of a database/sql database, labelled with the name.
+// Returns an error if the statistics of the name are already registered.
+func (m *Metrics) RegisterDB(name string, db *sql.DB) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterPool exports the connection statistics of a pgx connection pool.
+// Returns an error if the statistics of a pool are already registered.
+func (m *Metrics) RegisterPool(pool *pgxpool.Pool) error {
+	return m.registry.Register(newPoolCollector(pool))
+}
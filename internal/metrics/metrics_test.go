@@ -0,0 +1,72 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/metrics"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New()
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/api/vault/{vaultID}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	r.Post("/api/vault", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	})
+	for _, path := range []string{"/api/vault/1", "/api/vault/2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/vault", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("FOO", "/unknown", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BAR", "/unknown", nil))
+
+	m.SignInSucceeded()
+	m.SignInFailed("invalid password")
+	m.LargeObjectRead(10)
+	m.LargeObjectWritten(32)
+
+	vaultStorage := metrics.NewVaultStorage(memory.NewVaultStorage(), m)
+	v, err := vaultStorage.CreateVault(context.Background(), storage.Vault{Key: "k", Value: []byte("v"), UserID: 1})
+	require.NoError(t, err)
+	_, err = vaultStorage.GetVault(context.Background(), v.ID)
+	require.NoError(t, err)
+
+	got := scrape(t, m)
+	assert.Contains(t, got, `gophkeeper_http_requests_total{method="GET",route="/api/vault/{vaultID}",status="404"} 2`)
+	assert.Contains(t, got, `gophkeeper_http_requests_total{method="POST",route="/api/vault",status="200"} 1`)
+	assert.Contains(t, got, `gophkeeper_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, got, `gophkeeper_http_requests_total{method="OTHER",route="unmatched",status="405"} 2`)
+	assert.Contains(t, got, `gophkeeper_http_request_duration_seconds_count{method="GET",route="/api/vault/{vaultID}",status="404"} 2`)
+	assert.Contains(t, got, `gophkeeper_sign_ins_total{reason="",result="success"} 1`)
+	assert.Contains(t, got, `gophkeeper_sign_ins_total{reason="invalid password",result="failure"} 1`)
+	assert.Contains(t, got, `gophkeeper_large_object_bytes_total{direction="read"} 10`)
+	assert.Contains(t, got, `gophkeeper_large_object_bytes_total{direction="written"} 32`)
+	assert.Contains(t, got, `gophkeeper_vault_operation_duration_seconds_count{method="CreateVault"} 1`)
+	assert.Contains(t, got, `gophkeeper_vault_operation_duration_seconds_count{method="GetVault"} 1`)
+	assert.Contains(t, got, "go_goroutines")
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// VaultStorage observes the durations of the operations of a storage.VaultStorage.
+type VaultStorage struct {
+	next    storage.VaultStorage
+	metrics *Metrics
+}
+
+// NewVaultStorage wraps a vault storage to observe the durations of its operations.
+// It takes the wrapped storage.VaultStorage and the Metrics.
+// Returns a pointer to the VaultStorage.
+func NewVaultStorage(next storage.VaultStorage, m *Metrics) *VaultStorage {
+	return &VaultStorage{next: next, metrics: m}
+}
+
+func (s *VaultStorage) observe(method string, start time.Time) {
+	s.metrics.vaultDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// GetVault retrieves a vault by its ID from the wrapped storage.
+func (s *VaultStorage) GetVault(ctx context.Context, id uint64) (storage.Vault, error) {
+	defer s.observe("GetVault", time.Now())
+	return s.next.GetVault(ctx, id)
+}
+
+// CreateVault inserts a vault into the wrapped storage.
+func (s *VaultStorage) CreateVault(ctx context.Context, v storage.Vault) (storage.Vault, error) {
+	defer s.observe("CreateVault", time.Now())
+	return s.next.CreateVault(ctx, v)
+}
+
+// UpdateVault updates a vault in the wrapped storage.
+func (s *VaultStorage) UpdateVault(ctx context.Context, v storage.Vault) error {
+	defer s.observe("UpdateVault", time.Now())
+	return s.next.UpdateVault(ctx, v)
+}
+
+// DeleteVault removes a vault by its ID from the wrapped storage.
+func (s *VaultStorage) DeleteVault(ctx context.Context, id uint64) error {
+	defer s.observe("DeleteVault", time.Now())
+	return s.next.DeleteVault(ctx, id)
+}
+
+// ListVaults retrieves the vaults of a user from the wrapped storage.
+func (s *VaultStorage) ListVaults(ctx context.Context, userID uint64) ([]storage.Vault, error) {
+	defer s.observe("ListVaults", time.Now())
+	return s.next.ListVaults(ctx, userID)
+}
@@ -0,0 +1,111 @@
+// Package oidc implements sign-in with an external OpenID Connect identity provider
+// using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrMissingIDToken is returned when the token response of the provider has no ID token.
+var ErrMissingIDToken = errors.New("oidc: token response has no id_token")
+
+// Config holds the registration of gophkeeper as a client of the identity provider.
+type Config struct {
+	Issuer       string   // Issuer URL, the discovery document is fetched from Issuer + "/.well-known/openid-configuration".
+	ClientID     string   // Client ID registered at the provider.
+	ClientSecret string   // Client secret, empty for public clients.
+	RedirectURL  string   // Callback URL of the server registered at the provider.
+	Scopes       []string // Additional scopes, "openid" is always requested.
+}
+
+// Identity holds the claims of a verified ID token used to map the user to a gophkeeper account.
+type Identity struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// Claim returns the value of a supported claim by its name, or an empty string.
+func (i Identity) Claim(name string) string {
+	switch name {
+	case "sub":
+		return i.Subject
+	case "email":
+		return i.Email
+	case "preferred_username":
+		return i.PreferredUsername
+	}
+	return ""
+}
+
+// Provider is a discovered identity provider.
+type Provider struct {
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewProvider fetches the discovery document of the issuer and creates a Provider.
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover oidc provider %s: %w", cfg.Issuer, err)
+	}
+
+	return &Provider{
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, cfg.Scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// GenerateVerifier returns a new random PKCE code verifier.
+func GenerateVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// AuthCodeURL returns the URL of the provider the user signs in at.
+// The state and nonce bind the callback and the ID token to this sign-in,
+// the S256 challenge of the code verifier binds the authorization code to it.
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	return p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
+}
+
+// Exchange redeems the authorization code and verifies the returned ID token.
+func (p *Provider) Exchange(ctx context.Context, code, nonce, codeVerifier string) (Identity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, ErrMissingIDToken
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("verify id token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return Identity{}, errors.New("oidc: id token nonce mismatch")
+	}
+
+	var identity Identity
+	err = idToken.Claims(&identity)
+	if err != nil {
+		return Identity{}, fmt.Errorf("parse id token claims: %w", err)
+	}
+	return identity, nil
+}
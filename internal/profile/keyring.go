@@ -0,0 +1,41 @@
+package profile
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// keyringService is the service the key of the credentials is stored under in the keyring of the OS.
+const keyringService = "gophkeeper"
+
+var (
+	// ErrKeyNotFound is returned by a Keyring which holds no key for the account.
+	ErrKeyNotFound = errors.New("key not found in keyring")
+	// ErrKeyringUnavailable is returned by a Keyring which can't be used, e.g. without a desktop session.
+	ErrKeyringUnavailable = errors.New("keyring is unavailable")
+)
+
+// Keyring keeps the key of the credentials outside of the configuration directory.
+type Keyring interface {
+	// Key returns the key stored for the account, ErrKeyNotFound if there is none.
+	Key(account string) ([]byte, error)
+	// SetKey stores the key for the account, replacing the previous one.
+	SetKey(account string, key []byte) error
+}
+
+// SystemKeyring returns the keyring of the OS: the login keychain on macOS, the Credential Manager on Windows and
+// the Secret Service, e.g. GNOME Keyring or KWallet, through secret-tool elsewhere.
+// Its methods return ErrKeyringUnavailable if the keyring can't be reached.
+func SystemKeyring() Keyring {
+	return systemKeyring{}
+}
+
+// decodeKey decodes a key stored hex-encoded in the keyring, as the keyring tools handle text only.
+func decodeKey(secret string) ([]byte, error) {
+	key, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in keyring: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,47 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// errSecItemNotFound is the exit code of security if the keychain holds no matching item.
+const errSecItemNotFound = 44
+
+// systemKeyring keeps the key in the login keychain with the security tool.
+type systemKeyring struct{}
+
+// Key implements Keyring.
+func (systemKeyring) Key(account string) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", account, "-w").Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyringUnavailable, err)
+	}
+	return decodeKey(strings.TrimSpace(string(out)))
+}
+
+// SetKey implements Keyring. The command is passed on stdin, so that the key doesn't show up in the process list.
+func (systemKeyring) SetKey(account string, key []byte) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		keyringService, quoteArg(account), hex.EncodeToString(key)))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %w: %s", ErrKeyringUnavailable, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// quoteArg quotes an argument of a command of security -i.
+func quoteArg(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
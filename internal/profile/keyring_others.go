@@ -0,0 +1,44 @@
+//go:build !darwin && !windows
+
+package profile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// systemKeyring keeps the key in the Secret Service with the secret-tool of libsecret.
+type systemKeyring struct{}
+
+// Key implements Keyring.
+func (systemKeyring) Key(account string) ([]byte, error) {
+	cmd := exec.Command("secret-tool", "lookup", "service", keyringService, "account", account)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	// secret-tool fails without a message if nothing matches, and with one if the Secret Service can't be reached.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && stderr.Len() == 0 {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w: %s", ErrKeyringUnavailable, err, strings.TrimSpace(stderr.String()))
+	}
+	return decodeKey(strings.TrimSpace(string(out)))
+}
+
+// SetKey implements Keyring. The key is passed on stdin, so that it doesn't show up in the process list.
+func (systemKeyring) SetKey(account string, key []byte) error {
+	cmd := exec.Command("secret-tool", "store", "--label=GophKeeper credentials key", "service", keyringService, "account", account)
+	cmd.Stdin = strings.NewReader(hex.EncodeToString(key))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %w: %s", ErrKeyringUnavailable, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
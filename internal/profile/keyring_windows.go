@@ -0,0 +1,91 @@
+package profile
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	credTypeGeneric         = 1 // CRED_TYPE_GENERIC
+	credPersistLocalMachine = 2 // CRED_PERSIST_LOCAL_MACHINE
+)
+
+var (
+	advapi32   = windows.NewLazySystemDLL("advapi32.dll")
+	credReadW  = advapi32.NewProc("CredReadW")
+	credWriteW = advapi32.NewProc("CredWriteW")
+	credFree   = advapi32.NewProc("CredFree")
+)
+
+// credential is the CREDENTIALW structure of the Credential Manager.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// systemKeyring keeps the key as a generic credential in the Credential Manager.
+type systemKeyring struct{}
+
+// Key implements Keyring.
+func (systemKeyring) Key(account string) ([]byte, error) {
+	target, err := windows.UTF16PtrFromString(keyringService + ":" + account)
+	if err != nil {
+		return nil, err
+	}
+	if err = credReadW.Find(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyringUnavailable, err)
+	}
+	var cred *credential
+	ok, _, err := credReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ok == 0 {
+		if errors.Is(err, windows.ERROR_NOT_FOUND) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("%w: %w", ErrKeyringUnavailable, err)
+	}
+	defer credFree.Call(uintptr(unsafe.Pointer(cred)))
+	return decodeKey(string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)))
+}
+
+// SetKey implements Keyring.
+func (systemKeyring) SetKey(account string, key []byte) error {
+	target, err := windows.UTF16PtrFromString(keyringService + ":" + account)
+	if err != nil {
+		return err
+	}
+	userName, err := windows.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+	if err = credWriteW.Find(); err != nil {
+		return fmt.Errorf("%w: %w", ErrKeyringUnavailable, err)
+	}
+	secret := []byte(hex.EncodeToString(key))
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(secret)),
+		CredentialBlob:     &secret[0],
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+	ok, _, err := credWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if ok == 0 {
+		return fmt.Errorf("%w: %w", ErrKeyringUnavailable, err)
+	}
+	return nil
+}
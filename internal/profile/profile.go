@@ -0,0 +1,395 @@
+// Package profile keeps the configuration of the client: named profiles with the URL of a server, the CA certificate
+// it is verified with and the default output format, and the tokens of the profiles the user has logged in with.
+//
+// Profiles are kept in config.json in the configuration directory. Tokens are kept in credentials.json next to it,
+// encrypted with AES-256-GCM under a random key. With WithKeyring the key is kept in the keyring of the OS, so that
+// the configuration directory alone doesn't reveal the tokens. Without a keyring, or if it is unavailable, the key is
+// kept in the key file next to the credentials, which only protects the credentials file if it is copied alone.
+// All files are only readable by the user.
+package profile
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+const (
+	// DefaultName is the name of the profile used if none is selected.
+	DefaultName = "default"
+	// DirEnv is the environment variable overriding the configuration directory.
+	DirEnv = "GOPHKEEPER_CONFIG_DIR"
+
+	// OutputText prints human-readable messages, OutputJSON prints the responses of the server as JSON.
+	OutputText = "text"
+	OutputJSON = "json"
+
+	configFile      = "config.json"
+	credentialsFile = "credentials.json"
+	keyFile         = "key"
+	keySize         = 32
+)
+
+var (
+	// ErrNotFound is returned for a profile which is not configured.
+	ErrNotFound = errors.New("profile not found")
+	// ErrNoToken is returned by Store.Token if the user has not logged in with the profile.
+	ErrNoToken = errors.New("not logged in")
+
+	namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+)
+
+// Profile is a server the client connects to.
+type Profile struct {
+	Server string `json:"server"`           // URL of the server.
+	CA     string `json:"ca,omitempty"`     // Path of a PEM file with the CA certificates of the server, the system's by default.
+	Output string `json:"output,omitempty"` // OutputText (the default) or OutputJSON.
+}
+
+// Validate checks the profile.
+func (p Profile) Validate() error {
+	if p.Server == "" {
+		return errors.New("server URL is required")
+	}
+	switch p.Output {
+	case "", OutputText, OutputJSON:
+	default:
+		return fmt.Errorf("unknown output format %q, use %s or %s", p.Output, OutputText, OutputJSON)
+	}
+	return nil
+}
+
+// Config is the content of the configuration file.
+type Config struct {
+	Current  string             `json:"current,omitempty"` // Profile used if none is selected, DefaultName if empty.
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Names returns the names of the profiles in order.
+func (c Config) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the profile with the name, or the current profile if the name is empty.
+// Returns the name of the profile, the profile and ErrNotFound if it is not configured.
+func (c Config) Profile(name string) (string, Profile, error) {
+	if name == "" {
+		name = c.Current
+	}
+	if name == "" {
+		name = DefaultName
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return name, Profile{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return name, p, nil
+}
+
+// ValidateName checks the name of a profile.
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q, use up to 64 letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// Store reads and writes the files in a configuration directory.
+type Store struct {
+	dir      string
+	keyring  Keyring   // Keyring keeping the key of the credentials, the key file if nil.
+	warnings io.Writer // Writer of warnings, e.g. about falling back to the key file.
+	warned   bool      // Whether the fallback to the key file was reported.
+}
+
+// StoreOption configures a Store.
+type StoreOption func(*Store)
+
+// WithKeyring keeps the key of the credentials in the keyring, e.g. SystemKeyring. A key file left from before
+// is moved into the keyring. If the keyring is unavailable, the key file is used instead.
+func WithKeyring(keyring Keyring) StoreOption {
+	return func(s *Store) {
+		s.keyring = keyring
+	}
+}
+
+// WithWarnings reports falling back from the keyring to the key file to w.
+func WithWarnings(w io.Writer) StoreOption {
+	return func(s *Store) {
+		s.warnings = w
+	}
+}
+
+// NewStore creates a new instance of Store for the directory, which is created when it is first written to.
+func NewStore(dir string, opts ...StoreOption) *Store {
+	s := &Store{dir: dir, warnings: io.Discard}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// DefaultDir returns the configuration directory: the directory of GOPHKEEPER_CONFIG_DIR if it is set,
+// gophkeeper in the configuration directory of the user otherwise, e.g. ~/.config/gophkeeper on Linux.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(DirEnv); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find configuration directory: %w", err)
+	}
+	return filepath.Join(dir, "gophkeeper"), nil
+}
+
+// Dir returns the configuration directory.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Load reads the configuration. Returns an empty configuration if there is none yet.
+func (s *Store) Load() (Config, error) {
+	var cfg Config
+	if err := s.readJSON(configFile, &cfg); err != nil {
+		return Config{}, err
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]Profile)
+	}
+	return cfg, nil
+}
+
+// Save writes the configuration.
+func (s *Store) Save(cfg Config) error {
+	for name, p := range cfg.Profiles {
+		if err := ValidateName(name); err != nil {
+			return err
+		}
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return s.writeJSON(configFile, cfg)
+}
+
+// Token returns the token the user has logged in with to the profile with the name.
+// Returns ErrNoToken if there is none.
+func (s *Store) Token(name string) (string, error) {
+	credentials, err := s.loadCredentials()
+	if err != nil {
+		return "", err
+	}
+	sealed, ok := credentials[name]
+	if !ok {
+		return "", fmt.Errorf("%w with profile %s", ErrNoToken, name)
+	}
+	aead, err := s.aead(false)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("failed to decrypt token of profile %s: too short", name)
+	}
+	token, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt token of profile %s: %w", name, err)
+	}
+	return string(token), nil
+}
+
+// SaveToken encrypts the token and stores it for the profile with the name, replacing the previous one.
+func (s *Store) SaveToken(name, token string) error {
+	credentials, err := s.loadCredentials()
+	if err != nil {
+		return err
+	}
+	aead, err := s.aead(true)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(token)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	// The name is authenticated, so that the token of one profile can't be moved to another one.
+	credentials[name] = aead.Seal(nonce, nonce, []byte(token), []byte(name))
+	return s.writeJSON(credentialsFile, credentials)
+}
+
+// DeleteToken deletes the token of the profile with the name. Returns ErrNoToken if there is none.
+func (s *Store) DeleteToken(name string) error {
+	credentials, err := s.loadCredentials()
+	if err != nil {
+		return err
+	}
+	if _, ok := credentials[name]; !ok {
+		return fmt.Errorf("%w with profile %s", ErrNoToken, name)
+	}
+	delete(credentials, name)
+	return s.writeJSON(credentialsFile, credentials)
+}
+
+// loadCredentials reads the encrypted tokens by profile name.
+func (s *Store) loadCredentials() (map[string][]byte, error) {
+	credentials := make(map[string][]byte)
+	if err := s.readJSON(credentialsFile, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// aead returns the cipher of the tokens. The key is generated if it doesn't exist and create is set.
+func (s *Store) aead(create bool) (cipher.AEAD, error) {
+	key, err := s.key(create)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// key returns the key of the tokens from the keyring, or from the key file if there is no keyring or it is unavailable.
+// A key file found while the keyring holds no key is moved into the keyring.
+func (s *Store) key(create bool) ([]byte, error) {
+	if s.keyring == nil {
+		return s.fileKey(create)
+	}
+
+	// Keys are stored by the configuration directory, which GOPHKEEPER_CONFIG_DIR may change.
+	account, err := filepath.Abs(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find configuration directory: %w", err)
+	}
+	key, err := s.keyring.Key(account)
+	if err == nil {
+		if len(key) != keySize {
+			return nil, errors.New("invalid key in keyring")
+		}
+		return key, nil
+	}
+	if errors.Is(err, ErrKeyNotFound) {
+		key, err = s.fileKey(false)
+		if err == nil {
+			if err = s.keyring.SetKey(account, key); err == nil {
+				err = os.Remove(filepath.Join(s.dir, keyFile))
+			}
+			if err != nil {
+				s.warn(err)
+			}
+			return key, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) || !create {
+			return nil, err
+		}
+
+		key = make([]byte, keySize)
+		if _, err = rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		if err = s.keyring.SetKey(account, key); err == nil {
+			return key, nil
+		}
+	}
+	if !errors.Is(err, ErrKeyringUnavailable) {
+		return nil, err
+	}
+	s.warn(err)
+	return s.fileKey(create)
+}
+
+// warn reports once that the key is kept in the key file instead of the keyring.
+func (s *Store) warn(err error) {
+	if s.warned {
+		return
+	}
+	s.warned = true
+	fmt.Fprintf(s.warnings, "Warning: the key of the credentials is kept in %s, not in the keyring: %v\n", filepath.Join(s.dir, keyFile), err)
+}
+
+// fileKey reads the key of the tokens from the key file. The key is generated if it doesn't exist and create is set.
+func (s *Store) fileKey(create bool) ([]byte, error) {
+	path := filepath.Join(s.dir, keyFile)
+	key, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && create {
+		key = make([]byte, keySize)
+		if _, err = rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		err = s.writeFile(keyFile, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("invalid key in %s", path)
+	}
+	return key, nil
+}
+
+// readJSON decodes the file in the directory into v, leaving v unchanged if the file doesn't exist.
+func (s *Store) readJSON(name string, v any) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeJSON encodes v into the file in the directory.
+func (s *Store) writeJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return s.writeFile(name, append(data, '\n'))
+}
+
+// writeFile replaces the file in the directory, which is created if needed, with a new file only readable by the user,
+// so that the file is never left half written.
+func (s *Store) writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create configuration directory: %w", err)
+	}
+	f, err := os.CreateTemp(s.dir, name+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	defer os.Remove(f.Name())
+	// CreateTemp creates the file with mode 0600, Chmod only guards against a umask or platform doing otherwise.
+	if err = f.Chmod(0o600); err == nil {
+		_, err = f.Write(data)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(s.dir, name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
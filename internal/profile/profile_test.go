@@ -0,0 +1,160 @@
+package profile_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+	store := profile.NewStore(filepath.Join(t.TempDir(), "gophkeeper"))
+
+	cfg, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Profiles)
+	_, _, err = cfg.Profile("")
+	assert.ErrorIs(t, err, profile.ErrNotFound)
+
+	cfg.Profiles["work"] = profile.Profile{Server: "https://keeper.example.com", CA: "/etc/ca.pem", Output: profile.OutputJSON}
+	cfg.Profiles[profile.DefaultName] = profile.Profile{Server: "http://localhost:8080"}
+	require.NoError(t, store.Save(cfg))
+
+	loaded, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, cfg, loaded)
+	assert.Equal(t, []string{"default", "work"}, loaded.Names())
+	name, p, err := loaded.Profile("")
+	require.NoError(t, err)
+	assert.Equal(t, profile.DefaultName, name)
+	assert.Equal(t, "http://localhost:8080", p.Server)
+	loaded.Current = "work"
+	name, p, err = loaded.Profile("")
+	require.NoError(t, err)
+	assert.Equal(t, "work", name)
+	assert.Equal(t, profile.OutputJSON, p.Output)
+
+	cfg.Profiles["bad"] = profile.Profile{Server: "http://localhost:8080", Output: "yaml"}
+	assert.Error(t, store.Save(cfg))
+	delete(cfg.Profiles, "bad")
+	cfg.Profiles["../bad"] = profile.Profile{Server: "http://localhost:8080"}
+	assert.Error(t, store.Save(cfg))
+}
+
+func TestToken(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store := profile.NewStore(dir)
+
+	_, err := store.Token("work")
+	assert.ErrorIs(t, err, profile.ErrNoToken)
+	require.NoError(t, store.SaveToken("work", "secret-jwt"))
+	require.NoError(t, store.SaveToken("home", "other-jwt"))
+	token, err := store.Token("work")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-jwt", token)
+
+	data, err := os.ReadFile(filepath.Join(dir, "credentials.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret-jwt")
+	if runtime.GOOS != "windows" {
+		for _, name := range []string{"credentials.json", "key"} {
+			info, err := os.Stat(filepath.Join(dir, name))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), name)
+		}
+	}
+
+	// The token of one profile doesn't decrypt as the token of another.
+	var credentials map[string][]byte
+	require.NoError(t, json.Unmarshal(data, &credentials))
+	credentials["home"] = credentials["work"]
+	data, err = json.Marshal(credentials)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "credentials.json"), data, 0o600))
+	_, err = store.Token("home")
+	assert.Error(t, err)
+
+	require.NoError(t, store.DeleteToken("work"))
+	_, err = store.Token("work")
+	assert.ErrorIs(t, err, profile.ErrNoToken)
+	assert.ErrorIs(t, store.DeleteToken("work"), profile.ErrNoToken)
+}
+
+// fakeKeyring keeps keys in memory, or is unavailable.
+type fakeKeyring struct {
+	keys        map[string][]byte
+	unavailable bool
+}
+
+func (k *fakeKeyring) Key(account string) ([]byte, error) {
+	if k.unavailable {
+		return nil, profile.ErrKeyringUnavailable
+	}
+	key, ok := k.keys[account]
+	if !ok {
+		return nil, profile.ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (k *fakeKeyring) SetKey(account string, key []byte) error {
+	if k.unavailable {
+		return profile.ErrKeyringUnavailable
+	}
+	k.keys[account] = key
+	return nil
+}
+
+func TestKeyring(t *testing.T) {
+	t.Parallel()
+	keyring := &fakeKeyring{keys: make(map[string][]byte)}
+
+	t.Run("key is kept in the keyring", func(t *testing.T) {
+		dir := t.TempDir()
+		store := profile.NewStore(dir, profile.WithKeyring(keyring))
+		require.NoError(t, store.SaveToken("work", "secret-jwt"))
+		assert.NoFileExists(t, filepath.Join(dir, "key"))
+		assert.Contains(t, keyring.keys, dir)
+
+		token, err := profile.NewStore(dir, profile.WithKeyring(keyring)).Token("work")
+		require.NoError(t, err)
+		assert.Equal(t, "secret-jwt", token)
+		_, err = profile.NewStore(dir).Token("work")
+		assert.Error(t, err, "the configuration directory alone doesn't reveal the token")
+	})
+
+	t.Run("key file is moved into the keyring", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, profile.NewStore(dir).SaveToken("work", "secret-jwt"))
+		require.FileExists(t, filepath.Join(dir, "key"))
+
+		token, err := profile.NewStore(dir, profile.WithKeyring(keyring)).Token("work")
+		require.NoError(t, err)
+		assert.Equal(t, "secret-jwt", token)
+		assert.NoFileExists(t, filepath.Join(dir, "key"))
+		assert.Contains(t, keyring.keys, dir)
+	})
+
+	t.Run("unavailable keyring falls back to the key file", func(t *testing.T) {
+		dir := t.TempDir()
+		var warnings bytes.Buffer
+		store := profile.NewStore(dir, profile.WithKeyring(&fakeKeyring{unavailable: true}), profile.WithWarnings(&warnings))
+		require.NoError(t, store.SaveToken("work", "secret-jwt"))
+		require.NoError(t, store.SaveToken("home", "other-jwt"))
+		assert.FileExists(t, filepath.Join(dir, "key"))
+		assert.Equal(t, 1, strings.Count(warnings.String(), "Warning"), warnings.String())
+
+		token, err := profile.NewStore(dir).Token("work")
+		require.NoError(t, err)
+		assert.Equal(t, "secret-jwt", token)
+	})
+}
@@ -1,30 +1,153 @@
 package pwd
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// argon2idPrefix starts every hash produced by HashService.Hash.
+const argon2idPrefix = "$argon2id$"
+
+// ErrUnknownHashFormat is returned for hashes which are neither Argon2id nor bcrypt.
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Argon2Params holds the cost parameters of the Argon2id key derivation.
+type Argon2Params struct {
+	Memory      uint32 // Memory in KiB.
+	Iterations  uint32 // Number of passes over the memory.
+	Parallelism uint8  // Number of threads.
+	SaltLength  uint32 // Length of the random salt in bytes.
+	KeyLength   uint32 // Length of the derived key in bytes.
+}
+
+// DefaultArgon2Params are the parameters used when none are configured,
+// following the OWASP recommendations for password storage.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
 // HashService provides methods for hashing passwords and comparing hashed passwords.
-type HashService struct{}
+// New hashes are always Argon2id with the configured parameters, while bcrypt hashes
+// created by earlier versions are still accepted so that they can be upgraded on sign-in.
+type HashService struct {
+	params Argon2Params
+}
 
-// NewHashService creates a new instance of HashService.
-func NewHashService() HashService {
-	return HashService{}
+// NewHashService creates a new instance of HashService with the given Argon2id parameters.
+// Zero parameters fall back to DefaultArgon2Params.
+func NewHashService(params Argon2Params) HashService {
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2Params.Memory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = DefaultArgon2Params.Iterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = DefaultArgon2Params.Parallelism
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = DefaultArgon2Params.SaltLength
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = DefaultArgon2Params.KeyLength
+	}
+	return HashService{params: params}
 }
 
-// Hash takes a plain text password and returns its bcrypt hash.
-// It uses bcrypt's MinCost parameter for hashing, which is a low computational cost for fast hashing.
+// Hash takes a plain text password and returns its Argon2id hash in the PHC string format,
+// e.g. "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>", which records the parameters used.
 // Returns the hashed password as a string and any error encountered during hashing.
 func (s HashService) Hash(password string) (string, error) {
-	var passwordBytes = []byte(password)
-	hashedPasswordBytes, err := bcrypt.GenerateFromPassword(passwordBytes, bcrypt.MinCost)
-	return string(hashedPasswordBytes), err
+	salt := make([]byte, s.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("read random salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, s.params.Iterations, s.params.Memory, s.params.Parallelism, s.params.KeyLength)
+	return encodeArgon2id(s.params, salt, key), nil
 }
 
 // Match compares a plain text password with a hashed password to check if they match.
-// It returns true if the password matches the hash, and false otherwise.
+// Both Argon2id and legacy bcrypt hashes are supported.
 // Returns true if the plain text password, when hashed, matches the provided hashed password, and false if not.
 func (s HashService) Match(hashedPassword string, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+	if !strings.HasPrefix(hashedPassword, argon2idPrefix) {
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+		return err == nil
+	}
+
+	params, salt, key, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return false
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+// NeedsRehash reports whether the hash was created with another algorithm or other parameters
+// than the configured ones. Such hashes should be replaced after the next successful Match.
+func (s HashService) NeedsRehash(hashedPassword string) bool {
+	params, salt, key, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return true
+	}
+	return params.Memory != s.params.Memory ||
+		params.Iterations != s.params.Iterations ||
+		params.Parallelism != s.params.Parallelism ||
+		uint32(len(salt)) != s.params.SaltLength ||
+		uint32(len(key)) != s.params.KeyLength
+}
+
+// encodeArgon2id formats the parameters, salt and key in the PHC string format.
+func encodeArgon2id(params Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// decodeArgon2id parses a hash in the PHC string format produced by encodeArgon2id.
+func decodeArgon2id(hashedPassword string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, fmt.Errorf("parse version: %w", err)
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("parse parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("decode salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("decode key: %w", err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
 }
@@ -0,0 +1,59 @@
+package pwd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/pwd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams keeps the tests fast, the production defaults are much more expensive.
+var testParams = pwd.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashService(t *testing.T) {
+	t.Parallel()
+	s := pwd.NewHashService(testParams)
+
+	hash, err := s.Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+	assert.True(t, s.Match(hash, "secret"))
+	assert.False(t, s.Match(hash, "Secret"))
+	assert.False(t, s.NeedsRehash(hash))
+
+	other, err := s.Hash("secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "salt must be random")
+
+	assert.False(t, s.Match("$argon2id$broken", "secret"))
+	assert.False(t, s.Match("", "secret"))
+}
+
+func TestHashServiceLegacyBcrypt(t *testing.T) {
+	t.Parallel()
+	s := pwd.NewHashService(testParams)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	assert.True(t, s.Match(string(legacy), "secret"))
+	assert.False(t, s.Match(string(legacy), "other"))
+	assert.True(t, s.NeedsRehash(string(legacy)))
+}
+
+func TestHashServiceNeedsRehashOnNewParameters(t *testing.T) {
+	t.Parallel()
+	old := pwd.NewHashService(testParams)
+	hash, err := old.Hash("secret")
+	require.NoError(t, err)
+
+	stronger := testParams
+	stronger.Iterations = 2
+	s := pwd.NewHashService(stronger)
+
+	assert.True(t, s.Match(hash, "secret"), "hashes with old parameters must still verify")
+	assert.True(t, s.NeedsRehash(hash))
+}
@@ -0,0 +1,286 @@
+// Package srp implements the SRP-6a password-authenticated key exchange (RFC 5054)
+// for zero-knowledge sign-in: the server stores only a verifier derived from the password
+// and never sees the password itself, not even during sign-in.
+//
+// The private key x is derived with Argon2id instead of a single hash, so that a leaked
+// verifier is as expensive to brute-force as a stored password hash. The login is not part
+// of x, which keeps the verifier valid when the login is renamed.
+//
+// Sign-in works as follows:
+//   - The client sends its public ephemeral A (Client.PublicKey).
+//   - The server answers with the salt and its public ephemeral B (Server.PublicKey).
+//   - The client sends its proof M1 (Client.Proof), the server checks it (Server.ClientProof).
+//   - The server answers with its proof M2 (Server.ServerProof), the client checks it (Client.VerifyServer).
+package srp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// SaltLength is the length of the random salt in bytes.
+const SaltLength = 16
+
+// Argon2id parameters used to derive the private key x from the password.
+// They are part of the verifier format and can't be changed without re-registering all verifiers.
+const (
+	kdfMemory      = 64 * 1024
+	kdfIterations  = 3
+	kdfParallelism = 2
+	kdfKeyLength   = 32
+)
+
+// MaxSaltLength is the maximum accepted length of a salt in bytes.
+const MaxSaltLength = 64
+
+var (
+	// ErrInvalidPublicKey is returned for public ephemeral values which are 0 modulo N.
+	ErrInvalidPublicKey = errors.New("srp: invalid public key")
+	// ErrInvalidVerifier is returned by ValidateVerifier for malformed registrations.
+	ErrInvalidVerifier = errors.New("srp: invalid salt or verifier")
+)
+
+// Group is a safe prime N and a generator g modulo N.
+type Group struct {
+	N *big.Int
+	G *big.Int
+}
+
+// Group2048 is the 2048-bit group from RFC 5054 Appendix A.
+var Group2048 = mustGroup(`
+	AC6BDB41 324A9A9B F166DE5E 1389582F AF72B665 1987EE07 FC319294
+	3DB56050 A37329CB B4A099ED 8193E075 7767A13D D52312AB 4B03310D
+	CD7F48A9 DA04FD50 E8083969 EDB767B0 CF609517 9A163AB3 661A05FB
+	D5FAAAE8 2918A996 2F0B93B8 55F97993 EC975EEA A80D740A DBF4FF74
+	7359D041 D5C33EA7 1D281E44 6B14773B CA97B43A 23FB8016 76BD207A
+	436C6481 F1D2B907 8717461A 5B9D32E6 88F87748 544523B5 24B0D57D
+	5EA77A27 75D2ECFA 032CFBDB F52FB378 61602790 04E57AE6 AF874E73
+	03CE5329 9CCC041C 7BC308D8 2A5698F3 A8D0C382 71AE35F8 E9DBFBB6
+	94B5C803 D89F7AE4 35DE236D 525F5475 9B65E372 FCD68EF2 0FA7111F
+	9E4AFF73`, 2)
+
+func mustGroup(hexN string, g int64) Group {
+	n, ok := new(big.Int).SetString(strings.Join(strings.Fields(hexN), ""), 16)
+	if !ok {
+		panic("srp: invalid group prime")
+	}
+	return Group{N: n, G: big.NewInt(g)}
+}
+
+// NewVerifier creates a random salt and the verifier of the password for registration.
+// Only the salt and the verifier are sent to the server.
+func NewVerifier(password string) (salt []byte, verifier []byte, err error) {
+	salt = make([]byte, SaltLength)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, nil, fmt.Errorf("read random salt: %w", err)
+	}
+	return salt, ComputeVerifier(salt, password), nil
+}
+
+// ComputeVerifier returns the verifier v = g^x mod N of the password with the given salt.
+func ComputeVerifier(salt []byte, password string) []byte {
+	g := Group2048
+	x := deriveX(salt, password)
+	return pad(g, new(big.Int).Exp(g.G, x, g.N))
+}
+
+// ValidateVerifier checks that a salt and a verifier sent for registration are well-formed.
+// It can't check that the verifier belongs to any particular password.
+func ValidateVerifier(salt, verifier []byte) error {
+	g := Group2048
+	v := new(big.Int).SetBytes(verifier)
+	if len(salt) < SaltLength || len(salt) > MaxSaltLength || len(verifier) != len(pad(g, g.N)) ||
+		v.Cmp(big.NewInt(1)) <= 0 || v.Cmp(g.N) >= 0 {
+		return ErrInvalidVerifier
+	}
+	return nil
+}
+
+// deriveX derives the private key x = H(salt | Argon2id(password, salt)).
+func deriveX(salt []byte, password string) *big.Int {
+	key := argon2.IDKey([]byte(password), salt, kdfIterations, kdfMemory, kdfParallelism, kdfKeyLength)
+	return new(big.Int).SetBytes(hashBytes(sha256.New, salt, key))
+}
+
+// Client is the client side of a single sign-in.
+type Client struct {
+	group       Group
+	password    string
+	a           *big.Int
+	publicA     *big.Int
+	serverProof []byte
+}
+
+// NewClient starts a sign-in with the given password.
+func NewClient(password string) (*Client, error) {
+	g := Group2048
+	a, err := randomExponent(g)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		group:    g,
+		password: password,
+		a:        a,
+		publicA:  new(big.Int).Exp(g.G, a, g.N),
+	}, nil
+}
+
+// PublicKey returns the public ephemeral A which is sent to the server.
+func (c *Client) PublicKey() []byte {
+	return pad(c.group, c.publicA)
+}
+
+// Proof computes the client proof M1 from the salt and the public ephemeral B received from the server.
+func (c *Client) Proof(salt, serverPublicKey []byte) ([]byte, error) {
+	g := c.group
+	publicB, err := parsePublicKey(g, serverPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	u := scramble(g, c.publicA, publicB)
+	if u.Sign() == 0 {
+		return nil, ErrInvalidPublicKey
+	}
+
+	// S = (B - k * g^x) ^ (a + u * x) mod N
+	x := deriveX(salt, c.password)
+	kgx := new(big.Int).Mul(multiplier(g), new(big.Int).Exp(g.G, x, g.N))
+	base := new(big.Int).Sub(publicB, kgx)
+	base.Mod(base, g.N)
+	exp := new(big.Int).Add(c.a, new(big.Int).Mul(u, x))
+	s := new(big.Int).Exp(base, exp, g.N)
+
+	m1, m2 := proofs(g, c.publicA, publicB, s)
+	c.serverProof = m2
+	return m1, nil
+}
+
+// VerifyServer checks the server proof M2, proving that the server knows the verifier.
+// It must be called after Proof.
+func (c *Client) VerifyServer(serverProof []byte) bool {
+	return c.serverProof != nil && subtle.ConstantTimeCompare(c.serverProof, serverProof) == 1
+}
+
+// Server is the server side of a single sign-in.
+// All values are computed in NewServer, so that only the proofs need to be kept until the client answers.
+type Server struct {
+	publicB     []byte
+	clientProof []byte
+	serverProof []byte
+}
+
+// NewServer answers the public ephemeral A of a client with the stored verifier.
+func NewServer(verifier, clientPublicKey []byte) (*Server, error) {
+	g := Group2048
+	publicA, err := parsePublicKey(g, clientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := randomExponent(g)
+	if err != nil {
+		return nil, err
+	}
+
+	// B = (k * v + g^b) mod N
+	v := new(big.Int).SetBytes(verifier)
+	publicB := new(big.Int).Mul(multiplier(g), v)
+	publicB.Add(publicB, new(big.Int).Exp(g.G, b, g.N))
+	publicB.Mod(publicB, g.N)
+
+	u := scramble(g, publicA, publicB)
+	if u.Sign() == 0 {
+		return nil, ErrInvalidPublicKey
+	}
+
+	// S = (A * v^u) ^ b mod N
+	base := new(big.Int).Mul(publicA, new(big.Int).Exp(v, u, g.N))
+	s := new(big.Int).Exp(base.Mod(base, g.N), b, g.N)
+
+	m1, m2 := proofs(g, publicA, publicB, s)
+	return &Server{publicB: pad(g, publicB), clientProof: m1, serverProof: m2}, nil
+}
+
+// PublicKey returns the public ephemeral B which is sent to the client.
+func (s *Server) PublicKey() []byte {
+	return s.publicB
+}
+
+// ClientProof returns the proof M1 the client must send.
+func (s *Server) ClientProof() []byte {
+	return s.clientProof
+}
+
+// ServerProof returns the proof M2 sent to the client after its proof has been accepted.
+func (s *Server) ServerProof() []byte {
+	return s.serverProof
+}
+
+// VerifyProof compares a received proof with the expected one in constant time.
+func VerifyProof(expected, actual []byte) bool {
+	return len(expected) > 0 && subtle.ConstantTimeCompare(expected, actual) == 1
+}
+
+// parsePublicKey parses a public ephemeral received from the other side. Keys longer than N, not less than N
+// or 0 mod N are rejected, the latter would let the other side force the session key.
+func parsePublicKey(g Group, key []byte) (*big.Int, error) {
+	if len(key) > len(pad(g, g.N)) {
+		return nil, ErrInvalidPublicKey
+	}
+	n := new(big.Int).SetBytes(key)
+	if n.Cmp(g.N) >= 0 || new(big.Int).Mod(n, g.N).Sign() == 0 {
+		return nil, ErrInvalidPublicKey
+	}
+	return n, nil
+}
+
+// multiplier returns k = H(N | PAD(g)).
+func multiplier(g Group) *big.Int {
+	return new(big.Int).SetBytes(hashBytes(sha256.New, g.N.Bytes(), pad(g, g.G)))
+}
+
+// scramble returns u = H(PAD(A) | PAD(B)).
+func scramble(g Group, publicA, publicB *big.Int) *big.Int {
+	return new(big.Int).SetBytes(hashBytes(sha256.New, pad(g, publicA), pad(g, publicB)))
+}
+
+// proofs returns M1 = H(PAD(A) | PAD(B) | K) and M2 = H(PAD(A) | M1 | K) with the session key K = H(PAD(S)).
+func proofs(g Group, publicA, publicB, s *big.Int) ([]byte, []byte) {
+	k := hashBytes(sha256.New, pad(g, s))
+	m1 := hashBytes(sha256.New, pad(g, publicA), pad(g, publicB), k)
+	m2 := hashBytes(sha256.New, pad(g, publicA), m1, k)
+	return m1, m2
+}
+
+// randomExponent returns a random secret ephemeral of 256 bits.
+func randomExponent(g Group) (*big.Int, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("read random ephemeral: %w", err)
+	}
+	n := new(big.Int).SetBytes(b)
+	return n.Mod(n, g.N), nil
+}
+
+// pad returns n as a big-endian byte slice of the length of N.
+func pad(g Group, n *big.Int) []byte {
+	return n.FillBytes(make([]byte, (g.N.BitLen()+7)/8))
+}
+
+func hashBytes(newHash func() hash.Hash, parts ...[]byte) []byte {
+	h := newHash()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
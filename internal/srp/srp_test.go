@@ -0,0 +1,93 @@
+package srp_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/srp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup2048IsSafePrime(t *testing.T) {
+	t.Parallel()
+	n := srp.Group2048.N
+	assert.Equal(t, 2048, n.BitLen())
+	assert.True(t, n.ProbablyPrime(20))
+	q := new(big.Int).Rsh(new(big.Int).Sub(n, big.NewInt(1)), 1)
+	assert.True(t, q.ProbablyPrime(20))
+}
+
+func TestSignIn(t *testing.T) {
+	t.Parallel()
+	salt, verifier, err := srp.NewVerifier("password")
+	require.NoError(t, err)
+
+	handshake := func(password string) (*srp.Client, *srp.Server, []byte) {
+		client, err := srp.NewClient(password)
+		require.NoError(t, err)
+		server, err := srp.NewServer(verifier, client.PublicKey())
+		require.NoError(t, err)
+		proof, err := client.Proof(salt, server.PublicKey())
+		require.NoError(t, err)
+		return client, server, proof
+	}
+
+	t.Run("valid password", func(t *testing.T) {
+		t.Parallel()
+		client, server, proof := handshake("password")
+		assert.True(t, srp.VerifyProof(server.ClientProof(), proof))
+		assert.True(t, client.VerifyServer(server.ServerProof()))
+	})
+
+	t.Run("invalid password", func(t *testing.T) {
+		t.Parallel()
+		client, server, proof := handshake("wrong password")
+		assert.False(t, srp.VerifyProof(server.ClientProof(), proof))
+		assert.False(t, client.VerifyServer(server.ServerProof()))
+	})
+
+	t.Run("invalid public keys", func(t *testing.T) {
+		t.Parallel()
+		_, err := srp.NewServer(verifier, srp.Group2048.N.Bytes())
+		assert.ErrorIs(t, err, srp.ErrInvalidPublicKey)
+		_, err = srp.NewServer(verifier, []byte{0})
+		assert.ErrorIs(t, err, srp.ErrInvalidPublicKey)
+
+		client, err := srp.NewClient("password")
+		require.NoError(t, err)
+		_, err = client.Proof(salt, srp.Group2048.N.Bytes())
+		assert.ErrorIs(t, err, srp.ErrInvalidPublicKey)
+		assert.False(t, client.VerifyServer(nil))
+	})
+
+	t.Run("out of range public keys", func(t *testing.T) {
+		t.Parallel()
+		oversized := make([]byte, 300)
+		oversized[0] = 1
+		nPlusOne := new(big.Int).Add(srp.Group2048.N, big.NewInt(1)).Bytes()
+		for _, key := range [][]byte{oversized, nPlusOne} {
+			_, err := srp.NewServer(verifier, key)
+			assert.ErrorIs(t, err, srp.ErrInvalidPublicKey)
+
+			client, err := srp.NewClient("password")
+			require.NoError(t, err)
+			_, err = client.Proof(salt, key)
+			assert.ErrorIs(t, err, srp.ErrInvalidPublicKey)
+		}
+	})
+}
+
+func TestValidateVerifier(t *testing.T) {
+	t.Parallel()
+	salt, verifier, err := srp.NewVerifier("password")
+	require.NoError(t, err)
+	assert.NoError(t, srp.ValidateVerifier(salt, verifier))
+
+	one := make([]byte, len(verifier))
+	one[len(one)-1] = 1
+	assert.ErrorIs(t, srp.ValidateVerifier(salt[:4], verifier), srp.ErrInvalidVerifier)
+	assert.ErrorIs(t, srp.ValidateVerifier(salt, verifier[1:]), srp.ErrInvalidVerifier)
+	assert.ErrorIs(t, srp.ValidateVerifier(salt, one), srp.ErrInvalidVerifier)
+	assert.ErrorIs(t, srp.ValidateVerifier(salt, srp.Group2048.N.Bytes()), srp.ErrInvalidVerifier)
+}
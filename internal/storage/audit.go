@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditSignIn        = "sign_in"        // A user signed in and a session was started.
+	AuditSignInFailed  = "sign_in_failed" // A sign-in was rejected, Detail holds the reason.
+	AuditVaultRead     = "vault_read"     // A vault entry was read.
+	AuditVaultCreate   = "vault_create"   // A vault entry was created.
+	AuditVaultUpdate   = "vault_update"   // A vault entry was updated.
+	AuditVaultExport   = "vault_export"   // All vault entries were exported to an archive, Detail holds their number.
+	AuditVaultImport   = "vault_import"   // Vault entries were imported from an archive, Detail holds the outcome.
+	AuditAccountDelete = "account_delete" // A user deleted their account with all vault entries.
+	AuditTokenCreate   = "token_create"   // A personal access token sharing vault entries was created, Detail holds its scope.
+	AuditTokenRevoke   = "token_revoke"   // A personal access token was revoked.
+
+	AuditAdminDisable        = "admin_disable"   // An administrator disabled the account, Detail holds the administrator's login.
+	AuditAdminEnable         = "admin_enable"    // An administrator enabled the account, Detail holds the administrator's login.
+	AuditAdminLogout         = "admin_logout"    // An administrator signed the user out, Detail holds the administrator's login.
+	AuditAdminResetTwoFactor = "admin_reset_2fa" // An administrator reset two-factor authentication, Detail holds the administrator's login.
+	AuditAdminJob            = "admin_job"       // An administrator ran a maintenance job, Detail holds its name.
+)
+
+// ErrAuditChainBroken is returned by VerifyAuditChain if a record of the audit log was changed, removed or reordered.
+var ErrAuditChainBroken = errors.New("audit log hash chain is broken")
+
+// AuditEvent is a record of the append-only audit log of security-relevant actions.
+// Every record holds the hash of the previous record, so that changing, removing or reordering records
+// breaks the chain of hashes.
+type AuditEvent struct {
+	ID        uint64    `json:"id"`                 // Sequence number of the record, assigned by the storage.
+	CreatedAt time.Time `json:"created_at"`         // Time of the action.
+	Action    string    `json:"action"`             // One of the Audit* actions.
+	UserID    uint64    `json:"user_id"`            // The user who acted, or whose account a failed sign-in targeted. 0 if unknown.
+	Login     string    `json:"login"`              // The login of the user at the time of the action.
+	TokenID   uint64    `json:"token_id,omitempty"` // The personal access token used, 0 for sign-in sessions.
+	VaultID   uint64    `json:"vault_id,omitempty"` // The vault entry accessed, 0 for other actions.
+	IP        string    `json:"ip"`                 // The client IP address.
+	UserAgent string    `json:"user_agent"`         // The client User-Agent header.
+	RequestID string    `json:"request_id"`         // The ID of the HTTP request, also found in the request logs.
+	Detail    string    `json:"detail,omitempty"`   // Additional information, such as the reason of a failed sign-in.
+	PrevHash  string    `json:"prev_hash"`          // Hex-encoded hash of the previous record, empty for the first one.
+	Hash      string    `json:"hash"`               // Hex-encoded SHA-256 hash of this record and PrevHash.
+}
+
+// ComputeHash returns the hex-encoded SHA-256 hash of the record chained to PrevHash.
+// All fields but ID and Hash are hashed, the time with microsecond precision in UTC.
+func (e AuditEvent) ComputeHash() string {
+	h := sha256.New()
+	fields := []string{
+		e.PrevHash,
+		e.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		e.Action,
+		strconv.FormatUint(e.UserID, 10),
+		e.Login,
+		strconv.FormatUint(e.TokenID, 10),
+		strconv.FormatUint(e.VaultID, 10),
+		e.IP,
+		e.UserAgent,
+		e.RequestID,
+		e.Detail,
+	}
+	// Every field is prefixed with its length, so that moving bytes between fields changes the hash.
+	var length [8]byte
+	for _, f := range fields {
+		binary.BigEndian.PutUint64(length[:], uint64(len(f)))
+		h.Write(length[:])
+		h.Write([]byte(f))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ChainAuditEvent links a new record to the latest record of the log.
+// It takes the new record and the hash of the latest record, empty if the log is empty.
+// Returns the record with the time rounded to the precision of the storage, PrevHash and Hash set.
+func ChainAuditEvent(e AuditEvent, prevHash string) AuditEvent {
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+	e.PrevHash = prevHash
+	e.Hash = e.ComputeHash()
+	return e
+}
+
+// VerifyAuditChain checks that consecutive records of the audit log, oldest first, are chained.
+// It takes the hash of the record preceding the first one, empty if they start the log, and the records.
+// Returns the hash of the last record, to continue the verification with the following records,
+// and an error wrapping ErrAuditChainBroken with the ID of the first invalid record.
+func VerifyAuditChain(prevHash string, events []AuditEvent) (string, error) {
+	for _, e := range events {
+		if e.PrevHash != prevHash {
+			return prevHash, fmt.Errorf("%w: record %d does not follow the previous record", ErrAuditChainBroken, e.ID)
+		}
+		if e.ComputeHash() != e.Hash {
+			return prevHash, fmt.Errorf("%w: record %d was modified", ErrAuditChainBroken, e.ID)
+		}
+		prevHash = e.Hash
+	}
+	return prevHash, nil
+}
+
+// VerifyAuditLog reads the whole audit log, oldest first, and verifies its chain of hashes.
+// It takes a context.Context, the AuditStorage and the number of records to read at once as parameters.
+// Returns the number of verified records, the hash of the latest one and an error if any.
+func VerifyAuditLog(ctx context.Context, s AuditStorage, pageSize int) (int, string, error) {
+	n := 0
+	lastHash := ""
+	var afterID uint64
+	for {
+		events, err := s.ExportAuditEvents(ctx, afterID, pageSize)
+		if err != nil {
+			return n, lastHash, err
+		}
+		if len(events) == 0 {
+			return n, lastHash, nil
+		}
+		lastHash, err = VerifyAuditChain(lastHash, events)
+		if err != nil {
+			return n, lastHash, err
+		}
+		n += len(events)
+		afterID = events[len(events)-1].ID
+	}
+}
+
+// AuditStorage defines the interface for the append-only audit log.
+// Implementations must append records atomically, so that the chain of hashes has no forks
+// when several server replicas append at the same time.
+type AuditStorage interface {
+	// AppendAuditEvent chains a record to the latest record of the log with ChainAuditEvent and appends it.
+	// Takes a context.Context and an AuditEvent object as parameters.
+	// Returns the stored AuditEvent and an error if any.
+	AppendAuditEvent(ctx context.Context, e AuditEvent) (AuditEvent, error)
+
+	// ListAuditEvents retrieves the records of a user, newest first.
+	// Takes a context.Context, the user's ID (uint64), the ID of the record to list the older records of
+	// (0 to start with the newest) and the maximum number of records as parameters.
+	// Returns the list of AuditEvent and an error if any.
+	ListAuditEvents(ctx context.Context, userID, beforeID uint64, limit int) ([]AuditEvent, error)
+
+	// ExportAuditEvents retrieves the records of all users in the order of the chain, oldest first.
+	// Takes a context.Context, the ID of the record to list the newer records of (0 to start with the oldest)
+	// and the maximum number of records as parameters.
+	// Returns the list of AuditEvent and an error if any.
+	ExportAuditEvents(ctx context.Context, afterID uint64, limit int) ([]AuditEvent, error)
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/andreevym/gophkeeper/internal/backup"
+)
+
+// ErrNotEmpty is returned by BackupStorage.Restore if the storage already holds data.
+var ErrNotEmpty = errors.New("database is not empty")
+
+// BackupStorage defines the interface for backing up the whole storage and restoring it.
+// Backups hold the users, their vault entries with their values, access tokens, sessions, quotas and the audit
+// log, and are only restored into a storage of the same kind.
+type BackupStorage interface {
+	// Backup writes a consistent, encrypted backup of the storage.
+	// Takes a context.Context, the writer and the passphrase (string) as parameters.
+	// Returns the backup.Summary of the backup and an error if any.
+	Backup(ctx context.Context, w io.Writer, passphrase string) (backup.Summary, error)
+
+	// Restore restores a backup into the storage, which must be empty. The backup is verified while it is
+	// restored, nothing is restored from a backup which is damaged.
+	// Takes a context.Context, the reader and the passphrase (string) as parameters.
+	// Returns the backup.Summary of the backup and an error if any.
+	Restore(ctx context.Context, r io.Reader, passphrase string) (backup.Summary, error)
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// BlobStore stores the values of vault entries outside the database, e.g. in a directory or an S3 bucket,
+// while the metadata of the entries stays in the database.
+// Blobs are immutable: a changed value is stored as a new blob and the old one is deleted.
+type BlobStore interface {
+	// CreateBlob stores the content read from r as a new blob.
+	// Takes a context.Context, the reader and the size of the content (int64), -1 if unknown, as parameters.
+	// Returns the key of the new blob and an error if any.
+	CreateBlob(ctx context.Context, r io.Reader, size int64) (string, error)
+
+	// OpenBlob opens a blob for reading, the caller must close the returned reader.
+	// Takes a context.Context and the blob's key (string) as parameters.
+	// Returns the reader and an error if any.
+	OpenBlob(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// DeleteBlob removes a blob. Deleting a blob which doesn't exist is not an error.
+	// Takes a context.Context and the blob's key (string) as parameters.
+	// Returns an error if any.
+	DeleteBlob(ctx context.Context, key string) error
+}
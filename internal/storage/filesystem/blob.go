@@ -0,0 +1,107 @@
+// Package filesystem provides a storage.BlobStore keeping blobs as files in a local directory.
+package filesystem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// keyLength is the number of random bytes of a blob key.
+const keyLength = 16
+
+// BlobStore keeps blobs as files in a directory. Files are spread over subdirectories
+// named after the first two characters of their key, so that no directory grows too large.
+type BlobStore struct {
+	dir string
+}
+
+// NewBlobStore creates a new instance of BlobStore, creating the directory if needed.
+// Only the owner of the process can access the files.
+func NewBlobStore(dir string) (*BlobStore, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob directory %s: %w", dir, err)
+	}
+	return &BlobStore{dir: dir}, nil
+}
+
+// CreateBlob writes the content to a temporary file which is renamed to a random key once it is complete,
+// so a blob is never visible partially written.
+func (s *BlobStore) CreateBlob(_ context.Context, r io.Reader, _ int64) (string, error) {
+	b := make([]byte, keyLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate blob key: %w", err)
+	}
+	key := hex.EncodeToString(b)
+	path := s.path(key)
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return "", fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+	return key, nil
+}
+
+// OpenBlob opens the file of the blob.
+func (s *BlobStore) OpenBlob(_ context.Context, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, fmt.Errorf("invalid blob key %q", key)
+	}
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// DeleteBlob removes the file of the blob.
+func (s *BlobStore) DeleteBlob(_ context.Context, key string) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	err := os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob %s: %w", key, err)
+	}
+	return nil
+}
+
+// path returns the path of the file of the blob.
+func (s *BlobStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+// validKey reports whether the key can have been created by CreateBlob,
+// so that keys from the database can't point outside of the directory.
+func validKey(key string) bool {
+	b, err := hex.DecodeString(key)
+	return err == nil && len(b) == keyLength
+}
@@ -0,0 +1,35 @@
+package filesystem_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/storage/filesystem"
+	"github.com/andreevym/gophkeeper/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobStore(t *testing.T) {
+	blobs, err := filesystem.NewBlobStore(filepath.Join(t.TempDir(), "blobs"))
+	require.NoError(t, err)
+	storagetest.RunBlobStore(t, blobs)
+}
+
+func TestBlobStoreInvalidKey(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0o600))
+	blobs, err := filesystem.NewBlobStore(filepath.Join(dir, "blobs"))
+	require.NoError(t, err)
+
+	// Keys which weren't created by the store can't reach files outside of its directory.
+	for _, key := range []string{"", "../secret", "../../secret", "00/../../secret", "ab"} {
+		_, err = blobs.OpenBlob(context.Background(), key)
+		assert.Error(t, err, key)
+		assert.Error(t, blobs.DeleteBlob(context.Background(), key), key)
+	}
+	assert.FileExists(t, secret)
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// AuditStorage keeps the audit log in memory. It is safe for concurrent use.
+type AuditStorage struct {
+	mu     sync.Mutex
+	events []storage.AuditEvent
+}
+
+// NewAuditStorage creates a new, empty instance of AuditStorage.
+func NewAuditStorage() *AuditStorage {
+	return &AuditStorage{}
+}
+
+// AppendAuditEvent chains the record to the latest record of the log and appends it.
+func (s *AuditStorage) AppendAuditEvent(_ context.Context, e storage.AuditEvent) (storage.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prevHash := ""
+	if len(s.events) > 0 {
+		prevHash = s.events[len(s.events)-1].Hash
+	}
+	e = storage.ChainAuditEvent(e, prevHash)
+	e.ID = uint64(len(s.events)) + 1
+	s.events = append(s.events, e)
+	return e, nil
+}
+
+// ListAuditEvents retrieves the records of the user older than beforeID, newest first.
+func (s *AuditStorage) ListAuditEvents(_ context.Context, userID, beforeID uint64, limit int) ([]storage.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]storage.AuditEvent, 0)
+	for i := len(s.events) - 1; i >= 0 && len(events) < limit; i-- {
+		e := s.events[i]
+		if e.UserID == userID && (beforeID == 0 || e.ID < beforeID) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// ExportAuditEvents retrieves the records of all users newer than afterID, oldest first.
+func (s *AuditStorage) ExportAuditEvents(_ context.Context, afterID uint64, limit int) ([]storage.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]storage.AuditEvent, 0)
+	// Records are stored in the order of their IDs, which start with 1.
+	for i := afterID; i < uint64(len(s.events)) && len(events) < limit; i++ {
+		events = append(events, s.events[i])
+	}
+	return events, nil
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"context"
+)
+
+// DB stands in for the database connection when all storages are kept in memory.
+// It implements the ping of handlers.DBClient and is always reachable.
+type DB struct{}
+
+// PingContext always succeeds.
+func (DB) PingContext(context.Context) error {
+	return nil
+}
@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+type oidcIdentityKey struct {
+	issuer  string
+	subject string
+}
+
+// OIDCStorage keeps pending OIDC sign-ins and identity links in memory. It is safe for concurrent use.
+type OIDCStorage struct {
+	mu         sync.Mutex
+	logins     map[string]storage.OIDCLogin
+	identities map[oidcIdentityKey]uint64
+}
+
+// NewOIDCStorage creates a new, empty instance of OIDCStorage.
+func NewOIDCStorage() *OIDCStorage {
+	return &OIDCStorage{
+		logins:     make(map[string]storage.OIDCLogin),
+		identities: make(map[oidcIdentityKey]uint64),
+	}
+}
+
+// CreateOIDCLogin stores a new pending sign-in and removes expired ones.
+func (s *OIDCStorage) CreateOIDCLogin(_ context.Context, l storage.OIDCLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for hash, existing := range s.logins {
+		if existing.ExpiresAt.Before(now) {
+			delete(s.logins, hash)
+		}
+	}
+	s.logins[l.DeviceCodeHash] = l
+	return nil
+}
+
+// GetOIDCLogin retrieves a sign-in by the hash of its device code.
+// If the sign-in is not found, it returns storage.ErrOIDCLoginNotFound.
+func (s *OIDCStorage) GetOIDCLogin(_ context.Context, deviceCodeHash string) (storage.OIDCLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.logins[deviceCodeHash]
+	if !ok {
+		return storage.OIDCLogin{}, storage.ErrOIDCLoginNotFound
+	}
+	return l, nil
+}
+
+// GetOIDCLoginByState retrieves a sign-in by its state parameter.
+// If the sign-in is not found, it returns storage.ErrOIDCLoginNotFound.
+func (s *OIDCStorage) GetOIDCLoginByState(_ context.Context, state string) (storage.OIDCLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range s.logins {
+		if l.State == state {
+			return l, nil
+		}
+	}
+	return storage.OIDCLogin{}, storage.ErrOIDCLoginNotFound
+}
+
+// GetOIDCLoginByUserCode retrieves a sign-in by the hash of its user code.
+// If the sign-in is not found, it returns storage.ErrOIDCLoginNotFound.
+func (s *OIDCStorage) GetOIDCLoginByUserCode(_ context.Context, userCodeHash string) (storage.OIDCLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range s.logins {
+		if l.UserCodeHash == userCodeHash {
+			return l, nil
+		}
+	}
+	return storage.OIDCLogin{}, storage.ErrOIDCLoginNotFound
+}
+
+// ApproveOIDCLogin records the browser which approved a sign-in and reports whether it was not approved before.
+func (s *OIDCStorage) ApproveOIDCLogin(_ context.Context, userCodeHash, browserHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, l := range s.logins {
+		if l.UserCodeHash == userCodeHash {
+			if l.BrowserHash != "" {
+				return false, nil
+			}
+			l.BrowserHash = browserHash
+			s.logins[hash] = l
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CompleteOIDCLogin records the user who signed in at the provider.
+// If the sign-in is not found, it returns storage.ErrOIDCLoginNotFound.
+func (s *OIDCStorage) CompleteOIDCLogin(_ context.Context, state string, userID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, l := range s.logins {
+		if l.State == state {
+			l.UserID = userID
+			s.logins[hash] = l
+			return nil
+		}
+	}
+	return storage.ErrOIDCLoginNotFound
+}
+
+// DeleteOIDCLogin removes a sign-in by the hash of its device code and reports whether it existed.
+func (s *OIDCStorage) DeleteOIDCLogin(_ context.Context, deviceCodeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.logins[deviceCodeHash]
+	delete(s.logins, deviceCodeHash)
+	return ok, nil
+}
+
+// GetOIDCIdentity retrieves the ID of the user linked to an identity of the provider.
+// If the identity is not linked, it returns storage.ErrOIDCIdentityNotFound.
+func (s *OIDCStorage) GetOIDCIdentity(_ context.Context, issuer, subject string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, ok := s.identities[oidcIdentityKey{issuer: issuer, subject: subject}]
+	if !ok {
+		return 0, storage.ErrOIDCIdentityNotFound
+	}
+	return userID, nil
+}
+
+// CreateOIDCIdentity links an identity of the provider to a user.
+func (s *OIDCStorage) CreateOIDCIdentity(_ context.Context, issuer, subject string, userID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.identities[oidcIdentityKey{issuer: issuer, subject: subject}] = userID
+	return nil
+}
@@ -0,0 +1,26 @@
+package memory
+
+import "github.com/andreevym/gophkeeper/internal/storage"
+
+// Option configures VaultStorage.
+type Option func(*options)
+
+type options struct {
+	defaultQuota storage.Quota
+}
+
+// WithDefaultQuota sets the quota of users without a quota set with VaultStorage.SetQuota.
+// Without it, the storage of users is only limited by their own quota.
+func WithDefaultQuota(q storage.Quota) Option {
+	return func(o *options) {
+		o.defaultQuota = q
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
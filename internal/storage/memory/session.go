@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// SessionStorage keeps sign-in sessions in memory. It is safe for concurrent use.
+type SessionStorage struct {
+	mu       sync.Mutex
+	sessions map[uint64]storage.Session
+	nextID   uint64
+}
+
+// NewSessionStorage creates a new, empty instance of SessionStorage.
+func NewSessionStorage() *SessionStorage {
+	return &SessionStorage{sessions: make(map[uint64]storage.Session)}
+}
+
+// GetSession retrieves a session by its ID.
+// If the session is not found, it returns storage.ErrSessionNotFound.
+func (s *SessionStorage) GetSession(_ context.Context, id uint64) (storage.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return storage.Session{}, storage.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// ListSessions retrieves the sessions of the user which are not revoked, most recently seen first.
+func (s *SessionStorage) ListSessions(_ context.Context, userID uint64) ([]storage.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]storage.Session, 0)
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastSeenAt.Equal(sessions[j].LastSeenAt) {
+			return sessions[i].ID > sessions[j].ID
+		}
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// CreateSession stores a new session.
+func (s *SessionStorage) CreateSession(_ context.Context, session storage.Session) (storage.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	session.ID = s.nextID
+	session.LastSeenAt = session.CreatedAt
+	s.sessions[session.ID] = session
+	return session, nil
+}
+
+// TouchSession updates the last-seen time of the session.
+func (s *SessionStorage) TouchSession(_ context.Context, id uint64, seenAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	session.LastSeenAt = seenAt
+	s.sessions[id] = session
+	return nil
+}
+
+// RevokeSession marks the session as revoked. Revoking an already revoked session keeps the original revocation time.
+func (s *SessionStorage) RevokeSession(_ context.Context, id uint64, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return storage.ErrSessionNotFound
+	}
+	if session.RevokedAt == nil {
+		session.RevokedAt = &revokedAt
+		s.sessions[id] = session
+	}
+	return nil
+}
+
+// RevokeOtherSessions marks all active sessions of the user except keepID as revoked.
+func (s *SessionStorage) RevokeOtherSessions(_ context.Context, userID, keepID uint64, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserID == userID && id != keepID && session.RevokedAt == nil {
+			session.RevokedAt = &revokedAt
+			s.sessions[id] = session
+		}
+	}
+	return nil
+}
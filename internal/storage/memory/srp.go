@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// SRPHandshakeStorage keeps zero-knowledge sign-in handshakes in memory. It is safe for concurrent use.
+type SRPHandshakeStorage struct {
+	mu         sync.Mutex
+	handshakes map[string]storage.SRPHandshake
+}
+
+// NewSRPHandshakeStorage creates a new, empty instance of SRPHandshakeStorage.
+func NewSRPHandshakeStorage() *SRPHandshakeStorage {
+	return &SRPHandshakeStorage{handshakes: make(map[string]storage.SRPHandshake)}
+}
+
+// CreateSRPHandshake stores a new handshake and removes expired ones.
+func (s *SRPHandshakeStorage) CreateSRPHandshake(_ context.Context, h storage.SRPHandshake) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range s.handshakes {
+		if existing.ExpiresAt.Before(now) {
+			delete(s.handshakes, id)
+		}
+	}
+	s.handshakes[h.ID] = h
+	return nil
+}
+
+// TakeSRPHandshake removes the handshake with the given ID and returns it.
+// If the handshake is not found, it returns storage.ErrSRPHandshakeNotFound.
+func (s *SRPHandshakeStorage) TakeSRPHandshake(_ context.Context, id string) (storage.SRPHandshake, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.handshakes[id]
+	if !ok {
+		return storage.SRPHandshake{}, storage.ErrSRPHandshakeNotFound
+	}
+	delete(s.handshakes, id)
+	return h, nil
+}
@@ -0,0 +1,19 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/andreevym/gophkeeper/internal/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	t.Parallel()
+	vaultStorage := memory.NewVaultStorage()
+	storagetest.Run(t, storagetest.Backend{
+		Users:  memory.NewUserStorage(vaultStorage, memory.NewTokenStorage()),
+		Vaults: vaultStorage,
+		Quotas: vaultStorage,
+		Audit:  memory.NewAuditStorage(),
+	})
+}
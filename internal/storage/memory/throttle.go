@@ -0,0 +1,128 @@
+// Package memory provides in-memory storage implementations for single-node deployments and tests.
+// The data is lost when the process exits.
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// ThrottleStorage keeps the sign-in throttling state and the failed sign-in log in memory.
+// It is safe for concurrent use but not shared between server replicas.
+type ThrottleStorage struct {
+	mu       sync.Mutex
+	states   map[string]storage.ThrottleState
+	attempts []storage.FailedSignIn
+	nextID   uint64
+}
+
+// NewThrottleStorage creates a new, empty instance of ThrottleStorage.
+func NewThrottleStorage() *ThrottleStorage {
+	return &ThrottleStorage{states: make(map[string]storage.ThrottleState)}
+}
+
+// ReserveThrottle counts a sign-in attempt in progress for a key,
+// forgetting pending attempts reserved longer than timeout ago.
+func (s *ThrottleStorage) ReserveThrottle(_ context.Context, key string, now time.Time, timeout time.Duration) (storage.ThrottleState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[key]
+	if !ok {
+		state = storage.ThrottleState{Key: key}
+	}
+	if state.ReservedAt.Before(now.Add(-timeout)) {
+		state.Pending = 0
+	}
+	state.Pending++
+	state.ReservedAt = now
+	s.states[key] = state
+	return state, nil
+}
+
+// ReleaseThrottle ends an attempt reserved with ReserveThrottle,
+// deleting the state of the key once it has neither failures nor pending attempts.
+func (s *ThrottleStorage) ReleaseThrottle(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[key]
+	if !ok {
+		return nil
+	}
+	if state.Pending > 0 {
+		state.Pending--
+	}
+	if state.Failures == 0 && state.Pending == 0 {
+		delete(s.states, key)
+		return nil
+	}
+	s.states[key] = state
+	return nil
+}
+
+// AddThrottleFailure increments the failure counter of a key,
+// starting over if the previous failure is older than window.
+func (s *ThrottleStorage) AddThrottleFailure(_ context.Context, key string, now time.Time, window time.Duration) (storage.ThrottleState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[key]
+	if !ok {
+		state = storage.ThrottleState{Key: key}
+	}
+	if state.LastFailureAt.Before(now.Add(-window)) {
+		state.Failures = 0
+	}
+	state.Failures++
+	state.LastFailureAt = now
+	s.states[key] = state
+	return state, nil
+}
+
+// ResetThrottle deletes the state of a key.
+func (s *ThrottleStorage) ResetThrottle(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.states, key)
+	return nil
+}
+
+// CreateFailedSignIn appends a failed sign-in attempt to the log.
+func (s *ThrottleStorage) CreateFailedSignIn(_ context.Context, a storage.FailedSignIn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	a.ID = s.nextID
+	s.attempts = append(s.attempts, a)
+	return nil
+}
+
+// ListFailedSignIns retrieves the most recent failed sign-in attempts against the user, newest first.
+func (s *ThrottleStorage) ListFailedSignIns(_ context.Context, userID uint64, limit int) ([]storage.FailedSignIn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := make([]storage.FailedSignIn, 0)
+	for _, a := range s.attempts {
+		if a.UserID == userID {
+			attempts = append(attempts, a)
+		}
+	}
+	sort.SliceStable(attempts, func(i, j int) bool {
+		if attempts[i].CreatedAt.Equal(attempts[j].CreatedAt) {
+			return attempts[i].ID > attempts[j].ID
+		}
+		return attempts[i].CreatedAt.After(attempts[j].CreatedAt)
+	})
+	if limit >= 0 && len(attempts) > limit {
+		attempts = attempts[:limit]
+	}
+	return attempts, nil
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// TokenStorage keeps personal access tokens in memory. It is safe for concurrent use.
+type TokenStorage struct {
+	mu     sync.Mutex
+	tokens map[uint64]storage.AccessToken
+	nextID uint64
+}
+
+// NewTokenStorage creates a new, empty instance of TokenStorage.
+func NewTokenStorage() *TokenStorage {
+	return &TokenStorage{tokens: make(map[uint64]storage.AccessToken)}
+}
+
+// GetToken retrieves a token by its ID.
+// If the token is not found, it returns storage.ErrTokenNotFound.
+func (s *TokenStorage) GetToken(_ context.Context, id uint64) (storage.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return storage.AccessToken{}, storage.ErrTokenNotFound
+	}
+	return cloneToken(t), nil
+}
+
+// GetTokenByHash retrieves a token by the hash of its plain value.
+// If the token is not found, it returns storage.ErrTokenNotFound.
+func (s *TokenStorage) GetTokenByHash(_ context.Context, hash string) (storage.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.Hash == hash {
+			return cloneToken(t), nil
+		}
+	}
+	return storage.AccessToken{}, storage.ErrTokenNotFound
+}
+
+// ListTokens retrieves all tokens issued by the user ordered by creation.
+func (s *TokenStorage) ListTokens(_ context.Context, userID uint64) ([]storage.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := make([]storage.AccessToken, 0)
+	for _, t := range s.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, cloneToken(t))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+// CreateToken stores a new token.
+func (s *TokenStorage) CreateToken(_ context.Context, t storage.AccessToken) (storage.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	t.ID = s.nextID
+	t.CreatedAt = time.Now()
+	s.tokens[t.ID] = cloneToken(t)
+	return t, nil
+}
+
+// TouchToken updates the last-used timestamp of the token.
+func (s *TokenStorage) TouchToken(_ context.Context, id uint64, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil
+	}
+	t.LastUsedAt = &usedAt
+	s.tokens[id] = t
+	return nil
+}
+
+// RevokeToken marks the token as revoked. Revoking an already revoked token keeps the original revocation time.
+func (s *TokenStorage) RevokeToken(_ context.Context, id uint64, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return storage.ErrTokenNotFound
+	}
+	if t.RevokedAt == nil {
+		t.RevokedAt = &revokedAt
+		s.tokens[id] = t
+	}
+	return nil
+}
+
+// deleteUserTokens removes all tokens of the user.
+func (s *TokenStorage) deleteUserTokens(userID uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.tokens {
+		if t.UserID == userID {
+			delete(s.tokens, id)
+		}
+	}
+}
+
+// cloneToken copies the token so callers can't modify the stored one.
+func cloneToken(t storage.AccessToken) storage.AccessToken {
+	t.VaultIDs = slices.Clone(t.VaultIDs)
+	return t
+}
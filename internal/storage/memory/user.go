@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// UserStorage keeps users in memory. It is safe for concurrent use.
+type UserStorage struct {
+	mu     sync.Mutex
+	users  map[uint64]storage.User
+	nextID uint64
+
+	vaults *VaultStorage
+	tokens *TokenStorage
+}
+
+// NewUserStorage creates a new, empty instance of UserStorage.
+// Deleting a user also deletes their vault entries and personal access tokens from the given storages,
+// either of which may be nil.
+func NewUserStorage(vaults *VaultStorage, tokens *TokenStorage) *UserStorage {
+	return &UserStorage{users: make(map[uint64]storage.User), vaults: vaults, tokens: tokens}
+}
+
+// GetUser retrieves a user by their ID.
+// If the user is not found, it returns storage.ErrUserNotFound.
+func (s *UserStorage) GetUser(_ context.Context, id uint64) (storage.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return storage.User{}, storage.ErrUserNotFound
+	}
+	return cloneUser(u), nil
+}
+
+// GetUserByLogin retrieves a user by their login, ignoring case.
+// If the user is not found, it returns storage.ErrUserNotFound.
+func (s *UserStorage) GetUserByLogin(_ context.Context, login string) (storage.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found, ok := s.userByLogin(login)
+	if !ok {
+		return storage.User{}, storage.ErrUserNotFound
+	}
+	return cloneUser(found), nil
+}
+
+// ListUsers retrieves the users whose login contains the query ignoring case, ordered by ID.
+func (s *UserStorage) ListUsers(_ context.Context, query string, afterID uint64, limit int) ([]storage.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query = strings.ToLower(query)
+	users := []storage.User{}
+	for _, u := range s.users {
+		if u.ID > afterID && strings.Contains(strings.ToLower(u.Login), query) {
+			users = append(users, cloneUser(u))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// CreateUser stores a new user.
+// If the login is taken ignoring case, it returns storage.ErrLoginTaken.
+func (s *UserStorage) CreateUser(_ context.Context, u storage.User) (storage.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.userByLogin(u.Login); ok {
+		return u, storage.ErrLoginTaken
+	}
+	if u.Role == "" {
+		u.Role = storage.RoleUser
+	}
+	s.nextID++
+	u.ID = s.nextID
+	u.Revision = 0
+	s.users[u.ID] = cloneUser(u)
+	return u, nil
+}
+
+// UpdateUser replaces an existing user if its revision is still the one of the user.
+// If the login is taken by another user ignoring case, it returns storage.ErrLoginTaken.
+// If the user was changed or deleted since it was read, it returns storage.ErrUserConflict.
+func (s *UserStorage) UpdateUser(_ context.Context, u storage.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[u.ID]
+	if !ok || stored.Revision != u.Revision {
+		return storage.ErrUserConflict
+	}
+	if other, ok := s.userByLogin(u.Login); ok && other.ID != u.ID {
+		return storage.ErrLoginTaken
+	}
+	u.Revision++
+	s.users[u.ID] = cloneUser(u)
+	return nil
+}
+
+// userByLogin returns the user with the login ignoring case, the caller must hold the lock.
+func (s *UserStorage) userByLogin(login string) (storage.User, bool) {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Login, login) {
+			return u, true
+		}
+	}
+	return storage.User{}, false
+}
+
+// DeleteUser removes a user by their ID together with their vault entries and personal access tokens.
+func (s *UserStorage) DeleteUser(_ context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.vaults != nil {
+		s.vaults.deleteUserVaults(id)
+	}
+	if s.tokens != nil {
+		s.tokens.deleteUserTokens(id)
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// cloneUser copies the user so callers can't modify the stored one.
+func cloneUser(u storage.User) storage.User {
+	u.RecoveryCodes = slices.Clone(u.RecoveryCodes)
+	u.SRPSalt = bytes.Clone(u.SRPSalt)
+	u.SRPVerifier = bytes.Clone(u.SRPVerifier)
+	return u
+}
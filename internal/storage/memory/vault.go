@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// VaultStorage keeps vault entries in memory. It is safe for concurrent use.
+// VaultStorage also implements storage.QuotaStorage, creating and updating vaults checks the quota of the owner.
+type VaultStorage struct {
+	mu           sync.Mutex
+	vaults       map[uint64]storage.Vault
+	nextID       uint64
+	quotas       map[uint64]storage.Quota
+	defaultQuota storage.Quota
+}
+
+// NewVaultStorage creates a new, empty instance of VaultStorage.
+func NewVaultStorage(opts ...Option) *VaultStorage {
+	o := newOptions(opts)
+	return &VaultStorage{
+		vaults:       make(map[uint64]storage.Vault),
+		quotas:       make(map[uint64]storage.Quota),
+		defaultQuota: o.defaultQuota,
+	}
+}
+
+// GetVault retrieves a vault by its ID.
+// If the vault is not found, it returns storage.ErrVaultNotFound.
+func (s *VaultStorage) GetVault(_ context.Context, id uint64) (storage.Vault, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.vaults[id]
+	if !ok {
+		return storage.Vault{}, storage.ErrVaultNotFound
+	}
+	v.Value = bytes.Clone(v.Value)
+	return v, nil
+}
+
+// CreateVault stores a new vault.
+// If the vault doesn't fit into the quota of the user, it returns storage.ErrQuotaExceeded or storage.ErrEntryTooLarge.
+func (s *VaultStorage) CreateVault(_ context.Context, v storage.Vault) (storage.Vault, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := int64(len(v.Value))
+	err := storage.CheckQuota(s.quota(v.UserID), s.usage(v.UserID), size, storage.Usage{Bytes: size, Entries: 1})
+	if err != nil {
+		return storage.Vault{}, err
+	}
+	s.nextID++
+	v.ID = s.nextID
+	stored := v
+	stored.Value = bytes.Clone(v.Value)
+	s.vaults[v.ID] = stored
+	return v, nil
+}
+
+// UpdateVault replaces the key and the value of the vault. The owner of the vault can't be changed.
+// If the new value doesn't fit into the quota of the owner, it returns storage.ErrQuotaExceeded or storage.ErrEntryTooLarge.
+func (s *VaultStorage) UpdateVault(_ context.Context, v storage.Vault) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.vaults[v.ID]
+	if !ok {
+		return nil
+	}
+	size := int64(len(v.Value))
+	err := storage.CheckQuota(s.quota(stored.UserID), s.usage(stored.UserID), size, storage.Usage{Bytes: size - int64(len(stored.Value))})
+	if err != nil {
+		return err
+	}
+	stored.Key = v.Key
+	stored.Value = bytes.Clone(v.Value)
+	s.vaults[v.ID] = stored
+	return nil
+}
+
+// DeleteVault removes a vault by its ID.
+func (s *VaultStorage) DeleteVault(_ context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.vaults, id)
+	return nil
+}
+
+// ListVaults retrieves the vaults of a user without their values, ordered by ID.
+func (s *VaultStorage) ListVaults(_ context.Context, userID uint64) ([]storage.Vault, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vaults := []storage.Vault{}
+	for _, v := range s.vaults {
+		if v.UserID == userID {
+			v.Value = nil
+			vaults = append(vaults, v)
+		}
+	}
+	sort.Slice(vaults, func(i, j int) bool { return vaults[i].ID < vaults[j].ID })
+	return vaults, nil
+}
+
+// GetUsage retrieves the vault storage used by a user.
+func (s *VaultStorage) GetUsage(_ context.Context, userID uint64) (storage.Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.usage(userID), nil
+}
+
+// GetQuota retrieves the quota of a user, the default quota set with WithDefaultQuota unless overridden.
+func (s *VaultStorage) GetQuota(_ context.Context, userID uint64) (storage.Quota, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.quota(userID), nil
+}
+
+// SetQuota overrides the default quota for a user.
+func (s *VaultStorage) SetQuota(_ context.Context, userID uint64, q storage.Quota) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quotas[userID] = q
+	return nil
+}
+
+// DeleteQuota removes the quota of a user set with SetQuota.
+func (s *VaultStorage) DeleteQuota(_ context.Context, userID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.quotas, userID)
+	return nil
+}
+
+// usage sums up the vaults of the user, the caller must hold the lock.
+func (s *VaultStorage) usage(userID uint64) storage.Usage {
+	var u storage.Usage
+	for _, v := range s.vaults {
+		if v.UserID == userID {
+			u.Entries++
+			u.Bytes += int64(len(v.Value))
+		}
+	}
+	return u
+}
+
+// quota returns the quota of the user, the caller must hold the lock.
+func (s *VaultStorage) quota(userID uint64) storage.Quota {
+	if q, ok := s.quotas[userID]; ok {
+		return q
+	}
+	return s.defaultQuota
+}
+
+// deleteUserVaults removes all vaults and the quota of the user.
+func (s *VaultStorage) deleteUserVaults(userID uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.quotas, userID)
+	for id, v := range s.vaults {
+		if v.UserID == userID {
+			delete(s.vaults, id)
+		}
+	}
+}
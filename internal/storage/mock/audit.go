@@ -0,0 +1,81 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: audit.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	storage "github.com/andreevym/gophkeeper/internal/storage"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockAuditStorage is a mock of AuditStorage interface.
+type MockAuditStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditStorageMockRecorder
+}
+
+// MockAuditStorageMockRecorder is the mock recorder for MockAuditStorage.
+type MockAuditStorageMockRecorder struct {
+	mock *MockAuditStorage
+}
+
+// NewMockAuditStorage creates a new mock instance.
+func NewMockAuditStorage(ctrl *gomock.Controller) *MockAuditStorage {
+	mock := &MockAuditStorage{ctrl: ctrl}
+	mock.recorder = &MockAuditStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditStorage) EXPECT() *MockAuditStorageMockRecorder {
+	return m.recorder
+}
+
+// AppendAuditEvent mocks base method.
+func (m *MockAuditStorage) AppendAuditEvent(ctx context.Context, e storage.AuditEvent) (storage.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendAuditEvent", ctx, e)
+	ret0, _ := ret[0].(storage.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AppendAuditEvent indicates an expected call of AppendAuditEvent.
+func (mr *MockAuditStorageMockRecorder) AppendAuditEvent(ctx, e interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendAuditEvent", reflect.TypeOf((*MockAuditStorage)(nil).AppendAuditEvent), ctx, e)
+}
+
+// ExportAuditEvents mocks base method.
+func (m *MockAuditStorage) ExportAuditEvents(ctx context.Context, afterID uint64, limit int) ([]storage.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportAuditEvents", ctx, afterID, limit)
+	ret0, _ := ret[0].([]storage.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportAuditEvents indicates an expected call of ExportAuditEvents.
+func (mr *MockAuditStorageMockRecorder) ExportAuditEvents(ctx, afterID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportAuditEvents", reflect.TypeOf((*MockAuditStorage)(nil).ExportAuditEvents), ctx, afterID, limit)
+}
+
+// ListAuditEvents mocks base method.
+func (m *MockAuditStorage) ListAuditEvents(ctx context.Context, userID, beforeID uint64, limit int) ([]storage.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAuditEvents", ctx, userID, beforeID, limit)
+	ret0, _ := ret[0].([]storage.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAuditEvents indicates an expected call of ListAuditEvents.
+func (mr *MockAuditStorageMockRecorder) ListAuditEvents(ctx, userID, beforeID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAuditEvents", reflect.TypeOf((*MockAuditStorage)(nil).ListAuditEvents), ctx, userID, beforeID, limit)
+}
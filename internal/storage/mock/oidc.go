@@ -0,0 +1,168 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: oidc.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	storage "github.com/andreevym/gophkeeper/internal/storage"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockOIDCStorage is a mock of OIDCStorage interface.
+type MockOIDCStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockOIDCStorageMockRecorder
+}
+
+// MockOIDCStorageMockRecorder is the mock recorder for MockOIDCStorage.
+type MockOIDCStorageMockRecorder struct {
+	mock *MockOIDCStorage
+}
+
+// NewMockOIDCStorage creates a new mock instance.
+func NewMockOIDCStorage(ctrl *gomock.Controller) *MockOIDCStorage {
+	mock := &MockOIDCStorage{ctrl: ctrl}
+	mock.recorder = &MockOIDCStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOIDCStorage) EXPECT() *MockOIDCStorageMockRecorder {
+	return m.recorder
+}
+
+// ApproveOIDCLogin mocks base method.
+func (m *MockOIDCStorage) ApproveOIDCLogin(ctx context.Context, userCodeHash, browserHash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApproveOIDCLogin", ctx, userCodeHash, browserHash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ApproveOIDCLogin indicates an expected call of ApproveOIDCLogin.
+func (mr *MockOIDCStorageMockRecorder) ApproveOIDCLogin(ctx, userCodeHash, browserHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApproveOIDCLogin", reflect.TypeOf((*MockOIDCStorage)(nil).ApproveOIDCLogin), ctx, userCodeHash, browserHash)
+}
+
+// CompleteOIDCLogin mocks base method.
+func (m *MockOIDCStorage) CompleteOIDCLogin(ctx context.Context, state string, userID uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteOIDCLogin", ctx, state, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteOIDCLogin indicates an expected call of CompleteOIDCLogin.
+func (mr *MockOIDCStorageMockRecorder) CompleteOIDCLogin(ctx, state, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteOIDCLogin", reflect.TypeOf((*MockOIDCStorage)(nil).CompleteOIDCLogin), ctx, state, userID)
+}
+
+// CreateOIDCIdentity mocks base method.
+func (m *MockOIDCStorage) CreateOIDCIdentity(ctx context.Context, issuer, subject string, userID uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOIDCIdentity", ctx, issuer, subject, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateOIDCIdentity indicates an expected call of CreateOIDCIdentity.
+func (mr *MockOIDCStorageMockRecorder) CreateOIDCIdentity(ctx, issuer, subject, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOIDCIdentity", reflect.TypeOf((*MockOIDCStorage)(nil).CreateOIDCIdentity), ctx, issuer, subject, userID)
+}
+
+// CreateOIDCLogin mocks base method.
+func (m *MockOIDCStorage) CreateOIDCLogin(ctx context.Context, l storage.OIDCLogin) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOIDCLogin", ctx, l)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateOIDCLogin indicates an expected call of CreateOIDCLogin.
+func (mr *MockOIDCStorageMockRecorder) CreateOIDCLogin(ctx, l interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOIDCLogin", reflect.TypeOf((*MockOIDCStorage)(nil).CreateOIDCLogin), ctx, l)
+}
+
+// DeleteOIDCLogin mocks base method.
+func (m *MockOIDCStorage) DeleteOIDCLogin(ctx context.Context, deviceCodeHash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOIDCLogin", ctx, deviceCodeHash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteOIDCLogin indicates an expected call of DeleteOIDCLogin.
+func (mr *MockOIDCStorageMockRecorder) DeleteOIDCLogin(ctx, deviceCodeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOIDCLogin", reflect.TypeOf((*MockOIDCStorage)(nil).DeleteOIDCLogin), ctx, deviceCodeHash)
+}
+
+// GetOIDCIdentity mocks base method.
+func (m *MockOIDCStorage) GetOIDCIdentity(ctx context.Context, issuer, subject string) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOIDCIdentity", ctx, issuer, subject)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOIDCIdentity indicates an expected call of GetOIDCIdentity.
+func (mr *MockOIDCStorageMockRecorder) GetOIDCIdentity(ctx, issuer, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOIDCIdentity", reflect.TypeOf((*MockOIDCStorage)(nil).GetOIDCIdentity), ctx, issuer, subject)
+}
+
+// GetOIDCLogin mocks base method.
+func (m *MockOIDCStorage) GetOIDCLogin(ctx context.Context, deviceCodeHash string) (storage.OIDCLogin, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOIDCLogin", ctx, deviceCodeHash)
+	ret0, _ := ret[0].(storage.OIDCLogin)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOIDCLogin indicates an expected call of GetOIDCLogin.
+func (mr *MockOIDCStorageMockRecorder) GetOIDCLogin(ctx, deviceCodeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOIDCLogin", reflect.TypeOf((*MockOIDCStorage)(nil).GetOIDCLogin), ctx, deviceCodeHash)
+}
+
+// GetOIDCLoginByState mocks base method.
+func (m *MockOIDCStorage) GetOIDCLoginByState(ctx context.Context, state string) (storage.OIDCLogin, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOIDCLoginByState", ctx, state)
+	ret0, _ := ret[0].(storage.OIDCLogin)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOIDCLoginByState indicates an expected call of GetOIDCLoginByState.
+func (mr *MockOIDCStorageMockRecorder) GetOIDCLoginByState(ctx, state interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOIDCLoginByState", reflect.TypeOf((*MockOIDCStorage)(nil).GetOIDCLoginByState), ctx, state)
+}
+
+// GetOIDCLoginByUserCode mocks base method.
+func (m *MockOIDCStorage) GetOIDCLoginByUserCode(ctx context.Context, userCodeHash string) (storage.OIDCLogin, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOIDCLoginByUserCode", ctx, userCodeHash)
+	ret0, _ := ret[0].(storage.OIDCLogin)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOIDCLoginByUserCode indicates an expected call of GetOIDCLoginByUserCode.
+func (mr *MockOIDCStorageMockRecorder) GetOIDCLoginByUserCode(ctx, userCodeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOIDCLoginByUserCode", reflect.TypeOf((*MockOIDCStorage)(nil).GetOIDCLoginByUserCode), ctx, userCodeHash)
+}
@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: srp.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	storage "github.com/andreevym/gophkeeper/internal/storage"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockSRPHandshakeStorage is a mock of SRPHandshakeStorage interface.
+type MockSRPHandshakeStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockSRPHandshakeStorageMockRecorder
+}
+
+// MockSRPHandshakeStorageMockRecorder is the mock recorder for MockSRPHandshakeStorage.
+type MockSRPHandshakeStorageMockRecorder struct {
+	mock *MockSRPHandshakeStorage
+}
+
+// NewMockSRPHandshakeStorage creates a new mock instance.
+func NewMockSRPHandshakeStorage(ctrl *gomock.Controller) *MockSRPHandshakeStorage {
+	mock := &MockSRPHandshakeStorage{ctrl: ctrl}
+	mock.recorder = &MockSRPHandshakeStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSRPHandshakeStorage) EXPECT() *MockSRPHandshakeStorageMockRecorder {
+	return m.recorder
+}
+
+// CreateSRPHandshake mocks base method.
+func (m *MockSRPHandshakeStorage) CreateSRPHandshake(ctx context.Context, h storage.SRPHandshake) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSRPHandshake", ctx, h)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSRPHandshake indicates an expected call of CreateSRPHandshake.
+func (mr *MockSRPHandshakeStorageMockRecorder) CreateSRPHandshake(ctx, h interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSRPHandshake", reflect.TypeOf((*MockSRPHandshakeStorage)(nil).CreateSRPHandshake), ctx, h)
+}
+
+// TakeSRPHandshake mocks base method.
+func (m *MockSRPHandshakeStorage) TakeSRPHandshake(ctx context.Context, id string) (storage.SRPHandshake, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakeSRPHandshake", ctx, id)
+	ret0, _ := ret[0].(storage.SRPHandshake)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TakeSRPHandshake indicates an expected call of TakeSRPHandshake.
+func (mr *MockSRPHandshakeStorageMockRecorder) TakeSRPHandshake(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakeSRPHandshake", reflect.TypeOf((*MockSRPHandshakeStorage)(nil).TakeSRPHandshake), ctx, id)
+}
@@ -0,0 +1,147 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: throttle.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	storage "github.com/andreevym/gophkeeper/internal/storage"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockThrottleStorage is a mock of ThrottleStorage interface.
+type MockThrottleStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockThrottleStorageMockRecorder
+}
+
+// MockThrottleStorageMockRecorder is the mock recorder for MockThrottleStorage.
+type MockThrottleStorageMockRecorder struct {
+	mock *MockThrottleStorage
+}
+
+// NewMockThrottleStorage creates a new mock instance.
+func NewMockThrottleStorage(ctrl *gomock.Controller) *MockThrottleStorage {
+	mock := &MockThrottleStorage{ctrl: ctrl}
+	mock.recorder = &MockThrottleStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockThrottleStorage) EXPECT() *MockThrottleStorageMockRecorder {
+	return m.recorder
+}
+
+// AddThrottleFailure mocks base method.
+func (m *MockThrottleStorage) AddThrottleFailure(ctx context.Context, key string, now time.Time, window time.Duration) (storage.ThrottleState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddThrottleFailure", ctx, key, now, window)
+	ret0, _ := ret[0].(storage.ThrottleState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddThrottleFailure indicates an expected call of AddThrottleFailure.
+func (mr *MockThrottleStorageMockRecorder) AddThrottleFailure(ctx, key, now, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddThrottleFailure", reflect.TypeOf((*MockThrottleStorage)(nil).AddThrottleFailure), ctx, key, now, window)
+}
+
+// ReleaseThrottle mocks base method.
+func (m *MockThrottleStorage) ReleaseThrottle(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseThrottle", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseThrottle indicates an expected call of ReleaseThrottle.
+func (mr *MockThrottleStorageMockRecorder) ReleaseThrottle(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseThrottle", reflect.TypeOf((*MockThrottleStorage)(nil).ReleaseThrottle), ctx, key)
+}
+
+// ReserveThrottle mocks base method.
+func (m *MockThrottleStorage) ReserveThrottle(ctx context.Context, key string, now time.Time, timeout time.Duration) (storage.ThrottleState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveThrottle", ctx, key, now, timeout)
+	ret0, _ := ret[0].(storage.ThrottleState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReserveThrottle indicates an expected call of ReserveThrottle.
+func (mr *MockThrottleStorageMockRecorder) ReserveThrottle(ctx, key, now, timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveThrottle", reflect.TypeOf((*MockThrottleStorage)(nil).ReserveThrottle), ctx, key, now, timeout)
+}
+
+// ResetThrottle mocks base method.
+func (m *MockThrottleStorage) ResetThrottle(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetThrottle", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetThrottle indicates an expected call of ResetThrottle.
+func (mr *MockThrottleStorageMockRecorder) ResetThrottle(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetThrottle", reflect.TypeOf((*MockThrottleStorage)(nil).ResetThrottle), ctx, key)
+}
+
+// MockFailedSignInStorage is a mock of FailedSignInStorage interface.
+type MockFailedSignInStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockFailedSignInStorageMockRecorder
+}
+
+// MockFailedSignInStorageMockRecorder is the mock recorder for MockFailedSignInStorage.
+type MockFailedSignInStorageMockRecorder struct {
+	mock *MockFailedSignInStorage
+}
+
+// NewMockFailedSignInStorage creates a new mock instance.
+func NewMockFailedSignInStorage(ctrl *gomock.Controller) *MockFailedSignInStorage {
+	mock := &MockFailedSignInStorage{ctrl: ctrl}
+	mock.recorder = &MockFailedSignInStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFailedSignInStorage) EXPECT() *MockFailedSignInStorageMockRecorder {
+	return m.recorder
+}
+
+// CreateFailedSignIn mocks base method.
+func (m *MockFailedSignInStorage) CreateFailedSignIn(ctx context.Context, a storage.FailedSignIn) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateFailedSignIn", ctx, a)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateFailedSignIn indicates an expected call of CreateFailedSignIn.
+func (mr *MockFailedSignInStorageMockRecorder) CreateFailedSignIn(ctx, a interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateFailedSignIn", reflect.TypeOf((*MockFailedSignInStorage)(nil).CreateFailedSignIn), ctx, a)
+}
+
+// ListFailedSignIns mocks base method.
+func (m *MockFailedSignInStorage) ListFailedSignIns(ctx context.Context, userID uint64, limit int) ([]storage.FailedSignIn, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListFailedSignIns", ctx, userID, limit)
+	ret0, _ := ret[0].([]storage.FailedSignIn)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListFailedSignIns indicates an expected call of ListFailedSignIns.
+func (mr *MockFailedSignInStorageMockRecorder) ListFailedSignIns(ctx, userID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListFailedSignIns", reflect.TypeOf((*MockFailedSignInStorage)(nil).ListFailedSignIns), ctx, userID, limit)
+}
@@ -0,0 +1,125 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: token.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	storage "github.com/andreevym/gophkeeper/internal/storage"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockTokenStorage is a mock of TokenStorage interface.
+type MockTokenStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenStorageMockRecorder
+}
+
+// MockTokenStorageMockRecorder is the mock recorder for MockTokenStorage.
+type MockTokenStorageMockRecorder struct {
+	mock *MockTokenStorage
+}
+
+// NewMockTokenStorage creates a new mock instance.
+func NewMockTokenStorage(ctrl *gomock.Controller) *MockTokenStorage {
+	mock := &MockTokenStorage{ctrl: ctrl}
+	mock.recorder = &MockTokenStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTokenStorage) EXPECT() *MockTokenStorageMockRecorder {
+	return m.recorder
+}
+
+// CreateToken mocks base method.
+func (m *MockTokenStorage) CreateToken(ctx context.Context, t storage.AccessToken) (storage.AccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateToken", ctx, t)
+	ret0, _ := ret[0].(storage.AccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateToken indicates an expected call of CreateToken.
+func (mr *MockTokenStorageMockRecorder) CreateToken(ctx, t interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateToken", reflect.TypeOf((*MockTokenStorage)(nil).CreateToken), ctx, t)
+}
+
+// GetToken mocks base method.
+func (m *MockTokenStorage) GetToken(ctx context.Context, id uint64) (storage.AccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetToken", ctx, id)
+	ret0, _ := ret[0].(storage.AccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetToken indicates an expected call of GetToken.
+func (mr *MockTokenStorageMockRecorder) GetToken(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetToken", reflect.TypeOf((*MockTokenStorage)(nil).GetToken), ctx, id)
+}
+
+// GetTokenByHash mocks base method.
+func (m *MockTokenStorage) GetTokenByHash(ctx context.Context, hash string) (storage.AccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenByHash", ctx, hash)
+	ret0, _ := ret[0].(storage.AccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTokenByHash indicates an expected call of GetTokenByHash.
+func (mr *MockTokenStorageMockRecorder) GetTokenByHash(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenByHash", reflect.TypeOf((*MockTokenStorage)(nil).GetTokenByHash), ctx, hash)
+}
+
+// ListTokens mocks base method.
+func (m *MockTokenStorage) ListTokens(ctx context.Context, userID uint64) ([]storage.AccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTokens", ctx, userID)
+	ret0, _ := ret[0].([]storage.AccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTokens indicates an expected call of ListTokens.
+func (mr *MockTokenStorageMockRecorder) ListTokens(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTokens", reflect.TypeOf((*MockTokenStorage)(nil).ListTokens), ctx, userID)
+}
+
+// RevokeToken mocks base method.
+func (m *MockTokenStorage) RevokeToken(ctx context.Context, id uint64, revokedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeToken", ctx, id, revokedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeToken indicates an expected call of RevokeToken.
+func (mr *MockTokenStorageMockRecorder) RevokeToken(ctx, id, revokedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockTokenStorage)(nil).RevokeToken), ctx, id, revokedAt)
+}
+
+// TouchToken mocks base method.
+func (m *MockTokenStorage) TouchToken(ctx context.Context, id uint64, usedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchToken", ctx, id, usedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchToken indicates an expected call of TouchToken.
+func (mr *MockTokenStorageMockRecorder) TouchToken(ctx, id, usedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchToken", reflect.TypeOf((*MockTokenStorage)(nil).TouchToken), ctx, id, usedAt)
+}
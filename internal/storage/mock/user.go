@@ -94,6 +94,21 @@ func (mr *MockUserStorageMockRecorder) GetUserByLogin(ctx, login interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByLogin", reflect.TypeOf((*MockUserStorage)(nil).GetUserByLogin), ctx, login)
 }
 
+// ListUsers mocks base method.
+func (m *MockUserStorage) ListUsers(ctx context.Context, query string, afterID uint64, limit int) ([]storage.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, query, afterID, limit)
+	ret0, _ := ret[0].([]storage.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockUserStorageMockRecorder) ListUsers(ctx, query, afterID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockUserStorage)(nil).ListUsers), ctx, query, afterID, limit)
+}
+
 // UpdateUser mocks base method.
 func (m *MockUserStorage) UpdateUser(ctx context.Context, user storage.User) error {
 	m.ctrl.T.Helper()
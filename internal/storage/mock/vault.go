@@ -79,6 +79,21 @@ func (mr *MockVaultStorageMockRecorder) GetVault(ctx, id interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVault", reflect.TypeOf((*MockVaultStorage)(nil).GetVault), ctx, id)
 }
 
+// ListVaults mocks base method.
+func (m *MockVaultStorage) ListVaults(ctx context.Context, userID uint64) ([]storage.Vault, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListVaults", ctx, userID)
+	ret0, _ := ret[0].([]storage.Vault)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListVaults indicates an expected call of ListVaults.
+func (mr *MockVaultStorageMockRecorder) ListVaults(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListVaults", reflect.TypeOf((*MockVaultStorage)(nil).ListVaults), ctx, userID)
+}
+
 // UpdateVault mocks base method.
 func (m *MockVaultStorage) UpdateVault(ctx context.Context, v storage.Vault) error {
 	m.ctrl.T.Helper()
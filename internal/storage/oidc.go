@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrOIDCLoginNotFound is returned if no pending OIDC sign-in has the device code, user code or state.
+var ErrOIDCLoginNotFound = errors.New("oidc login not found")
+
+// ErrOIDCIdentityNotFound is returned if no user is linked to the identity of the provider.
+var ErrOIDCIdentityNotFound = errors.New("oidc identity not found")
+
+// OIDCLogin is a pending sign-in with the external identity provider started by a terminal client.
+// The client polls with its device code while the user enters the user code shown by the client in a browser,
+// approves the sign-in and signs in at the provider.
+type OIDCLogin struct {
+	DeviceCodeHash string    // SHA-256 of the device code, the code itself is only known to the client.
+	UserCodeHash   string    // SHA-256 of the user code, which the user types into the browser.
+	BrowserHash    string    // SHA-256 of the cookie of the browser which approved the sign-in, empty until approved.
+	State          string    // OAuth2 state parameter identifying the sign-in in the callback.
+	Nonce          string    // Nonce the ID token must carry.
+	CodeVerifier   string    // PKCE code verifier for the token exchange.
+	Device         string    // Device name of the client, used for the sign-in session.
+	UserID         uint64    // The signed-in user, 0 while the sign-in at the provider is pending.
+	ExpiresAt      time.Time // The sign-in can't be completed after this time.
+}
+
+// OIDCStorage defines the interface for pending OIDC sign-ins and for the links between
+// identities of the provider and users in the storage system.
+type OIDCStorage interface {
+	// CreateOIDCLogin stores a new pending sign-in and removes expired ones.
+	// Takes a context.Context and an OIDCLogin object as parameters.
+	// Returns an error if any.
+	CreateOIDCLogin(ctx context.Context, l OIDCLogin) error
+
+	// GetOIDCLogin retrieves a sign-in by the hash of its device code.
+	// Takes a context.Context and the device code hash (string) as parameters.
+	// Returns the OIDCLogin and an error if any.
+	GetOIDCLogin(ctx context.Context, deviceCodeHash string) (OIDCLogin, error)
+
+	// GetOIDCLoginByState retrieves a sign-in by its state parameter.
+	// Takes a context.Context and the state (string) as parameters.
+	// Returns the OIDCLogin and an error if any.
+	GetOIDCLoginByState(ctx context.Context, state string) (OIDCLogin, error)
+
+	// GetOIDCLoginByUserCode retrieves a sign-in by the hash of its user code.
+	// Takes a context.Context and the user code hash (string) as parameters.
+	// Returns the OIDCLogin and an error if any.
+	GetOIDCLoginByUserCode(ctx context.Context, userCodeHash string) (OIDCLogin, error)
+
+	// ApproveOIDCLogin records the browser which approved a sign-in, unless it was approved before.
+	// Takes a context.Context, the user code hash (string) and the hash of the browser cookie (string) as parameters.
+	// Returns whether the sign-in was approved by this call, so that it is approved by a single browser, and an error if any.
+	ApproveOIDCLogin(ctx context.Context, userCodeHash, browserHash string) (bool, error)
+
+	// CompleteOIDCLogin records the user who signed in at the provider.
+	// Takes a context.Context, the state (string) and the user's ID (uint64) as parameters.
+	// Returns an error if any.
+	CompleteOIDCLogin(ctx context.Context, state string, userID uint64) error
+
+	// DeleteOIDCLogin removes a sign-in by the hash of its device code.
+	// Takes a context.Context and the device code hash (string) as parameters.
+	// Returns whether the sign-in existed, so that concurrent polls issue a single token, and an error if any.
+	DeleteOIDCLogin(ctx context.Context, deviceCodeHash string) (bool, error)
+
+	// GetOIDCIdentity retrieves the user linked to an identity of the provider.
+	// Takes a context.Context, the issuer (string) and the subject (string) as parameters.
+	// Returns the user's ID and an error if any.
+	GetOIDCIdentity(ctx context.Context, issuer, subject string) (uint64, error)
+
+	// CreateOIDCIdentity links an identity of the provider to a user.
+	// Takes a context.Context, the issuer (string), the subject (string) and the user's ID (uint64) as parameters.
+	// Returns an error if any.
+	CreateOIDCIdentity(ctx context.Context, issuer, subject string, userID uint64) error
+}
@@ -0,0 +1,407 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/backup"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Driver is the name of the database in the manifest of backups.
+const Driver = "postgres"
+
+// backupPageSize is the number of vaults read at once by Backup, whose values are read one after the other.
+const backupPageSize = 1000
+
+// backupTable is a table kept in backups.
+type backupTable struct {
+	name     string
+	order    string // Columns the rows are written in the order of.
+	sequence bool   // Whether the id column is generated from the sequence <name>_id_seq.
+}
+
+// backupTables are the tables kept in backups, in an order satisfying their foreign keys.
+// Sign-in throttling, SRP handshakes and pending OIDC sign-ins are short-lived and not kept.
+// The values of the sequences follow as the rows of the pseudo table sequencesTable.
+var backupTables = []backupTable{
+	{name: "users", order: "id", sequence: true},
+	{name: "user_quotas", order: "user_id"},
+	{name: "vault", order: "id", sequence: true},
+	{name: "access_tokens", order: "id", sequence: true},
+	{name: "failed_sign_ins", order: "id", sequence: true},
+	{name: "sessions", order: "id", sequence: true},
+	{name: "oidc_identities", order: "issuer, subject"},
+	{name: "audit_log", order: "id", sequence: true},
+}
+
+// sequencesTable holds the values of the sequences in backups, which are restored as they were rather than
+// after the largest restored ID, so that the IDs of deleted rows, which tokens and the audit log may still
+// refer to, are not used again.
+const sequencesTable = "sequences"
+
+// backupSequence is a row of sequencesTable.
+type backupSequence struct {
+	Name      string `json:"name"`
+	LastValue int64  `json:"last_value"`
+	IsCalled  bool   `json:"is_called"`
+}
+
+// BackupStorage writes backups of the whole database and restores them.
+// Vault values are read from and restored to large objects, or to the storage.BlobStore configured with
+// WithBlobStore.
+type BackupStorage struct {
+	pool  *pgxpool.Pool
+	blobs storage.BlobStore
+}
+
+// NewBackupStorage creates a new instance of BackupStorage.
+// It takes a *pgxpool.Pool instance which is used to interact with the database, and options.
+// Returns a pointer to a BackupStorage instance.
+func NewBackupStorage(pool *pgxpool.Pool, opts ...Option) *BackupStorage {
+	o := newOptions(opts)
+	return &BackupStorage{pool: pool, blobs: o.blobs}
+}
+
+// Backup writes a backup of the database to w, encrypted with the passphrase.
+// Rows and large objects are read in a single repeatable read transaction, so the backup is a consistent snapshot
+// while the server keeps running. Values in the blob store are immutable, and the blobs of vaults updated or deleted
+// during the backup are kept for BlobDeletionGracePeriod, which the backup must finish within.
+// It takes a context.Context, the writer and the passphrase as parameters.
+// Returns the summary of the backup and an error if any.
+func (s BackupStorage) Backup(ctx context.Context, w io.Writer, passphrase string) (_ backup.Summary, err error) {
+	ctx, span := startSpan(ctx, "BackupStorage.Backup")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return backup.Summary{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	m := backup.Manifest{Driver: Driver, CreatedAt: time.Now().UTC()}
+	m.Schema, err = schemaVersion(ctx, tx)
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	bw, err := backup.NewWriter(w, passphrase, m)
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	for _, t := range backupTables {
+		if t.name == "vault" {
+			err = s.backupVaults(ctx, tx, bw)
+		} else {
+			err = backupRows(ctx, tx, bw, t)
+		}
+		if err != nil {
+			return backup.Summary{}, err
+		}
+	}
+	if err = backupSequences(ctx, tx, bw); err != nil {
+		return backup.Summary{}, err
+	}
+	if err = bw.Close(); err != nil {
+		return backup.Summary{}, err
+	}
+
+	summary := bw.Summary()
+	span.SetAttributes(attribute.Int64("backup.values", summary.Values), attribute.Int64("backup.bytes", summary.Bytes))
+	return summary, nil
+}
+
+// backupRows writes the rows of a table.
+func backupRows(ctx context.Context, tx pgx.Tx, bw *backup.Writer, t backupTable) error {
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT row_to_json(t) FROM (SELECT * FROM %s ORDER BY %s) t`, t.name, t.order))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", t.name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row []byte
+		if err = rows.Scan(&row); err != nil {
+			return fmt.Errorf("failed to read %s: %w", t.name, err)
+		}
+		if err = bw.WriteRow(t.name, row); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", t.name, err)
+	}
+	return nil
+}
+
+// backupSequences writes the values of the sequences. Sequences are not transactional, so a value may be ahead
+// of the snapshot, which only skips some IDs after a restore.
+func backupSequences(ctx context.Context, tx pgx.Tx, bw *backup.Writer) error {
+	for _, t := range backupTables {
+		if !t.sequence {
+			continue
+		}
+		seq := backupSequence{Name: t.name + "_id_seq"}
+		err := tx.QueryRow(ctx, fmt.Sprintf(`SELECT last_value, is_called FROM %s`, seq.Name)).Scan(&seq.LastValue, &seq.IsCalled)
+		if err != nil {
+			return fmt.Errorf("failed to read sequence %s: %w", seq.Name, err)
+		}
+		row, err := json.Marshal(seq)
+		if err != nil {
+			return fmt.Errorf("failed to marshal sequence %s: %w", seq.Name, err)
+		}
+		if err = bw.WriteRow(sequencesTable, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupVault is a vault row without its value, and where its value is stored.
+type backupVault struct {
+	Row     []byte
+	ID      uint64
+	OID     *uint32
+	BlobKey *string
+}
+
+// backupVaults writes the vault rows, each followed by its value. The rows are read a page at a time,
+// as the connection can't read large objects while a query is running.
+func (s BackupStorage) backupVaults(ctx context.Context, tx pgx.Tx, bw *backup.Writer) error {
+	var afterID uint64
+	for {
+		rows, err := tx.Query(
+			ctx,
+			`SELECT to_jsonb(v) - 'value' - 'blob_key', id, value, blob_key FROM vault v WHERE id > $1 ORDER BY id LIMIT $2`,
+			afterID, backupPageSize,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to read vaults: %w", err)
+		}
+		vaults, err := pgx.CollectRows(rows, pgx.RowToStructByPos[backupVault])
+		if err != nil {
+			return fmt.Errorf("failed to read vaults: %w", err)
+		}
+		if len(vaults) == 0 {
+			return nil
+		}
+
+		for _, v := range vaults {
+			if err = bw.WriteRow("vault", v.Row); err != nil {
+				return err
+			}
+			if err = s.backupValue(ctx, tx, bw, v); err != nil {
+				return err
+			}
+		}
+		afterID = vaults[len(vaults)-1].ID
+	}
+}
+
+// backupValue writes the value of a vault from its large object or blob.
+func (s BackupStorage) backupValue(ctx context.Context, tx pgx.Tx, bw *backup.Writer, v backupVault) error {
+	var value io.Reader = strings.NewReader("")
+	switch {
+	case v.BlobKey != nil:
+		if s.blobs == nil {
+			return fmt.Errorf("value of vault %d is stored in blob %s, but no blob store is configured", v.ID, *v.BlobKey)
+		}
+		blob, err := s.blobs.OpenBlob(ctx, *v.BlobKey)
+		if err != nil {
+			return fmt.Errorf("failed to read value of vault %d: %w", v.ID, err)
+		}
+		defer blob.Close()
+		value = blob
+	case v.OID != nil:
+		lobs := tx.LargeObjects()
+		obj, err := lobs.Open(ctx, *v.OID, pgx.LargeObjectModeRead)
+		if err != nil {
+			return fmt.Errorf("failed to open value of vault %d: %w", v.ID, err)
+		}
+		defer obj.Close()
+		value = obj
+	}
+	_, err := bw.WriteValue(v.ID, value)
+	return err
+}
+
+// Restore restores a backup read from r, decrypted with the passphrase, into the database, which must be empty
+// and migrated to the schema version of the backup. The backup is verified while it is restored, all of it is
+// restored in a single transaction which is only committed if the whole backup is intact.
+// Values are restored to new large objects, or to the blob store if one is configured, whose blobs are deleted
+// again if the restore fails.
+// It takes a context.Context, the reader and the passphrase as parameters.
+// Returns the summary of the backup and an error if any.
+// If the database holds data, it returns storage.ErrNotEmpty.
+func (s BackupStorage) Restore(ctx context.Context, r io.Reader, passphrase string) (_ backup.Summary, err error) {
+	ctx, span := startSpan(ctx, "BackupStorage.Restore")
+	defer func() { tracing.End(span, err) }()
+
+	br, err := backup.NewReader(r, passphrase)
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	m := br.Manifest()
+	if m.Driver != Driver {
+		return backup.Summary{}, fmt.Errorf("backup of a %s database can't be restored to PostgreSQL", m.Driver)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return backup.Summary{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	schema, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	if schema != m.Schema {
+		return backup.Summary{}, fmt.Errorf("backup has schema version %d, the database %d, migrate the database to version %d first", m.Schema, schema, m.Schema)
+	}
+	for _, t := range backupTables {
+		var exists bool
+		if err = tx.QueryRow(ctx, fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s)`, t.name)).Scan(&exists); err != nil {
+			return backup.Summary{}, fmt.Errorf("failed to read %s: %w", t.name, err)
+		}
+		if exists {
+			return backup.Summary{}, fmt.Errorf("%w: %s has rows", storage.ErrNotEmpty, t.name)
+		}
+	}
+
+	var blobKeys []string
+	committed := false
+	defer func() {
+		if !committed {
+			for _, key := range blobKeys {
+				deleteBlob(ctx, s.blobs, key)
+			}
+		}
+	}()
+
+	tables := make(map[string]bool, len(backupTables))
+	sequences := make(map[string]bool)
+	for _, t := range backupTables {
+		tables[t.name] = true
+		if t.sequence {
+			sequences[t.name+"_id_seq"] = true
+		}
+	}
+	// The row of a vault is inserted once its value, which follows it, is stored.
+	var vaultRow json.RawMessage
+	var vaultID uint64
+	for {
+		rec, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return backup.Summary{}, err
+		}
+
+		switch {
+		case vaultRow != nil && rec.Value == nil:
+			return backup.Summary{}, fmt.Errorf("%w: vault %d has no value", backup.ErrDamaged, vaultID)
+		case rec.Table == "vault":
+			var id struct {
+				ID uint64 `json:"id"`
+			}
+			if err = json.Unmarshal(rec.Row, &id); err != nil {
+				return backup.Summary{}, fmt.Errorf("%w: %v", backup.ErrDamaged, err)
+			}
+			vaultRow, vaultID = rec.Row, id.ID
+		case rec.Table == sequencesTable:
+			var seq backupSequence
+			if err = json.Unmarshal(rec.Row, &seq); err != nil || !sequences[seq.Name] {
+				return backup.Summary{}, fmt.Errorf("%w: unexpected sequence %s", backup.ErrDamaged, rec.Row)
+			}
+			if _, err = tx.Exec(ctx, `SELECT setval($1::regclass, $2, $3)`, seq.Name, seq.LastValue, seq.IsCalled); err != nil {
+				return backup.Summary{}, fmt.Errorf("failed to restore sequence %s: %w", seq.Name, err)
+			}
+		case rec.Table != "":
+			if !tables[rec.Table] {
+				return backup.Summary{}, fmt.Errorf("%w: unexpected table %s", backup.ErrDamaged, rec.Table)
+			}
+			_, err = tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %[1]s SELECT * FROM json_populate_record(NULL::%[1]s, $1)`, rec.Table), string(rec.Row))
+			if err != nil {
+				return backup.Summary{}, fmt.Errorf("failed to restore row of %s: %w", rec.Table, err)
+			}
+		default:
+			if vaultRow == nil || rec.VaultID != vaultID {
+				return backup.Summary{}, fmt.Errorf("%w: value of vault %d without its row", backup.ErrDamaged, rec.VaultID)
+			}
+			var oid *uint32
+			var key *string
+			if s.blobs != nil {
+				k, err := s.blobs.CreateBlob(ctx, rec.Value, -1)
+				if err != nil {
+					return backup.Summary{}, fmt.Errorf("failed to restore value of vault %d: %w", vaultID, err)
+				}
+				blobKeys = append(blobKeys, k)
+				key = &k
+			} else {
+				o, err := restoreLargeObject(ctx, tx, rec.Value)
+				if err != nil {
+					return backup.Summary{}, fmt.Errorf("failed to restore value of vault %d: %w", vaultID, err)
+				}
+				oid = &o
+			}
+			_, err = tx.Exec(
+				ctx,
+				`INSERT INTO vault SELECT * FROM jsonb_populate_record(NULL::vault, $1::jsonb || jsonb_build_object('value', $2::oid, 'blob_key', $3::text))`,
+				string(vaultRow), oid, key,
+			)
+			if err != nil {
+				return backup.Summary{}, fmt.Errorf("failed to restore vault %d: %w", vaultID, err)
+			}
+			vaultRow = nil
+		}
+	}
+	if vaultRow != nil {
+		return backup.Summary{}, fmt.Errorf("%w: vault %d has no value", backup.ErrDamaged, vaultID)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return backup.Summary{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+
+	summary := br.Summary()
+	span.SetAttributes(attribute.Int64("backup.values", summary.Values), attribute.Int64("backup.bytes", summary.Bytes))
+	return summary, nil
+}
+
+// restoreLargeObject stores a value read from r in a new large object.
+func restoreLargeObject(ctx context.Context, tx pgx.Tx, r io.Reader) (uint32, error) {
+	lobs := tx.LargeObjects()
+	oid, err := lobs.Create(ctx, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create object: %w", err)
+	}
+	obj, err := lobs.Open(ctx, oid, pgx.LargeObjectModeWrite)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open object %d: %w", oid, err)
+	}
+	defer obj.Close()
+	if _, err = io.Copy(obj, r); err != nil {
+		return 0, fmt.Errorf("failed to write object %d: %w", oid, err)
+	}
+	return oid, nil
+}
+
+// schemaVersion returns the version of the latest migration applied to the database.
+func schemaVersion(ctx context.Context, tx pgx.Tx) (int64, error) {
+	var version int64
+	err := tx.QueryRow(ctx, `SELECT COALESCE(max(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,55 @@
+package postgres_test
+
+import (
+	"context"
+	"log"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/storage/filesystem"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/internal/storage/storagetest"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackup(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	source := postgres.NewDB()
+	defer source.TeardownDB()
+	if err := source.SetupDB(ctx, "../../../migrations"); err != nil {
+		log.Fatalf("Could not setup postgres container: %v", err)
+	}
+	target := postgres.NewDB()
+	defer target.TeardownDB()
+	if err := target.SetupDB(ctx, "../../../migrations"); err != nil {
+		log.Fatalf("Could not setup postgres container: %v", err)
+	}
+
+	// Values are backed up from large objects and restored to a blob store.
+	dir := t.TempDir()
+	blobs, err := filesystem.NewBlobStore(dir)
+	require.NoError(t, err)
+	backend := func(db *postgres.DB, opts ...postgres.Option) storagetest.BackupBackend {
+		vaultStorage := postgres.NewVaultStorage(db.Pool, opts...)
+		return storagetest.BackupBackend{
+			Backend: storagetest.Backend{
+				Users:  postgres.NewUserStorage(db.DB),
+				Vaults: vaultStorage,
+				Quotas: vaultStorage,
+				Audit:  postgres.NewAuditStorage(db.DB),
+			},
+			Tokens:   postgres.NewTokenStorage(db.DB),
+			Sessions: postgres.NewSessionStorage(db.DB),
+			Backups:  postgres.NewBackupStorage(db.Pool, opts...),
+		}
+	}
+	storagetest.RunBackup(t, backend(source), backend(target, postgres.WithBlobStore(blobs)))
+
+	// The blobs of the failed restores were deleted, the 3 restored values and the one created since are left.
+	assert.Equal(t, 4, countFiles(t, dir))
+	var largeObjects int
+	require.NoError(t, target.DB.GetContext(ctx, &largeObjects, `SELECT count(*) FROM pg_largeobject_metadata`))
+	assert.Zero(t, largeObjects)
+}
@@ -0,0 +1,107 @@
+package postgres_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/filesystem"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/internal/storage/storagetest"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(dir, func(_ string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func TestBlobStorage(t *testing.T) {
+	t.Parallel()
+	db := postgres.NewDB()
+	defer db.TeardownDB()
+	ctx := context.Background()
+	err := db.SetupDB(ctx, "../../../migrations")
+	if err != nil {
+		log.Fatalf("Could not setup postgres container: %v", err)
+	}
+
+	dir := t.TempDir()
+	blobs, err := filesystem.NewBlobStore(dir)
+	require.NoError(t, err)
+
+	storagetest.Run(t, storagetest.Backend{
+		Users:  postgres.NewUserStorage(db.DB),
+		Vaults: postgres.NewVaultStorage(db.Pool, postgres.WithBlobStore(blobs)),
+	})
+
+	t.Run("move large objects", func(t *testing.T) {
+		largeObjectVaults := postgres.NewVaultStorage(db.Pool)
+		blobVaults := postgres.NewVaultStorage(db.Pool, postgres.WithBlobStore(blobs))
+		userStorage := postgres.NewUserStorage(db.DB)
+
+		// The blobs of the other tests are deleted first, so that the files of this test can be counted.
+		_, err := blobVaults.CollectBlobs(ctx, 0)
+		require.NoError(t, err)
+		u, err := userStorage.CreateUser(ctx, storage.User{Login: t.Name(), Password: "hash"})
+		require.NoError(t, err)
+		v1, err := largeObjectVaults.CreateVault(ctx, storage.Vault{Key: "k1", Value: []byte("v1"), UserID: u.ID})
+		require.NoError(t, err)
+		v2, err := largeObjectVaults.CreateVault(ctx, storage.Vault{Key: "k2", UserID: u.ID})
+		require.NoError(t, err)
+		files := countFiles(t, dir)
+
+		moved, err := blobVaults.MoveLargeObjects(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, moved)
+		assert.Equal(t, files+2, countFiles(t, dir))
+
+		var largeObjects int
+		require.NoError(t, db.DB.GetContext(ctx, &largeObjects, `SELECT count(*) FROM vault WHERE value IS NOT NULL`))
+		assert.Zero(t, largeObjects)
+		got, err := blobVaults.GetVault(ctx, v1.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("v1"), got.Value)
+		got, err = blobVaults.GetVault(ctx, v2.ID)
+		require.NoError(t, err)
+		assert.Empty(t, got.Value)
+
+		// Nothing is left to move.
+		moved, err = blobVaults.MoveLargeObjects(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, moved)
+
+		// Updating a vault keeps the replaced blob for the grace period.
+		require.NoError(t, blobVaults.UpdateVault(ctx, storage.Vault{ID: v1.ID, Key: "k1", Value: []byte("v2"), UserID: u.ID}))
+		assert.Equal(t, files+3, countFiles(t, dir))
+		deleted, err := blobVaults.CollectBlobs(ctx, time.Hour)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+		deleted, err = blobVaults.CollectBlobs(ctx, 0)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, deleted)
+		assert.Equal(t, files+2, countFiles(t, dir))
+
+		// Deleting the user deletes the blobs after the grace period.
+		require.NoError(t, userStorage.DeleteUser(ctx, u.ID))
+		assert.Equal(t, files+2, countFiles(t, dir))
+		deleted, err = blobVaults.CollectBlobs(ctx, 0)
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, deleted)
+		assert.Equal(t, files, countFiles(t, dir))
+	})
+}
@@ -8,7 +8,7 @@ import (
 	"os"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jmoiron/sqlx"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
@@ -16,7 +16,7 @@ import (
 
 type DB struct {
 	DB       *sqlx.DB
-	Conn     *pgx.Conn
+	Pool     *pgxpool.Pool
 	pool     *dockertest.Pool
 	resource *dockertest.Resource
 	dbURL    string
@@ -69,12 +69,16 @@ func (d *DB) SetupDB(ctx context.Context, migrationPath string) error {
 		return fmt.Errorf("could not connect to postgres container: %w", err)
 	}
 
-	d.Conn, err = pgx.Connect(ctx, d.dbURL)
+	d.Pool, err = pgxpool.New(ctx, d.dbURL)
 	if err != nil {
 		return fmt.Errorf("could not connect to postgres: %w", err)
 	}
 
-	err = Migration(ctx, migrationPath, d.DB)
+	migrator, err := NewMigrator(d.DB, os.DirFS(migrationPath))
+	if err != nil {
+		return fmt.Errorf("could not read migrations: %w", err)
+	}
+	_, err = migrator.Up(ctx)
 	if err != nil {
 		return fmt.Errorf("could not migrate: %w", err)
 	}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// BlobDeletionGracePeriod is how long the blobs of replaced and deleted vault values are kept before CollectBlobs
+// deletes them, so that reads which found the old blob key and backups of older snapshots can still read them.
+// Backups must finish within it.
+const BlobDeletionGracePeriod = 24 * time.Hour
+
+// scheduleBlobDeletion records the blob of a replaced or deleted vault value for deletion by CollectBlobs.
+// It runs in the transaction replacing or deleting the value, so the blob is kept if the transaction fails.
+func scheduleBlobDeletion(ctx context.Context, tx pgx.Tx, key string) error {
+	_, err := tx.Exec(ctx, "INSERT INTO deleted_blobs (key) VALUES ($1) ON CONFLICT (key) DO NOTHING", key)
+	if err != nil {
+		return fmt.Errorf("failed to schedule deletion of blob %s: %w", key, err)
+	}
+	return nil
+}
+
+// CollectBlobs deletes the blobs of vault values which were replaced or deleted more than gracePeriod ago
+// from the blob store configured with WithBlobStore. Every blob is forgotten after it is deleted, so the
+// collection can be interrupted and resumed.
+// It takes a context.Context and the grace period as parameters.
+// Returns the number of deleted blobs and an error if any.
+func (s VaultStorage) CollectBlobs(ctx context.Context, gracePeriod time.Duration) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.CollectBlobs")
+	defer func() { tracing.End(span, err) }()
+
+	if s.blobs == nil {
+		return 0, errors.New("no blob store is configured")
+	}
+	rows, err := s.pool.Query(ctx, "SELECT key FROM deleted_blobs WHERE deleted_at < $1 ORDER BY deleted_at", time.Now().Add(-gracePeriod))
+	if err != nil {
+		return 0, fmt.Errorf("failed to list deleted blobs: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("failed to list deleted blobs: %w", err)
+	}
+
+	var deleted int64
+	defer func() { span.SetAttributes(attribute.Int64("deleted", deleted)) }()
+	for _, key := range keys {
+		if err = s.blobs.DeleteBlob(ctx, key); err != nil {
+			return deleted, fmt.Errorf("failed to delete blob %s: %w", key, err)
+		}
+		if _, err = s.pool.Exec(ctx, "DELETE FROM deleted_blobs WHERE key = $1", key); err != nil {
+			return deleted, fmt.Errorf("failed to forget deleted blob %s: %w", key, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// CollectLargeObjects deletes the large objects no vault refers to, left behind for example by vault values
+// deleted outside of the server. The database must not be shared with other applications storing large objects.
+// Large objects are created in the same transaction as the vault referring to them, so the collection
+// is safe while the server is running.
+// It takes a context.Context as a parameter.
+// Returns the number of deleted large objects and an error if any.
+func (s VaultStorage) CollectLargeObjects(ctx context.Context) (_ int64, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.CollectLargeObjects")
+	defer func() { tracing.End(span, err) }()
+
+	var deleted int64
+	err = s.pool.QueryRow(
+		ctx,
+		`SELECT count(lo_unlink(m.oid)) FROM pg_largeobject_metadata m WHERE NOT EXISTS (SELECT 1 FROM vault v WHERE v.value = m.oid)`,
+	).Scan(&deleted)
+	if err != nil {
+		return 0, fmt.Errorf("failed to collect large objects: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("deleted", deleted))
+	return deleted, nil
+}
+
+// VerifyLargeObjects finds the vaults whose value refers to a large object which does not exist.
+// It takes a context.Context as a parameter.
+// Returns the IDs of the vaults, ordered by ID, and an error if any.
+func (s VaultStorage) VerifyLargeObjects(ctx context.Context) (_ []uint64, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.VerifyLargeObjects")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := s.pool.Query(
+		ctx,
+		`SELECT id FROM vault v WHERE value IS NOT NULL AND NOT EXISTS (SELECT 1 FROM pg_largeobject_metadata m WHERE m.oid = v.value) ORDER BY id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify large objects: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uint64])
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify large objects: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,55 @@
+package postgres_test
+
+import (
+	"context"
+	"log"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance(t *testing.T) {
+	t.Parallel()
+	db := postgres.NewDB()
+	defer db.TeardownDB()
+	ctx := context.Background()
+	err := db.SetupDB(ctx, "../../../migrations")
+	if err != nil {
+		log.Fatalf("Could not setup postgres container: %v", err)
+	}
+
+	u, err := postgres.NewUserStorage(db.DB).CreateUser(ctx, storage.User{Login: "test", Password: "test"})
+	require.NoError(t, err)
+	vaultStorage := postgres.NewVaultStorage(db.Pool)
+	kept, err := vaultStorage.CreateVault(ctx, storage.Vault{Key: "kept", Value: []byte("v"), UserID: u.ID})
+	require.NoError(t, err)
+	broken, err := vaultStorage.CreateVault(ctx, storage.Vault{Key: "broken", Value: []byte("v"), UserID: u.ID})
+	require.NoError(t, err)
+
+	missing, err := vaultStorage.VerifyLargeObjects(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+	deleted, err := vaultStorage.CollectLargeObjects(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	// An orphaned large object and a vault whose large object was deleted behind the server's back.
+	_, err = db.DB.ExecContext(ctx, `SELECT lo_from_bytea(0, 'orphan')`)
+	require.NoError(t, err)
+	_, err = db.DB.ExecContext(ctx, `SELECT lo_unlink(value) FROM vault WHERE id = $1`, broken.ID)
+	require.NoError(t, err)
+
+	missing, err = vaultStorage.VerifyLargeObjects(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{broken.ID}, missing)
+	deleted, err = vaultStorage.CollectLargeObjects(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	got, err := vaultStorage.GetVault(ctx, kept.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), got.Value, "large objects of vaults are kept")
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
-	"os"
-	"path/filepath"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/andreevym/gophkeeper/pkg/logger"
@@ -13,38 +15,285 @@ import (
 	"go.uber.org/zap"
 )
 
-func ApplyMigration(ctx context.Context, db *sqlx.DB, sql string) error {
-	rCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
-	defer cancel()
+// migrationLockKey is the key of the advisory lock held while migrating, so that replicas starting at the same time
+// apply every migration once.
+const migrationLockKey = 0x676b5f6d69677261
 
-	_, err := db.ExecContext(rCtx, sql)
+// migrationFileName matches migration files, e.g. 00001_users.up.sql.
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// MigrationState is a schema migration and whether it has been applied to the database.
+type MigrationState struct {
+	Version   int64      // Schema version set by the migration.
+	Name      string     // Name of the migration.
+	AppliedAt *time.Time // When the migration was applied, nil if it is pending.
+}
+
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+// Migrator applies and rolls back versioned schema migrations. Applied versions are recorded in the
+// schema_migrations table, each migration runs in its own transaction under an advisory lock.
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []migration
+}
+
+// NewMigrator creates a new instance of Migrator.
+// It takes a *sqlx.DB instance which is used to interact with the database, and a file system holding the
+// migrations: NNNNN_name.up.sql and NNNNN_name.down.sql files for every schema version NNNNN.
+// Returns a pointer to a Migrator instance and an error if the migration files are invalid.
+func NewMigrator(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	names, err := fs.Glob(fsys, "*.sql")
 	if err != nil {
-		return fmt.Errorf("failed apply sql '%s': %w", sql, err)
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
 	}
 
-	return nil
+	byVersion := map[int64]*migration{}
+	for _, fileName := range names {
+		match := migrationFileName.FindStringSubmatch(fileName)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name '%s', expected NNNNN_name.up.sql or NNNNN_name.down.sql", fileName)
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in '%s': %w", fileName, err)
+		}
+		b, err := fs.ReadFile(fsys, fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration '%s': %w", fileName, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		}
+		if m.name != match[2] {
+			return nil, fmt.Errorf("migrations '%s' and '%s' have the same version %d", m.name, match[2], version)
+		}
+		if match[3] == "up" {
+			m.up = string(b)
+		} else {
+			m.down = string(b)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d %s has no up migration", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	return &Migrator{db: db, migrations: migrations}, nil
 }
 
-func Migration(ctx context.Context, migrationPath string, db *sqlx.DB) error {
-	err := filepath.Walk(migrationPath, func(path string, info fs.FileInfo, err error) error {
-		if !info.IsDir() {
-			logger.Logger().Info("apply migration", zap.String("path", path))
-			bytes, err := os.ReadFile(path)
+// Up applies all pending migrations in the order of their versions.
+// It takes a context.Context as a parameter.
+// Returns the number of applied migrations and an error if any.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	return m.UpTo(ctx, math.MaxInt64)
+}
+
+// UpTo applies the pending migrations up to the given version in the order of their versions,
+// for example to restore a backup of an older schema version.
+// It takes a context.Context and the version (int64) as parameters.
+// Returns the number of applied migrations and an error if any.
+func (m *Migrator) UpTo(ctx context.Context, version int64) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if mig.version > version {
+				break
+			}
+			if _, ok := versions[mig.version]; ok {
+				continue
+			}
+			logger.Logger().Info("apply migration", zap.Int64("version", mig.version), zap.String("name", mig.name))
+			err = runMigration(ctx, conn, mig.up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.version, mig.name)
 			if err != nil {
-				return err
+				return fmt.Errorf("apply migration %d %s: %w", mig.version, mig.name, err)
 			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the latest applied migrations.
+// It takes a context.Context and the number of migrations to roll back (int) as parameters.
+// Returns the number of rolled back migrations and an error if any.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	byVersion := map[int64]migration{}
+	for _, mig := range m.migrations {
+		byVersion[mig.version] = mig
+	}
 
-			sql := string(bytes)
-			err = ApplyMigration(ctx, db, sql)
+	rolledBack := 0
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		latest := make([]int64, 0, len(versions))
+		for version := range versions {
+			latest = append(latest, version)
+		}
+		sort.Slice(latest, func(i, j int) bool { return latest[i] > latest[j] })
+
+		for _, version := range latest {
+			if rolledBack == steps {
+				break
+			}
+			mig, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("migration %d %s is unknown to this version of the server", version, versions[version].Name)
+			}
+			if mig.down == "" {
+				return fmt.Errorf("migration %d %s has no down migration", mig.version, mig.name)
+			}
+			logger.Logger().Info("roll back migration", zap.Int64("version", mig.version), zap.String("name", mig.name))
+			err = runMigration(ctx, conn, mig.down, `DELETE FROM schema_migrations WHERE version = $1`, mig.version)
 			if err != nil {
-				return fmt.Errorf("apply migration, path '%s', sql '%s': %w", path, sql, err)
+				return fmt.Errorf("roll back migration %d %s: %w", mig.version, mig.name, err)
 			}
+			rolledBack++
 		}
+		return nil
+	})
+	return rolledBack, err
+}
 
+// Status lists the migrations known to this version of the server and the ones applied to the database,
+// ordered by version.
+// It takes a context.Context as a parameter.
+// Returns the list of migration states and an error if any.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationState, error) {
+	var states []MigrationState
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			state := MigrationState{Version: mig.version, Name: mig.name}
+			if applied, ok := versions[mig.version]; ok {
+				state.AppliedAt = applied.AppliedAt
+				delete(versions, mig.version)
+			}
+			states = append(states, state)
+		}
+		for _, applied := range versions {
+			states = append(states, applied)
+		}
 		return nil
 	})
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, err
+}
+
+// Pending lists the migrations known to this version of the server which have not been applied to the database,
+// ordered by version. Unlike Status it doesn't wait for a migration running on another replica.
+// It takes a context.Context as a parameter.
+// Returns the list of pending migration states and an error if any, also if no migration has been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]MigrationState, error) {
+	versions, err := appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []MigrationState
+	for _, mig := range m.migrations {
+		if _, ok := versions[mig.version]; !ok {
+			pending = append(pending, MigrationState{Version: mig.version, Name: mig.name})
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on a connection holding the migration lock, creating the schema_migrations table if needed.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    BIGINT PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions returns the migrations recorded in the schema_migrations table by version.
+func appliedVersions(ctx context.Context, q sqlx.QueryerContext) (map[int64]MigrationState, error) {
+	rows, err := q.QueryxContext(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	versions := map[int64]MigrationState{}
+	for rows.Next() {
+		var state MigrationState
+		var appliedAt time.Time
+		err = rows.Scan(&state.Version, &state.Name, &appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+		}
+		state.AppliedAt = &appliedAt
+		versions[state.Version] = state
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	return versions, nil
+}
+
+// runMigration executes the statements of a migration and records it in a single transaction.
+func runMigration(ctx context.Context, conn *sqlx.Conn, statements string, record string, args ...any) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, statements)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("exec migration: %w", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
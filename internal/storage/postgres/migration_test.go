@@ -0,0 +1,153 @@
+package postgres_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/migrations"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMigrator(t *testing.T) {
+	t.Run("embedded migrations", func(t *testing.T) {
+		_, err := postgres.NewMigrator(nil, migrations.FS)
+		require.NoError(t, err)
+
+		// Every migration can be rolled back.
+		entries, err := migrations.FS.ReadDir(".")
+		require.NoError(t, err)
+		ups, downs := 0, 0
+		for _, e := range entries {
+			switch {
+			case strings.HasSuffix(e.Name(), ".up.sql"):
+				ups++
+			case strings.HasSuffix(e.Name(), ".down.sql"):
+				downs++
+			}
+		}
+		assert.NotZero(t, ups)
+		assert.Equal(t, ups, downs)
+
+		// The embedded files are the ones in the migrations directory.
+		onDisk, err := os.ReadDir("../../../migrations")
+		require.NoError(t, err)
+		assert.Len(t, entries, len(onDisk)-1) // migrations.go
+	})
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr string
+	}{
+		{
+			name: "valid",
+			files: fstest.MapFS{
+				"00002_b.up.sql":   {Data: []byte("b")},
+				"00001_a.up.sql":   {Data: []byte("a")},
+				"00001_a.down.sql": {Data: []byte("a")},
+			},
+		},
+		{
+			name:    "invalid file name",
+			files:   fstest.MapFS{"users.sql": {Data: []byte("a")}},
+			wantErr: "invalid migration file name",
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"00001_a.up.sql": {Data: []byte("a")},
+				"00001_b.up.sql": {Data: []byte("b")},
+			},
+			wantErr: "same version 1",
+		},
+		{
+			name:    "down without up",
+			files:   fstest.MapFS{"00001_a.down.sql": {Data: []byte("a")}},
+			wantErr: "has no up migration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := postgres.NewMigrator(nil, tt.files)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	t.Parallel()
+	db := postgres.NewDB()
+	defer db.TeardownDB()
+	ctx := context.Background()
+	err := db.SetupDB(ctx, "../../../migrations")
+	if err != nil {
+		log.Fatalf("Could not setup postgres container: %v", err)
+	}
+
+	migrator, err := postgres.NewMigrator(db.DB, migrations.FS)
+	require.NoError(t, err)
+
+	// SetupDB has applied all migrations.
+	states, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, states)
+	for _, state := range states {
+		assert.NotNil(t, state.AppliedAt, state.Name)
+	}
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, applied)
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// Roll back the latest migration.
+	rolledBack, err := migrator.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rolledBack)
+	states, err = migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, states[len(states)-1].AppliedAt)
+	assert.NotNil(t, states[len(states)-2].AppliedAt)
+	pending, err = migrator.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, states[len(states)-1].Version, pending[0].Version)
+
+	// Roll back everything, then migrate concurrently like replicas starting at the same time.
+	rolledBack, err = migrator.Down(ctx, len(states))
+	require.NoError(t, err)
+	assert.Equal(t, len(states)-1, rolledBack)
+	var tables int
+	require.NoError(t, db.DB.GetContext(ctx, &tables, `SELECT count(*) FROM information_schema.tables WHERE table_schema = 'public' AND table_name <> 'schema_migrations'`))
+	assert.Zero(t, tables)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	total := 0
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := migrator.Up(ctx)
+			assert.NoError(t, err)
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, len(states), total)
+}
@@ -0,0 +1,51 @@
+package postgres
+
+import "github.com/andreevym/gophkeeper/internal/storage"
+
+// Option configures UserStorage and VaultStorage.
+type Option func(*options)
+
+type options struct {
+	blobs        storage.BlobStore
+	defaultQuota storage.Quota
+	observer     LargeObjectObserver
+}
+
+// LargeObjectObserver is notified of the bytes of vault values read from and written to large objects,
+// for example to export them as metrics.
+type LargeObjectObserver interface {
+	LargeObjectRead(n int64)    // LargeObjectRead is called with the number of bytes read from a large object.
+	LargeObjectWritten(n int64) // LargeObjectWritten is called with the number of bytes written to a large object.
+}
+
+// WithBlobStore stores the values of new and updated vault entries in the blob store instead of
+// PostgreSQL large objects. Entries still kept in large objects stay readable,
+// VaultStorage.MoveLargeObjects moves them to the blob store.
+func WithBlobStore(blobs storage.BlobStore) Option {
+	return func(o *options) {
+		o.blobs = blobs
+	}
+}
+
+// WithDefaultQuota sets the quota of users without a quota set with VaultStorage.SetQuota.
+// Without it, the storage of users is only limited by their own quota.
+func WithDefaultQuota(q storage.Quota) Option {
+	return func(o *options) {
+		o.defaultQuota = q
+	}
+}
+
+// WithLargeObjectObserver notifies the observer of the bytes VaultStorage reads from and writes to large objects.
+func WithLargeObjectObserver(observer LargeObjectObserver) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
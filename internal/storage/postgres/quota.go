@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetUsage retrieves the vault storage used by a user.
+// It takes a context.Context and a user ID (uint64) as parameters.
+// Returns a storage.Usage object and an error if any.
+func (s VaultStorage) GetUsage(ctx context.Context, userID uint64) (storage.Usage, error) {
+	return getUsage(ctx, s.pool, userID)
+}
+
+// GetQuota retrieves the quota of a user, the default quota set with WithDefaultQuota unless overridden.
+// It takes a context.Context and a user ID (uint64) as parameters.
+// Returns a storage.Quota object and an error if any.
+func (s VaultStorage) GetQuota(ctx context.Context, userID uint64) (storage.Quota, error) {
+	return s.getQuota(ctx, s.pool, userID)
+}
+
+// SetQuota overrides the default quota for a user.
+// It takes a context.Context, a user ID (uint64) and a storage.Quota object as parameters.
+// Returns an error if any.
+func (s VaultStorage) SetQuota(ctx context.Context, userID uint64, q storage.Quota) error {
+	_, err := s.pool.Exec(
+		ctx,
+		`INSERT INTO user_quotas (user_id, max_bytes, max_entries) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET max_bytes = excluded.max_bytes, max_entries = excluded.max_entries`,
+		userID, q.MaxBytes, q.MaxEntries,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set quota of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// DeleteQuota removes the quota of a user set with SetQuota.
+// It takes a context.Context and a user ID (uint64) as parameters.
+// Returns an error if any.
+func (s VaultStorage) DeleteQuota(ctx context.Context, userID uint64) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM user_quotas WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete quota of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// querier is implemented by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func getUsage(ctx context.Context, q querier, userID uint64) (storage.Usage, error) {
+	var u storage.Usage
+	err := q.QueryRow(ctx, `SELECT count(*), COALESCE(sum(size), 0) FROM vault WHERE user_id = $1`, userID).Scan(&u.Entries, &u.Bytes)
+	if err != nil {
+		return u, fmt.Errorf("failed to get usage of user %d: %w", userID, err)
+	}
+	return u, nil
+}
+
+func (s VaultStorage) getQuota(ctx context.Context, q querier, userID uint64) (storage.Quota, error) {
+	quota := storage.Quota{}
+	err := q.QueryRow(ctx, `SELECT max_bytes, max_entries FROM user_quotas WHERE user_id = $1`, userID).Scan(&quota.MaxBytes, &quota.MaxEntries)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.defaultQuota, nil
+	}
+	if err != nil {
+		return quota, fmt.Errorf("failed to get quota of user %d: %w", userID, err)
+	}
+	return quota, nil
+}
+
+// checkQuota locks the row of the user until the end of the transaction, so writes of the same user are
+// serialized and can't exceed the quota together, and checks the write with storage.CheckQuota.
+func (s VaultStorage) checkQuota(ctx context.Context, tx pgx.Tx, userID uint64, size int64, delta storage.Usage) error {
+	// FOR NO KEY UPDATE doesn't block inserts referencing the user, e.g. of access tokens.
+	_, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to lock user %d: %w", userID, err)
+	}
+	quota, err := s.getQuota(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if quota == (storage.Quota{}) {
+		return nil
+	}
+	used, err := getUsage(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	return storage.CheckQuota(quota, used, size, delta)
+}
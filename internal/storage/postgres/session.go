@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+const sessionColumns = `id, user_id, device_name, user_agent, ip, created_at, last_seen_at, revoked_at`
+
+// SessionStorage handles operations related to sign-in sessions in a PostgreSQL database.
+type SessionStorage struct {
+	db *sqlx.DB
+}
+
+// NewSessionStorage creates a new instance of SessionStorage.
+// It takes a *sqlx.DB instance which is used to interact with the database.
+// Returns a pointer to a SessionStorage instance.
+func NewSessionStorage(db *sqlx.DB) *SessionStorage {
+	return &SessionStorage{db: db}
+}
+
+// GetSession retrieves a session by its ID.
+// If the session is not found, it returns storage.ErrSessionNotFound.
+func (s SessionStorage) GetSession(ctx context.Context, id uint64) (storage.Session, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = $1`, id)
+	session, err := scanSession(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return session, storage.ErrSessionNotFound
+		}
+		return session, fmt.Errorf("failed to get session by id %d: %w", id, err)
+	}
+
+	return session, nil
+}
+
+// ListSessions retrieves the sessions of the user which are not revoked, most recently seen first.
+func (s SessionStorage) ListSessions(ctx context.Context, userID uint64) ([]storage.Session, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE user_id = $1 AND revoked_at IS NULL ORDER BY last_seen_at DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions by user id %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	sessions := make([]storage.Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions by user id %d: %w", userID, err)
+	}
+
+	return sessions, nil
+}
+
+// CreateSession inserts a new session into the database.
+// Returns the created storage.Session object and an error if any.
+func (s SessionStorage) CreateSession(ctx context.Context, session storage.Session) (storage.Session, error) {
+	err := s.db.QueryRowContext(
+		ctx,
+		`INSERT INTO sessions (user_id, device_name, user_agent, ip, created_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $5) RETURNING id, last_seen_at`,
+		session.UserID, session.DeviceName, session.UserAgent, session.IP, session.CreatedAt,
+	).Scan(&session.ID, &session.LastSeenAt)
+	if err != nil {
+		return session, fmt.Errorf("failed to create session for user id %d: %w", session.UserID, err)
+	}
+
+	return session, nil
+}
+
+// TouchSession updates the last-seen time of the session.
+func (s SessionStorage) TouchSession(ctx context.Context, id uint64, seenAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE sessions SET last_seen_at = $2 WHERE id = $1`, id, seenAt)
+	if err != nil {
+		return fmt.Errorf("failed to touch session by id %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// RevokeSession marks the session as revoked. Revoking an already revoked session keeps the original revocation time.
+func (s SessionStorage) RevokeSession(ctx context.Context, id uint64, revokedAt time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`, id, revokedAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session by id %d: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session by id %d: %w", id, err)
+	}
+	if n == 0 {
+		return storage.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions marks all active sessions of the user except keepID as revoked.
+func (s SessionStorage) RevokeOtherSessions(ctx context.Context, userID, keepID uint64, revokedAt time.Time) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE sessions SET revoked_at = $3 WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`,
+		userID, keepID, revokedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions by user id %d: %w", userID, err)
+	}
+
+	return nil
+}
+
+// scanSession reads a single sessions row selected with sessionColumns.
+func scanSession(row rowScanner) (storage.Session, error) {
+	var session storage.Session
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent, &session.IP,
+		&session.CreatedAt, &session.LastSeenAt, &session.RevokedAt,
+	)
+	return session, err
+}
@@ -0,0 +1,30 @@
+package postgres_test
+
+import (
+	"context"
+	"log"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/storage/postgres"
+	"github.com/andreevym/gophkeeper/internal/storage/storagetest"
+	_ "github.com/lib/pq"
+)
+
+func TestStorage(t *testing.T) {
+	t.Parallel()
+	db := postgres.NewDB()
+	defer db.TeardownDB()
+	ctx := context.Background()
+	err := db.SetupDB(ctx, "../../../migrations")
+	if err != nil {
+		log.Fatalf("Could not setup postgres container: %v", err)
+	}
+
+	vaultStorage := postgres.NewVaultStorage(db.Pool)
+	storagetest.Run(t, storagetest.Backend{
+		Users:  postgres.NewUserStorage(db.DB),
+		Vaults: vaultStorage,
+		Quotas: vaultStorage,
+		Audit:  postgres.NewAuditStorage(db.DB),
+	})
+}
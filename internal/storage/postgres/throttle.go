@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// ThrottleStorage keeps the sign-in throttling state and the failed sign-in log in a PostgreSQL database,
+// so that it is shared by all server replicas.
+type ThrottleStorage struct {
+	db *sqlx.DB
+}
+
+// NewThrottleStorage creates a new instance of ThrottleStorage.
+// It takes a *sqlx.DB instance which is used to interact with the database.
+// Returns a pointer to a ThrottleStorage instance.
+func NewThrottleStorage(db *sqlx.DB) *ThrottleStorage {
+	return &ThrottleStorage{db: db}
+}
+
+// ReserveThrottle counts a sign-in attempt in progress for a key in a single statement,
+// forgetting pending attempts reserved longer than timeout ago.
+func (s ThrottleStorage) ReserveThrottle(ctx context.Context, key string, now time.Time, timeout time.Duration) (storage.ThrottleState, error) {
+	state := storage.ThrottleState{Key: key}
+	err := s.db.QueryRowContext(
+		ctx,
+		`INSERT INTO sign_in_throttle (key, failures, last_failure_at, pending, reserved_at) VALUES ($1, 0, to_timestamp(0), 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			pending = CASE WHEN sign_in_throttle.reserved_at < $3 THEN 1 ELSE sign_in_throttle.pending + 1 END,
+			reserved_at = EXCLUDED.reserved_at
+		RETURNING failures, last_failure_at, pending, reserved_at`,
+		key, now, now.Add(-timeout),
+	).Scan(&state.Failures, &state.LastFailureAt, &state.Pending, &state.ReservedAt)
+	if err != nil {
+		return state, fmt.Errorf("failed to reserve throttle by key %s: %w", key, err)
+	}
+
+	return state, nil
+}
+
+// ReleaseThrottle ends an attempt reserved with ReserveThrottle,
+// deleting the state of the key once it has neither failures nor pending attempts.
+func (s ThrottleStorage) ReleaseThrottle(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE sign_in_throttle SET pending = pending - 1 WHERE key = $1 AND pending > 0`, key)
+	if err != nil {
+		return fmt.Errorf("failed to release throttle by key %s: %w", key, err)
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM sign_in_throttle WHERE key = $1 AND failures = 0 AND pending = 0`, key)
+	if err != nil {
+		return fmt.Errorf("failed to release throttle by key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// AddThrottleFailure increments the failure counter of a key in a single statement,
+// starting over if the previous failure is older than window.
+func (s ThrottleStorage) AddThrottleFailure(ctx context.Context, key string, now time.Time, window time.Duration) (storage.ThrottleState, error) {
+	state := storage.ThrottleState{Key: key}
+	err := s.db.QueryRowContext(
+		ctx,
+		`INSERT INTO sign_in_throttle (key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN sign_in_throttle.last_failure_at < $3 THEN 1 ELSE sign_in_throttle.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures, last_failure_at`,
+		key, now, now.Add(-window),
+	).Scan(&state.Failures, &state.LastFailureAt)
+	if err != nil {
+		return state, fmt.Errorf("failed to add throttle failure by key %s: %w", key, err)
+	}
+
+	return state, nil
+}
+
+// ResetThrottle deletes the state of a key.
+func (s ThrottleStorage) ResetThrottle(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sign_in_throttle WHERE key = $1`, key)
+	if err != nil {
+		return fmt.Errorf("failed to reset throttle by key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// CreateFailedSignIn inserts a failed sign-in attempt into the database.
+// Attempts with an unknown login are stored without a user ID.
+func (s ThrottleStorage) CreateFailedSignIn(ctx context.Context, a storage.FailedSignIn) error {
+	var userID sql.NullInt64
+	if a.UserID != 0 {
+		userID = sql.NullInt64{Int64: int64(a.UserID), Valid: true}
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO failed_sign_ins (user_id, login, ip, user_agent, reason, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		userID, a.Login, a.IP, a.UserAgent, a.Reason, a.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create failed sign-in for login %s: %w", a.Login, err)
+	}
+
+	return nil
+}
+
+// ListFailedSignIns retrieves the most recent failed sign-in attempts against the user, newest first.
+func (s ThrottleStorage) ListFailedSignIns(ctx context.Context, userID uint64, limit int) ([]storage.FailedSignIn, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, user_id, login, ip, user_agent, reason, created_at FROM failed_sign_ins
+		WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`,
+		userID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed sign-ins by user id %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	attempts := make([]storage.FailedSignIn, 0)
+	for rows.Next() {
+		a := storage.FailedSignIn{}
+		err = rows.Scan(&a.ID, &a.UserID, &a.Login, &a.IP, &a.UserAgent, &a.Reason, &a.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan failed sign-in: %w", err)
+		}
+		attempts = append(attempts, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list failed sign-ins by user id %d: %w", userID, err)
+	}
+
+	return attempts, nil
+}
@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the spans of the operations of UserStorage and VaultStorage.
+var tracer = otel.Tracer("github.com/andreevym/gophkeeper/internal/storage/postgres")
+
+// startSpan starts a span of a storage operation, e.g. "postgres.VaultStorage.GetVault".
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "postgres."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL),
+		trace.WithAttributes(attrs...),
+	)
+}
@@ -7,13 +7,34 @@ import (
 	"strings"
 
 	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/tracing"
 	"github.com/jackc/pgx/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-var (
-	ErrUserNotFound = errors.New("user not found")
-)
+// loginConstraint is the unique index on the lowercase logins of users.
+const loginConstraint = "users_login_key"
+
+// isLoginTaken reports whether err is a violation of the unique index on logins.
+func isLoginTaken(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == loginConstraint
+}
+
+// userColumns are the columns of users read by scanUser.
+const userColumns = `id, login, password, totp_secret, totp_enabled, totp_last_step, recovery_codes, token_version, srp_salt, srp_verifier, role, disabled, revision`
+
+// scanUser reads a single users row selected with userColumns.
+func scanUser(row rowScanner) (storage.User, error) {
+	var u storage.User
+	err := row.Scan(
+		&u.ID, &u.Login, &u.Password, &u.TOTPSecret, &u.TOTPEnabled, &u.TOTPLastStep, (*pq.StringArray)(&u.RecoveryCodes),
+		&u.TokenVersion, &u.SRPSalt, &u.SRPVerifier, &u.Role, &u.Disabled, &u.Revision,
+	)
+	return u, err
+}
 
 // UserStorage handles operations related to user data in a PostgreSQL database.
 type UserStorage struct {
@@ -22,6 +43,7 @@ type UserStorage struct {
 
 // NewUserStorage creates a new instance of UserStorage.
 // It takes a *sqlx.DB instance which is used to interact with the database.
+// The blobs of the vault values of deleted users are deleted later by VaultStorage.CollectBlobs.
 // Returns a pointer to a UserStorage instance.
 func NewUserStorage(db *sqlx.DB) *UserStorage {
 	return &UserStorage{db: db}
@@ -30,16 +52,15 @@ func NewUserStorage(db *sqlx.DB) *UserStorage {
 // GetUser retrieves a user by their ID.
 // It takes a context.Context and a user ID (uint64) as parameters.
 // Returns a storage.User object and an error if any.
-// If the user is not found, it returns ErrUserNotFound.
-func (s UserStorage) GetUser(ctx context.Context, id uint64) (storage.User, error) {
-	sql := `SELECT login, password FROM users WHERE id = $1`
-	u := storage.User{
-		ID: id,
-	}
-	err := s.db.QueryRowContext(ctx, sql, id).Scan(&u.Login, &u.Password)
+// If the user is not found, it returns storage.ErrUserNotFound.
+func (s UserStorage) GetUser(ctx context.Context, id uint64) (_ storage.User, err error) {
+	ctx, span := startSpan(ctx, "UserStorage.GetUser", attribute.Int64("user.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+
+	u, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
 	if err != nil {
 		if strings.Contains(err.Error(), pgx.ErrNoRows.Error()) {
-			return u, ErrUserNotFound
+			return u, storage.ErrUserNotFound
 		}
 		return u, fmt.Errorf("failed to get user by id %d: %w", id, err)
 	}
@@ -47,19 +68,18 @@ func (s UserStorage) GetUser(ctx context.Context, id uint64) (storage.User, erro
 	return u, nil
 }
 
-// GetUserByLogin retrieves a user by their login.
+// GetUserByLogin retrieves a user by their login, ignoring case.
 // It takes a context.Context and a login string as parameters.
 // Returns a storage.User object and an error if any.
-// If the user is not found, it returns ErrUserNotFound.
-func (s UserStorage) GetUserByLogin(ctx context.Context, login string) (storage.User, error) {
-	sql := `SELECT id, password FROM users WHERE login = $1`
-	u := storage.User{
-		Login: login,
-	}
-	err := s.db.QueryRowContext(ctx, sql, login).Scan(&u.ID, &u.Password)
+// If the user is not found, it returns storage.ErrUserNotFound.
+func (s UserStorage) GetUserByLogin(ctx context.Context, login string) (_ storage.User, err error) {
+	ctx, span := startSpan(ctx, "UserStorage.GetUserByLogin")
+	defer func() { tracing.End(span, err) }()
+
+	u, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE lower(login) = lower($1)`, login))
 	if err != nil {
 		if strings.Contains(err.Error(), pgx.ErrNoRows.Error()) {
-			return u, ErrUserNotFound
+			return u, storage.ErrUserNotFound
 		}
 		return u, fmt.Errorf("failed to get user by login %s: %w", login, err)
 	}
@@ -67,47 +87,131 @@ func (s UserStorage) GetUserByLogin(ctx context.Context, login string) (storage.
 	return u, nil
 }
 
-// CreateUser inserts a new user into the database.
-// It takes a context.Context and a storage.User object as parameters.
-// Returns the created storage.User object and an error if any.
-func (s UserStorage) CreateUser(ctx context.Context, u storage.User) (storage.User, error) {
-	rows, err := s.db.QueryContext(ctx, "INSERT INTO users (login, password) VALUES ($1, $2) RETURNING id", u.Login, u.Password)
+// ListUsers retrieves the users whose login contains the query ignoring case, ordered by ID.
+// It takes a context.Context, the query, the ID of the user to list the following users of and the maximum number of users.
+// Returns a list of storage.User objects and an error if any.
+func (s UserStorage) ListUsers(ctx context.Context, query string, afterID uint64, limit int) (_ []storage.User, err error) {
+	ctx, span := startSpan(ctx, "UserStorage.ListUsers")
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+userColumns+` FROM users WHERE id > $1 AND strpos(lower(login), lower($2)) > 0 ORDER BY id LIMIT $3`,
+		afterID, query, limit,
+	)
 	if err != nil {
-		return u, fmt.Errorf("failed to create user %s: %w", u.Login, err)
+		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
+	defer rows.Close()
 
-	if rows.Next() {
-		err = rows.Scan(&u.ID)
+	users := []storage.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
 		if err != nil {
-			return u, fmt.Errorf("failed to create user %s: %w", u.Login, err)
+			return nil, fmt.Errorf("failed to list users: %w", err)
 		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, nil
+}
+
+// CreateUser inserts a new user into the database.
+// It takes a context.Context and a storage.User object as parameters.
+// Returns the created storage.User object and an error if any.
+// If the login is taken ignoring case, it returns storage.ErrLoginTaken.
+func (s UserStorage) CreateUser(ctx context.Context, u storage.User) (_ storage.User, err error) {
+	ctx, span := startSpan(ctx, "UserStorage.CreateUser")
+	defer func() { tracing.End(span, err) }()
+
+	if u.Role == "" {
+		u.Role = storage.RoleUser
+	}
+	err = s.db.QueryRowContext(
+		ctx,
+		`INSERT INTO users (login, password, srp_salt, srp_verifier, role, disabled)
+		VALUES ($1, $2, COALESCE($3, ''::BYTEA), COALESCE($4, ''::BYTEA), $5, $6) RETURNING id`,
+		u.Login, u.Password, u.SRPSalt, u.SRPVerifier, u.Role, u.Disabled,
+	).Scan(&u.ID)
+	if isLoginTaken(err) {
+		return u, storage.ErrLoginTaken
+	}
+	if err != nil {
+		return u, fmt.Errorf("failed to create user %s: %w", u.Login, err)
 	}
 
 	return u, nil
 }
 
-// UpdateUser updates an existing user in the database.
+// UpdateUser updates an existing user in the database if its revision is still the one of the user.
 // It takes a context.Context and a storage.User object as parameters.
 // Returns an error if any.
-func (s UserStorage) UpdateUser(ctx context.Context, u storage.User) error {
-	sql := `UPDATE users SET login = $2, password = $3 WHERE id = $1`
-	_, err := s.db.ExecContext(ctx, sql, u.ID, u.Login, u.Password)
+// If the login is taken by another user ignoring case, it returns storage.ErrLoginTaken.
+// If the user was changed or deleted since it was read, it returns storage.ErrUserConflict.
+func (s UserStorage) UpdateUser(ctx context.Context, u storage.User) (err error) {
+	ctx, span := startSpan(ctx, "UserStorage.UpdateUser", attribute.Int64("user.id", int64(u.ID)))
+	defer func() { tracing.End(span, err) }()
+
+	sql := `UPDATE users SET login = $2, password = $3, totp_secret = $4, totp_enabled = $5, totp_last_step = $6, recovery_codes = COALESCE($7::TEXT[], '{}'), token_version = $8,
+		srp_salt = COALESCE($9, ''::BYTEA), srp_verifier = COALESCE($10, ''::BYTEA), role = $11, disabled = $12, revision = revision + 1
+		WHERE id = $1 AND revision = $13`
+	res, err := s.db.ExecContext(
+		ctx, sql, u.ID, u.Login, u.Password, u.TOTPSecret, u.TOTPEnabled, u.TOTPLastStep, pq.StringArray(u.RecoveryCodes), u.TokenVersion, u.SRPSalt, u.SRPVerifier,
+		u.Role, u.Disabled, u.Revision,
+	)
+	if isLoginTaken(err) {
+		return storage.ErrLoginTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update user by id %d, login %s: %w", u.ID, u.Login, err)
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to update user by id %d, login %s: %w", u.ID, u.Login, err)
 	}
+	if n == 0 {
+		return storage.ErrUserConflict
+	}
 
 	return nil
 }
 
-// DeleteUser removes a user from the database by their ID.
+// DeleteUser removes a user from the database by their ID together with all their data:
+// vault entries and their large objects or blobs, personal access tokens and the quota.
+// Everything in the database is deleted in a single transaction, so a failure leaves the account intact.
+// Blobs are deleted by VaultStorage.CollectBlobs after BlobDeletionGracePeriod.
 // It takes a context.Context and a user ID (uint64) as parameters.
 // Returns an error if any.
-func (s UserStorage) DeleteUser(ctx context.Context, id uint64) error {
-	sql := `DELETE FROM users WHERE id = $1`
-	_, err := s.db.ExecContext(ctx, sql, id)
+func (s UserStorage) DeleteUser(ctx context.Context, id uint64) (err error) {
+	ctx, span := startSpan(ctx, "UserStorage.DeleteUser", attribute.Int64("user.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to delete user by id %d: %w", id, err)
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`SELECT lo_unlink(value) FROM vault WHERE user_id = $1 AND value IS NOT NULL`,
+		`INSERT INTO deleted_blobs (key) SELECT blob_key FROM vault WHERE user_id = $1 AND blob_key IS NOT NULL ON CONFLICT (key) DO NOTHING`,
+		`DELETE FROM vault WHERE user_id = $1`,
+		`DELETE FROM access_tokens WHERE user_id = $1`,
+		`DELETE FROM user_quotas WHERE user_id = $1`,
+		`DELETE FROM users WHERE id = $1`,
+	}
+	for _, sql := range queries {
+		_, err = tx.ExecContext(ctx, sql, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete user by id %d: %w", id, err)
+		}
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
@@ -63,9 +63,23 @@ func TestUserRepository(t *testing.T) {
 	require.Equal(t, updateduser1.Login, afterUpdateuser1.Login)
 	require.Equal(t, updateduser1.Password, afterUpdateuser1.Password)
 
+	// Deleting a user also deletes the vault entries and their large objects.
+	vaultStorage := postgres.NewVaultStorage(db.Pool)
+	v, err := vaultStorage.CreateVault(ctx, storage.Vault{Key: "k1", Value: []byte("v1"), UserID: 1})
+	require.NoError(t, err)
+	var oid uint32
+	err = db.DB.QueryRowContext(ctx, "SELECT value FROM vault WHERE id = $1", v.ID).Scan(&oid)
+	require.NoError(t, err)
+
 	err = userStorage.DeleteUser(ctx, 1)
 	require.NoError(t, err)
 
 	_, err = userStorage.GetUser(ctx, 1)
-	require.EqualError(t, err, postgres.ErrUserNotFound.Error())
+	require.EqualError(t, err, storage.ErrUserNotFound.Error())
+	_, err = vaultStorage.GetVault(ctx, v.ID)
+	require.ErrorIs(t, err, storage.ErrVaultNotFound)
+	var objects int
+	err = db.DB.QueryRowContext(ctx, "SELECT count(*) FROM pg_largeobject_metadata WHERE oid = $1", oid).Scan(&objects)
+	require.NoError(t, err)
+	require.Zero(t, objects)
 }
@@ -6,107 +6,225 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strings"
 
 	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/tracing"
+	"github.com/andreevym/gophkeeper/pkg/logger"
 	"github.com/jackc/pgx/v5"
-	"github.com/jmoiron/sqlx"
-)
-
-var (
-	ErrVaultNotFound = errors.New("vault not found")
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
 )
 
 // VaultStorage handles operations related to vault data in a PostgreSQL database.
+// Values are kept in PostgreSQL large objects, or in a storage.BlobStore if one is configured with WithBlobStore.
+// Every operation runs in its own transaction on a connection of the pool, so VaultStorage is safe for concurrent use.
+// VaultStorage also implements storage.QuotaStorage, creating and updating vaults checks the quota of the owner.
 type VaultStorage struct {
-	db   *sqlx.DB
-	conn *pgx.Conn
+	pool         *pgxpool.Pool
+	blobs        storage.BlobStore
+	defaultQuota storage.Quota
+	observer     LargeObjectObserver
 }
 
 // NewVaultStorage creates a new instance of VaultStorage.
-// It takes a *sqlx.DB and a *pgx.Conn instance which are used to interact with the database.
+// It takes a *pgxpool.Pool instance which is used to interact with the database, and options.
 // Returns a pointer to a VaultStorage instance.
-func NewVaultStorage(db *sqlx.DB, conn *pgx.Conn) *VaultStorage {
-	return &VaultStorage{db: db, conn: conn}
+func NewVaultStorage(pool *pgxpool.Pool, opts ...Option) *VaultStorage {
+	o := newOptions(opts)
+	return &VaultStorage{pool: pool, blobs: o.blobs, defaultQuota: o.defaultQuota, observer: o.observer}
 }
 
 // GetVault retrieves a vault by its ID.
+// The vault and its large object are read in the same transaction, so they belong to the same snapshot.
 // It takes a context.Context and a vault ID (uint64) as parameters.
 // Returns a storage.Vault object and an error if any.
-// If the vault is not found, it returns ErrVaultNotFound.
-func (s VaultStorage) GetVault(ctx context.Context, id uint64) (storage.Vault, error) {
-	tx, err := s.conn.Begin(ctx)
+// If the vault is not found, it returns storage.ErrVaultNotFound.
+func (s VaultStorage) GetVault(ctx context.Context, id uint64) (_ storage.Vault, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.GetVault", attribute.Int64("vault.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
 	if err != nil {
 		return storage.Vault{}, fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	var oid uint32
+	var oid *uint32
+	var blobKey *string
 	var v storage.Vault
-	err = s.db.QueryRowContext(ctx, "SELECT key, value, user_id FROM vault WHERE id = $1", id).Scan(&v.Key, &oid, &v.UserID)
+	err = tx.QueryRow(ctx, "SELECT key, value, blob_key, user_id FROM vault WHERE id = $1", id).Scan(&v.Key, &oid, &blobKey, &v.UserID)
 	if err != nil {
-		if strings.Contains(err.Error(), pgx.ErrNoRows.Error()) {
-			return v, ErrVaultNotFound
+		if errors.Is(err, pgx.ErrNoRows) {
+			return v, storage.ErrVaultNotFound
 		}
 		return v, fmt.Errorf("failed to get vault by id %d: %w", id, err)
 	}
 	v.ID = id
 
+	switch {
+	case blobKey != nil:
+		// Blobs are immutable and replaced blobs are only deleted after BlobDeletionGracePeriod,
+		// so the transaction isn't needed to read them.
+		tx.Rollback(ctx)
+		v.Value, err = s.readBlob(ctx, *blobKey)
+	case oid != nil:
+		v.Value, err = s.readLargeObject(ctx, tx, *oid)
+	}
+	if err != nil {
+		return storage.Vault{}, err
+	}
+	return v, nil
+}
+
+// readLargeObject reads the value of a vault stored in a large object.
+func (s VaultStorage) readLargeObject(ctx context.Context, tx pgx.Tx, oid uint32) (_ []byte, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.readLargeObject", attribute.Int64("large_object.oid", int64(oid)))
+	defer func() { tracing.End(span, err) }()
+
 	lobs := tx.LargeObjects()
 	obj, err := lobs.Open(ctx, oid, pgx.LargeObjectModeRead)
 	if err != nil {
-		return storage.Vault{}, fmt.Errorf("failed to open object: %w", err)
+		return nil, fmt.Errorf("failed to open object: %w", err)
 	}
 
 	buffer := bytes.NewBuffer([]byte{})
-	_, err = io.Copy(buffer, obj)
+	n, err := io.Copy(buffer, obj)
+	span.SetAttributes(attribute.Int64("large_object.bytes", n))
+	if s.observer != nil {
+		s.observer.LargeObjectRead(n)
+	}
 	if err != nil {
-		return storage.Vault{}, fmt.Errorf("failed to read object: %w", err)
+		return nil, fmt.Errorf("failed to read object: %w", err)
 	}
-	v.Value = buffer.Bytes()
-	return v, nil
+	return buffer.Bytes(), nil
 }
 
-// CreateVault inserts a new vault into the database.
-// It takes a context.Context and a storage.Vault object as parameters.
-// Returns the created storage.Vault object and an error if any.
-func (s VaultStorage) CreateVault(ctx context.Context, v storage.Vault) (storage.Vault, error) {
-	tx, err := s.conn.Begin(ctx)
-	if err != nil {
-		return storage.Vault{}, fmt.Errorf("failed to start transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
+// writeLargeObject stores a value in a new large object.
+func (s VaultStorage) writeLargeObject(ctx context.Context, tx pgx.Tx, value []byte) (_ uint32, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.writeLargeObject")
+	defer func() { tracing.End(span, err) }()
 
 	lobs := tx.LargeObjects()
 
 	oid, err := lobs.Create(ctx, 0)
 	if err != nil {
-		return storage.Vault{}, fmt.Errorf("failed to create vault object: %w", err)
+		return 0, fmt.Errorf("failed to create vault object: %w", err)
 	}
 
-	var vaultID uint64
+	// Open the new Object for writing.
+	obj, err := lobs.Open(ctx, oid, pgx.LargeObjectModeWrite)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open vault object %d: %w", oid, err)
+	}
 
-	err = tx.QueryRow(ctx, "INSERT INTO vault (key, value, user_id) VALUES ($1, $2, $3) RETURNING id", v.Key, oid, v.UserID).Scan(&vaultID)
+	// Copy the file stream to the Large Object stream
+	n, err := io.Copy(obj, bytes.NewReader(value))
+	span.SetAttributes(attribute.Int64("large_object.oid", int64(oid)), attribute.Int64("large_object.bytes", n))
+	if s.observer != nil {
+		s.observer.LargeObjectWritten(n)
+	}
 	if err != nil {
-		return storage.Vault{}, fmt.Errorf("failed to create vault %s: %w", v.Key, err)
+		return 0, fmt.Errorf("failed to copy vault object %d: %w", oid, err)
 	}
+	return oid, nil
+}
 
-	// Open the new Object for writing.
-	obj, err := lobs.Open(ctx, oid, pgx.LargeObjectModeWrite)
+// readBlob reads the value of a vault stored in the blob store.
+func (s VaultStorage) readBlob(ctx context.Context, key string) (_ []byte, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.readBlob")
+	defer func() { tracing.End(span, err) }()
+
+	if s.blobs == nil {
+		return nil, fmt.Errorf("vault value is stored in blob %s, but no blob store is configured", key)
+	}
+	r, err := s.blobs.OpenBlob(ctx, key)
 	if err != nil {
-		return storage.Vault{}, fmt.Errorf("failed to open vault %s: %w", v.Key, err)
+		return nil, err
 	}
+	defer r.Close()
 
-	// Copy the file stream to the Large Object stream
-	_, err = io.Copy(obj, bytes.NewReader(v.Value))
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// createBlob stores a value in the blob store.
+func (s VaultStorage) createBlob(ctx context.Context, value []byte) (_ string, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.createBlob")
+	defer func() { tracing.End(span, err) }()
+
+	return s.blobs.CreateBlob(ctx, bytes.NewReader(value), int64(len(value)))
+}
+
+// deleteBlob removes a blob which was never referenced by a committed vault. A failure only leaves an orphaned
+// blob behind, so it is logged rather than returned. Blobs of committed vaults are deleted with scheduleBlobDeletion.
+func deleteBlob(ctx context.Context, blobs storage.BlobStore, key string) {
+	err := blobs.DeleteBlob(context.WithoutCancel(ctx), key)
 	if err != nil {
-		return storage.Vault{}, fmt.Errorf("failed to copy vault %s: %w", v.Key, err)
+		logger.Logger().Warn("failed to delete blob", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// CreateVault inserts a new vault into the database.
+// It takes a context.Context and a storage.Vault object as parameters.
+// Returns the created storage.Vault object and an error if any.
+// If the vault doesn't fit into the quota of the user, it returns storage.ErrQuotaExceeded or storage.ErrEntryTooLarge.
+func (s VaultStorage) CreateVault(ctx context.Context, v storage.Vault) (_ storage.Vault, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.CreateVault")
+	defer func() { tracing.End(span, err) }()
+
+	size := int64(len(v.Value))
+	var key *string
+	if s.blobs != nil {
+		k, err := s.createBlob(ctx, v.Value)
+		if err != nil {
+			return storage.Vault{}, fmt.Errorf("failed to store vault %s: %w", v.Key, err)
+		}
+		key = &k
+	}
+	committed := false
+	defer func() {
+		if key != nil && !committed {
+			deleteBlob(ctx, s.blobs, *key)
+		}
+	}()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return storage.Vault{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = s.checkQuota(ctx, tx, v.UserID, size, storage.Usage{Bytes: size, Entries: 1})
+	if err != nil {
+		return storage.Vault{}, err
+	}
+
+	var oid *uint32
+	if key == nil {
+		o, err := s.writeLargeObject(ctx, tx, v.Value)
+		if err != nil {
+			return storage.Vault{}, fmt.Errorf("failed to store vault %s: %w", v.Key, err)
+		}
+		oid = &o
+	}
+
+	var vaultID uint64
+	err = tx.QueryRow(
+		ctx, "INSERT INTO vault (key, value, blob_key, size, user_id) VALUES ($1, $2, $3, $4, $5) RETURNING id", v.Key, oid, key, size, v.UserID,
+	).Scan(&vaultID)
+	if err != nil {
+		return storage.Vault{}, fmt.Errorf("failed to create vault %s: %w", v.Key, err)
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
 		return storage.Vault{}, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	committed = true
 
 	return storage.Vault{
 		ID:     vaultID,
@@ -117,56 +235,231 @@ func (s VaultStorage) CreateVault(ctx context.Context, v storage.Vault) (storage
 }
 
 // UpdateVault updates an existing vault in the database.
+// The new value is stored as a new large object or blob and the old one is deleted, so readers see
+// either the old or the new value. The old blob is only deleted by CollectBlobs after BlobDeletionGracePeriod.
 // It takes a context.Context and a storage.Vault object as parameters.
 // Returns an error if any.
-func (s VaultStorage) UpdateVault(ctx context.Context, v storage.Vault) error {
-	tx, err := s.conn.Begin(ctx)
+// If the new value doesn't fit into the quota of the owner, it returns storage.ErrQuotaExceeded or storage.ErrEntryTooLarge.
+func (s VaultStorage) UpdateVault(ctx context.Context, v storage.Vault) (err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.UpdateVault", attribute.Int64("vault.id", int64(v.ID)))
+	defer func() { tracing.End(span, err) }()
+
+	var key *string
+	if s.blobs != nil {
+		k, err := s.createBlob(ctx, v.Value)
+		if err != nil {
+			return fmt.Errorf("failed to store vault %s: %w", v.Key, err)
+		}
+		key = &k
+	}
+	committed := false
+	defer func() {
+		if key != nil && !committed {
+			deleteBlob(ctx, s.blobs, *key)
+		}
+	}()
+
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	lobs := tx.LargeObjects()
-
-	oid, err := lobs.Create(ctx, 0)
+	var oldOID *uint32
+	var oldKey *string
+	var oldSize int64
+	var userID uint64
+	err = tx.QueryRow(ctx, "SELECT value, blob_key, size, user_id FROM vault WHERE id = $1 FOR UPDATE", v.ID).Scan(&oldOID, &oldKey, &oldSize, &userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create vault object: %w", err)
+		return fmt.Errorf("failed to get vault by id %d: %w", v.ID, err)
 	}
 
-	_, err = tx.Exec(ctx, "UPDATE vault SET key = $2, value = $3 WHERE id = $1", v.ID, v.Key, oid)
+	size := int64(len(v.Value))
+	err = s.checkQuota(ctx, tx, userID, size, storage.Usage{Bytes: size - oldSize})
 	if err != nil {
-		return fmt.Errorf("failed to update vault by id %d, key %s: %w", v.ID, v.Key, err)
+		return err
 	}
 
-	// Open the new Object for writing.
-	obj, err := lobs.Open(ctx, oid, pgx.LargeObjectModeWrite)
-	if err != nil {
-		return fmt.Errorf("failed to open vault %s: %w", v.Key, err)
+	var oid *uint32
+	if key == nil {
+		o, err := s.writeLargeObject(ctx, tx, v.Value)
+		if err != nil {
+			return fmt.Errorf("failed to store vault %s: %w", v.Key, err)
+		}
+		oid = &o
 	}
 
-	// Copy the file stream to the Large Object stream
-	_, err = io.Copy(obj, bytes.NewReader(v.Value))
+	_, err = tx.Exec(ctx, "UPDATE vault SET key = $2, value = $3, blob_key = $4, size = $5 WHERE id = $1", v.ID, v.Key, oid, key, size)
 	if err != nil {
-		return fmt.Errorf("failed to copy vault %s: %w", v.Key, err)
+		return fmt.Errorf("failed to update vault by id %d, key %s: %w", v.ID, v.Key, err)
+	}
+	if oldOID != nil {
+		lobs := tx.LargeObjects()
+		err = lobs.Unlink(ctx, *oldOID)
+		if err != nil {
+			return fmt.Errorf("failed to delete vault object %d: %w", *oldOID, err)
+		}
+	}
+	if oldKey != nil {
+		if err = scheduleBlobDeletion(ctx, tx, *oldKey); err != nil {
+			return err
+		}
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
-
+	committed = true
 	return nil
 }
 
-// DeleteVault removes a vault from the database by its ID.
+// DeleteVault removes a vault from the database by its ID together with its value.
+// A blob is only deleted by CollectBlobs after BlobDeletionGracePeriod.
 // It takes a context.Context and a vault ID (uint64) as parameters.
 // Returns an error if any.
-func (s VaultStorage) DeleteVault(ctx context.Context, id uint64) error {
-	sql := `DELETE FROM vault WHERE id = $1`
-	_, err := s.db.ExecContext(ctx, sql, id)
+func (s VaultStorage) DeleteVault(ctx context.Context, id uint64) (err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.DeleteVault", attribute.Int64("vault.id", int64(id)))
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oid *uint32
+	var blobKey *string
+	err = tx.QueryRow(ctx, `DELETE FROM vault WHERE id = $1 RETURNING value, blob_key`, id).Scan(&oid, &blobKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete vault by id %d: %w", id, err)
 	}
+	if oid != nil {
+		lobs := tx.LargeObjects()
+		err = lobs.Unlink(ctx, *oid)
+		if err != nil {
+			return fmt.Errorf("failed to delete vault object %d: %w", *oid, err)
+		}
+	}
+	if blobKey != nil {
+		if err = scheduleBlobDeletion(ctx, tx, *blobKey); err != nil {
+			return err
+		}
+	}
 
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
+
+// ListVaults retrieves the vaults of a user without their values, ordered by ID.
+// It takes a context.Context and a user ID (uint64) as parameters.
+// Returns the vaults and an error if any.
+func (s VaultStorage) ListVaults(ctx context.Context, userID uint64) (_ []storage.Vault, err error) {
+	ctx, span := startSpan(ctx, "VaultStorage.ListVaults", attribute.Int64("user.id", int64(userID)))
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := s.pool.Query(ctx, "SELECT id, key, user_id FROM vault WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vaults of user %d: %w", userID, err)
+	}
+	vaults, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storage.Vault, error) {
+		var v storage.Vault
+		err := row.Scan(&v.ID, &v.Key, &v.UserID)
+		return v, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vaults of user %d: %w", userID, err)
+	}
+	return vaults, nil
+}
+
+// MoveLargeObjects moves the values of all vaults still kept in PostgreSQL large objects to the blob store
+// configured with WithBlobStore and deletes the large objects. Each vault is moved in its own transaction,
+// so the move can be interrupted and resumed, and the server can keep running meanwhile.
+// It takes a context.Context as a parameter.
+// Returns the number of moved vaults and an error if any.
+func (s VaultStorage) MoveLargeObjects(ctx context.Context) (int, error) {
+	if s.blobs == nil {
+		return 0, errors.New("no blob store is configured")
+	}
+
+	rows, err := s.pool.Query(ctx, "SELECT id FROM vault WHERE value IS NOT NULL ORDER BY id")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list vaults with large objects: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uint64])
+	if err != nil {
+		return 0, fmt.Errorf("failed to list vaults with large objects: %w", err)
+	}
+
+	moved := 0
+	for _, id := range ids {
+		ok, err := s.moveLargeObject(ctx, id)
+		if err != nil {
+			return moved, err
+		}
+		if ok {
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// moveLargeObject moves the value of a vault from its large object to the blob store.
+// Returns false if the vault has been deleted or updated meanwhile.
+func (s VaultStorage) moveLargeObject(ctx context.Context, id uint64) (bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oid uint32
+	err = tx.QueryRow(ctx, "SELECT value FROM vault WHERE id = $1 AND value IS NOT NULL FOR UPDATE", id).Scan(&oid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get vault by id %d: %w", id, err)
+	}
+
+	lobs := tx.LargeObjects()
+	obj, err := lobs.Open(ctx, oid, pgx.LargeObjectModeRead)
+	if err != nil {
+		return false, fmt.Errorf("failed to open object %d: %w", oid, err)
+	}
+	size, err := obj.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = obj.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read object %d: %w", oid, err)
+	}
+
+	key, err := s.blobs.CreateBlob(ctx, obj, size)
+	if err != nil {
+		return false, fmt.Errorf("failed to move vault %d to the blob store: %w", id, err)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE vault SET value = NULL, blob_key = $2 WHERE id = $1", id, key)
+	if err == nil {
+		err = lobs.Unlink(ctx, oid)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		deleteBlob(ctx, s.blobs, key)
+		return false, fmt.Errorf("failed to move vault %d to the blob store: %w", id, err)
+	}
+	return true, nil
+}
@@ -31,7 +31,7 @@ func TestVaultRepository(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	vaultStorage := postgres.NewVaultStorage(db.DB, db.Conn)
+	vaultStorage := postgres.NewVaultStorage(db.Pool)
 
 	vault1 := storage.Vault{
 		Key:    "k1",
@@ -79,5 +79,5 @@ func TestVaultRepository(t *testing.T) {
 	require.NoError(t, err)
 
 	_, err = vaultStorage.GetVault(ctx, 1)
-	require.EqualError(t, err, postgres.ErrVaultNotFound.Error())
+	require.EqualError(t, err, storage.ErrVaultNotFound.Error())
 }
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded is returned if a write of a vault entry would exceed the quota of the user.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// ErrEntryTooLarge is returned if the value of a vault entry alone is larger than the quota of the user.
+var ErrEntryTooLarge = errors.New("entry is larger than the storage quota")
+
+// Quota limits the vault storage of a user. A zero limit means unlimited.
+type Quota struct {
+	MaxBytes   int64 `json:"max_bytes"`   // Maximum total size of the values of all vault entries.
+	MaxEntries int64 `json:"max_entries"` // Maximum number of vault entries.
+}
+
+// Usage is the vault storage used by a user.
+type Usage struct {
+	Bytes   int64 `json:"bytes"`   // Total size of the values of all vault entries.
+	Entries int64 `json:"entries"` // Number of vault entries.
+}
+
+// QuotaStorage defines the interface for reporting the usage of vault storage and managing quotas.
+// The quota is enforced by the VaultStorage when entries are created or updated.
+type QuotaStorage interface {
+	// GetUsage retrieves the vault storage used by a user.
+	// Takes a context.Context and the user's ID (uint64) as parameters.
+	// Returns the Usage and an error if any.
+	GetUsage(ctx context.Context, userID uint64) (Usage, error)
+
+	// GetQuota retrieves the quota of a user: the quota set with SetQuota, or the default quota of the storage.
+	// Takes a context.Context and the user's ID (uint64) as parameters.
+	// Returns the Quota and an error if any.
+	GetQuota(ctx context.Context, userID uint64) (Quota, error)
+
+	// SetQuota overrides the default quota for a user.
+	// Takes a context.Context, the user's ID (uint64) and the Quota as parameters.
+	// Returns an error if any.
+	SetQuota(ctx context.Context, userID uint64, q Quota) error
+
+	// DeleteQuota removes the quota set with SetQuota, so the default quota applies to the user again.
+	// Takes a context.Context and the user's ID (uint64) as parameters.
+	// Returns an error if any.
+	DeleteQuota(ctx context.Context, userID uint64) error
+}
+
+// CheckQuota checks whether a write of a vault value of the given size, changing the usage of the user by delta,
+// fits into the quota. Writes which don't increase the usage are always allowed, even if the user is over quota.
+// It is shared by the storage backends, which call it while holding a lock on the usage of the user.
+// Returns ErrEntryTooLarge if the value alone is larger than the quota, or ErrQuotaExceeded.
+func CheckQuota(q Quota, used Usage, size int64, delta Usage) error {
+	if q.MaxEntries > 0 && delta.Entries > 0 && used.Entries+delta.Entries > q.MaxEntries {
+		return fmt.Errorf("%w: %d of %d entries used", ErrQuotaExceeded, used.Entries, q.MaxEntries)
+	}
+	if q.MaxBytes == 0 || delta.Bytes <= 0 {
+		return nil
+	}
+	if size > q.MaxBytes {
+		return fmt.Errorf("%w: %d bytes, the quota is %d bytes", ErrEntryTooLarge, size, q.MaxBytes)
+	}
+	if used.Bytes+delta.Bytes > q.MaxBytes {
+		return fmt.Errorf("%w: %d of %d bytes used, %d more bytes needed", ErrQuotaExceeded, used.Bytes, q.MaxBytes, delta.Bytes)
+	}
+	return nil
+}
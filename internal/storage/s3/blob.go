@@ -0,0 +1,108 @@
+// Package s3 provides a storage.BlobStore keeping blobs as objects in an S3-compatible bucket,
+// e.g. Amazon S3, MinIO or Ceph.
+package s3
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Config holds the location of the bucket and the credentials.
+type Config struct {
+	Endpoint        string // URL of the S3 API, e.g. https://s3.amazonaws.com or http://localhost:9000.
+	Region          string // Region of the bucket, looked up if empty.
+	Bucket          string // Name of the bucket, which must exist.
+	Prefix          string // Prefix of the object keys, e.g. "gophkeeper/".
+	AccessKeyID     string // Access key ID.
+	SecretAccessKey string // Secret access key.
+}
+
+// BlobStore keeps blobs as objects in a bucket.
+type BlobStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewBlobStore creates a new instance of BlobStore and checks that the bucket exists.
+func NewBlobStore(ctx context.Context, cfg Config) (*BlobStore, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint '%s', expected http(s)://host[:port]", cfg.Endpoint)
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure: endpoint.Scheme == "https",
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check s3 bucket %s: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("s3 bucket %s does not exist", cfg.Bucket)
+	}
+
+	return &BlobStore{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+// partSize is the size of the parts content of unknown size is uploaded in,
+// objects of unknown size can be up to 10000 parts large.
+const partSize = 16 << 20
+
+// CreateBlob uploads the content as an object with a random key.
+// Content of unknown size is uploaded in parts.
+func (s *BlobStore) CreateBlob(ctx context.Context, r io.Reader, size int64) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate blob key: %w", err)
+	}
+	key := s.prefix + hex.EncodeToString(b)
+
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+	if size < 0 {
+		opts.PartSize = partSize
+	}
+	_, err = s.client.PutObject(ctx, s.bucket, key, r, size, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload blob %s: %w", key, err)
+	}
+	return key, nil
+}
+
+// OpenBlob downloads the object of the blob.
+func (s *BlobStore) OpenBlob(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob %s: %w", key, err)
+	}
+	// The request is sent lazily, stat it to report a missing object here rather than on the first read.
+	_, err = obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("failed to download blob %s: %w", key, err)
+	}
+	return obj, nil
+}
+
+// DeleteBlob removes the object of the blob.
+func (s *BlobStore) DeleteBlob(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete blob %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrSessionNotFound is returned if no session of the user has the ID.
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session represents a sign-in of a user on a device. Every sign-in token belongs to a session,
+// so that the user can see where they are signed in and revoke single devices.
+type Session struct {
+	ID         uint64     `json:"id"`                   // Unique identifier for the session.
+	UserID     uint64     `json:"user_id"`              // The ID of the user who signed in.
+	DeviceName string     `json:"device_name"`          // Device name sent by the client on sign-in.
+	UserAgent  string     `json:"user_agent"`           // The client User-Agent header on sign-in.
+	IP         string     `json:"ip"`                   // The client IP address on sign-in.
+	CreatedAt  time.Time  `json:"created_at"`           // Time of the sign-in.
+	LastSeenAt time.Time  `json:"last_seen_at"`         // Time the session was last used, updated at most once a minute.
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"` // Time the session was revoked.
+}
+
+// SessionStorage defines the interface for operations on sign-in sessions in the storage system.
+type SessionStorage interface {
+	// GetSession retrieves a session by its unique ID.
+	// Takes a context.Context and the session's ID (uint64) as parameters.
+	// Returns the Session and an error if any.
+	GetSession(ctx context.Context, id uint64) (Session, error)
+
+	// ListSessions retrieves the sessions of a user which are not revoked, most recently seen first.
+	// Takes a context.Context and the user's ID (uint64) as parameters.
+	// Returns the list of Session and an error if any.
+	ListSessions(ctx context.Context, userID uint64) ([]Session, error)
+
+	// CreateSession inserts a new session into the storage system.
+	// Takes a context.Context and a Session object as parameters.
+	// Returns the created Session and an error if any.
+	CreateSession(ctx context.Context, s Session) (Session, error)
+
+	// TouchSession updates the last-seen time of a session.
+	// Takes a context.Context, the session's ID (uint64) and the time of use as parameters.
+	// Returns an error if any.
+	TouchSession(ctx context.Context, id uint64, seenAt time.Time) error
+
+	// RevokeSession marks a session as revoked.
+	// Takes a context.Context, the session's ID (uint64) and the revocation time as parameters.
+	// Returns an error if any.
+	RevokeSession(ctx context.Context, id uint64, revokedAt time.Time) error
+
+	// RevokeOtherSessions marks all sessions of a user as revoked except the one with keepID.
+	// Takes a context.Context, the user's ID (uint64), the ID of the session to keep (0 to revoke all)
+	// and the revocation time as parameters.
+	// Returns an error if any.
+	RevokeOtherSessions(ctx context.Context, userID, keepID uint64, revokedAt time.Time) error
+}
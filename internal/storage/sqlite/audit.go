@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+const auditColumns = `id, created_at, action, user_id, login, token_id, vault_id, ip, user_agent, request_id, detail, prev_hash, hash`
+
+// AuditStorage handles the append-only audit log in a SQLite database.
+// Triggers reject updates and deletes of the audit_log table.
+type AuditStorage struct {
+	db *sqlx.DB
+}
+
+// NewAuditStorage creates a new instance of AuditStorage.
+// It takes a *sqlx.DB instance returned by Open which is used to interact with the database.
+// Returns a pointer to an AuditStorage instance.
+func NewAuditStorage(db *sqlx.DB) *AuditStorage {
+	return &AuditStorage{db: db}
+}
+
+// AppendAuditEvent chains the record to the latest record of the log and inserts it.
+// The database has a single connection, so records appended at the same time are chained one after another.
+// Returns the stored storage.AuditEvent object and an error if any.
+func (s AuditStorage) AppendAuditEvent(ctx context.Context, e storage.AuditEvent) (storage.AuditEvent, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return e, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var prevHash string
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return e, fmt.Errorf("failed to get latest audit event: %w", err)
+	}
+
+	e = storage.ChainAuditEvent(e, prevHash)
+	err = tx.QueryRowContext(
+		ctx,
+		`INSERT INTO audit_log (created_at, action, user_id, login, token_id, vault_id, ip, user_agent, request_id, detail, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		toUnix(e.CreatedAt), e.Action, e.UserID, e.Login, e.TokenID, e.VaultID, e.IP, e.UserAgent, e.RequestID, e.Detail, e.PrevHash, e.Hash,
+	).Scan(&e.ID)
+	if err != nil {
+		return e, fmt.Errorf("failed to append audit event %s of user id %d: %w", e.Action, e.UserID, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return e, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return e, nil
+}
+
+// ListAuditEvents retrieves the records of the user older than beforeID, newest first.
+func (s AuditStorage) ListAuditEvents(ctx context.Context, userID, beforeID uint64, limit int) ([]storage.AuditEvent, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+auditColumns+` FROM audit_log WHERE user_id = ? AND (? = 0 OR id < ?) ORDER BY id DESC LIMIT ?`,
+		userID, beforeID, beforeID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events by user id %d: %w", userID, err)
+	}
+	return scanAuditEvents(rows)
+}
+
+// ExportAuditEvents retrieves the records of all users newer than afterID, oldest first.
+func (s AuditStorage) ExportAuditEvents(ctx context.Context, afterID uint64, limit int) ([]storage.AuditEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_log WHERE id > ? ORDER BY id LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export audit events after id %d: %w", afterID, err)
+	}
+	return scanAuditEvents(rows)
+}
+
+// scanAuditEvents reads and closes audit_log rows selected with auditColumns.
+func scanAuditEvents(rows *sql.Rows) ([]storage.AuditEvent, error) {
+	defer rows.Close()
+
+	events := make([]storage.AuditEvent, 0)
+	for rows.Next() {
+		var e storage.AuditEvent
+		var createdAt int64
+		err := rows.Scan(
+			&e.ID, &createdAt, &e.Action, &e.UserID, &e.Login, &e.TokenID, &e.VaultID,
+			&e.IP, &e.UserAgent, &e.RequestID, &e.Detail, &e.PrevHash, &e.Hash,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		e.CreatedAt = fromUnix(createdAt)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,340 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/backup"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// Driver is the name of the database in the manifest of backups.
+const Driver = "sqlite"
+
+// backupPageSize is the number of vaults read at once by Backup, whose values are read one after the other.
+const backupPageSize = 1000
+
+// backupTables are the tables kept in backups, in an order satisfying their foreign keys, with the columns
+// their rows are written in the order of. Sign-in throttling, SRP handshakes and pending OIDC sign-ins are
+// short-lived and not kept. The values of the AUTOINCREMENT counters follow as the rows of sqlite_sequence,
+// so that the IDs of deleted rows, which tokens and the audit log may still refer to, are not used again.
+var backupTables = []struct{ name, order string }{
+	{"users", "id"},
+	{"user_quotas", "user_id"},
+	{"vault", "id"},
+	{"access_tokens", "id"},
+	{"failed_sign_ins", "id"},
+	{"sessions", "id"},
+	{"oidc_identities", "issuer, subject"},
+	{"audit_log", "id"},
+	{"sqlite_sequence", "name"},
+}
+
+// BackupStorage writes backups of the whole database and restores them.
+type BackupStorage struct {
+	db *sqlx.DB
+}
+
+// NewBackupStorage creates a new instance of BackupStorage.
+// It takes a *sqlx.DB instance returned by Open which is used to interact with the database.
+// Returns a pointer to a BackupStorage instance.
+func NewBackupStorage(db *sqlx.DB) *BackupStorage {
+	return &BackupStorage{db: db}
+}
+
+// Backup writes a backup of the database to w, encrypted with the passphrase.
+// The database is read in a single transaction, so the backup is a consistent snapshot, during which a server
+// using the database waits for its writes unless the database is in WAL mode.
+func (s BackupStorage) Backup(ctx context.Context, w io.Writer, passphrase string) (backup.Summary, error) {
+	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return backup.Summary{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	m := backup.Manifest{Driver: Driver, CreatedAt: time.Now().UTC()}
+	err = tx.GetContext(ctx, &m.Schema, `PRAGMA user_version`)
+	if err != nil {
+		return backup.Summary{}, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	bw, err := backup.NewWriter(w, passphrase, m)
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	for _, t := range backupTables {
+		if t.name == "vault" {
+			err = backupVaults(ctx, tx, bw)
+		} else {
+			err = backupRows(ctx, tx, bw, t.name, fmt.Sprintf(`SELECT * FROM %s ORDER BY %s`, t.name, t.order))
+		}
+		if err != nil {
+			return backup.Summary{}, err
+		}
+	}
+	if err = bw.Close(); err != nil {
+		return backup.Summary{}, err
+	}
+	return bw.Summary(), nil
+}
+
+// backupRows writes the rows returned by the query as rows of the table, BLOB columns are base64 encoded.
+func backupRows(ctx context.Context, tx *sqlx.Tx, bw *backup.Writer, table, query string, args ...any) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			return fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		row := make(map[string]any, len(columns))
+		for i, c := range columns {
+			if b, ok := values[i].([]byte); ok && b == nil {
+				// Empty BLOBs are scanned as nil slices, which would be marshaled like NULL.
+				values[i] = []byte{}
+			}
+			row[c] = values[i]
+		}
+		b, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("failed to marshal row of %s: %w", table, err)
+		}
+		if err = bw.WriteRow(table, b); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	return nil
+}
+
+// backupVaults writes the vault rows, each followed by its value. The rows are read a page at a time,
+// as the single connection can't read the chunks of values while a query is running.
+func backupVaults(ctx context.Context, tx *sqlx.Tx, bw *backup.Writer) error {
+	var afterID int64
+	for {
+		var ids, generations []int64
+		rows, err := tx.QueryContext(ctx, `SELECT id, generation FROM vault WHERE id > ? ORDER BY id LIMIT ?`, afterID, backupPageSize)
+		if err != nil {
+			return fmt.Errorf("failed to read vaults: %w", err)
+		}
+		for rows.Next() {
+			var id, generation int64
+			if err = rows.Scan(&id, &generation); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read vaults: %w", err)
+			}
+			ids = append(ids, id)
+			generations = append(generations, generation)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("failed to read vaults: %w", err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		for i, id := range ids {
+			if err = backupRows(ctx, tx, bw, "vault", `SELECT * FROM vault WHERE id = ?`, id); err != nil {
+				return err
+			}
+			_, err = bw.WriteValue(uint64(id), &chunkReader{ctx: ctx, q: tx, vaultID: uint64(id), generation: generations[i]})
+			if err != nil {
+				return err
+			}
+		}
+		afterID = ids[len(ids)-1]
+	}
+}
+
+// Restore restores a backup read from r, decrypted with the passphrase, into the database, which must be empty
+// and migrated to the schema version of the backup. The backup is verified while it is restored, all of it is
+// restored in a single transaction which is only committed if the whole backup is intact.
+// If the database holds data, it returns storage.ErrNotEmpty.
+func (s BackupStorage) Restore(ctx context.Context, r io.Reader, passphrase string) (backup.Summary, error) {
+	br, err := backup.NewReader(r, passphrase)
+	if err != nil {
+		return backup.Summary{}, err
+	}
+	m := br.Manifest()
+	if m.Driver != Driver {
+		return backup.Summary{}, fmt.Errorf("backup of a %s database can't be restored to SQLite", m.Driver)
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return backup.Summary{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var schema int64
+	if err = tx.GetContext(ctx, &schema, `PRAGMA user_version`); err != nil {
+		return backup.Summary{}, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if schema != m.Schema {
+		return backup.Summary{}, fmt.Errorf("backup has schema version %d, the database %d", m.Schema, schema)
+	}
+	blobColumns := make(map[string]map[string]bool)
+	for _, t := range backupTables {
+		if t.name == "sqlite_sequence" {
+			continue
+		}
+		var exists bool
+		if err = tx.GetContext(ctx, &exists, fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s)`, t.name)); err != nil {
+			return backup.Summary{}, fmt.Errorf("failed to read %s: %w", t.name, err)
+		}
+		if exists {
+			return backup.Summary{}, fmt.Errorf("%w: %s has rows", storage.ErrNotEmpty, t.name)
+		}
+		blobColumns[t.name], err = columnTypes(ctx, tx, t.name)
+		if err != nil {
+			return backup.Summary{}, err
+		}
+	}
+
+	// The value of a vault follows its row.
+	var vaultID uint64
+	for {
+		rec, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return backup.Summary{}, err
+		}
+
+		switch {
+		case vaultID != 0 && rec.Value == nil:
+			return backup.Summary{}, fmt.Errorf("%w: vault %d has no value", backup.ErrDamaged, vaultID)
+		case rec.Table == "sqlite_sequence":
+			var seq struct {
+				Name string `json:"name"`
+				Seq  int64  `json:"seq"`
+			}
+			if err = json.Unmarshal(rec.Row, &seq); err != nil || blobColumns[seq.Name] == nil {
+				return backup.Summary{}, fmt.Errorf("%w: unexpected sequence %s", backup.ErrDamaged, rec.Row)
+			}
+			_, err = tx.ExecContext(ctx, `DELETE FROM sqlite_sequence WHERE name = ?`, seq.Name)
+			if err == nil {
+				_, err = tx.ExecContext(ctx, `INSERT INTO sqlite_sequence (name, seq) VALUES (?, ?)`, seq.Name, seq.Seq)
+			}
+			if err != nil {
+				return backup.Summary{}, fmt.Errorf("failed to restore sequence of %s: %w", seq.Name, err)
+			}
+		case rec.Table != "":
+			if blobColumns[rec.Table] == nil {
+				return backup.Summary{}, fmt.Errorf("%w: unexpected table %s", backup.ErrDamaged, rec.Table)
+			}
+			id, err := restoreRow(ctx, tx, rec.Table, rec.Row, blobColumns[rec.Table])
+			if err != nil {
+				return backup.Summary{}, err
+			}
+			if rec.Table == "vault" {
+				vaultID = id
+			}
+		default:
+			if vaultID == 0 || rec.VaultID != vaultID {
+				return backup.Summary{}, fmt.Errorf("%w: value of vault %d without its row", backup.ErrDamaged, rec.VaultID)
+			}
+			if err = writeChunks(ctx, tx, vaultID, rec.Value, -1); err != nil {
+				return backup.Summary{}, fmt.Errorf("failed to restore value of vault %d: %w", vaultID, err)
+			}
+			vaultID = 0
+		}
+	}
+	if vaultID != 0 {
+		return backup.Summary{}, fmt.Errorf("%w: vault %d has no value", backup.ErrDamaged, vaultID)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return backup.Summary{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return br.Summary(), nil
+}
+
+// columnTypes returns which columns of a table are BLOB columns, whose values are base64 encoded in backups.
+func columnTypes(ctx context.Context, tx *sqlx.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name, type FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name, typ string
+		if err = rows.Scan(&name, &typ); err != nil {
+			return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		columns[name] = strings.EqualFold(typ, "BLOB")
+	}
+	return columns, rows.Err()
+}
+
+// restoreRow inserts a row of a table. Returns the id column of the row, 0 if it has none.
+func restoreRow(ctx context.Context, tx *sqlx.Tx, table string, row json.RawMessage, blobColumns map[string]bool) (uint64, error) {
+	dec := json.NewDecoder(bytes.NewReader(row))
+	dec.UseNumber()
+	var values map[string]any
+	if err := dec.Decode(&values); err != nil {
+		return 0, fmt.Errorf("%w: %v", backup.ErrDamaged, err)
+	}
+
+	names := make([]string, 0, len(values))
+	args := make([]any, 0, len(values))
+	var id uint64
+	for name, value := range values {
+		isBlob, ok := blobColumns[name]
+		if !ok {
+			return 0, fmt.Errorf("%w: unexpected column %s of %s", backup.ErrDamaged, name, table)
+		}
+		switch v := value.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				value = n
+				if name == "id" {
+					id = uint64(n)
+				}
+			} else if f, err := v.Float64(); err == nil {
+				value = f
+			}
+		case string:
+			if isBlob {
+				b, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return 0, fmt.Errorf("%w: column %s of %s: %v", backup.ErrDamaged, name, table, err)
+				}
+				value = b
+			}
+		}
+		names = append(names, name)
+		args = append(args, value)
+	}
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`,
+		table, strings.Join(names, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", "))
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to restore row of %s: %w", table, err)
+	}
+	return id, nil
+}
@@ -0,0 +1,132 @@
+// Package sqlite provides storage implementations backed by an embedded SQLite database file,
+// for single-node deployments without a database server.
+// Vault values are stored in chunks of ChunkSize bytes, which VaultStorage reads and writes one at a time
+// through storage.VaultValueStorage, so that files are not held in memory as a whole.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite" // Registers the "sqlite" database/sql driver.
+)
+
+// Scheme is the scheme of database URIs selecting SQLite, e.g. sqlite:///var/lib/gophkeeper/gophkeeper.db.
+const Scheme = "sqlite"
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open opens the database file of a sqlite:// URI, creating it if needed, and applies the migrations.
+// A relative path is written as sqlite://gophkeeper.db, an absolute one as sqlite:///path/gophkeeper.db.
+//
+// SQLite allows a single writer at a time, so the returned pool uses a single connection.
+// Foreign keys are enforced.
+func Open(ctx context.Context, uri string) (*sqlx.DB, error) {
+	path, ok := strings.CutPrefix(uri, Scheme+"://")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("invalid sqlite URI '%s', expected sqlite://<path>", uri)
+	}
+
+	db, err := sqlx.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", path, err)
+	}
+
+	err = Migration(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Migration applies the embedded migrations which are newer than the schema version of the database.
+// The number of applied migrations is kept in PRAGMA user_version.
+func Migration(ctx context.Context, db *sqlx.DB) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("list migrations: %w", err)
+	}
+	sort.Strings(names)
+
+	var version int
+	err = db.GetContext(ctx, &version, `PRAGMA user_version`)
+	if err != nil {
+		return fmt.Errorf("get schema version: %w", err)
+	}
+
+	for i := version; i < len(names); i++ {
+		logger.Logger().Info("apply migration", zap.String("path", names[i]))
+		b, err := migrations.ReadFile(names[i])
+		if err != nil {
+			return fmt.Errorf("read migration '%s': %w", names[i], err)
+		}
+
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start transaction: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, string(b))
+		if err == nil {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration '%s': %w", names[i], err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("apply migration '%s': %w", names[i], err)
+		}
+	}
+
+	return nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// Times are stored as microseconds since the Unix epoch, which SQLite compares and sorts as numbers.
+
+func toUnix(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+func toNullUnix(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMicro(), Valid: true}
+}
+
+func fromUnix(us int64) time.Time {
+	return time.UnixMicro(us)
+}
+
+func fromNullUnix(us sql.NullInt64) *time.Time {
+	if !us.Valid {
+		return nil
+	}
+	t := time.UnixMicro(us.Int64)
+	return &t
+}
@@ -0,0 +1,111 @@
+-- Times are stored as microseconds since the Unix epoch.
+CREATE TABLE IF NOT EXISTS users
+(
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    login          TEXT    NOT NULL,
+    password       TEXT    NOT NULL DEFAULT '',
+    totp_secret    TEXT    NOT NULL DEFAULT '',
+    totp_enabled   INTEGER NOT NULL DEFAULT 0,
+    totp_last_step INTEGER NOT NULL DEFAULT 0,
+    recovery_codes TEXT    NOT NULL DEFAULT '[]',
+    token_version  INTEGER NOT NULL DEFAULT 0,
+    srp_salt       BLOB    NOT NULL DEFAULT x'',
+    srp_verifier   BLOB    NOT NULL DEFAULT x''
+);
+CREATE INDEX IF NOT EXISTS users_login_idx ON users (login);
+
+CREATE TABLE IF NOT EXISTS vault
+(
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    key     TEXT    NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users
+);
+CREATE INDEX IF NOT EXISTS vault_user_id_idx ON vault (user_id);
+
+-- Vault values are split into chunks, so they are written and read piece by piece.
+CREATE TABLE IF NOT EXISTS vault_chunks
+(
+    vault_id INTEGER NOT NULL REFERENCES vault ON DELETE CASCADE,
+    seq      INTEGER NOT NULL,
+    data     BLOB    NOT NULL,
+    PRIMARY KEY (vault_id, seq)
+);
+
+CREATE TABLE IF NOT EXISTS access_tokens
+(
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER NOT NULL REFERENCES users,
+    name         TEXT    NOT NULL,
+    token_hash   TEXT    NOT NULL UNIQUE,
+    permission   TEXT    NOT NULL,
+    key_prefix   TEXT    NOT NULL DEFAULT '',
+    vault_ids    TEXT    NOT NULL DEFAULT '[]',
+    expires_at   INTEGER,
+    last_used_at INTEGER,
+    revoked_at   INTEGER,
+    created_at   INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sign_in_throttle
+(
+    key             TEXT PRIMARY KEY,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    last_failure_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS failed_sign_ins
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER REFERENCES users ON DELETE CASCADE,
+    login      TEXT    NOT NULL,
+    ip         TEXT    NOT NULL,
+    user_agent TEXT    NOT NULL DEFAULT '',
+    reason     TEXT    NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS failed_sign_ins_user_id_idx ON failed_sign_ins (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    device_name  TEXT    NOT NULL DEFAULT '',
+    user_agent   TEXT    NOT NULL DEFAULT '',
+    ip           TEXT    NOT NULL DEFAULT '',
+    created_at   INTEGER NOT NULL,
+    last_seen_at INTEGER NOT NULL,
+    revoked_at   INTEGER
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS srp_handshakes
+(
+    id           TEXT PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    client_proof BLOB    NOT NULL,
+    server_proof BLOB    NOT NULL,
+    expires_at   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS srp_handshakes_expires_at_idx ON srp_handshakes (expires_at);
+
+CREATE TABLE IF NOT EXISTS oidc_logins
+(
+    device_code_hash TEXT PRIMARY KEY,
+    state            TEXT    NOT NULL UNIQUE,
+    nonce            TEXT    NOT NULL,
+    code_verifier    TEXT    NOT NULL,
+    device           TEXT    NOT NULL DEFAULT '',
+    user_id          INTEGER REFERENCES users ON DELETE CASCADE,
+    expires_at       INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS oidc_logins_expires_at_idx ON oidc_logins (expires_at);
+
+CREATE TABLE IF NOT EXISTS oidc_identities
+(
+    issuer     TEXT    NOT NULL,
+    subject    TEXT    NOT NULL,
+    user_id    INTEGER NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX IF NOT EXISTS oidc_identities_user_id_idx ON oidc_identities (user_id);
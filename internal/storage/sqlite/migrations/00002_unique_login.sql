@@ -0,0 +1,7 @@
+-- Logins are unique ignoring case. Fails with "UNIQUE constraint failed: users.login" if logins differ only in case,
+-- rename or delete such duplicates first.
+UPDATE users
+SET login = lower(trim(login))
+WHERE login <> lower(trim(login));
+DROP INDEX IF EXISTS users_login_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_key ON users (login COLLATE NOCASE);
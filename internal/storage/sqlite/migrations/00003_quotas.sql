@@ -0,0 +1,10 @@
+ALTER TABLE vault ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+UPDATE vault
+SET size = (SELECT COALESCE(sum(length(data)), 0) FROM vault_chunks WHERE vault_id = vault.id);
+
+CREATE TABLE IF NOT EXISTS user_quotas
+(
+    user_id     INTEGER PRIMARY KEY REFERENCES users,
+    max_bytes   INTEGER NOT NULL,
+    max_entries INTEGER NOT NULL
+);
@@ -0,0 +1,32 @@
+-- Append-only audit log. Records are not deleted with users, so user_id has no foreign key.
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at INTEGER NOT NULL,
+    action     TEXT    NOT NULL,
+    user_id    INTEGER NOT NULL DEFAULT 0,
+    login      TEXT    NOT NULL DEFAULT '',
+    token_id   INTEGER NOT NULL DEFAULT 0,
+    vault_id   INTEGER NOT NULL DEFAULT 0,
+    ip         TEXT    NOT NULL DEFAULT '',
+    user_agent TEXT    NOT NULL DEFAULT '',
+    request_id TEXT    NOT NULL DEFAULT '',
+    detail     TEXT    NOT NULL DEFAULT '',
+    prev_hash  TEXT    NOT NULL DEFAULT '',
+    hash       TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id, id);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update
+    BEFORE UPDATE
+    ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete
+    BEFORE DELETE
+    ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
@@ -0,0 +1,2 @@
+ALTER TABLE sign_in_throttle ADD COLUMN pending INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sign_in_throttle ADD COLUMN reserved_at INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- The generation changes whenever the value of a vault is replaced, so that a value read chunk by chunk
+-- outside of a transaction notices a concurrent update.
+ALTER TABLE vault ADD COLUMN generation INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- Pending sign-ins started before user codes existed can't be approved, so they are dropped.
+DELETE FROM oidc_logins;
+-- The user types the user code into the verification page of the server and approves the sign-in there,
+-- the browser which approved it is the only one whose callback completes the sign-in.
+ALTER TABLE oidc_logins ADD COLUMN user_code_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE oidc_logins ADD COLUMN browser_hash TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS oidc_logins_user_code_hash_idx ON oidc_logins (user_code_hash);
@@ -0,0 +1,160 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+const oidcLoginColumns = `device_code_hash, user_code_hash, browser_hash, state, nonce, code_verifier, device, COALESCE(user_id, 0), expires_at`
+
+// OIDCStorage handles operations related to OIDC sign-ins and identities in a SQLite database.
+type OIDCStorage struct {
+	db *sqlx.DB
+}
+
+// NewOIDCStorage creates a new instance of OIDCStorage.
+// It takes a *sqlx.DB instance returned by Open which is used to interact with the database.
+// Returns a pointer to an OIDCStorage instance.
+func NewOIDCStorage(db *sqlx.DB) *OIDCStorage {
+	return &OIDCStorage{db: db}
+}
+
+// CreateOIDCLogin inserts a new pending sign-in into the database and removes expired ones.
+func (s OIDCStorage) CreateOIDCLogin(ctx context.Context, l storage.OIDCLogin) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM oidc_logins WHERE expires_at < ?`, toUnix(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to delete expired oidc logins: %w", err)
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO oidc_logins (device_code_hash, user_code_hash, state, nonce, code_verifier, device, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		l.DeviceCodeHash, l.UserCodeHash, l.State, l.Nonce, l.CodeVerifier, l.Device, toUnix(l.ExpiresAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create oidc login: %w", err)
+	}
+
+	return nil
+}
+
+// GetOIDCLogin retrieves a sign-in by the hash of its device code.
+// If the sign-in is not found, it returns storage.ErrOIDCLoginNotFound.
+func (s OIDCStorage) GetOIDCLogin(ctx context.Context, deviceCodeHash string) (storage.OIDCLogin, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+oidcLoginColumns+` FROM oidc_logins WHERE device_code_hash = ?`, deviceCodeHash)
+	return scanOIDCLogin(row)
+}
+
+// GetOIDCLoginByState retrieves a sign-in by its state parameter.
+// If the sign-in is not found, it returns storage.ErrOIDCLoginNotFound.
+func (s OIDCStorage) GetOIDCLoginByState(ctx context.Context, state string) (storage.OIDCLogin, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+oidcLoginColumns+` FROM oidc_logins WHERE state = ?`, state)
+	return scanOIDCLogin(row)
+}
+
+// GetOIDCLoginByUserCode retrieves a sign-in by the hash of its user code.
+// If the sign-in is not found, it returns storage.ErrOIDCLoginNotFound.
+func (s OIDCStorage) GetOIDCLoginByUserCode(ctx context.Context, userCodeHash string) (storage.OIDCLogin, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+oidcLoginColumns+` FROM oidc_logins WHERE user_code_hash = ?`, userCodeHash)
+	return scanOIDCLogin(row)
+}
+
+// ApproveOIDCLogin records the browser which approved a sign-in and reports whether it was not approved before.
+func (s OIDCStorage) ApproveOIDCLogin(ctx context.Context, userCodeHash, browserHash string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE oidc_logins SET browser_hash = ? WHERE user_code_hash = ? AND browser_hash = ''`, browserHash, userCodeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to approve oidc login: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to approve oidc login: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// CompleteOIDCLogin records the user who signed in at the provider.
+// If the sign-in is not found, it returns storage.ErrOIDCLoginNotFound.
+func (s OIDCStorage) CompleteOIDCLogin(ctx context.Context, state string, userID uint64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE oidc_logins SET user_id = ? WHERE state = ?`, userID, state)
+	if err != nil {
+		return fmt.Errorf("failed to complete oidc login: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to complete oidc login: %w", err)
+	}
+	if n == 0 {
+		return storage.ErrOIDCLoginNotFound
+	}
+
+	return nil
+}
+
+// DeleteOIDCLogin removes a sign-in by the hash of its device code and reports whether it existed.
+func (s OIDCStorage) DeleteOIDCLogin(ctx context.Context, deviceCodeHash string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM oidc_logins WHERE device_code_hash = ?`, deviceCodeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete oidc login: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete oidc login: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// GetOIDCIdentity retrieves the ID of the user linked to an identity of the provider.
+// If the identity is not linked, it returns storage.ErrOIDCIdentityNotFound.
+func (s OIDCStorage) GetOIDCIdentity(ctx context.Context, issuer, subject string) (uint64, error) {
+	var userID uint64
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT user_id FROM oidc_identities WHERE issuer = ? AND subject = ?`,
+		issuer, subject,
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, storage.ErrOIDCIdentityNotFound
+		}
+		return 0, fmt.Errorf("failed to get oidc identity: %w", err)
+	}
+
+	return userID, nil
+}
+
+// CreateOIDCIdentity links an identity of the provider to a user.
+func (s OIDCStorage) CreateOIDCIdentity(ctx context.Context, issuer, subject string, userID uint64) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO oidc_identities (issuer, subject, user_id, created_at) VALUES (?, ?, ?, ?)`,
+		issuer, subject, userID, toUnix(time.Now()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create oidc identity for user id %d: %w", userID, err)
+	}
+
+	return nil
+}
+
+// scanOIDCLogin reads a single oidc_logins row selected with oidcLoginColumns.
+func scanOIDCLogin(row rowScanner) (storage.OIDCLogin, error) {
+	var l storage.OIDCLogin
+	var expiresAt int64
+	err := row.Scan(&l.DeviceCodeHash, &l.UserCodeHash, &l.BrowserHash, &l.State, &l.Nonce, &l.CodeVerifier, &l.Device, &l.UserID, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return l, storage.ErrOIDCLoginNotFound
+		}
+		return l, fmt.Errorf("failed to get oidc login: %w", err)
+	}
+	l.ExpiresAt = fromUnix(expiresAt)
+	return l, nil
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// GetUsage retrieves the vault storage used by a user.
+func (s VaultStorage) GetUsage(ctx context.Context, userID uint64) (storage.Usage, error) {
+	return getUsage(ctx, s.db, userID)
+}
+
+// GetQuota retrieves the quota of a user, the default quota set with WithDefaultQuota unless overridden.
+func (s VaultStorage) GetQuota(ctx context.Context, userID uint64) (storage.Quota, error) {
+	return s.getQuota(ctx, s.db, userID)
+}
+
+// SetQuota overrides the default quota for a user.
+func (s VaultStorage) SetQuota(ctx context.Context, userID uint64, q storage.Quota) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO user_quotas (user_id, max_bytes, max_entries) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET max_bytes = excluded.max_bytes, max_entries = excluded.max_entries`,
+		userID, q.MaxBytes, q.MaxEntries,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set quota of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// DeleteQuota removes the quota of a user set with SetQuota.
+func (s VaultStorage) DeleteQuota(ctx context.Context, userID uint64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM user_quotas WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete quota of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+func getUsage(ctx context.Context, q sqlx.QueryerContext, userID uint64) (storage.Usage, error) {
+	var u storage.Usage
+	err := q.QueryRowxContext(ctx, `SELECT count(*), COALESCE(sum(size), 0) FROM vault WHERE user_id = ?`, userID).Scan(&u.Entries, &u.Bytes)
+	if err != nil {
+		return u, fmt.Errorf("failed to get usage of user %d: %w", userID, err)
+	}
+	return u, nil
+}
+
+func (s VaultStorage) getQuota(ctx context.Context, q sqlx.QueryerContext, userID uint64) (storage.Quota, error) {
+	quota := storage.Quota{}
+	err := q.QueryRowxContext(ctx, `SELECT max_bytes, max_entries FROM user_quotas WHERE user_id = ?`, userID).Scan(&quota.MaxBytes, &quota.MaxEntries)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s.defaultQuota, nil
+	}
+	if err != nil {
+		return quota, fmt.Errorf("failed to get quota of user %d: %w", userID, err)
+	}
+	return quota, nil
+}
+
+// checkQuota checks a write of the user with storage.CheckQuota. The database has a single connection,
+// so the transaction alone keeps concurrent writes from exceeding the quota together.
+func (s VaultStorage) checkQuota(ctx context.Context, tx *sqlx.Tx, userID uint64, size int64, delta storage.Usage) error {
+	quota, err := s.getQuota(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if quota == (storage.Quota{}) {
+		return nil
+	}
+	used, err := getUsage(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	return storage.CheckQuota(quota, used, size, delta)
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// SRPHandshakeStorage handles operations related to zero-knowledge sign-in handshakes in a SQLite database.
+type SRPHandshakeStorage struct {
+	db *sqlx.DB
+}
+
+// NewSRPHandshakeStorage creates a new instance of SRPHandshakeStorage.
+// It takes a *sqlx.DB instance returned by Open which is used to interact with the database.
+// Returns a pointer to a SRPHandshakeStorage instance.
+func NewSRPHandshakeStorage(db *sqlx.DB) *SRPHandshakeStorage {
+	return &SRPHandshakeStorage{db: db}
+}
+
+// CreateSRPHandshake inserts a new handshake into the database and removes expired ones.
+func (s SRPHandshakeStorage) CreateSRPHandshake(ctx context.Context, h storage.SRPHandshake) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM srp_handshakes WHERE expires_at < ?`, toUnix(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to delete expired srp handshakes: %w", err)
+	}
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO srp_handshakes (id, user_id, client_proof, server_proof, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		h.ID, h.UserID, h.ClientProof, h.ServerProof, toUnix(h.ExpiresAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create srp handshake for user id %d: %w", h.UserID, err)
+	}
+
+	return nil
+}
+
+// TakeSRPHandshake deletes the handshake with the given ID and returns it.
+// The delete makes concurrent attempts to complete the same handshake fail.
+// If the handshake is not found, it returns storage.ErrSRPHandshakeNotFound.
+func (s SRPHandshakeStorage) TakeSRPHandshake(ctx context.Context, id string) (storage.SRPHandshake, error) {
+	h := storage.SRPHandshake{ID: id}
+	var expiresAt int64
+	err := s.db.QueryRowContext(
+		ctx,
+		`DELETE FROM srp_handshakes WHERE id = ? RETURNING user_id, client_proof, server_proof, expires_at`,
+		id,
+	).Scan(&h.UserID, &h.ClientProof, &h.ServerProof, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return h, storage.ErrSRPHandshakeNotFound
+		}
+		return h, fmt.Errorf("failed to take srp handshake: %w", err)
+	}
+	h.ExpiresAt = fromUnix(expiresAt)
+
+	return h, nil
+}
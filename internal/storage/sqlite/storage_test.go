@@ -0,0 +1,279 @@
+package sqlite_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/andreevym/gophkeeper/internal/storage/sqlite"
+	"github.com/andreevym/gophkeeper/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	t.Parallel()
+	db, err := sqlite.Open(context.Background(), "sqlite://"+filepath.Join(t.TempDir(), "gophkeeper.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	vaultStorage := sqlite.NewVaultStorage(db)
+	storagetest.Run(t, storagetest.Backend{
+		Users:  sqlite.NewUserStorage(db),
+		Vaults: vaultStorage,
+		Quotas: vaultStorage,
+		Audit:  sqlite.NewAuditStorage(db),
+	})
+}
+
+func TestBackup(t *testing.T) {
+	t.Parallel()
+	open := func(name string) storagetest.BackupBackend {
+		db, err := sqlite.Open(context.Background(), "sqlite://"+filepath.Join(t.TempDir(), name))
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		vaultStorage := sqlite.NewVaultStorage(db)
+		return storagetest.BackupBackend{
+			Backend: storagetest.Backend{
+				Users:  sqlite.NewUserStorage(db),
+				Vaults: vaultStorage,
+				Quotas: vaultStorage,
+				Audit:  sqlite.NewAuditStorage(db),
+			},
+			Tokens:   sqlite.NewTokenStorage(db),
+			Sessions: sqlite.NewSessionStorage(db),
+			Backups:  sqlite.NewBackupStorage(db),
+		}
+	}
+	storagetest.RunBackup(t, open("source.db"), open("target.db"))
+}
+
+func TestReopen(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	uri := "sqlite://" + filepath.Join(t.TempDir(), "gophkeeper.db")
+
+	db, err := sqlite.Open(ctx, uri)
+	require.NoError(t, err)
+	u, err := sqlite.NewUserStorage(db).CreateUser(ctx, storage.User{Login: "user", Password: "hash"})
+	require.NoError(t, err)
+	value := bytes.Repeat([]byte("0123456789"), sqlite.ChunkSize/4)
+	v, err := sqlite.NewVaultStorage(db).CreateVault(ctx, storage.Vault{Key: "k", Value: value, UserID: u.ID})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// Migrations are applied once, the data is kept.
+	db, err = sqlite.Open(ctx, uri)
+	require.NoError(t, err)
+	defer db.Close()
+	got, err := sqlite.NewVaultStorage(db).GetVault(ctx, v.ID)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(value, got.Value), "value differs")
+	var chunks int
+	require.NoError(t, db.GetContext(ctx, &chunks, `SELECT count(*) FROM vault_chunks WHERE vault_id = ?`, v.ID))
+	assert.Equal(t, 3, chunks)
+
+	_, err = sqlite.Open(ctx, "postgres://localhost/gophkeeper")
+	assert.Error(t, err)
+}
+
+func TestVaultValue(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db, err := sqlite.Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "gophkeeper.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	u, err := sqlite.NewUserStorage(db).CreateUser(ctx, storage.User{Login: "user"})
+	require.NoError(t, err)
+	vaultStorage := sqlite.NewVaultStorage(db)
+	value := bytes.Repeat([]byte("0123456789"), sqlite.ChunkSize/4)
+
+	v, err := vaultStorage.CreateVaultFrom(ctx, storage.Vault{Key: "k", UserID: u.ID}, bytes.NewReader(value), int64(len(value)))
+	require.NoError(t, err)
+	r, err := vaultStorage.OpenVaultValue(ctx, v.ID)
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.True(t, bytes.Equal(value, got), "value differs")
+
+	// The value must have the size the quota was checked against.
+	_, err = vaultStorage.CreateVaultFrom(ctx, storage.Vault{Key: "short", UserID: u.ID}, bytes.NewReader(value), int64(len(value))+1)
+	assert.Error(t, err)
+	err = vaultStorage.UpdateVaultFrom(ctx, storage.Vault{ID: v.ID, Key: "k"}, bytes.NewReader(value), int64(len(value))-1)
+	assert.Error(t, err)
+	_, err = vaultStorage.GetVault(ctx, v.ID)
+	require.NoError(t, err, "failed updates keep the value")
+
+	// A value replaced while it is read isn't mixed with the new one.
+	r, err = vaultStorage.OpenVaultValue(ctx, v.ID)
+	require.NoError(t, err)
+	_, err = io.ReadFull(r, make([]byte, sqlite.ChunkSize))
+	require.NoError(t, err)
+	require.NoError(t, vaultStorage.UpdateVaultFrom(ctx, storage.Vault{ID: v.ID, Key: "k"}, bytes.NewReader(value), int64(len(value))))
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, storage.ErrVaultChanged)
+
+	r, err = vaultStorage.OpenVaultValue(ctx, v.ID)
+	require.NoError(t, err)
+	require.NoError(t, vaultStorage.DeleteVault(ctx, v.ID))
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, storage.ErrVaultChanged)
+	_, err = vaultStorage.OpenVaultValue(ctx, v.ID)
+	assert.ErrorIs(t, err, storage.ErrVaultNotFound)
+}
+
+func TestAuthStorage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db, err := sqlite.Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "gophkeeper.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	u, err := sqlite.NewUserStorage(db).CreateUser(ctx, storage.User{Login: "user"})
+	require.NoError(t, err)
+	now := time.Now().Truncate(time.Microsecond)
+
+	t.Run("tokens", func(t *testing.T) {
+		tokenStorage := sqlite.NewTokenStorage(db)
+		expiresAt := now.Add(time.Hour)
+		created, err := tokenStorage.CreateToken(ctx, storage.AccessToken{
+			UserID: u.ID, Name: "ci", Hash: "hash", Permission: storage.TokenPermissionRead, VaultIDs: []uint64{1, 2}, ExpiresAt: &expiresAt,
+		})
+		require.NoError(t, err)
+		require.NoError(t, tokenStorage.RevokeToken(ctx, created.ID, now))
+		require.NoError(t, tokenStorage.RevokeToken(ctx, created.ID, now.Add(time.Minute)))
+
+		got, err := tokenStorage.GetTokenByHash(ctx, "hash")
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2}, got.VaultIDs)
+		assert.True(t, expiresAt.Equal(*got.ExpiresAt))
+		assert.True(t, now.Equal(*got.RevokedAt))
+		assert.Nil(t, got.LastUsedAt)
+		assert.ErrorIs(t, tokenStorage.RevokeToken(ctx, created.ID+1, now), storage.ErrTokenNotFound)
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		sessionStorage := sqlite.NewSessionStorage(db)
+		s1, err := sessionStorage.CreateSession(ctx, storage.Session{UserID: u.ID, DeviceName: "laptop", CreatedAt: now})
+		require.NoError(t, err)
+		s2, err := sessionStorage.CreateSession(ctx, storage.Session{UserID: u.ID, DeviceName: "phone", CreatedAt: now})
+		require.NoError(t, err)
+		require.NoError(t, sessionStorage.TouchSession(ctx, s1.ID, now.Add(time.Minute)))
+
+		sessions, err := sessionStorage.ListSessions(ctx, u.ID)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		assert.Equal(t, s1.ID, sessions[0].ID)
+
+		require.NoError(t, sessionStorage.RevokeOtherSessions(ctx, u.ID, s1.ID, now))
+		got, err := sessionStorage.GetSession(ctx, s2.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, got.RevokedAt)
+	})
+
+	t.Run("throttle", func(t *testing.T) {
+		throttleStorage := sqlite.NewThrottleStorage(db)
+		for i := 1; i <= 2; i++ {
+			state, err := throttleStorage.AddThrottleFailure(ctx, "login:user", now, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, i, state.Failures)
+		}
+		state, err := throttleStorage.AddThrottleFailure(ctx, "login:user", now.Add(2*time.Minute), time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, 1, state.Failures)
+
+		for i := 1; i <= 2; i++ {
+			state, err = throttleStorage.ReserveThrottle(ctx, "login:other", now, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, i, state.Pending)
+		}
+		require.NoError(t, throttleStorage.ReleaseThrottle(ctx, "login:other"))
+		state, err = throttleStorage.ReserveThrottle(ctx, "login:other", now.Add(2*time.Minute), time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, 1, state.Pending, "abandoned reservations expire")
+		assert.Zero(t, state.Failures)
+
+		require.NoError(t, throttleStorage.CreateFailedSignIn(ctx, storage.FailedSignIn{UserID: u.ID, Login: "user", Reason: "invalid_password", CreatedAt: now}))
+		require.NoError(t, throttleStorage.CreateFailedSignIn(ctx, storage.FailedSignIn{Login: "unknown", Reason: "unknown_login", CreatedAt: now}))
+		attempts, err := throttleStorage.ListFailedSignIns(ctx, u.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, attempts, 1)
+		assert.True(t, now.Equal(attempts[0].CreatedAt))
+	})
+
+	t.Run("srp handshakes can be taken once", func(t *testing.T) {
+		srpStorage := sqlite.NewSRPHandshakeStorage(db)
+		h := storage.SRPHandshake{ID: "id", UserID: u.ID, ClientProof: []byte("m1"), ServerProof: []byte("m2"), ExpiresAt: now.Add(time.Minute)}
+		require.NoError(t, srpStorage.CreateSRPHandshake(ctx, h))
+		got, err := srpStorage.TakeSRPHandshake(ctx, "id")
+		require.NoError(t, err)
+		assert.Equal(t, h.ServerProof, got.ServerProof)
+		_, err = srpStorage.TakeSRPHandshake(ctx, "id")
+		assert.ErrorIs(t, err, storage.ErrSRPHandshakeNotFound)
+	})
+
+	t.Run("audit log is append-only", func(t *testing.T) {
+		auditStorage := sqlite.NewAuditStorage(db)
+		e, err := auditStorage.AppendAuditEvent(ctx, storage.AuditEvent{CreatedAt: now, Action: storage.AuditSignIn, UserID: u.ID})
+		require.NoError(t, err)
+		_, err = db.ExecContext(ctx, `UPDATE audit_log SET user_id = 0 WHERE id = ?`, e.ID)
+		assert.ErrorContains(t, err, "append-only")
+		_, err = db.ExecContext(ctx, `DELETE FROM audit_log WHERE id = ?`, e.ID)
+		assert.ErrorContains(t, err, "append-only")
+	})
+
+	t.Run("deleting the user cascades", func(t *testing.T) {
+		oidcStorage := sqlite.NewOIDCStorage(db)
+		require.NoError(t, oidcStorage.CreateOIDCIdentity(ctx, "issuer", "subject", u.ID))
+		require.NoError(t, sqlite.NewUserStorage(db).DeleteUser(ctx, u.ID))
+		_, err := oidcStorage.GetOIDCIdentity(ctx, "issuer", "subject")
+		assert.ErrorIs(t, err, storage.ErrOIDCIdentityNotFound)
+		_, err = sqlite.NewTokenStorage(db).GetTokenByHash(ctx, "hash")
+		assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+	})
+}
+
+func TestOIDCLoginApproval(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	db, err := sqlite.Open(ctx, "sqlite://"+filepath.Join(t.TempDir(), "gophkeeper.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	oidcStorage := sqlite.NewOIDCStorage(db)
+	login := storage.OIDCLogin{
+		DeviceCodeHash: "device",
+		UserCodeHash:   "user",
+		State:          "state",
+		Nonce:          "nonce",
+		CodeVerifier:   "verifier",
+		Device:         "laptop",
+		ExpiresAt:      time.Now().Add(time.Minute),
+	}
+	require.NoError(t, oidcStorage.CreateOIDCLogin(ctx, login))
+	got, err := oidcStorage.GetOIDCLoginByUserCode(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, "laptop", got.Device)
+	assert.Empty(t, got.BrowserHash)
+	_, err = oidcStorage.GetOIDCLoginByUserCode(ctx, "other")
+	assert.ErrorIs(t, err, storage.ErrOIDCLoginNotFound)
+
+	approved, err := oidcStorage.ApproveOIDCLogin(ctx, "user", "browser")
+	require.NoError(t, err)
+	assert.True(t, approved)
+	approved, err = oidcStorage.ApproveOIDCLogin(ctx, "user", "another browser")
+	require.NoError(t, err)
+	assert.False(t, approved, "a sign-in is approved by a single browser")
+	got, err = oidcStorage.GetOIDCLoginByState(ctx, "state")
+	require.NoError(t, err)
+	assert.Equal(t, "browser", got.BrowserHash)
+
+	login.DeviceCodeHash, login.State = "device2", "state2"
+	assert.Error(t, oidcStorage.CreateOIDCLogin(ctx, login), "user codes are unique")
+}
@@ -0,0 +1,161 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+const tokenColumns = `id, user_id, name, token_hash, permission, key_prefix, vault_ids, expires_at, last_used_at, revoked_at, created_at`
+
+// TokenStorage handles operations related to personal access tokens in a SQLite database.
+type TokenStorage struct {
+	db *sqlx.DB
+}
+
+// NewTokenStorage creates a new instance of TokenStorage.
+// It takes a *sqlx.DB instance returned by Open which is used to interact with the database.
+// Returns a pointer to a TokenStorage instance.
+func NewTokenStorage(db *sqlx.DB) *TokenStorage {
+	return &TokenStorage{db: db}
+}
+
+// GetToken retrieves a token by its ID.
+// If the token is not found, it returns storage.ErrTokenNotFound.
+func (s TokenStorage) GetToken(ctx context.Context, id uint64) (storage.AccessToken, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+tokenColumns+` FROM access_tokens WHERE id = ?`, id)
+	t, err := scanToken(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t, storage.ErrTokenNotFound
+		}
+		return t, fmt.Errorf("failed to get token by id %d: %w", id, err)
+	}
+
+	return t, nil
+}
+
+// GetTokenByHash retrieves a token by the hash of its plain value.
+// If the token is not found, it returns storage.ErrTokenNotFound.
+func (s TokenStorage) GetTokenByHash(ctx context.Context, hash string) (storage.AccessToken, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+tokenColumns+` FROM access_tokens WHERE token_hash = ?`, hash)
+	t, err := scanToken(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t, storage.ErrTokenNotFound
+		}
+		return t, fmt.Errorf("failed to get token by hash: %w", err)
+	}
+
+	return t, nil
+}
+
+// ListTokens retrieves all tokens issued by the user ordered by creation.
+func (s TokenStorage) ListTokens(ctx context.Context, userID uint64) ([]storage.AccessToken, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+tokenColumns+` FROM access_tokens WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens by user id %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	tokens := make([]storage.AccessToken, 0)
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tokens by user id %d: %w", userID, err)
+	}
+
+	return tokens, nil
+}
+
+// CreateToken inserts a new token into the database.
+// Returns the created storage.AccessToken object and an error if any.
+func (s TokenStorage) CreateToken(ctx context.Context, t storage.AccessToken) (storage.AccessToken, error) {
+	vaultIDs, err := json.Marshal(nonNilIDs(t.VaultIDs))
+	if err != nil {
+		return t, fmt.Errorf("failed to marshal vault ids: %w", err)
+	}
+
+	t.CreatedAt = time.Now()
+	err = s.db.QueryRowContext(
+		ctx,
+		`INSERT INTO access_tokens (user_id, name, token_hash, permission, key_prefix, vault_ids, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		t.UserID, t.Name, t.Hash, t.Permission, t.KeyPrefix, string(vaultIDs), toNullUnix(t.ExpiresAt), toUnix(t.CreatedAt),
+	).Scan(&t.ID)
+	if err != nil {
+		return t, fmt.Errorf("failed to create token %s: %w", t.Name, err)
+	}
+
+	return t, nil
+}
+
+// TouchToken updates the last-used timestamp of the token.
+func (s TokenStorage) TouchToken(ctx context.Context, id uint64, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE access_tokens SET last_used_at = ? WHERE id = ?`, toUnix(usedAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to touch token by id %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// RevokeToken marks the token as revoked. Revoking an already revoked token keeps the original revocation time.
+func (s TokenStorage) RevokeToken(ctx context.Context, id uint64, revokedAt time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE access_tokens SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`, toUnix(revokedAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token by id %d: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke token by id %d: %w", id, err)
+	}
+	if n == 0 {
+		return storage.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// scanToken reads a single access_tokens row selected with tokenColumns.
+func scanToken(row rowScanner) (storage.AccessToken, error) {
+	var t storage.AccessToken
+	var vaultIDs string
+	var expiresAt, lastUsedAt, revokedAt sql.NullInt64
+	var createdAt int64
+	err := row.Scan(
+		&t.ID, &t.UserID, &t.Name, &t.Hash, &t.Permission, &t.KeyPrefix, &vaultIDs,
+		&expiresAt, &lastUsedAt, &revokedAt, &createdAt,
+	)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal([]byte(vaultIDs), &t.VaultIDs)
+	if err != nil {
+		return t, fmt.Errorf("failed to unmarshal vault ids: %w", err)
+	}
+	t.ExpiresAt = fromNullUnix(expiresAt)
+	t.LastUsedAt = fromNullUnix(lastUsedAt)
+	t.RevokedAt = fromNullUnix(revokedAt)
+	t.CreatedAt = fromUnix(createdAt)
+	return t, nil
+}
+
+// nonNilIDs returns an empty slice for nil, which would be marshalled to JSON null.
+func nonNilIDs(ids []uint64) []uint64 {
+	if ids == nil {
+		return []uint64{}
+	}
+	return ids
+}
@@ -0,0 +1,211 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const userColumns = `id, login, password, totp_secret, totp_enabled, totp_last_step, recovery_codes, token_version, srp_salt, srp_verifier, role, disabled, revision`
+
+// UserStorage handles operations related to user data in a SQLite database.
+type UserStorage struct {
+	db *sqlx.DB
+}
+
+// NewUserStorage creates a new instance of UserStorage.
+// It takes a *sqlx.DB instance returned by Open which is used to interact with the database.
+// Returns a pointer to a UserStorage instance.
+func NewUserStorage(db *sqlx.DB) *UserStorage {
+	return &UserStorage{db: db}
+}
+
+// GetUser retrieves a user by their ID.
+// If the user is not found, it returns storage.ErrUserNotFound.
+func (s UserStorage) GetUser(ctx context.Context, id uint64) (storage.User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+	u, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return u, storage.ErrUserNotFound
+		}
+		return u, fmt.Errorf("failed to get user by id %d: %w", id, err)
+	}
+
+	return u, nil
+}
+
+// GetUserByLogin retrieves a user by their login, ignoring the case of ASCII letters.
+// Other letters are compared as they are, logins are expected to be normalized with storage.NormalizeLogin.
+// If the user is not found, it returns storage.ErrUserNotFound.
+func (s UserStorage) GetUserByLogin(ctx context.Context, login string) (storage.User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE login = ? COLLATE NOCASE`, login)
+	u, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return u, storage.ErrUserNotFound
+		}
+		return u, fmt.Errorf("failed to get user by login %s: %w", login, err)
+	}
+
+	return u, nil
+}
+
+// ListUsers retrieves the users whose login contains the query, ignoring the case of ASCII letters, ordered by ID.
+func (s UserStorage) ListUsers(ctx context.Context, query string, afterID uint64, limit int) ([]storage.User, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+userColumns+` FROM users WHERE id > ? AND instr(lower(login), lower(?)) > 0 ORDER BY id LIMIT ?`,
+		afterID, query, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []storage.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, nil
+}
+
+// CreateUser inserts a new user into the database.
+// Returns the created storage.User object and an error if any.
+// If the login is taken ignoring case, it returns storage.ErrLoginTaken.
+func (s UserStorage) CreateUser(ctx context.Context, u storage.User) (storage.User, error) {
+	if u.Role == "" {
+		u.Role = storage.RoleUser
+	}
+	err := s.db.QueryRowContext(
+		ctx,
+		`INSERT INTO users (login, password, srp_salt, srp_verifier, role, disabled) VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+		u.Login, u.Password, nonNilBytes(u.SRPSalt), nonNilBytes(u.SRPVerifier), u.Role, u.Disabled,
+	).Scan(&u.ID)
+	if isLoginTaken(err) {
+		return u, storage.ErrLoginTaken
+	}
+	if err != nil {
+		return u, fmt.Errorf("failed to create user %s: %w", u.Login, err)
+	}
+
+	return u, nil
+}
+
+// UpdateUser updates an existing user in the database if its revision is still the one of the user.
+// If the login is taken by another user ignoring case, it returns storage.ErrLoginTaken.
+// If the user was changed or deleted since it was read, it returns storage.ErrUserConflict.
+func (s UserStorage) UpdateUser(ctx context.Context, u storage.User) error {
+	recoveryCodes, err := json.Marshal(nonNilStrings(u.RecoveryCodes))
+	if err != nil {
+		return fmt.Errorf("failed to marshal recovery codes: %w", err)
+	}
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE users SET login = ?, password = ?, totp_secret = ?, totp_enabled = ?, totp_last_step = ?, recovery_codes = ?,
+		token_version = ?, srp_salt = ?, srp_verifier = ?, role = ?, disabled = ?, revision = revision + 1 WHERE id = ? AND revision = ?`,
+		u.Login, u.Password, u.TOTPSecret, u.TOTPEnabled, u.TOTPLastStep, string(recoveryCodes),
+		u.TokenVersion, nonNilBytes(u.SRPSalt), nonNilBytes(u.SRPVerifier), u.Role, u.Disabled, u.ID, u.Revision,
+	)
+	if isLoginTaken(err) {
+		return storage.ErrLoginTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update user by id %d, login %s: %w", u.ID, u.Login, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update user by id %d, login %s: %w", u.ID, u.Login, err)
+	}
+	if n == 0 {
+		return storage.ErrUserConflict
+	}
+
+	return nil
+}
+
+// isLoginTaken reports whether err is a violation of the unique index on logins, the only unique index of users.
+func isLoginTaken(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// DeleteUser removes a user from the database by their ID together with all their data:
+// vault entries and their chunks, personal access tokens and the quota.
+// Everything is deleted in a single transaction, so a failure leaves the account intact.
+func (s UserStorage) DeleteUser(ctx context.Context, id uint64) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM vault WHERE user_id = ?`,
+		`DELETE FROM access_tokens WHERE user_id = ?`,
+		`DELETE FROM user_quotas WHERE user_id = ?`,
+		`DELETE FROM users WHERE id = ?`,
+	}
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete user by id %d: %w", id, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// scanUser reads a single users row selected with userColumns.
+func scanUser(row rowScanner) (storage.User, error) {
+	var u storage.User
+	var recoveryCodes string
+	err := row.Scan(
+		&u.ID, &u.Login, &u.Password, &u.TOTPSecret, &u.TOTPEnabled, &u.TOTPLastStep, &recoveryCodes,
+		&u.TokenVersion, &u.SRPSalt, &u.SRPVerifier, &u.Role, &u.Disabled, &u.Revision,
+	)
+	if err != nil {
+		return storage.User{}, err
+	}
+	err = json.Unmarshal([]byte(recoveryCodes), &u.RecoveryCodes)
+	if err != nil {
+		return storage.User{}, fmt.Errorf("failed to unmarshal recovery codes: %w", err)
+	}
+	return u, nil
+}
+
+// nonNilBytes returns an empty slice for nil, which the driver would store as NULL.
+func nonNilBytes(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+// nonNilStrings returns an empty slice for nil, which would be marshalled to JSON null.
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
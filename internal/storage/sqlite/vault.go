@@ -0,0 +1,291 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// ChunkSize is the size of the chunks vault values are split into.
+// SQLite reads and writes a BLOB as a whole, so values are stored in chunks which are copied one at a time.
+const ChunkSize = 64 * 1024
+
+// VaultStorage handles operations related to vault data in a SQLite database.
+// VaultStorage also implements storage.QuotaStorage, creating and updating vaults checks the quota of the owner.
+type VaultStorage struct {
+	db           *sqlx.DB
+	defaultQuota storage.Quota
+}
+
+// NewVaultStorage creates a new instance of VaultStorage.
+// It takes a *sqlx.DB instance returned by Open which is used to interact with the database, and options.
+// Returns a pointer to a VaultStorage instance.
+func NewVaultStorage(db *sqlx.DB, opts ...Option) *VaultStorage {
+	o := newOptions(opts)
+	return &VaultStorage{db: db, defaultQuota: o.defaultQuota}
+}
+
+// GetVault retrieves a vault by its ID.
+// If the vault is not found, it returns storage.ErrVaultNotFound.
+func (s VaultStorage) GetVault(ctx context.Context, id uint64) (storage.Vault, error) {
+	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return storage.Vault{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	v := storage.Vault{ID: id}
+	var generation int64
+	err = tx.QueryRowContext(ctx, `SELECT key, user_id, generation FROM vault WHERE id = ?`, id).Scan(&v.Key, &v.UserID, &generation)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return v, storage.ErrVaultNotFound
+		}
+		return v, fmt.Errorf("failed to get vault by id %d: %w", id, err)
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	_, err = io.Copy(buffer, &chunkReader{ctx: ctx, q: tx, vaultID: id, generation: generation})
+	if err != nil {
+		return storage.Vault{}, fmt.Errorf("failed to read vault %d: %w", id, err)
+	}
+	v.Value = buffer.Bytes()
+	return v, nil
+}
+
+// OpenVaultValue opens the value of a vault for reading chunk by chunk.
+// The database has a single connection, so the chunks are read one query at a time rather than in a transaction
+// held open until the caller is done. The reader fails with storage.ErrVaultChanged if the value is replaced meanwhile.
+// If the vault is not found, it returns storage.ErrVaultNotFound.
+func (s VaultStorage) OpenVaultValue(ctx context.Context, id uint64) (io.ReadCloser, error) {
+	var generation int64
+	err := s.db.QueryRowContext(ctx, `SELECT generation FROM vault WHERE id = ?`, id).Scan(&generation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrVaultNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vault by id %d: %w", id, err)
+	}
+	return io.NopCloser(&chunkReader{ctx: ctx, q: s.db, vaultID: id, generation: generation}), nil
+}
+
+// CreateVault inserts a new vault into the database.
+// Returns the created storage.Vault object and an error if any.
+// If the vault doesn't fit into the quota of the user, it returns storage.ErrQuotaExceeded or storage.ErrEntryTooLarge.
+func (s VaultStorage) CreateVault(ctx context.Context, v storage.Vault) (storage.Vault, error) {
+	created, err := s.CreateVaultFrom(ctx, v, bytes.NewReader(v.Value), int64(len(v.Value)))
+	if err != nil {
+		return storage.Vault{}, err
+	}
+	created.Value = v.Value
+	return created, nil
+}
+
+// CreateVaultFrom inserts a new vault into the database, copying its value of the given size from r chunk by chunk.
+// Returns the created storage.Vault object without its value and an error if any.
+// If the vault doesn't fit into the quota of the user, it returns storage.ErrQuotaExceeded or storage.ErrEntryTooLarge.
+func (s VaultStorage) CreateVaultFrom(ctx context.Context, v storage.Vault, r io.Reader, size int64) (storage.Vault, error) {
+	v.Value = nil
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return storage.Vault{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = s.checkQuota(ctx, tx, v.UserID, size, storage.Usage{Bytes: size, Entries: 1})
+	if err != nil {
+		return storage.Vault{}, err
+	}
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO vault (key, size, user_id) VALUES (?, ?, ?) RETURNING id`, v.Key, size, v.UserID).Scan(&v.ID)
+	if err != nil {
+		return storage.Vault{}, fmt.Errorf("failed to create vault %s: %w", v.Key, err)
+	}
+
+	err = writeChunks(ctx, tx, v.ID, r, size)
+	if err != nil {
+		return storage.Vault{}, fmt.Errorf("failed to copy vault %s: %w", v.Key, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return storage.Vault{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return v, nil
+}
+
+// UpdateVault updates the key and the value of an existing vault in the database.
+// If the new value doesn't fit into the quota of the owner, it returns storage.ErrQuotaExceeded or storage.ErrEntryTooLarge.
+func (s VaultStorage) UpdateVault(ctx context.Context, v storage.Vault) error {
+	return s.UpdateVaultFrom(ctx, v, bytes.NewReader(v.Value), int64(len(v.Value)))
+}
+
+// UpdateVaultFrom updates the key of an existing vault in the database and replaces its value with the one
+// of the given size copied from r chunk by chunk.
+// If the new value doesn't fit into the quota of the owner, it returns storage.ErrQuotaExceeded or storage.ErrEntryTooLarge.
+func (s VaultStorage) UpdateVaultFrom(ctx context.Context, v storage.Vault, r io.Reader, size int64) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldSize int64
+	var userID uint64
+	err = tx.QueryRowContext(ctx, `SELECT size, user_id FROM vault WHERE id = ?`, v.ID).Scan(&oldSize, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get vault by id %d: %w", v.ID, err)
+	}
+
+	err = s.checkQuota(ctx, tx, userID, size, storage.Usage{Bytes: size - oldSize})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE vault SET key = ?, size = ?, generation = generation + 1 WHERE id = ?`, v.Key, size, v.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update vault by id %d, key %s: %w", v.ID, v.Key, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM vault_chunks WHERE vault_id = ?`, v.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update vault by id %d, key %s: %w", v.ID, v.Key, err)
+	}
+	err = writeChunks(ctx, tx, v.ID, r, size)
+	if err != nil {
+		return fmt.Errorf("failed to copy vault %s: %w", v.Key, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteVault removes a vault and its chunks from the database by its ID.
+func (s VaultStorage) DeleteVault(ctx context.Context, id uint64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM vault WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete vault by id %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// ListVaults retrieves the vaults of a user without their values, ordered by ID.
+func (s VaultStorage) ListVaults(ctx context.Context, userID uint64) ([]storage.Vault, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, key, user_id FROM vault WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vaults of user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	vaults := []storage.Vault{}
+	for rows.Next() {
+		var v storage.Vault
+		err = rows.Scan(&v.ID, &v.Key, &v.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list vaults of user %d: %w", userID, err)
+		}
+		vaults = append(vaults, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list vaults of user %d: %w", userID, err)
+	}
+	return vaults, nil
+}
+
+// writeChunks stores the value read from r as chunks of the vault, ChunkSize bytes at a time.
+// Unless the size is -1, the value must have exactly the given size, which the quota was checked against.
+func writeChunks(ctx context.Context, tx *sqlx.Tx, vaultID uint64, r io.Reader, size int64) error {
+	if size >= 0 {
+		r = io.LimitReader(r, size+1)
+	}
+	buf := make([]byte, ChunkSize)
+	var written int64
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			written += int64(n)
+			if size >= 0 && written > size {
+				return fmt.Errorf("value is larger than %d bytes", size)
+			}
+			_, execErr := tx.ExecContext(ctx, `INSERT INTO vault_chunks (vault_id, seq, data) VALUES (?, ?, ?)`, vaultID, seq, buf[:n])
+			if execErr != nil {
+				return execErr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			if size >= 0 && written != size {
+				return fmt.Errorf("value has %d bytes instead of %d", written, size)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// chunkReader reads the value of a vault chunk by chunk.
+// Each chunk is only read if the vault still has the generation the reader started with.
+type chunkReader struct {
+	ctx        context.Context
+	q          sqlx.QueryerContext
+	vaultID    uint64
+	generation int64
+	seq        int
+	chunk      []byte
+	done       bool
+}
+
+// Read implements io.Reader, loading the next chunk when the current one is consumed.
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		err := r.q.QueryRowxContext(r.ctx, `
+			SELECT vault_chunks.data FROM vault_chunks JOIN vault ON vault.id = vault_chunks.vault_id
+			WHERE vault_chunks.vault_id = ? AND vault_chunks.seq = ? AND vault.generation = ?`,
+			r.vaultID, r.seq, r.generation).Scan(&r.chunk)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Either all chunks are read or the value was replaced since the last one.
+			if err = r.checkGeneration(); err != nil {
+				return 0, err
+			}
+			r.done = true
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		r.seq++
+	}
+
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+// checkGeneration returns storage.ErrVaultChanged if the vault was updated or deleted since the reader started.
+func (r *chunkReader) checkGeneration() error {
+	var generation int64
+	err := r.q.QueryRowxContext(r.ctx, `SELECT generation FROM vault WHERE id = ?`, r.vaultID).Scan(&generation)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && generation != r.generation {
+		return storage.ErrVaultChanged
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrSRPHandshakeNotFound is returned if no zero-knowledge sign-in handshake has the ID.
+var ErrSRPHandshakeNotFound = errors.New("srp handshake not found")
+
+// SRPHandshake is a started zero-knowledge sign-in waiting for the client proof.
+// Only the expected proofs are kept, the secret ephemeral of the server is discarded after the challenge.
+type SRPHandshake struct {
+	ID          string    // Random identifier sent to the client with the challenge.
+	UserID      uint64    // The ID of the user signing in.
+	ClientProof []byte    // The proof M1 the client must send.
+	ServerProof []byte    // The proof M2 returned to the client on success.
+	ExpiresAt   time.Time // The handshake can't be completed after this time.
+}
+
+// SRPHandshakeStorage defines the interface for operations on zero-knowledge sign-in handshakes in the storage system.
+type SRPHandshakeStorage interface {
+	// CreateSRPHandshake stores a new handshake and removes expired ones.
+	// Takes a context.Context and an SRPHandshake object as parameters.
+	// Returns an error if any.
+	CreateSRPHandshake(ctx context.Context, h SRPHandshake) error
+
+	// TakeSRPHandshake retrieves a handshake by its ID and removes it, so that every handshake can be completed once.
+	// Takes a context.Context and the handshake's ID (string) as parameters.
+	// Returns the SRPHandshake and an error if any.
+	TakeSRPHandshake(ctx context.Context, id string) (SRPHandshake, error)
+}
@@ -0,0 +1,134 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAuditAppend(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	other := createUser(t, b, "other")
+	now := time.Now()
+
+	e1, err := b.Audit.AppendAuditEvent(ctx, storage.AuditEvent{
+		CreatedAt: now, Action: storage.AuditSignIn, UserID: u.ID, Login: u.Login,
+		IP: "192.0.2.1", UserAgent: "agent", RequestID: "host/1",
+	})
+	require.NoError(t, err)
+	assert.NotZero(t, e1.ID)
+	assert.Len(t, e1.Hash, 64)
+	assert.Equal(t, e1.ComputeHash(), e1.Hash)
+
+	_, err = b.Audit.AppendAuditEvent(ctx, storage.AuditEvent{CreatedAt: now, Action: storage.AuditVaultRead, UserID: other.ID, VaultID: 7})
+	require.NoError(t, err)
+	e3, err := b.Audit.AppendAuditEvent(ctx, storage.AuditEvent{
+		CreatedAt: now.Add(time.Second), Action: storage.AuditVaultRead, UserID: u.ID, TokenID: 3, VaultID: 7,
+	})
+	require.NoError(t, err)
+	assert.Greater(t, e3.ID, e1.ID)
+
+	events, err := b.Audit.ListAuditEvents(ctx, u.ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, e3.ID, events[0].ID)
+	assert.Equal(t, e1.ID, events[1].ID)
+	assert.True(t, e1.CreatedAt.Equal(events[1].CreatedAt))
+	assert.Equal(t, e1.Hash, events[1].Hash)
+	assert.Equal(t, e1.Hash, events[1].ComputeHash(), "the stored record hashes the same")
+	assert.Equal(t, "host/1", events[1].RequestID)
+	assert.Equal(t, uint64(3), events[0].TokenID)
+
+	events, err = b.Audit.ListAuditEvents(ctx, u.ID, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, e3.ID, events[0].ID)
+
+	events, err = b.Audit.ListAuditEvents(ctx, u.ID, e3.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, e1.ID, events[0].ID)
+}
+
+func testAuditExport(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+
+	first, err := b.Audit.AppendAuditEvent(ctx, storage.AuditEvent{CreatedAt: time.Now(), Action: storage.AuditVaultCreate, UserID: u.ID, VaultID: 1})
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		_, err = b.Audit.AppendAuditEvent(ctx, storage.AuditEvent{CreatedAt: time.Now(), Action: storage.AuditVaultUpdate, UserID: u.ID, VaultID: 1})
+		require.NoError(t, err)
+	}
+
+	// Export in pages and verify the chain across the pages.
+	prevHash := first.PrevHash
+	afterID := first.ID - 1
+	var exported []storage.AuditEvent
+	for {
+		events, err := b.Audit.ExportAuditEvents(ctx, afterID, 2)
+		require.NoError(t, err)
+		if len(events) == 0 {
+			break
+		}
+		assert.LessOrEqual(t, len(events), 2)
+		prevHash, err = storage.VerifyAuditChain(prevHash, events)
+		require.NoError(t, err)
+		exported = append(exported, events...)
+		afterID = events[len(events)-1].ID
+	}
+	require.Len(t, exported, 5)
+	assert.Equal(t, first.ID, exported[0].ID)
+
+	n, lastHash, err := storage.VerifyAuditLog(ctx, b.Audit, 2)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 5)
+	assert.Equal(t, exported[4].Hash, lastHash)
+
+	tampered := append([]storage.AuditEvent(nil), exported...)
+	tampered[2].VaultID = 2
+	_, err = storage.VerifyAuditChain(first.PrevHash, tampered)
+	assert.ErrorIs(t, err, storage.ErrAuditChainBroken)
+	_, err = storage.VerifyAuditChain(first.PrevHash, append(exported[:2:2], exported[3:]...))
+	assert.ErrorIs(t, err, storage.ErrAuditChainBroken)
+}
+
+func testConcurrentAudit(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := b.Audit.AppendAuditEvent(ctx, storage.AuditEvent{
+				CreatedAt: time.Now(), Action: storage.AuditVaultRead, UserID: u.ID, VaultID: uint64(i + 1), RequestID: fmt.Sprint(i),
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	events, err := b.Audit.ListAuditEvents(ctx, u.ID, 0, workers)
+	require.NoError(t, err)
+	require.Len(t, events, workers)
+	oldest := events[workers-1]
+	exported, err := b.Audit.ExportAuditEvents(ctx, oldest.ID-1, workers)
+	require.NoError(t, err)
+	_, err = storage.VerifyAuditChain(oldest.PrevHash, exported)
+	assert.NoError(t, err, "appends at the same time are chained one after another")
+}
@@ -0,0 +1,157 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/backup"
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// BackupBackend is a storage implementation whose backups are under test.
+// Unlike Backend, it must not be shared with other tests: the whole storage is compared.
+type BackupBackend struct {
+	Backend  // Quotas and Audit are required.
+	Tokens   storage.TokenStorage
+	Sessions storage.SessionStorage
+	Backups  storage.BackupStorage
+}
+
+// RunBackup populates the source, backs it up and restores the backup into the empty target,
+// then compares both storages.
+func RunBackup(t *testing.T, source, target BackupBackend) {
+	ctx := context.Background()
+	large := make([]byte, 300*1024)
+	_, err := rand.Read(large)
+	require.NoError(t, err)
+
+	alice, err := source.Users.CreateUser(ctx, storage.User{
+		Login: "alice", Password: "hash", TOTPSecret: "JBSWY3DPEHPK3PXP", TOTPEnabled: true, TOTPLastStep: 42,
+		RecoveryCodes: []string{"code1", "code2"}, SRPSalt: []byte{0, 1, 2}, SRPVerifier: []byte{0xff}, Role: storage.RoleAdmin,
+	})
+	require.NoError(t, err)
+	bob, err := source.Users.CreateUser(ctx, storage.User{Login: "bob", Password: "hash"})
+	require.NoError(t, err)
+	require.NoError(t, source.Quotas.SetQuota(ctx, bob.ID, storage.Quota{MaxBytes: 1 << 20, MaxEntries: 10}))
+
+	var vaults []storage.Vault
+	for _, v := range []storage.Vault{
+		{Key: "login/mail", Value: []byte(`{"login":"alice"}`), UserID: alice.ID},
+		{Key: "binary/photo", Value: large, UserID: alice.ID},
+		{Key: "text/empty", Value: []byte{}, UserID: bob.ID},
+		{Key: "deleted", Value: []byte("gone"), UserID: bob.ID},
+	} {
+		created, err := source.Vaults.CreateVault(ctx, v)
+		require.NoError(t, err)
+		vaults = append(vaults, created)
+	}
+	deleted := vaults[3]
+	require.NoError(t, source.Vaults.DeleteVault(ctx, deleted.ID))
+	vaults = vaults[:3]
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	_, err = source.Tokens.CreateToken(ctx, storage.AccessToken{
+		UserID: alice.ID, Name: "ci", Hash: "hash", Permission: storage.TokenPermissionRead,
+		VaultIDs: []uint64{vaults[0].ID}, ExpiresAt: &expiresAt, CreatedAt: time.Now(),
+	})
+	require.NoError(t, err)
+	now := time.Now()
+	_, err = source.Sessions.CreateSession(ctx, storage.Session{UserID: bob.ID, DeviceName: "laptop", CreatedAt: now, LastSeenAt: now})
+	require.NoError(t, err)
+	for _, action := range []string{storage.AuditSignIn, storage.AuditVaultCreate, storage.AuditVaultRead} {
+		_, err = source.Audit.AppendAuditEvent(ctx, storage.AuditEvent{CreatedAt: time.Now(), Action: action, UserID: alice.ID, Login: "alice"})
+		require.NoError(t, err)
+	}
+
+	var buf bytes.Buffer
+	summary, err := source.Backups.Backup(ctx, &buf, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), summary.Values)
+	assert.Equal(t, int64(len(large)+len(`{"login":"alice"}`)), summary.Bytes)
+	assert.Equal(t, int64(2), summary.Rows["users"])
+	assert.Equal(t, int64(3), summary.Rows["audit_log"])
+	assert.NotContains(t, buf.String(), "alice")
+
+	_, err = target.Backups.Restore(ctx, bytes.NewReader(buf.Bytes()), "wrong")
+	require.ErrorIs(t, err, backup.ErrPassphrase)
+	damaged := bytes.Clone(buf.Bytes())
+	damaged[len(damaged)/2] ^= 1
+	_, err = target.Backups.Restore(ctx, bytes.NewReader(damaged), "correct horse")
+	require.ErrorIs(t, err, backup.ErrDamaged)
+	users, err := target.Users.ListUsers(ctx, "", 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, users, "nothing is restored from a damaged backup")
+
+	restored, err := target.Backups.Restore(ctx, bytes.NewReader(buf.Bytes()), "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, summary, restored)
+
+	want, err := source.Users.ListUsers(ctx, "", 0, 10)
+	require.NoError(t, err)
+	users, err = target.Users.ListUsers(ctx, "", 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, want, users)
+	for _, u := range []storage.User{alice, bob} {
+		got, err := target.Users.GetUser(ctx, u.ID)
+		require.NoError(t, err)
+		want, err := source.Users.GetUser(ctx, u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		wantVaults, err := source.Vaults.ListVaults(ctx, u.ID)
+		require.NoError(t, err)
+		gotVaults, err := target.Vaults.ListVaults(ctx, u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wantVaults, gotVaults)
+		wantTokens, err := source.Tokens.ListTokens(ctx, u.ID)
+		require.NoError(t, err)
+		gotTokens, err := target.Tokens.ListTokens(ctx, u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wantTokens, gotTokens)
+		wantSessions, err := source.Sessions.ListSessions(ctx, u.ID)
+		require.NoError(t, err)
+		gotSessions, err := target.Sessions.ListSessions(ctx, u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wantSessions, gotSessions)
+		wantQuota, err := source.Quotas.GetQuota(ctx, u.ID)
+		require.NoError(t, err)
+		gotQuota, err := target.Quotas.GetQuota(ctx, u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wantQuota, gotQuota)
+		wantUsage, err := source.Quotas.GetUsage(ctx, u.ID)
+		require.NoError(t, err)
+		gotUsage, err := target.Quotas.GetUsage(ctx, u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wantUsage, gotUsage)
+	}
+	for _, v := range vaults {
+		got, err := target.Vaults.GetVault(ctx, v.ID)
+		require.NoError(t, err)
+		assert.Equal(t, v.Key, got.Key)
+		assert.Equal(t, v.UserID, got.UserID)
+		assert.True(t, bytes.Equal(v.Value, got.Value), "value of vault %d differs", v.ID)
+	}
+	wantEvents, err := source.Audit.ExportAuditEvents(ctx, 0, 10)
+	require.NoError(t, err)
+	gotEvents, err := target.Audit.ExportAuditEvents(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, wantEvents, gotEvents)
+	_, _, err = storage.VerifyAuditLog(ctx, target.Audit, 10)
+	require.NoError(t, err)
+
+	// New rows don't reuse the IDs of restored ones, nor the ID of the deleted vault a token could still refer to.
+	carol, err := target.Users.CreateUser(ctx, storage.User{Login: "carol", Password: "hash"})
+	require.NoError(t, err)
+	assert.Greater(t, carol.ID, bob.ID)
+	v, err := target.Vaults.CreateVault(ctx, storage.Vault{Key: "new", Value: []byte("v"), UserID: carol.ID})
+	require.NoError(t, err)
+	assert.Greater(t, v.ID, deleted.ID)
+
+	_, err = target.Backups.Restore(ctx, bytes.NewReader(buf.Bytes()), "correct horse")
+	assert.Error(t, err, "backups are only restored into an empty storage")
+}
@@ -0,0 +1,73 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunBlobStore runs the behaviour tests of storage.BlobStore against the store.
+func RunBlobStore(t *testing.T, blobs storage.BlobStore) {
+	t.Run("create and open", func(t *testing.T) { testCreateBlob(t, blobs) })
+	t.Run("unknown size", func(t *testing.T) { testCreateBlobUnknownSize(t, blobs) })
+	t.Run("delete", func(t *testing.T) { testDeleteBlob(t, blobs) })
+}
+
+func readBlob(t *testing.T, blobs storage.BlobStore, key string) []byte {
+	t.Helper()
+	r, err := blobs.OpenBlob(context.Background(), key)
+	require.NoError(t, err)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return b
+}
+
+func testCreateBlob(t *testing.T, blobs storage.BlobStore) {
+	ctx := context.Background()
+	large := bytes.Repeat([]byte{0, 1, 2, 0xff}, 256*1024)
+
+	k1, err := blobs.CreateBlob(ctx, bytes.NewReader([]byte{0, 'v', 0}), 3)
+	require.NoError(t, err)
+	k2, err := blobs.CreateBlob(ctx, bytes.NewReader(large), int64(len(large)))
+	require.NoError(t, err)
+	empty, err := blobs.CreateBlob(ctx, bytes.NewReader(nil), 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, k1, k2)
+	assert.NotEqual(t, k1, empty)
+
+	assert.Equal(t, []byte{0, 'v', 0}, readBlob(t, blobs, k1))
+	assert.True(t, bytes.Equal(large, readBlob(t, blobs, k2)), "large blob differs")
+	assert.Empty(t, readBlob(t, blobs, empty))
+}
+
+func testCreateBlobUnknownSize(t *testing.T, blobs storage.BlobStore) {
+	value := bytes.Repeat([]byte("value"), 1000)
+	// Hide the length of the content, a bytes.Reader would reveal it.
+	r := io.MultiReader(bytes.NewReader(value))
+
+	key, err := blobs.CreateBlob(context.Background(), r, -1)
+	require.NoError(t, err)
+	assert.Equal(t, value, readBlob(t, blobs, key))
+}
+
+func testDeleteBlob(t *testing.T, blobs storage.BlobStore) {
+	ctx := context.Background()
+	key, err := blobs.CreateBlob(ctx, bytes.NewReader([]byte("v1")), 2)
+	require.NoError(t, err)
+	other, err := blobs.CreateBlob(ctx, bytes.NewReader([]byte("v2")), 2)
+	require.NoError(t, err)
+
+	require.NoError(t, blobs.DeleteBlob(ctx, key))
+	_, err = blobs.OpenBlob(ctx, key)
+	assert.Error(t, err)
+	assert.Equal(t, []byte("v2"), readBlob(t, blobs, other))
+
+	// Deleting again is not an error.
+	assert.NoError(t, blobs.DeleteBlob(ctx, key))
+}
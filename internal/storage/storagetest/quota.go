@@ -0,0 +1,141 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testUsage(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	other := createUser(t, b, "other")
+
+	usage, err := b.Quotas.GetUsage(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Usage{}, usage)
+
+	v1, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k1", Value: []byte("12345"), UserID: u.ID})
+	require.NoError(t, err)
+	_, err = b.Vaults.CreateVault(ctx, storage.Vault{Key: "k2", Value: []byte("123"), UserID: u.ID})
+	require.NoError(t, err)
+	_, err = b.Vaults.CreateVault(ctx, storage.Vault{Key: "k3", Value: []byte("1234567"), UserID: other.ID})
+	require.NoError(t, err)
+
+	usage, err = b.Quotas.GetUsage(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Usage{Bytes: 8, Entries: 2}, usage)
+
+	require.NoError(t, b.Vaults.UpdateVault(ctx, storage.Vault{ID: v1.ID, Key: "k1", Value: []byte("1"), UserID: u.ID}))
+	usage, err = b.Quotas.GetUsage(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Usage{Bytes: 4, Entries: 2}, usage)
+
+	require.NoError(t, b.Vaults.DeleteVault(ctx, v1.ID))
+	usage, err = b.Quotas.GetUsage(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Usage{Bytes: 3, Entries: 1}, usage)
+}
+
+func testQuotaEnforced(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	require.NoError(t, b.Quotas.SetQuota(ctx, u.ID, storage.Quota{MaxBytes: 10, MaxEntries: 2}))
+
+	_, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "huge", Value: make([]byte, 11), UserID: u.ID})
+	assert.ErrorIs(t, err, storage.ErrEntryTooLarge)
+
+	v1, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k1", Value: make([]byte, 6), UserID: u.ID})
+	require.NoError(t, err)
+	_, err = b.Vaults.CreateVault(ctx, storage.Vault{Key: "k2", Value: make([]byte, 5), UserID: u.ID})
+	assert.ErrorIs(t, err, storage.ErrQuotaExceeded)
+	v2, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k2", Value: make([]byte, 4), UserID: u.ID})
+	require.NoError(t, err)
+
+	// The entries are used up, even though bytes are left after shrinking an entry.
+	require.NoError(t, b.Vaults.UpdateVault(ctx, storage.Vault{ID: v1.ID, Key: "k1", Value: make([]byte, 1), UserID: u.ID}))
+	_, err = b.Vaults.CreateVault(ctx, storage.Vault{Key: "k3", Value: nil, UserID: u.ID})
+	assert.ErrorIs(t, err, storage.ErrQuotaExceeded)
+
+	err = b.Vaults.UpdateVault(ctx, storage.Vault{ID: v2.ID, Key: "k2", Value: make([]byte, 10), UserID: u.ID})
+	assert.ErrorIs(t, err, storage.ErrQuotaExceeded)
+	require.NoError(t, b.Vaults.UpdateVault(ctx, storage.Vault{ID: v2.ID, Key: "k2", Value: make([]byte, 9), UserID: u.ID}))
+
+	// A rejected write leaves the entry unchanged.
+	got, err := b.Vaults.GetVault(ctx, v2.ID)
+	require.NoError(t, err)
+	assert.Len(t, got.Value, 9)
+	usage, err := b.Quotas.GetUsage(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Usage{Bytes: 10, Entries: 2}, usage)
+
+	// Users over a lowered quota can still shrink and delete their entries.
+	require.NoError(t, b.Quotas.SetQuota(ctx, u.ID, storage.Quota{MaxBytes: 5, MaxEntries: 1}))
+	require.NoError(t, b.Vaults.UpdateVault(ctx, storage.Vault{ID: v2.ID, Key: "k2", Value: make([]byte, 8), UserID: u.ID}))
+	require.NoError(t, b.Vaults.DeleteVault(ctx, v1.ID))
+}
+
+func testQuotaOverride(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+
+	q, err := b.Quotas.GetQuota(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Quota{}, q)
+
+	require.NoError(t, b.Quotas.SetQuota(ctx, u.ID, storage.Quota{MaxBytes: 1, MaxEntries: 1}))
+	require.NoError(t, b.Quotas.SetQuota(ctx, u.ID, storage.Quota{MaxBytes: 100, MaxEntries: 3}))
+	q, err = b.Quotas.GetQuota(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Quota{MaxBytes: 100, MaxEntries: 3}, q)
+
+	require.NoError(t, b.Quotas.DeleteQuota(ctx, u.ID))
+	require.NoError(t, b.Quotas.DeleteQuota(ctx, u.ID))
+	q, err = b.Quotas.GetQuota(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Quota{}, q)
+
+	// The quota is deleted with the user.
+	require.NoError(t, b.Quotas.SetQuota(ctx, u.ID, storage.Quota{MaxBytes: 100, MaxEntries: 3}))
+	require.NoError(t, b.Users.DeleteUser(ctx, u.ID))
+}
+
+func testConcurrentQuota(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	const workers, maxEntries = 8, 3
+	require.NoError(t, b.Quotas.SetQuota(ctx, u.ID, storage.Quota{MaxEntries: maxEntries}))
+
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: fmt.Sprintf("k%d", w), Value: []byte("v"), UserID: u.ID})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.True(t, errors.Is(err, storage.ErrQuotaExceeded), "unexpected error: %v", err)
+	}
+	assert.Equal(t, maxEntries, created)
+
+	usage, err := b.Quotas.GetUsage(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(maxEntries), usage.Entries)
+}
@@ -0,0 +1,484 @@
+// Package storagetest provides behaviour tests every implementation of the storage interfaces must pass.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Backend is a storage implementation under test.
+// The tests create their own users with logins derived from the test name, so the storage may be shared
+// with other tests but must not be used concurrently by another Run.
+type Backend struct {
+	Users  storage.UserStorage
+	Vaults storage.VaultStorage
+	Quotas storage.QuotaStorage // Optional, enforced by Vaults and without a default quota.
+	Audit  storage.AuditStorage // Optional.
+}
+
+// Run runs the behaviour tests of storage.UserStorage, storage.VaultStorage and, if set,
+// storage.QuotaStorage and storage.AuditStorage against the backend.
+func Run(t *testing.T, b Backend) {
+	t.Run("users", func(t *testing.T) {
+		t.Run("create and get", func(t *testing.T) { testCreateUser(t, b) })
+		t.Run("not found", func(t *testing.T) { testUserNotFound(t, b) })
+		t.Run("update", func(t *testing.T) { testUpdateUser(t, b) })
+		t.Run("list", func(t *testing.T) { testListUsers(t, b) })
+		t.Run("delete", func(t *testing.T) { testDeleteUser(t, b) })
+		t.Run("unique login", func(t *testing.T) { testUniqueLogin(t, b) })
+		t.Run("concurrent sign-ups", func(t *testing.T) { testConcurrentCreateUser(t, b) })
+	})
+	t.Run("vaults", func(t *testing.T) {
+		t.Run("create and get", func(t *testing.T) { testCreateVault(t, b) })
+		t.Run("not found", func(t *testing.T) { testVaultNotFound(t, b) })
+		t.Run("update", func(t *testing.T) { testUpdateVault(t, b) })
+		t.Run("delete", func(t *testing.T) { testDeleteVault(t, b) })
+		t.Run("list", func(t *testing.T) { testListVaults(t, b) })
+		t.Run("stored values are copies", func(t *testing.T) { testVaultValueCopy(t, b) })
+		t.Run("concurrent use", func(t *testing.T) { testConcurrentVaults(t, b) })
+		t.Run("concurrent update and read", func(t *testing.T) { testConcurrentUpdateRead(t, b) })
+	})
+	if b.Quotas != nil {
+		t.Run("quotas", func(t *testing.T) {
+			t.Run("usage", func(t *testing.T) { testUsage(t, b) })
+			t.Run("enforced", func(t *testing.T) { testQuotaEnforced(t, b) })
+			t.Run("override", func(t *testing.T) { testQuotaOverride(t, b) })
+			t.Run("concurrent writes", func(t *testing.T) { testConcurrentQuota(t, b) })
+		})
+	}
+	if b.Audit != nil {
+		t.Run("audit", func(t *testing.T) {
+			t.Run("append and list", func(t *testing.T) { testAuditAppend(t, b) })
+			t.Run("export", func(t *testing.T) { testAuditExport(t, b) })
+			t.Run("concurrent appends", func(t *testing.T) { testConcurrentAudit(t, b) })
+		})
+	}
+}
+
+func createUser(t *testing.T, b Backend, suffix string) storage.User {
+	t.Helper()
+	u, err := b.Users.CreateUser(context.Background(), storage.User{Login: t.Name() + suffix, Password: "hash"})
+	require.NoError(t, err)
+	require.NotZero(t, u.ID)
+	return u
+}
+
+func testCreateUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u1, err := b.Users.CreateUser(ctx, storage.User{
+		Login:       t.Name() + "1",
+		Password:    "hash",
+		SRPSalt:     []byte("salt"),
+		SRPVerifier: []byte("verifier"),
+	})
+	require.NoError(t, err)
+	u2 := createUser(t, b, "2")
+	assert.NotEqual(t, u1.ID, u2.ID)
+
+	got, err := b.Users.GetUser(ctx, u1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, u1.ID, got.ID)
+	assert.Equal(t, t.Name()+"1", got.Login)
+	assert.Equal(t, "hash", got.Password)
+	assert.Equal(t, []byte("salt"), got.SRPSalt)
+	assert.Equal(t, []byte("verifier"), got.SRPVerifier)
+	assert.False(t, got.TOTPEnabled)
+	assert.Empty(t, got.RecoveryCodes)
+	assert.Zero(t, got.TokenVersion)
+	assert.Equal(t, storage.RoleUser, got.Role)
+	assert.False(t, got.Disabled)
+
+	got, err = b.Users.GetUserByLogin(ctx, t.Name()+"2")
+	require.NoError(t, err)
+	assert.Equal(t, u2.ID, got.ID)
+	assert.Equal(t, u2.Login, got.Login)
+	assert.Empty(t, got.SRPVerifier)
+}
+
+func testUserNotFound(t *testing.T, b Backend) {
+	ctx := context.Background()
+	_, err := b.Users.GetUser(ctx, 1<<62)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = b.Users.GetUserByLogin(ctx, t.Name())
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+func testUpdateUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	other := createUser(t, b, "other")
+
+	u.Login = t.Name() + "renamed"
+	u.Password = ""
+	u.TOTPSecret = "SECRET"
+	u.TOTPEnabled = true
+	u.TOTPLastStep = 42
+	u.RecoveryCodes = []string{"a", "b"}
+	u.TokenVersion = 3
+	u.SRPSalt = []byte("salt")
+	u.SRPVerifier = []byte("verifier")
+	u.Role = storage.RoleAdmin
+	u.Disabled = true
+	require.NoError(t, b.Users.UpdateUser(ctx, u))
+
+	got, err := b.Users.GetUser(ctx, u.ID)
+	require.NoError(t, err)
+	u.Revision++
+	assert.Equal(t, u, got)
+	_, err = b.Users.GetUserByLogin(ctx, t.Name())
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	// Other users are not changed.
+	got, err = b.Users.GetUser(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, other.Login, got.Login)
+	assert.False(t, got.TOTPEnabled)
+
+	// Clearing the recovery codes and the verifier is stored, too.
+	u.RecoveryCodes = nil
+	u.SRPVerifier = nil
+	require.NoError(t, b.Users.UpdateUser(ctx, u))
+	got, err = b.Users.GetUser(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.RecoveryCodes)
+	assert.Empty(t, got.SRPVerifier)
+
+	// An update based on a stale read is refused instead of reverting the newer change.
+	stale := got
+	got.Disabled = false
+	require.NoError(t, b.Users.UpdateUser(ctx, got))
+	stale.Password = "rehashed"
+	assert.ErrorIs(t, b.Users.UpdateUser(ctx, stale), storage.ErrUserConflict)
+	got, err = b.Users.GetUser(ctx, u.ID)
+	require.NoError(t, err)
+	assert.False(t, got.Disabled)
+	assert.Empty(t, got.Password)
+
+	require.NoError(t, b.Users.DeleteUser(ctx, u.ID))
+	assert.ErrorIs(t, b.Users.UpdateUser(ctx, got), storage.ErrUserConflict)
+}
+
+func testListUsers(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u1 := createUser(t, b, "alice")
+	u2 := createUser(t, b, "bob")
+	u3 := createUser(t, b, "ALICE2")
+
+	// The query matches any part of the login ignoring case, the users are ordered by ID.
+	got, err := b.Users.ListUsers(ctx, strings.ToLower(t.Name())+"alice", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, u1.Login, got[0].Login)
+	assert.Equal(t, u1.ID, got[0].ID)
+	assert.Equal(t, u3.ID, got[1].ID)
+
+	got, err = b.Users.ListUsers(ctx, t.Name(), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.Equal(t, []uint64{u1.ID, u2.ID, u3.ID}, []uint64{got[0].ID, got[1].ID, got[2].ID})
+
+	// Pages continue after the last user of the previous page.
+	got, err = b.Users.ListUsers(ctx, t.Name(), 0, 2)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	got, err = b.Users.ListUsers(ctx, t.Name(), got[1].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, u3.ID, got[0].ID)
+
+	got, err = b.Users.ListUsers(ctx, t.Name()+"nobody", 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func testDeleteUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	other := createUser(t, b, "other")
+	v, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k", Value: []byte("v"), UserID: u.ID})
+	require.NoError(t, err)
+	otherVault, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k", Value: []byte("v"), UserID: other.ID})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Users.DeleteUser(ctx, u.ID))
+
+	_, err = b.Users.GetUser(ctx, u.ID)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = b.Users.GetUserByLogin(ctx, u.Login)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = b.Vaults.GetVault(ctx, v.ID)
+	assert.ErrorIs(t, err, storage.ErrVaultNotFound)
+
+	_, err = b.Users.GetUser(ctx, other.ID)
+	assert.NoError(t, err)
+	_, err = b.Vaults.GetVault(ctx, otherVault.ID)
+	assert.NoError(t, err)
+}
+
+func testUniqueLogin(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	other := createUser(t, b, "other")
+
+	// Logins are compared ignoring case.
+	_, err := b.Users.CreateUser(ctx, storage.User{Login: strings.ToUpper(u.Login), Password: "hash"})
+	assert.ErrorIs(t, err, storage.ErrLoginTaken)
+	got, err := b.Users.GetUserByLogin(ctx, strings.ToLower(u.Login))
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, got.ID)
+	assert.Equal(t, u.Login, got.Login)
+
+	other.Login = strings.ToLower(u.Login)
+	assert.ErrorIs(t, b.Users.UpdateUser(ctx, other), storage.ErrLoginTaken)
+
+	// Users may change the case of their own login.
+	u, err = b.Users.GetUser(ctx, u.ID)
+	require.NoError(t, err)
+	u.Login = strings.ToLower(u.Login)
+	require.NoError(t, b.Users.UpdateUser(ctx, u))
+	got, err = b.Users.GetUser(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, u.Login, got.Login)
+}
+
+func testConcurrentCreateUser(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	const workers = 8
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.Users.CreateUser(ctx, storage.User{Login: t.Name(), Password: "hash"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.True(t, errors.Is(err, storage.ErrLoginTaken), "unexpected error: %v", err)
+	}
+	assert.Equal(t, 1, created)
+}
+
+func testCreateVault(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+
+	// Values are arbitrary binary data, including large files.
+	large := bytes.Repeat([]byte{0, 1, 2, 0xff}, 256*1024)
+	v1, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k1", Value: []byte{0, 'v', 0}, UserID: u.ID})
+	require.NoError(t, err)
+	v2, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k1", Value: large, UserID: u.ID})
+	require.NoError(t, err)
+	assert.NotZero(t, v1.ID)
+	assert.NotEqual(t, v1.ID, v2.ID)
+	assert.Equal(t, "k1", v1.Key)
+	assert.Equal(t, u.ID, v1.UserID)
+
+	got, err := b.Vaults.GetVault(ctx, v1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Vault{ID: v1.ID, Key: "k1", Value: []byte{0, 'v', 0}, UserID: u.ID}, got)
+
+	got, err = b.Vaults.GetVault(ctx, v2.ID)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(large, got.Value), "large value differs")
+
+	empty, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "empty", UserID: u.ID})
+	require.NoError(t, err)
+	got, err = b.Vaults.GetVault(ctx, empty.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.Value)
+}
+
+func testVaultNotFound(t *testing.T, b Backend) {
+	_, err := b.Vaults.GetVault(context.Background(), 1<<62)
+	assert.ErrorIs(t, err, storage.ErrVaultNotFound)
+}
+
+func testUpdateVault(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	v, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k1", Value: []byte("v1"), UserID: u.ID})
+	require.NoError(t, err)
+	other, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k2", Value: []byte("v2"), UserID: u.ID})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Vaults.UpdateVault(ctx, storage.Vault{ID: v.ID, Key: "k3", Value: []byte("v3"), UserID: u.ID}))
+
+	got, err := b.Vaults.GetVault(ctx, v.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.Vault{ID: v.ID, Key: "k3", Value: []byte("v3"), UserID: u.ID}, got)
+	got, err = b.Vaults.GetVault(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, other, got)
+}
+
+func testDeleteVault(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	v, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k1", Value: []byte("v1"), UserID: u.ID})
+	require.NoError(t, err)
+	other, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k2", Value: []byte("v2"), UserID: u.ID})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Vaults.DeleteVault(ctx, v.ID))
+
+	_, err = b.Vaults.GetVault(ctx, v.ID)
+	assert.ErrorIs(t, err, storage.ErrVaultNotFound)
+	_, err = b.Vaults.GetVault(ctx, other.ID)
+	assert.NoError(t, err)
+}
+
+func testListVaults(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	other := createUser(t, b, "-other")
+
+	empty, err := b.Vaults.ListVaults(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	v1, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k1", Value: []byte("v1"), UserID: u.ID})
+	require.NoError(t, err)
+	_, err = b.Vaults.CreateVault(ctx, storage.Vault{Key: "k2", Value: []byte("v2"), UserID: other.ID})
+	require.NoError(t, err)
+	v3, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k3", Value: []byte("v3"), UserID: u.ID})
+	require.NoError(t, err)
+
+	// Only the vaults of the user are listed, ordered by ID and without their values.
+	got, err := b.Vaults.ListVaults(ctx, u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Vault{
+		{ID: v1.ID, Key: "k1", UserID: u.ID},
+		{ID: v3.ID, Key: "k3", UserID: u.ID},
+	}, got)
+}
+
+func testVaultValueCopy(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	value := []byte("v1")
+	v, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k1", Value: value, UserID: u.ID})
+	require.NoError(t, err)
+
+	// Modifying the slices passed in or returned must not change the stored value.
+	value[0] = 'x'
+	got, err := b.Vaults.GetVault(ctx, v.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v1"), got.Value)
+	got.Value[0] = 'x'
+	got, err = b.Vaults.GetVault(ctx, v.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v1"), got.Value)
+}
+
+func testConcurrentVaults(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+
+	// Every worker creates a vault and updates and reads it in turns, while the other workers do the same.
+	const workers, rounds = 8, 20
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- useVault(ctx, b, u.ID, fmt.Sprintf("k%d", w), rounds)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func testConcurrentUpdateRead(t *testing.T, b Backend) {
+	ctx := context.Background()
+	u := createUser(t, b, "")
+	v, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: "k", Value: []byte("v-0"), UserID: u.ID})
+	require.NoError(t, err)
+
+	// Readers must see the old or the new value while the vault is updated, never fail.
+	const readers, rounds = 4, 50
+	done := make(chan struct{})
+	errs := make(chan error, readers+1)
+	var wg sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					errs <- nil
+					return
+				default:
+				}
+				got, err := b.Vaults.GetVault(ctx, v.ID)
+				if err != nil {
+					errs <- fmt.Errorf("get: %w", err)
+					return
+				}
+				if !strings.HasPrefix(string(got.Value), "v-") {
+					errs <- fmt.Errorf("get: got %q", got.Value)
+					return
+				}
+			}
+		}()
+	}
+	for i := 1; i <= rounds; i++ {
+		err = b.Vaults.UpdateVault(ctx, storage.Vault{ID: v.ID, Key: "k", Value: []byte(fmt.Sprintf("v-%d", i)), UserID: u.ID})
+		if err != nil {
+			errs <- fmt.Errorf("update: %w", err)
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func useVault(ctx context.Context, b Backend, userID uint64, key string, rounds int) error {
+	v, err := b.Vaults.CreateVault(ctx, storage.Vault{Key: key, Value: []byte(key), UserID: userID})
+	if err != nil {
+		return fmt.Errorf("create %s: %w", key, err)
+	}
+	for i := 0; i < rounds; i++ {
+		value := []byte(fmt.Sprintf("%s-%d", key, i))
+		err = b.Vaults.UpdateVault(ctx, storage.Vault{ID: v.ID, Key: key, Value: value, UserID: userID})
+		if err != nil {
+			return fmt.Errorf("update %s: %w", key, err)
+		}
+		got, err := b.Vaults.GetVault(ctx, v.ID)
+		if err != nil {
+			return fmt.Errorf("get %s: %w", key, err)
+		}
+		if got.Key != key || !bytes.Equal(got.Value, value) {
+			return fmt.Errorf("get %s: got %s=%q, want %q", key, got.Key, got.Value, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// ThrottleState holds the number of recent sign-in failures for a throttling key, such as a login or an IP address.
+type ThrottleState struct {
+	Key           string    `json:"key"`             // The throttling key.
+	Failures      int       `json:"failures"`        // Number of failures within the current window.
+	LastFailureAt time.Time `json:"last_failure_at"` // Time of the most recent failure.
+	Pending       int       `json:"pending"`         // Number of reserved attempts which have neither succeeded nor failed yet.
+	ReservedAt    time.Time `json:"reserved_at"`     // Time of the most recent reservation.
+}
+
+// ThrottleStorage defines the interface for the shared sign-in throttling state.
+// Implementations must update the state atomically, so that several server replicas can share it.
+type ThrottleStorage interface {
+	// ReserveThrottle counts a sign-in attempt in progress for a key in a single atomic step, so that parallel
+	// attempts see each other before any of them has failed. Pending attempts reserved longer than timeout ago
+	// are considered abandoned and no longer counted.
+	// Takes a context.Context, the key (string), the time of the attempt and the timeout as parameters.
+	// Returns the updated ThrottleState, which includes the new attempt, and an error if any.
+	ReserveThrottle(ctx context.Context, key string, now time.Time, timeout time.Duration) (ThrottleState, error)
+
+	// ReleaseThrottle ends an attempt reserved with ReserveThrottle. The failure of a failed attempt must be
+	// recorded with AddThrottleFailure before the attempt is released.
+	// Takes a context.Context and the key (string) as parameters.
+	// Returns an error if any.
+	ReleaseThrottle(ctx context.Context, key string) error
+
+	// AddThrottleFailure records a failure for a key. If the previous failure is older than window,
+	// the counter starts over.
+	// Takes a context.Context, the key (string), the time of the failure and the window as parameters.
+	// Returns the updated ThrottleState and an error if any.
+	AddThrottleFailure(ctx context.Context, key string, now time.Time, window time.Duration) (ThrottleState, error)
+
+	// ResetThrottle forgets the failures of a key, for example after a successful sign-in.
+	// Takes a context.Context and the key (string) as parameters.
+	// Returns an error if any.
+	ResetThrottle(ctx context.Context, key string) error
+}
+
+// FailedSignIn represents a rejected sign-in attempt, kept so that users can review them.
+type FailedSignIn struct {
+	ID        uint64    `json:"id"`         // Unique identifier for the attempt.
+	UserID    uint64    `json:"user_id"`    // The ID of the user, 0 if the login is unknown.
+	Login     string    `json:"login"`      // The login used in the attempt.
+	IP        string    `json:"ip"`         // The client IP address.
+	UserAgent string    `json:"user_agent"` // The client User-Agent header.
+	Reason    string    `json:"reason"`     // Why the attempt was rejected.
+	CreatedAt time.Time `json:"created_at"` // Time of the attempt.
+}
+
+// FailedSignInStorage defines the interface for the log of failed sign-in attempts.
+type FailedSignInStorage interface {
+	// CreateFailedSignIn appends a failed attempt to the log.
+	// Takes a context.Context and a FailedSignIn object as parameters.
+	// Returns an error if any.
+	CreateFailedSignIn(ctx context.Context, a FailedSignIn) error
+
+	// ListFailedSignIns retrieves the most recent failed attempts against a user, newest first.
+	// Takes a context.Context, the user's ID (uint64) and the maximum number of attempts as parameters.
+	// Returns the list of FailedSignIn and an error if any.
+	ListFailedSignIns(ctx context.Context, userID uint64, limit int) ([]FailedSignIn, error)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrTokenNotFound is returned if no access token has the ID or hash.
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenPermission describes what a personal access token is allowed to do with vault entries.
+type TokenPermission string
+
+const (
+	// TokenPermissionRead allows a token to read vault entries only.
+	TokenPermissionRead TokenPermission = "read"
+	// TokenPermissionWrite allows a token to read, create and update vault entries.
+	TokenPermissionWrite TokenPermission = "write"
+)
+
+// AccessToken represents a named personal access token issued by a user, for example for a CI job.
+// Only the hash of the token is stored, the plain token is shown to the user once on creation.
+// Vault entries have no tags, so a token is scoped by key prefix, e.g. "ci/", rather than by tag.
+type AccessToken struct {
+	ID         uint64          `json:"id"`                     // Unique identifier for the token.
+	UserID     uint64          `json:"user_id"`                // The ID of the user who owns the token.
+	Name       string          `json:"name"`                   // Human readable name of the token.
+	Hash       string          `json:"-"`                      // SHA-256 hash of the plain token.
+	Permission TokenPermission `json:"permission"`             // Permission granted to the token.
+	KeyPrefix  string          `json:"key_prefix"`             // If set, the token is limited to entries whose key has this prefix.
+	VaultIDs   []uint64        `json:"vault_ids"`              // If set, the token is bound to these vault entries only.
+	ExpiresAt  *time.Time      `json:"expires_at,omitempty"`   // Time after which the token is no longer accepted.
+	LastUsedAt *time.Time      `json:"last_used_at,omitempty"` // Time the token was last used for authentication.
+	RevokedAt  *time.Time      `json:"revoked_at,omitempty"`   // Time the token was revoked by its owner.
+	CreatedAt  time.Time       `json:"created_at"`             // Time the token was created.
+}
+
+// IsActive reports whether the token is neither revoked nor expired at the given time.
+func (t AccessToken) IsActive(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
+
+// CanRead reports whether the token scope allows reading the given vault entry.
+func (t AccessToken) CanRead(v Vault) bool {
+	return t.matches(v)
+}
+
+// CanWrite reports whether the token scope allows storing the given vault entry.
+// A vault entry without an ID is a new one, which tokens bound to specific entries are not allowed to create.
+func (t AccessToken) CanWrite(v Vault) bool {
+	if t.Permission != TokenPermissionWrite {
+		return false
+	}
+	return t.matches(v)
+}
+
+// matches checks the key prefix and entry restrictions of the token against the vault entry.
+func (t AccessToken) matches(v Vault) bool {
+	if t.KeyPrefix != "" && !strings.HasPrefix(v.Key, t.KeyPrefix) {
+		return false
+	}
+	if len(t.VaultIDs) > 0 && !slices.Contains(t.VaultIDs, v.ID) {
+		return false
+	}
+	return true
+}
+
+// TokenStorage defines the interface for operations on personal access tokens in the storage system.
+type TokenStorage interface {
+	// GetToken retrieves a token by its unique ID.
+	// Takes a context.Context and the token's ID (uint64) as parameters.
+	// Returns the AccessToken and an error if any.
+	GetToken(ctx context.Context, id uint64) (AccessToken, error)
+
+	// GetTokenByHash retrieves a token by the hash of its plain value.
+	// Takes a context.Context and the token hash (string) as parameters.
+	// Returns the AccessToken and an error if any.
+	GetTokenByHash(ctx context.Context, hash string) (AccessToken, error)
+
+	// ListTokens retrieves all tokens issued by a user, including revoked and expired ones.
+	// Takes a context.Context and the user's ID (uint64) as parameters.
+	// Returns the list of AccessToken and an error if any.
+	ListTokens(ctx context.Context, userID uint64) ([]AccessToken, error)
+
+	// CreateToken inserts a new token into the storage system.
+	// Takes a context.Context and an AccessToken object as parameters.
+	// Returns the created AccessToken and an error if any.
+	CreateToken(ctx context.Context, t AccessToken) (AccessToken, error)
+
+	// TouchToken updates the last-used timestamp of a token.
+	// Takes a context.Context, the token's ID (uint64) and the time of use as parameters.
+	// Returns an error if any.
+	TouchToken(ctx context.Context, id uint64, usedAt time.Time) error
+
+	// RevokeToken marks a token as revoked.
+	// Takes a context.Context, the token's ID (uint64) and the time of revocation as parameters.
+	// Returns an error if any.
+	RevokeToken(ctx context.Context, id uint64, revokedAt time.Time) error
+}
@@ -0,0 +1,81 @@
+package storage_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessTokenScope(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		token     storage.AccessToken
+		vault     storage.Vault
+		wantRead  bool
+		wantWrite bool
+	}{
+		{
+			name:      "read token",
+			token:     storage.AccessToken{Permission: storage.TokenPermissionRead},
+			vault:     storage.Vault{ID: 1, Key: "login/a"},
+			wantRead:  true,
+			wantWrite: false,
+		},
+		{
+			name:      "write token",
+			token:     storage.AccessToken{Permission: storage.TokenPermissionWrite},
+			vault:     storage.Vault{ID: 1, Key: "login/a"},
+			wantRead:  true,
+			wantWrite: true,
+		},
+		{
+			name:      "key prefix matches",
+			token:     storage.AccessToken{Permission: storage.TokenPermissionWrite, KeyPrefix: "login/"},
+			vault:     storage.Vault{Key: "login/a"},
+			wantRead:  true,
+			wantWrite: true,
+		},
+		{
+			name:      "key prefix does not match",
+			token:     storage.AccessToken{Permission: storage.TokenPermissionWrite, KeyPrefix: "login/"},
+			vault:     storage.Vault{ID: 1, Key: "card/a"},
+			wantRead:  false,
+			wantWrite: false,
+		},
+		{
+			name:      "bound to entry",
+			token:     storage.AccessToken{Permission: storage.TokenPermissionWrite, VaultIDs: []uint64{1, 2}},
+			vault:     storage.Vault{ID: 2, Key: "text/a"},
+			wantRead:  true,
+			wantWrite: true,
+		},
+		{
+			name:      "bound token cannot create entries",
+			token:     storage.AccessToken{Permission: storage.TokenPermissionWrite, VaultIDs: []uint64{1}},
+			vault:     storage.Vault{Key: "text/a"},
+			wantRead:  false,
+			wantWrite: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.wantRead, test.token.CanRead(test.vault))
+			assert.Equal(t, test.wantWrite, test.token.CanWrite(test.vault))
+		})
+	}
+}
+
+func TestAccessTokenIsActive(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	assert.True(t, storage.AccessToken{}.IsActive(now))
+	assert.True(t, storage.AccessToken{ExpiresAt: &future}.IsActive(now))
+	assert.False(t, storage.AccessToken{ExpiresAt: &past}.IsActive(now))
+	assert.False(t, storage.AccessToken{ExpiresAt: &future, RevokedAt: &past}.IsActive(now))
+}
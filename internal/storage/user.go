@@ -2,13 +2,47 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrUserNotFound is returned if no user has the ID or login.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrLoginTaken is returned if a user is created or renamed with the login of another user.
+var ErrLoginTaken = errors.New("login is already taken")
+
+// ErrUserConflict is returned if a user is updated who was changed or deleted since they were read.
+var ErrUserConflict = errors.New("user was changed concurrently")
+
+// Roles of users.
+const (
+	RoleUser  = "user"  // RoleUser is the role of regular users, who can only access their own data.
+	RoleAdmin = "admin" // RoleAdmin is the role of operators, who can also manage all users with the admin API.
 )
 
 // User represents a user entity with basic information such as ID, login, and password.
 type User struct {
-	ID       uint64 `json:"id"`       // Unique identifier for the user.
-	Login    string `json:"login"`    // User's login name.
-	Password string `json:"password"` // User's password, typically hashed.
+	ID            uint64   `json:"id"`           // Unique identifier for the user.
+	Login         string   `json:"login"`        // User's login name.
+	Password      string   `json:"password"`     // User's password, typically hashed.
+	TOTPSecret    string   `json:"-"`            // Base32 TOTP secret, pending enrollment until TOTPEnabled is set.
+	TOTPEnabled   bool     `json:"totp_enabled"` // Whether sign-in requires a TOTP code.
+	TOTPLastStep  int64    `json:"-"`            // Period number of the last accepted TOTP code, to prevent replays.
+	RecoveryCodes []string `json:"-"`            // Hashes of unused single-use recovery codes.
+	TokenVersion  uint64   `json:"-"`            // Incremented to revoke all sign-in tokens issued so far.
+	SRPSalt       []byte   `json:"-"`            // Salt of the zero-knowledge sign-in verifier.
+	SRPVerifier   []byte   `json:"-"`            // SRP verifier, set when zero-knowledge sign-in is enabled.
+	Role          string   `json:"role"`         // RoleUser or RoleAdmin, CreateUser stores RoleUser if empty.
+	Disabled      bool     `json:"disabled"`     // Whether an administrator disabled the account, disabled users can't sign in.
+	Revision      uint64   `json:"-"`            // Incremented by every UpdateUser, to detect concurrent changes.
+}
+
+// IsAdmin reports whether the user may use the admin API.
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
 // UserStorage defines the interface for operations on user entities in the storage system.
@@ -18,23 +52,40 @@ type UserStorage interface {
 	// Returns the User and an error if any.
 	GetUser(ctx context.Context, id uint64) (User, error)
 
-	// GetUserByLogin retrieves a user by their login name.
+	// GetUserByLogin retrieves a user by their login name, ignoring case.
 	// Takes a context.Context and the user's login (string) as parameters.
 	// Returns the User and an error if any.
 	GetUserByLogin(ctx context.Context, login string) (User, error)
 
+	// ListUsers retrieves the users whose login contains the query ignoring case, ordered by ID.
+	// Takes a context.Context, the query (string, empty for all users), the ID of the user to list the following
+	// users of (0 to start with the first) and the maximum number of users as parameters.
+	// Returns the list of User and an error if any.
+	ListUsers(ctx context.Context, query string, afterID uint64, limit int) ([]User, error)
+
 	// CreateUser inserts a new user into the storage system.
+	// Logins are unique ignoring case, a taken login is reported as ErrLoginTaken.
 	// Takes a context.Context and a User object as parameters.
 	// Returns the created User and an error if any.
 	CreateUser(ctx context.Context, user User) (User, error)
 
-	// UpdateUser updates an existing user's information.
+	// UpdateUser updates an existing user's information and increments the stored Revision.
+	// The update is only applied if the Revision of the user is the stored one, otherwise ErrUserConflict is
+	// returned, so that concurrent read-modify-write cycles can't overwrite each other's changes.
+	// Renaming a user to a login taken by another user is reported as ErrLoginTaken.
 	// Takes a context.Context and a User object with updated information as parameters.
 	// Returns an error if any.
 	UpdateUser(ctx context.Context, user User) error
 
-	// DeleteUser removes a user from the storage system by their ID.
+	// DeleteUser removes a user from the storage system by their ID,
+	// together with their vault entries and personal access tokens, atomically.
 	// Takes a context.Context and the user's ID (uint64) as parameters.
 	// Returns an error if any.
 	DeleteUser(ctx context.Context, id uint64) error
 }
+
+// NormalizeLogin returns the canonical form of a login as entered by a user: without surrounding whitespace,
+// lowercase and in Unicode normalization form C, so that logins looking the same are the same.
+func NormalizeLogin(login string) string {
+	return norm.NFC.String(strings.ToLower(strings.TrimSpace(login)))
+}
@@ -0,0 +1,29 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLogin(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		login string
+		want  string
+	}{
+		{name: "unchanged", login: "alice", want: "alice"},
+		{name: "whitespace", login: " \talice\n", want: "alice"},
+		{name: "case", login: "Alice@Example.COM", want: "alice@example.com"},
+		{name: "non-ascii case", login: "ÄNNE", want: "änne"},
+		{name: "decomposed", login: "A\u0308nne", want: "\u00e4nne"},
+		{name: "empty", login: "  ", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, storage.NormalizeLogin(tt.login))
+		})
+	}
+}
@@ -2,8 +2,17 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"io"
 )
 
+// ErrVaultNotFound is returned if no vault entry has the ID.
+var ErrVaultNotFound = errors.New("vault not found")
+
+// ErrVaultChanged is returned by the reader of VaultValueStorage.OpenVaultValue if the value is replaced or
+// deleted while it is read.
+var ErrVaultChanged = errors.New("vault changed while reading")
+
 // Vault represents a vault entity with an ID, key, value, and associated user ID.
 type Vault struct {
 	ID     uint64 `json:"id"`      // Unique identifier for the vault.
@@ -33,4 +42,30 @@ type VaultStorage interface {
 	// Takes a context.Context and the vault's ID (uint64) as parameters.
 	// Returns an error if any.
 	DeleteVault(ctx context.Context, id uint64) error
+
+	// ListVaults retrieves the vaults of a user without their values, ordered by ID.
+	// Takes a context.Context and the user's ID (uint64) as parameters.
+	// Returns the vaults with an empty Value and an error if any.
+	ListVaults(ctx context.Context, userID uint64) ([]Vault, error)
+}
+
+// VaultValueStorage is implemented by vault storages which copy values piece by piece, so that files are
+// uploaded and downloaded without holding them in memory as a whole.
+type VaultValueStorage interface {
+	// OpenVaultValue opens the value of a vault for reading, the caller must close the returned reader.
+	// Takes a context.Context and the vault's ID (uint64) as parameters.
+	// Returns the reader and an error if any.
+	OpenVaultValue(ctx context.Context, id uint64) (io.ReadCloser, error)
+
+	// CreateVaultFrom inserts a new vault whose value is read from r.
+	// Takes a context.Context, a Vault object whose Value is ignored, the reader and the size of the value (int64)
+	// as parameters.
+	// Returns the created Vault without its value and an error if any.
+	CreateVaultFrom(ctx context.Context, v Vault, r io.Reader, size int64) (Vault, error)
+
+	// UpdateVaultFrom updates the key of an existing vault and replaces its value with the one read from r.
+	// Takes a context.Context, a Vault object whose Value is ignored, the reader and the size of the value (int64)
+	// as parameters.
+	// Returns an error if any.
+	UpdateVaultFrom(ctx context.Context, v Vault, r io.Reader, size int64) error
 }
@@ -0,0 +1,190 @@
+// Package throttle implements brute-force protection for sign-in.
+//
+// Failures are counted per login and per client IP address. After a number of free failures
+// every further attempt has to wait for an exponentially growing delay, and after too many
+// failures the login is locked for a while. The counters are kept in a storage.ThrottleStorage,
+// so that all server replicas see the same state.
+//
+// Every attempt is reserved with Reserve before the credentials are verified and released with Release
+// afterwards. Attempts in progress count like failures which haven't been recorded yet, so that a burst
+// of parallel attempts can't all pass the check before the first of them fails.
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage"
+)
+
+// Policy describes how fast sign-in attempts are slowed down for one kind of key.
+type Policy struct {
+	FreeFailures    int           // Number of failures allowed without any delay.
+	BaseDelay       time.Duration // Delay after the first failure exceeding FreeFailures, doubled for each further one.
+	MaxDelay        time.Duration // Upper bound of the exponential delay.
+	LockoutFailures int           // Number of failures locking the key for LockoutDuration, 0 disables the lockout.
+	LockoutDuration time.Duration // How long a locked key stays locked after its last failure.
+	Window          time.Duration // Failures older than this are forgotten.
+}
+
+// DefaultLoginPolicy protects single accounts against password guessing.
+var DefaultLoginPolicy = Policy{
+	FreeFailures:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutFailures: 10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// DefaultIPPolicy slows down clients trying many logins. It is more lenient than DefaultLoginPolicy
+// and never locks, because many users may share an address behind NAT.
+var DefaultIPPolicy = Policy{
+	FreeFailures: 20,
+	BaseDelay:    time.Second,
+	MaxDelay:     5 * time.Minute,
+	Window:       time.Hour,
+}
+
+// Delay returns how long a key has to wait after its last failure, given the number of failures.
+func (p Policy) Delay(failures int) time.Duration {
+	if p.LockoutFailures > 0 && failures >= p.LockoutFailures {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeFailures {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeFailures + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// BlockedUntil returns the time until which the key with the given state is blocked.
+// The zero time is returned for keys without failures.
+func (p Policy) BlockedUntil(state storage.ThrottleState) time.Time {
+	if state.Failures == 0 {
+		return time.Time{}
+	}
+	return state.LastFailureAt.Add(p.Delay(state.Failures))
+}
+
+// wait returns how long a newly reserved attempt of the key with the given state has to wait.
+// The other attempts in progress are counted as failures, so that no more attempts run at the same time
+// than could fail without a delay.
+func (p Policy) wait(state storage.ThrottleState, now time.Time) time.Duration {
+	if wait := p.BlockedUntil(state).Sub(now); wait > 0 {
+		return wait
+	}
+	if others := state.Pending - 1; others > 0 {
+		return p.Delay(state.Failures + others)
+	}
+	return 0
+}
+
+// PendingTimeout is how long a reserved attempt counts as in progress if it is never released,
+// e.g. because the server crashed while verifying the credentials.
+const PendingTimeout = time.Minute
+
+// Limiter applies a login and an IP Policy to sign-in attempts.
+type Limiter struct {
+	storage storage.ThrottleStorage
+	login   Policy
+	ip      Policy
+}
+
+// NewLimiter creates a new instance of Limiter.
+// It takes the storage for the shared state and the policies for logins and IP addresses.
+func NewLimiter(s storage.ThrottleStorage, login, ip Policy) *Limiter {
+	return &Limiter{storage: s, login: login, ip: ip}
+}
+
+// Reserve counts a sign-in attempt for the login from the IP address as in progress and checks whether it may proceed.
+// The check is decided from the state returned by the same storage call that reserved the attempt, so parallel
+// attempts see each other. Returns 0 if the attempt may proceed, and then it must be released with Release once
+// it has succeeded or its failure has been recorded with Fail. Otherwise returns how long the client has to wait
+// before retrying, and the attempt is already released.
+func (l *Limiter) Reserve(ctx context.Context, login, ip string, now time.Time) (time.Duration, error) {
+	var retryAfter time.Duration
+	keys := l.keys(login, ip)
+	for i, k := range keys {
+		state, err := l.storage.ReserveThrottle(ctx, k.key, now, PendingTimeout)
+		if err != nil {
+			l.release(ctx, keys[:i])
+			return 0, fmt.Errorf("failed to reserve sign-in attempt: %w", err)
+		}
+		if wait := k.policy.wait(state, now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		if err := l.release(ctx, keys); err != nil {
+			return 0, err
+		}
+	}
+	return retryAfter, nil
+}
+
+// Release ends a sign-in attempt for the login from the IP address allowed by Reserve.
+func (l *Limiter) Release(ctx context.Context, login, ip string) error {
+	return l.release(ctx, l.keys(login, ip))
+}
+
+// Fail records a failed sign-in attempt for the login from the IP address.
+func (l *Limiter) Fail(ctx context.Context, login, ip string, now time.Time) error {
+	for _, k := range l.keys(login, ip) {
+		_, err := l.storage.AddThrottleFailure(ctx, k.key, now, k.policy.Window)
+		if err != nil {
+			return fmt.Errorf("failed to record sign-in failure: %w", err)
+		}
+	}
+	return nil
+}
+
+// Reset forgets the failures of the login after a successful sign-in.
+// The failures of the IP address are kept, so that an attacker can't clear them by signing in to an own account.
+func (l *Limiter) Reset(ctx context.Context, login string) error {
+	err := l.storage.ResetThrottle(ctx, loginKey(login))
+	if err != nil {
+		return fmt.Errorf("failed to reset sign-in failures: %w", err)
+	}
+	return nil
+}
+
+// release ends the reserved attempts of the keys.
+func (l *Limiter) release(ctx context.Context, keys []policyKey) error {
+	for _, k := range keys {
+		err := l.storage.ReleaseThrottle(ctx, k.key)
+		if err != nil {
+			return fmt.Errorf("failed to release sign-in attempt: %w", err)
+		}
+	}
+	return nil
+}
+
+type policyKey struct {
+	key    string
+	policy Policy
+}
+
+// keys returns the throttling keys of an attempt. Attempts without a known IP address are throttled by login only.
+func (l *Limiter) keys(login, ip string) []policyKey {
+	keys := []policyKey{{key: loginKey(login), policy: l.login}}
+	if ip != "" {
+		keys = append(keys, policyKey{key: "ip:" + ip, policy: l.ip})
+	}
+	return keys
+}
+
+// loginKey returns the throttling key of a login. Logins are compared case-insensitively,
+// so that changing the case doesn't bypass the limit.
+func loginKey(login string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(login))
+}
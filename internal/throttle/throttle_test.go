@@ -0,0 +1,140 @@
+package throttle_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/storage/memory"
+	"github.com/andreevym/gophkeeper/internal/throttle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	t.Parallel()
+	p := throttle.Policy{
+		FreeFailures:    2,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockoutFailures: 8,
+		LockoutDuration: time.Hour,
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 5, want: 4 * time.Second},
+		{failures: 6, want: 8 * time.Second},
+		{failures: 7, want: 10 * time.Second},
+		{failures: 8, want: time.Hour},
+		{failures: 100, want: time.Hour},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, p.Delay(tt.failures), "failures %d", tt.failures)
+	}
+
+	p.LockoutFailures = 0
+	assert.Equal(t, 10*time.Second, p.Delay(100))
+}
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	login := throttle.Policy{FreeFailures: 1, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutFailures: 4, LockoutDuration: time.Hour, Window: 2 * time.Hour}
+	ip := throttle.Policy{FreeFailures: 5, BaseDelay: time.Second, MaxDelay: time.Minute, Window: 2 * time.Hour}
+	l := throttle.NewLimiter(memory.NewThrottleStorage(), login, ip)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	allow := func(login, ip string) time.Duration {
+		retryAfter, err := l.Reserve(ctx, login, ip, now)
+		require.NoError(t, err)
+		if retryAfter == 0 {
+			require.NoError(t, l.Release(ctx, login, ip))
+		}
+		return retryAfter
+	}
+
+	require.NoError(t, l.Fail(ctx, "user", "10.0.0.1", now))
+	assert.Zero(t, allow("user", "10.0.0.1"))
+
+	require.NoError(t, l.Fail(ctx, "User", "10.0.0.1", now))
+	assert.Equal(t, time.Second, allow("user", "10.0.0.1"), "logins are case-insensitive")
+	assert.Equal(t, time.Second, allow("USER", "10.0.0.2"), "the login is throttled from every address")
+	assert.Zero(t, allow("other", "10.0.0.1"))
+
+	now = now.Add(time.Second)
+	assert.Zero(t, allow("user", "10.0.0.1"))
+
+	require.NoError(t, l.Fail(ctx, "user", "10.0.0.1", now))
+	require.NoError(t, l.Fail(ctx, "user", "10.0.0.1", now))
+	assert.Equal(t, time.Hour, allow("user", "10.0.0.1"), "the account is locked")
+
+	// Many logins from the same address are throttled by the IP policy.
+	for _, other := range []string{"a", "b", "c"} {
+		require.NoError(t, l.Fail(ctx, other, "10.0.0.1", now))
+	}
+	assert.Equal(t, 2*time.Second, allow("d", "10.0.0.1"))
+	assert.Zero(t, allow("d", "10.0.0.2"))
+
+	// A successful sign-in lifts the lockout of the login but not the throttling of the address.
+	require.NoError(t, l.Reset(ctx, "user"))
+	assert.Zero(t, allow("user", "10.0.0.2"))
+	assert.Equal(t, 2*time.Second, allow("user", "10.0.0.1"))
+
+	// Failures older than the window are forgotten.
+	require.NoError(t, l.Fail(ctx, "user", "", now))
+	require.NoError(t, l.Fail(ctx, "user", "", now))
+	now = now.Add(3 * time.Hour)
+	require.NoError(t, l.Fail(ctx, "user", "", now))
+	assert.Zero(t, allow("user", ""))
+}
+
+func TestLimiterParallelAttempts(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	login := throttle.Policy{FreeFailures: 2, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour}
+	l := throttle.NewLimiter(memory.NewThrottleStorage(), login, throttle.DefaultIPPolicy)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Attempts in progress count like failures, so only as many may run at once as could fail without a delay.
+	for i := 0; i < 3; i++ {
+		retryAfter, err := l.Reserve(ctx, "user", "10.0.0.1", now)
+		require.NoError(t, err)
+		require.Zero(t, retryAfter, "attempt %d", i)
+	}
+	retryAfter, err := l.Reserve(ctx, "user", "10.0.0.2", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, retryAfter)
+
+	// Rejected attempts are released at once, finished attempts by Release.
+	require.NoError(t, l.Fail(ctx, "user", "10.0.0.1", now))
+	require.NoError(t, l.Release(ctx, "user", "10.0.0.1"))
+	retryAfter, err = l.Reserve(ctx, "user", "10.0.0.1", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, retryAfter, "one failure and two attempts in progress")
+
+	require.NoError(t, l.Release(ctx, "user", "10.0.0.1"))
+	require.NoError(t, l.Release(ctx, "user", "10.0.0.1"))
+	retryAfter, err = l.Reserve(ctx, "user", "10.0.0.1", now)
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+	require.NoError(t, l.Release(ctx, "user", "10.0.0.1"))
+
+	// Attempts which are never released stop counting after PendingTimeout.
+	for i := 0; i < 3; i++ {
+		_, err = l.Reserve(ctx, "other", "", now)
+		require.NoError(t, err)
+	}
+	retryAfter, err = l.Reserve(ctx, "other", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, retryAfter)
+	retryAfter, err = l.Reserve(ctx, "other", "", now.Add(throttle.PendingTimeout+time.Second))
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+}
@@ -0,0 +1,155 @@
+// Package totp implements time-based one-time passwords as described in RFC 6238,
+// compatible with common authenticator apps, together with single-use recovery codes.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is the lifetime of a single code.
+	Period = 30 * time.Second
+	// Digits is the number of digits in a code.
+	Digits = 6
+	// Skew is the number of periods before and after the current one that are still accepted.
+	Skew = 1
+	// secretSize is the size of generated secrets in bytes, as recommended by RFC 4226.
+	secretSize = 20
+	// recoveryCodeSize is the size of generated recovery codes in bytes.
+	recoveryCodeSize = 5
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random base32 encoded secret.
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("read random bytes: %w", err)
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// ProvisioningURI returns an otpauth:// URI which authenticator apps can import, usually as a QR code.
+//
+// Parameters:
+//   - issuer (string): The name of the service shown in the app.
+//   - account (string): The account name shown in the app, usually the login.
+//   - secret (string): The base32 encoded secret.
+func ProvisioningURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Step returns the number of the period the given time belongs to.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// GenerateCode returns the code for the given secret and period number.
+func GenerateCode(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+// Validate checks the code against the secret at the given time, allowing Skew periods of clock drift.
+// Codes of periods up to and including lastStep are rejected, so every code can be used only once.
+//
+// Returns:
+//   - int64: The period number of the accepted code, to be stored as the new lastStep.
+//   - bool: Whether the code is valid.
+func Validate(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(now)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := GenerateCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns n new random recovery codes in the form "xxxx-xxxx".
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("read random bytes: %w", err)
+		}
+		c := strings.ToLower(encoding.EncodeToString(b))
+		codes = append(codes, c[:4]+"-"+c[4:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the hex encoded SHA-256 hash of a recovery code.
+// Recovery codes are random, so a fast hash is sufficient for storing them.
+func HashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// UseRecoveryCode looks the code up in the list of hashes of unused recovery codes.
+//
+// Returns:
+//   - []string: The remaining hashes without the used code.
+//   - bool: Whether the code was found.
+func UseRecoveryCode(hashes []string, code string) ([]string, bool) {
+	hash := HashRecoveryCode(code)
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			remaining := make([]string, 0, len(hashes)-1)
+			remaining = append(remaining, hashes[:i]...)
+			remaining = append(remaining, hashes[i+1:]...)
+			return remaining, true
+		}
+	}
+	return hashes, false
+}
@@ -0,0 +1,93 @@
+package totp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreevym/gophkeeper/internal/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 seed "12345678901234567890" from RFC 6238 appendix B in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateCode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, test := range tests {
+		code, err := totp.GenerateCode(rfcSecret, totp.Step(time.Unix(test.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, test.want, code, test.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(1111111111, 0)
+	code, err := totp.GenerateCode(rfcSecret, totp.Step(now))
+	require.NoError(t, err)
+
+	step, ok := totp.Validate(rfcSecret, code, now, 0)
+	require.True(t, ok)
+	assert.Equal(t, totp.Step(now), step)
+
+	// Clock drift of one period is tolerated.
+	_, ok = totp.Validate(rfcSecret, code, now.Add(totp.Period), 0)
+	assert.True(t, ok)
+	_, ok = totp.Validate(rfcSecret, code, now.Add(-totp.Period), 0)
+	assert.True(t, ok)
+
+	// Two periods are too much.
+	_, ok = totp.Validate(rfcSecret, code, now.Add(2*totp.Period), 0)
+	assert.False(t, ok)
+
+	// A code can be used only once.
+	_, ok = totp.Validate(rfcSecret, code, now, step)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(rfcSecret, "000000", now, 0)
+	assert.False(t, ok)
+	_, ok = totp.Validate(rfcSecret, "", now, 0)
+	assert.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	t.Parallel()
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	uri := totp.ProvisioningURI("GophKeeper", "user@example.com", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/GophKeeper:user@example.com?"), uri)
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=GophKeeper")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Parallel()
+	codes, err := totp.GenerateRecoveryCodes(3)
+	require.NoError(t, err)
+	require.Len(t, codes, 3)
+
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashes = append(hashes, totp.HashRecoveryCode(c))
+	}
+
+	remaining, ok := totp.UseRecoveryCode(hashes, strings.ToUpper(codes[1]))
+	require.True(t, ok)
+	assert.Len(t, remaining, 2)
+
+	_, ok = totp.UseRecoveryCode(remaining, codes[1])
+	assert.False(t, ok)
+}
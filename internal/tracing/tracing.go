@@ -0,0 +1,86 @@
+// Package tracing sets up OpenTelemetry tracing and instruments HTTP servers and clients with spans.
+// Spans are propagated between the client and the server with W3C trace context headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters of spans.
+const (
+	ExporterNone   = "none"   // ExporterNone disables tracing, trace context is still propagated.
+	ExporterStdout = "stdout" // ExporterStdout writes spans as JSON to the standard output.
+	ExporterOTLP   = "otlp"   // ExporterOTLP sends spans to an OTLP/HTTP collector configured with OTEL_EXPORTER_OTLP_* variables.
+)
+
+// tracer starts the spans of the HTTP middleware and transport.
+var tracer = otel.Tracer("github.com/andreevym/gophkeeper/internal/tracing")
+
+// Config configures the tracer provider.
+type Config struct {
+	Exporter    string // One of the Exporter* constants, ExporterNone if empty.
+	ServiceName string // Name of the service, overridden by OTEL_SERVICE_NAME.
+	Synchronous bool   // Export every span when it ends instead of in batches, for short-lived programs.
+}
+
+// Setup installs the global tracer provider with the configured exporter and the W3C trace context propagator.
+// It takes a context.Context and the Config.
+// Returns a function flushing and stopping the exporter, which must be called before the program exits,
+// and an error if the exporter is unknown or cannot be created.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, expected %s, %s or %s", cfg.Exporter, ExporterOTLP, ExporterStdout, ExporterNone)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	processor := sdktrace.NewBatchSpanProcessor(exporter)
+	if cfg.Synchronous {
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// End records the error of the operation traced by the span, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,107 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andreevym/gophkeeper/internal/tracing"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Get("/api/vault/{vaultID}", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, trace.SpanContextFromContext(r.Context()).IsValid(), "handlers continue the span of the request")
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Post("/api/vault", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	httpClient := &http.Client{Transport: tracing.NewTransport(nil)}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "command")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/vault/42", nil)
+	require.NoError(t, err)
+	resp, err := httpClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/api/vault", nil)
+	require.NoError(t, err)
+	resp, err = httpClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	require.Contains(t, spans, "GET /api/vault/{vaultID}")
+	require.Contains(t, spans, "POST /api/vault")
+	require.Contains(t, spans, "HTTP GET")
+
+	server, client := spans["GET /api/vault/{vaultID}"], spans["HTTP GET"]
+	assert.Equal(t, parent.SpanContext().TraceID(), server.SpanContext().TraceID(), "the trace context is propagated")
+	assert.Equal(t, client.SpanContext().SpanID(), server.Parent().SpanID())
+	assert.Equal(t, parent.SpanContext().SpanID(), client.Parent().SpanID())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, trace.SpanKindClient, client.SpanKind())
+	assert.Equal(t, "/api/vault/{vaultID}", attributeOf(server, "http.route"))
+	assert.Equal(t, codes.Unset, server.Status().Code)
+	assert.Equal(t, codes.Error, spans["POST /api/vault"].Status().Code)
+	assert.Equal(t, codes.Error, spans["HTTP POST"].Status().Code)
+}
+
+func attributeOf(s sdktrace.ReadOnlySpan, key string) string {
+	for _, a := range s.Attributes() {
+		if string(a.Key) == key {
+			return a.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "ok")
+	tracing.End(span, nil)
+	_, span = tracer.Start(context.Background(), "failed")
+	tracing.End(span, errors.New("boom"))
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 2)
+	assert.Equal(t, codes.Unset, ended[0].Status().Code)
+	assert.Equal(t, codes.Error, ended[1].Status().Code)
+	assert.Equal(t, "boom", ended[1].Status().Description)
+	require.Len(t, ended[1].Events(), 1, "the error is recorded")
+}
+
+func TestSetup(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), tracing.Config{Exporter: "jaeger"})
+	assert.Error(t, err)
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{Exporter: tracing.ExporterNone})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
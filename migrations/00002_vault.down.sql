@@ -0,0 +1,3 @@
+SELECT lo_unlink(value) FROM vault WHERE value IS NOT NULL;
+DROP TABLE IF EXISTS vault;
+DROP SEQUENCE IF EXISTS vault_id_seq;
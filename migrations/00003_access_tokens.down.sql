@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS access_tokens;
+DROP SEQUENCE IF EXISTS access_tokens_id_seq;
@@ -0,0 +1,15 @@
+CREATE SEQUENCE IF NOT EXISTS access_tokens_id_seq;
+CREATE TABLE IF NOT EXISTS access_tokens
+(
+    id           BIGINT PRIMARY KEY DEFAULT nextval('access_tokens_id_seq'),
+    user_id      BIGINT references users NOT NULL,
+    name         VARCHAR(200) NOT NULL,
+    token_hash   VARCHAR(64)  NOT NULL UNIQUE,
+    permission   VARCHAR(16)  NOT NULL,
+    key_prefix   VARCHAR(256) NOT NULL DEFAULT '',
+    vault_ids    BIGINT[]     NOT NULL DEFAULT '{}',
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
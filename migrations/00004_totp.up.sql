@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret    VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS totp_enabled   BOOLEAN     NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS totp_last_step BIGINT      NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS recovery_codes TEXT[]      NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS failed_sign_ins;
+DROP SEQUENCE IF EXISTS failed_sign_ins_id_seq;
+DROP TABLE IF EXISTS sign_in_throttle;
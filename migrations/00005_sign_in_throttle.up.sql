@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS sign_in_throttle
+(
+    key             VARCHAR(300) PRIMARY KEY,
+    failures        INTEGER     NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL
+);
+CREATE SEQUENCE IF NOT EXISTS failed_sign_ins_id_seq;
+CREATE TABLE IF NOT EXISTS failed_sign_ins
+(
+    id         BIGINT PRIMARY KEY DEFAULT nextval('failed_sign_ins_id_seq'),
+    user_id    BIGINT references users ON DELETE CASCADE,
+    login      VARCHAR(200) NOT NULL,
+    ip         VARCHAR(64)  NOT NULL,
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    reason     VARCHAR(64)  NOT NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS failed_sign_ins_user_id_idx ON failed_sign_ins (user_id, created_at);
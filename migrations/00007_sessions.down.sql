@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS sessions;
+DROP SEQUENCE IF EXISTS sessions_id_seq;
@@ -0,0 +1,13 @@
+CREATE SEQUENCE IF NOT EXISTS sessions_id_seq;
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           BIGINT PRIMARY KEY DEFAULT nextval('sessions_id_seq'),
+    user_id      BIGINT references users ON DELETE CASCADE NOT NULL,
+    device_name  VARCHAR(100) NOT NULL DEFAULT '',
+    user_agent   VARCHAR(512) NOT NULL DEFAULT '',
+    ip           VARCHAR(64)  NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    revoked_at   TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
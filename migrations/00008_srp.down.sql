@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS srp_handshakes;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS srp_salt,
+    DROP COLUMN IF EXISTS srp_verifier;
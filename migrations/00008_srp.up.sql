@@ -0,0 +1,12 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS srp_salt     BYTEA NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS srp_verifier BYTEA NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS srp_handshakes
+(
+    id           VARCHAR(64) PRIMARY KEY,
+    user_id      BIGINT references users ON DELETE CASCADE NOT NULL,
+    client_proof BYTEA       NOT NULL,
+    server_proof BYTEA       NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS srp_handshakes_expires_at_idx ON srp_handshakes (expires_at);
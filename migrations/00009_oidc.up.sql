@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS oidc_logins
+(
+    device_code_hash VARCHAR(64) PRIMARY KEY,
+    state            VARCHAR(64)  NOT NULL UNIQUE,
+    nonce            VARCHAR(64)  NOT NULL,
+    code_verifier    VARCHAR(128) NOT NULL,
+    device           VARCHAR(100) NOT NULL DEFAULT '',
+    user_id          BIGINT references users ON DELETE CASCADE,
+    expires_at       TIMESTAMPTZ  NOT NULL
+);
+CREATE INDEX IF NOT EXISTS oidc_logins_expires_at_idx ON oidc_logins (expires_at);
+CREATE TABLE IF NOT EXISTS oidc_identities
+(
+    issuer     VARCHAR(255) NOT NULL,
+    subject    VARCHAR(255) NOT NULL,
+    user_id    BIGINT references users ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX IF NOT EXISTS oidc_identities_user_id_idx ON oidc_identities (user_id);
@@ -0,0 +1,10 @@
+DO
+$$
+    BEGIN
+        IF EXISTS(SELECT 1 FROM vault WHERE blob_key IS NOT NULL) THEN
+            RAISE EXCEPTION 'vault values are stored in the blob store, they would be lost';
+        END IF;
+    END
+$$;
+ALTER TABLE vault
+    DROP COLUMN IF EXISTS blob_key;
@@ -0,0 +1 @@
+ALTER TABLE vault ADD COLUMN IF NOT EXISTS blob_key VARCHAR(512);
@@ -0,0 +1,23 @@
+-- Logins differing only in case or surrounding whitespace can't be told apart by users, rename or delete such
+-- duplicates before this migration: it fails listing them, e.g. "alice (ids 3, 7)".
+DO
+$$
+    DECLARE
+        duplicates TEXT;
+    BEGIN
+        SELECT string_agg(format('%s (ids %s)', normalized, ids), ', ' ORDER BY normalized)
+        INTO duplicates
+        FROM (SELECT lower(normalize(btrim(login), NFC)) AS normalized, string_agg(id::TEXT, ', ' ORDER BY id) AS ids
+              FROM users
+              WHERE login IS NOT NULL
+              GROUP BY 1
+              HAVING count(*) > 1) AS d;
+        IF duplicates IS NOT NULL THEN
+            RAISE EXCEPTION 'duplicate logins, rename or delete all but one user of each: %', duplicates;
+        END IF;
+    END
+$$;
+UPDATE users
+SET login = lower(normalize(btrim(login), NFC))
+WHERE login <> lower(normalize(btrim(login), NFC));
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_key ON users (lower(login));
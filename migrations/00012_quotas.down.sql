@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_quotas;
+DROP INDEX IF EXISTS vault_user_id_idx;
+ALTER TABLE vault
+    DROP COLUMN IF EXISTS size;
@@ -0,0 +1,11 @@
+-- Sizes of values in the blob store are unknown to the database, they count from their next update.
+ALTER TABLE vault ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0;
+UPDATE vault SET size = length(lo_get(value)) WHERE value IS NOT NULL;
+CREATE INDEX IF NOT EXISTS vault_user_id_idx ON vault (user_id);
+
+CREATE TABLE IF NOT EXISTS user_quotas
+(
+    user_id     BIGINT PRIMARY KEY references users,
+    max_bytes   BIGINT NOT NULL,
+    max_entries BIGINT NOT NULL
+);
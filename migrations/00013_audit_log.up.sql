@@ -0,0 +1,32 @@
+-- Append-only audit log. Records are not deleted with users, so user_id has no foreign key.
+CREATE SEQUENCE IF NOT EXISTS audit_log_id_seq;
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         BIGINT PRIMARY KEY DEFAULT nextval('audit_log_id_seq'),
+    created_at TIMESTAMPTZ  NOT NULL,
+    action     VARCHAR(32)  NOT NULL,
+    user_id    BIGINT       NOT NULL DEFAULT 0,
+    login      VARCHAR(255) NOT NULL DEFAULT '',
+    token_id   BIGINT       NOT NULL DEFAULT 0,
+    vault_id   BIGINT       NOT NULL DEFAULT 0,
+    ip         VARCHAR(64)  NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    request_id VARCHAR(255) NOT NULL DEFAULT '',
+    detail     TEXT         NOT NULL DEFAULT '',
+    prev_hash  VARCHAR(64)  NOT NULL DEFAULT '',
+    hash       VARCHAR(64)  NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id, id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE
+    ON audit_log
+    FOR EACH STATEMENT
+EXECUTE FUNCTION audit_log_append_only();
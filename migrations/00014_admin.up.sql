@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role     VARCHAR(16) NOT NULL DEFAULT 'user',
+    ADD COLUMN IF NOT EXISTS disabled BOOLEAN     NOT NULL DEFAULT false;
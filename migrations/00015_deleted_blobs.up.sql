@@ -0,0 +1,8 @@
+-- Blobs of replaced and deleted vault values. They are deleted from the blob store after a grace period,
+-- so that readers and backups which still see the old value in their snapshot can read it.
+CREATE TABLE IF NOT EXISTS deleted_blobs
+(
+    key        VARCHAR(512) PRIMARY KEY,
+    deleted_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS deleted_blobs_deleted_at_idx ON deleted_blobs (deleted_at);
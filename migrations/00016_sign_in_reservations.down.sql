@@ -0,0 +1,2 @@
+ALTER TABLE sign_in_throttle DROP COLUMN IF EXISTS reserved_at;
+ALTER TABLE sign_in_throttle DROP COLUMN IF EXISTS pending;
@@ -0,0 +1,4 @@
+-- Sign-in attempts in progress, reserved before the credentials are verified,
+-- so that parallel attempts can't all pass the throttle before the first failure is recorded.
+ALTER TABLE sign_in_throttle ADD COLUMN IF NOT EXISTS pending INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sign_in_throttle ADD COLUMN IF NOT EXISTS reserved_at TIMESTAMPTZ NOT NULL DEFAULT to_timestamp(0);
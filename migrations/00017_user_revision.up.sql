@@ -0,0 +1,3 @@
+-- Incremented by every update of a user, so that concurrent updates are detected instead of overwriting each other.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE oidc_logins
+    DROP COLUMN IF EXISTS browser_hash;
+ALTER TABLE oidc_logins
+    DROP COLUMN IF EXISTS user_code_hash;
@@ -0,0 +1,8 @@
+-- Pending sign-ins started before user codes existed can't be approved, so they are dropped.
+DELETE FROM oidc_logins;
+-- The user types the user code into the verification page of the server and approves the sign-in there,
+-- the browser which approved it is the only one whose callback completes the sign-in.
+ALTER TABLE oidc_logins
+    ADD COLUMN IF NOT EXISTS user_code_hash VARCHAR(64) NOT NULL UNIQUE;
+ALTER TABLE oidc_logins
+    ADD COLUMN IF NOT EXISTS browser_hash VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+// Package migrations embeds the PostgreSQL schema migrations, applied with postgres.Migrator.
+//
+// Every schema version NNNNN has a migration NNNNN_name.up.sql and a rollback NNNNN_name.down.sql.
+// The first migrations create their objects only if they don't exist, so databases created before
+// schema versions were recorded are adopted as they are.
+package migrations
+
+import "embed"
+
+// FS holds the migration files.
+//
+//go:embed *.sql
+var FS embed.FS